@@ -188,12 +188,13 @@ on top of the FileStore
 it is the public interface of the FileStore which is included in the ethereum stack
 */
 type API struct {
-	feed      *feed.Handler
-	fileStore *storage.FileStore
-	dns       Resolver //provides access to multiple resolvers, usually associated with ens
-	rns       Resolver //provides access to rns resolvers
-	Tags      *chunk.Tags
-	Decryptor func(context.Context, string) DecryptFunc
+	feed       *feed.Handler
+	fileStore  *storage.FileStore
+	dns        Resolver //provides access to multiple resolvers, usually associated with ens
+	rns        Resolver //provides access to rns resolvers
+	Tags       *chunk.Tags
+	Decryptor  func(context.Context, string) DecryptFunc
+	Prefetcher *Prefetcher // prefetches the entries next to served web pages if set
 }
 
 // NewAPI the api constructor initialises a new API instance.
@@ -347,7 +348,7 @@ func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage
 	}
 
 	log.Debug("trie getting entry", "key", manifestAddr, "path", path)
-	entry, _ := trie.getEntry(path)
+	entry, fullpath := trie.getEntry(path)
 
 	if entry != nil {
 		log.Debug("trie got entry", "key", manifestAddr, "path", path, "entry.Hash", entry.Hash)
@@ -394,7 +395,7 @@ func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage
 			log.Trace("feed update contains swarm hash", "key", manifestAddr)
 
 			// get the manifest the swarm hash points to
-			trie, err := loadManifest(ctx, a.fileStore, manifestAddr, nil, NOOPDecrypt)
+			trie, err = loadManifest(ctx, a.fileStore, manifestAddr, nil, NOOPDecrypt)
 			if err != nil {
 				apiGetNotFound.Inc(1)
 				status = http.StatusNotFound
@@ -404,7 +405,7 @@ func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage
 
 			// finally, get the manifest entry
 			// it will always be the entry on path ""
-			entry, _ = trie.getEntry(path)
+			entry, fullpath = trie.getEntry(path)
 			if entry == nil {
 				status = http.StatusNotFound
 				apiGetNotFound.Inc(1)
@@ -425,6 +426,9 @@ func (a *API) Get(ctx context.Context, decrypt DecryptFunc, manifestAddr storage
 		mimeType = entry.ContentType
 		log.Debug("content lookup key", "key", contentAddr, "mimetype", mimeType)
 		reader, _ = a.fileStore.Retrieve(ctx, contentAddr)
+		if a.Prefetcher != nil && isPrefetchable(mimeType) {
+			a.Prefetcher.prefetch(ctx, trie, prefetchDir(fullpath), entry.Hash)
+		}
 	} else {
 		// no entry found
 		status = http.StatusNotFound
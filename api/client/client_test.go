@@ -38,7 +38,7 @@ import (
 )
 
 func serverFunc(api *api.API, pinAPI *pin.API) swarmhttp.TestServer {
-	return swarmhttp.NewServer(api, pinAPI, "")
+	return swarmhttp.NewServer(api, pinAPI, nil, "")
 }
 
 // TestClientUploadDownloadRaw test uploading and downloading raw data to swarm
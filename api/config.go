@@ -17,10 +17,12 @@
 package api
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -29,6 +31,7 @@ import (
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethersphere/swarm/contracts/ens"
 	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/p2p/protocols"
 	"github.com/ethersphere/swarm/pss"
 	"github.com/ethersphere/swarm/storage"
 	"github.com/ethersphere/swarm/swap"
@@ -39,6 +42,9 @@ const (
 	DefaultHTTPPort       = "8500"
 )
 
+// overlayMiningTimeout bounds the time a node mines the nonce of its overlay address on start
+var overlayMiningTimeout = 5 * time.Minute
+
 // separate bzz directories
 // allow several bzz nodes running in parallel
 type Config struct {
@@ -66,23 +72,35 @@ type Config struct {
 
 	*network.HiveParams
 	Pss                *pss.Params
+	Readiness          *ReadinessParams
+	RateLimits         *protocols.RateLimits // upload bandwidth limits in bytes per second
 	EnsRoot            common.Address
 	EnsAPIs            []string
 	RnsAPI             string
 	Path               string
 	ListenAddr         string
+	Underlays          []string // additional ip:port addresses the node is reachable on, in order of preference
 	Port               string
 	PublicKey          string
 	BzzKey             string
+	BzzKeyNonce        string      // hex encoded nonce mixed into the overlay address derivation
+	OverlayPrefix      string      // hex encoded prefix of the neighbourhood the overlay address is mined for
+	OverlayProximity   int         // number of leading bits of the overlay address matching OverlayPrefix
 	Enode              *enode.Node `toml:"-"`
 	NetworkID          uint64
+	NetworkAuthority   common.Address // private network authority, peers need a credential signed by it
+	NetworkCredential  string         // hex encoded credential issued by the network authority
 	SyncEnabled        bool
 	PushSyncEnabled    bool
+	SyncReconcile      bool // sync the history of pull sync streams by set reconciliation
 	LightNodeEnabled   bool
 	BootnodeMode       bool
 	DisableAutoConnect bool
 	EnablePinning      bool
 	Cors               string
+	PrefetchWorkers    int  // number of files prefetched concurrently for the served web pages, 0 disables prefetching
+	PssGateway         bool // serve pss over http and websockets to the clients which cannot use the node RPC
+	PssGatewayRaw      bool // allow the pss gateway clients to send and receive raw messages
 	BzzAccount         string
 	GlobalStoreAPI     string
 	privateKey         *ecdsa.PrivateKey
@@ -102,6 +120,8 @@ func NewConfig() *Config {
 		SwapLogLevel:            swap.DefaultSwapLogLevel,
 		HiveParams:              network.NewHiveParams(),
 		Pss:                     pss.NewParams(),
+		Readiness:               NewReadinessParams(),
+		RateLimits:              protocols.NewRateLimits(),
 		EnsRoot:                 ens.Address,
 		EnsAPIs:                 nil,
 		RnsAPI:                  "",
@@ -112,6 +132,7 @@ func NewConfig() *Config {
 		SyncEnabled:             true,
 		PushSyncEnabled:         true,
 		EnablePinning:           false,
+		PrefetchWorkers:         DefaultPrefetchWorkers,
 	}
 }
 
@@ -124,6 +145,18 @@ func (c *Config) Init(prvKey *ecdsa.PrivateKey, nodeKey *ecdsa.PrivateKey) error
 	if err != nil {
 		return fmt.Errorf("Error creating root swarm data directory: %v", err)
 	}
+	if c.BzzKeyNonce == "" && c.OverlayPrefix != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), overlayMiningTimeout)
+		nonce, err := network.MineNonce(ctx, prvKey, common.FromHex(c.OverlayPrefix), c.OverlayProximity)
+		cancel()
+		if err == context.DeadlineExceeded {
+			return fmt.Errorf("Error mining overlay address: no nonce found for proximity order %d within %v, lower the proximity order or mine the nonce with swarm mine --nonce", c.OverlayProximity, overlayMiningTimeout)
+		}
+		if err != nil {
+			return fmt.Errorf("Error mining overlay address: %v", err)
+		}
+		c.BzzKeyNonce = hexutil.Encode(nonce)
+	}
 	c.setKey(prvKey)
 
 	// create the new enode record
@@ -131,6 +164,7 @@ func (c *Config) Init(prvKey *ecdsa.PrivateKey, nodeKey *ecdsa.PrivateKey) error
 	enodeParams := &network.EnodeParams{
 		PrivateKey: prvKey,
 		EnodeKey:   nodeKey,
+		Nonce:      common.FromHex(c.BzzKeyNonce),
 		Lightnode:  c.LightNodeEnabled,
 		Bootnode:   c.BootnodeMode,
 	}
@@ -156,7 +190,7 @@ func (c *Config) ShiftPrivateKey() (privKey *ecdsa.PrivateKey) {
 }
 
 func (c *Config) setKey(prvKey *ecdsa.PrivateKey) {
-	bzzkeybytes := network.PrivateKeyToBzzKey(prvKey)
+	bzzkeybytes := network.PrivateKeyToBzzKeyWithNonce(prvKey, common.FromHex(c.BzzKeyNonce))
 	pubkey := crypto.FromECDSAPub(&prvKey.PublicKey)
 	pubkeyhex := hexutil.Encode(pubkey)
 	keyhex := hexutil.Encode(bzzkeybytes)
@@ -17,10 +17,17 @@
 package api
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/network"
 )
 
 func TestConfig(t *testing.T) {
@@ -63,3 +70,76 @@ func TestConfig(t *testing.T) {
 		t.Fatal("Failed to correctly initialize StoreParams")
 	}
 }
+
+// TestConfigOverlayMining tests that a nonce is mined on init
+// if a target neighbourhood for the overlay address is configured
+func TestConfigOverlayMining(t *testing.T) {
+	prvkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodekey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "swarm-config-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := NewConfig()
+	c.Path = dir
+	c.OverlayPrefix = "0xa5"
+	c.OverlayProximity = 8
+	if err := c.Init(prvkey, nodekey); err != nil {
+		t.Fatal(err)
+	}
+	if c.BzzKeyNonce == "" {
+		t.Fatal("Expected BzzKeyNonce to be set")
+	}
+	bzzkey := common.FromHex(c.BzzKey)
+	if !network.InNeighbourhood(bzzkey, common.FromHex(c.OverlayPrefix), c.OverlayProximity) {
+		t.Fatalf("Expected BzzKey %x to be in neighbourhood %s/%d", bzzkey, c.OverlayPrefix, c.OverlayProximity)
+	}
+	var addr network.ENRAddrEntry
+	if err := c.Enode.Record().Load(&addr); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(addr.Address(), bzzkey) {
+		t.Fatalf("Expected enode record bzzkey %x, got %x", bzzkey, addr.Address())
+	}
+}
+
+// TestConfigOverlayMiningLimits tests that init fails instead of mining
+// for a proximity order too high or longer than the mining timeout
+func TestConfigOverlayMiningLimits(t *testing.T) {
+	prvkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodekey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "swarm-config-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := NewConfig()
+	c.Path = dir
+	c.OverlayPrefix = "0xa5a5a5a5a5a5"
+	c.OverlayProximity = 48
+	if err := c.Init(prvkey, nodekey); err == nil {
+		t.Fatal("Expected error mining for proximity order 48")
+	}
+
+	defer func(timeout time.Duration) { overlayMiningTimeout = timeout }(overlayMiningTimeout)
+	overlayMiningTimeout = time.Nanosecond
+	c.OverlayProximity = network.MaxMineProximity
+	if err := c.Init(prvkey, nodekey); err == nil || !strings.Contains(err.Error(), "within") {
+		t.Fatalf("Expected mining timeout error, got %v", err)
+	}
+}
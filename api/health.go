@@ -0,0 +1,136 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/network/stream"
+	"github.com/ethersphere/swarm/pushsync"
+)
+
+// ReadinessParams holds the thresholds a node has to meet to be reported as ready
+type ReadinessParams struct {
+	MinPeers              int     // minimum number of connected peers
+	NeighbourhoodComplete bool    // whether all known peers within depth have to be connected
+	MinSyncProgress       float64 // minimum fraction of the pull sync history synced, between 0 and 1
+	MaxPushBacklog        int     // maximum number of chunks awaiting push sync receipts, 0 means no limit
+}
+
+// NewReadinessParams returns the default readiness thresholds
+func NewReadinessParams() *ReadinessParams {
+	return &ReadinessParams{
+		MinPeers: 1,
+	}
+}
+
+// Health is the health report of a node
+type Health struct {
+	Kademlia          network.KademliaStatus   `json:"kademlia"`
+	PullSync          []stream.BinSyncProgress `json:"pull_sync"`
+	PullSyncProgress  float64                  `json:"pull_sync_progress"` // fraction of the pull sync history synced over all bins
+	LastReceivedChunk time.Time                `json:"last_received_chunk"`
+	PushSyncBacklog   int                      `json:"push_sync_backlog"`
+}
+
+// Readiness is the health report of a node together with
+// the readiness thresholds it does not meet
+type Readiness struct {
+	*Health
+	Ready   bool     `json:"ready"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// HealthChecker reports the health and readiness of a node
+type HealthChecker struct {
+	kad      *network.Kademlia
+	streamer *stream.Registry
+	pusher   *pushsync.Pusher // nil if push sync is disabled
+	params   *ReadinessParams
+}
+
+// NewHealthChecker creates a HealthChecker reporting on the given kademlia,
+// pull sync registry and pusher
+// readiness is evaluated against params, if nil the defaults are used
+func NewHealthChecker(kad *network.Kademlia, streamer *stream.Registry, pusher *pushsync.Pusher, params *ReadinessParams) *HealthChecker {
+	if params == nil {
+		params = NewReadinessParams()
+	}
+	return &HealthChecker{
+		kad:      kad,
+		streamer: streamer,
+		pusher:   pusher,
+		params:   params,
+	}
+}
+
+// Health returns the current health report of the node
+func (h *HealthChecker) Health() (*Health, error) {
+	health := &Health{
+		Kademlia:         h.kad.Status(),
+		PullSyncProgress: 1,
+	}
+	if h.streamer != nil {
+		progress, err := h.streamer.SyncProgress()
+		if err != nil {
+			return nil, err
+		}
+		var cursor, synced uint64
+		for _, p := range progress {
+			cursor += p.Cursor
+			synced += p.Synced
+		}
+		if cursor > 0 {
+			health.PullSyncProgress = float64(synced) / float64(cursor)
+		}
+		health.PullSync = progress
+		health.LastReceivedChunk = h.streamer.LastReceivedChunkTime()
+	}
+	if h.pusher != nil {
+		health.PushSyncBacklog = h.pusher.Backlog()
+	}
+	return health, nil
+}
+
+// Readiness returns the health report of the node and whether it meets
+// the readiness thresholds
+func (h *HealthChecker) Readiness() (*Readiness, error) {
+	health, err := h.Health()
+	if err != nil {
+		return nil, err
+	}
+	var reasons []string
+	if health.Kademlia.Connected < h.params.MinPeers {
+		reasons = append(reasons, fmt.Sprintf("connected to %d peers, need %d", health.Kademlia.Connected, h.params.MinPeers))
+	}
+	if h.params.NeighbourhoodComplete && !health.Kademlia.NeighbourhoodComplete {
+		reasons = append(reasons, fmt.Sprintf("connected to %d of %d neighbours", health.Kademlia.Neighbourhood.Connected, health.Kademlia.Neighbourhood.Known))
+	}
+	if health.PullSyncProgress < h.params.MinSyncProgress {
+		reasons = append(reasons, fmt.Sprintf("pull sync progress %.2f, need %.2f", health.PullSyncProgress, h.params.MinSyncProgress))
+	}
+	if h.params.MaxPushBacklog > 0 && health.PushSyncBacklog > h.params.MaxPushBacklog {
+		reasons = append(reasons, fmt.Sprintf("push sync backlog %d, allowed %d", health.PushSyncBacklog, h.params.MaxPushBacklog))
+	}
+	return &Readiness{
+		Health:  health,
+		Ready:   len(reasons) == 0,
+		Reasons: reasons,
+	}, nil
+}
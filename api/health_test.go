@@ -0,0 +1,71 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"testing"
+
+	"github.com/ethersphere/swarm/network"
+)
+
+// TestHealthCheckerReadiness tests that readiness is reported
+// according to the configured thresholds
+func TestHealthCheckerReadiness(t *testing.T) {
+	kad := network.NewKademlia(network.RandomBzzAddr().Over(), network.NewKadParams())
+	params := NewReadinessParams()
+	h := NewHealthChecker(kad, nil, nil, params)
+
+	checkReady := func(expReady bool, expReasons int) {
+		t.Helper()
+		r, err := h.Readiness()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Ready != expReady || len(r.Reasons) != expReasons {
+			t.Fatalf("expected ready %v with %d reasons, got %v with %v", expReady, expReasons, r.Ready, r.Reasons)
+		}
+	}
+
+	// no peers connected
+	checkReady(false, 1)
+
+	kad.On(network.NewPeer(&network.BzzPeer{BzzAddr: network.RandomBzzAddr()}, kad))
+	checkReady(true, 0)
+
+	// a known but not connected neighbour
+	if err := kad.Register(network.RandomBzzAddr()); err != nil {
+		t.Fatal(err)
+	}
+	checkReady(true, 0)
+	params.NeighbourhoodComplete = true
+	checkReady(false, 1)
+
+	params.MinPeers = 2
+	params.MinSyncProgress = 0.5
+	checkReady(false, 2)
+
+	health, err := h.Health()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Kademlia.Connected != 1 || health.Kademlia.Known != 2 {
+		t.Fatalf("expected 1 connected and 2 known peers, got %+v", health.Kademlia)
+	}
+	if health.PullSyncProgress != 1 {
+		t.Fatalf("expected complete pull sync progress without syncing, got %v", health.PullSyncProgress)
+	}
+}
@@ -0,0 +1,535 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/pss"
+	"github.com/ethersphere/swarm/pss/message"
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+)
+
+var (
+	postPssSendCount = metrics.NewRegisteredCounter("api/http/post/pss/send/count", nil)
+	postPssSendFail  = metrics.NewRegisteredCounter("api/http/post/pss/send/fail", nil)
+	getPssRecvCount  = metrics.NewRegisteredCounter("api/http/get/pss/receive/count", nil)
+	getPssRecvDrop   = metrics.NewRegisteredCounter("api/http/get/pss/receive/drop", nil)
+)
+
+const (
+	pssSessionTTL      = time.Hour   // sessions without requests for longer expire
+	pssSessionCapacity = 1024        // maximum number of sessions
+	pssSessionKeys     = 64          // maximum number of keys added in a session
+	pssMaxRequestSize  = 1024 * 1024 // maximum size of the request bodies
+	pssReceiveBuffer   = 64          // messages waiting to be written to a websocket, further messages are dropped
+
+	// sessions are created at most once a minute for each remote address, after a burst
+	pssSessionInterval = time.Minute
+	pssSessionBurst    = 8
+	pssClientCapacity  = 4096 // maximum number of remote addresses whose session creations are limited
+)
+
+// PssSession is the response to the creation of a pss gateway session
+type PssSession struct {
+	Token     string        `json:"token"`     // authenticates the requests of the session
+	Address   hexutil.Bytes `json:"address"`   // overlay address of the node
+	PublicKey hexutil.Bytes `json:"publicKey"` // pss public key of the node
+}
+
+// PssKeyRequest adds a key to a pss gateway session
+type PssKeyRequest struct {
+	Topic   message.Topic `json:"topic"`
+	Address hexutil.Bytes `json:"address"` // address of the peer with the key
+	Key     hexutil.Bytes `json:"key"`     // public key of the peer or symmetric key, a symmetric key is generated if empty
+}
+
+// PssKeyResponse is the response to the addition of a key to a pss gateway session
+type PssKeyResponse struct {
+	Key string `json:"key"` // id of the key for sending and receiving messages
+}
+
+// PssSendRequest sends a message through the pss gateway
+type PssSendRequest struct {
+	Topic   message.Topic `json:"topic"`
+	Address hexutil.Bytes `json:"address"` // recipient address of raw messages
+	Key     string        `json:"key"`     // id of the key of encrypted messages
+	Message hexutil.Bytes `json:"message"`
+}
+
+// pssSessionKey is a key added in a pss gateway session for a topic
+type pssSessionKey struct {
+	id         string // id of the symmetric key or hex encoded public key
+	topic      message.Topic
+	asymmetric bool
+}
+
+// pssSession is a session of a pss gateway client,
+// it can only send and receive encrypted messages with the keys added in the session
+// the recipients of the keys are kept in the session rather than in the node key store
+// so that a session cannot redirect the messages of another one by adding the same key
+type pssSession struct {
+	keys     map[pssSessionKey]pss.PssAddress // recipients of the keys of the session
+	lastSeen time.Time
+	subs     int // open websockets, sessions with websockets do not expire
+}
+
+// pssGateway serves pss to clients which cannot use the node RPC
+type pssGateway struct {
+	pss      *pss.Pss
+	api      *pss.API
+	raw      bool // serve raw messages, which are not bound to the keys of a session
+	mu       sync.Mutex
+	sessions map[string]*pssSession
+	clients  map[string]*pssClient // session creation limits by remote address
+}
+
+// pssClient limits the creation of sessions from a remote address
+type pssClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// websockets are authenticated by session tokens rather than cookies,
+// so cross origin connections are allowed
+var pssUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// pssRegister registers the handler of the messages received on a websocket,
+// it is replaced in tests to deliver messages without a network
+var pssRegister = func(ps *pss.Pss, topic message.Topic, raw bool, f func(msg []byte, p *p2p.Peer, asymmetric bool, keyid string) error) func() {
+	handler := pss.NewHandler(f)
+	if raw {
+		handler = handler.WithRaw()
+	}
+	return ps.Register(&topic, handler)
+}
+
+// SetPss enables the pss gateway of the server
+// raw messages can only be sent and received if raw is true
+// it must be set before the server is started
+func (s *Server) SetPss(ps *pss.Pss, raw bool) {
+	s.pssGateway = &pssGateway{
+		pss:      ps,
+		api:      pss.NewAPI(ps),
+		raw:      raw,
+		sessions: make(map[string]*pssSession),
+		clients:  make(map[string]*pssClient),
+	}
+}
+
+// HandlePssSession creates a pss gateway session on POST and ends it on DELETE
+func (s *Server) HandlePssSession(w http.ResponseWriter, r *http.Request) {
+	g := s.pssGateway
+	if g == nil {
+		respondError(w, r, "Pss gateway disabled on this node", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		token, ok := g.authenticate(r, false)
+		if !ok {
+			respondError(w, r, "invalid session", http.StatusUnauthorized)
+			return
+		}
+		g.mu.Lock()
+		g.removeSession(token)
+		g.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !g.allowSession(r.RemoteAddr) {
+		respondError(w, r, "too many pss sessions created from this address", http.StatusTooManyRequests)
+		return
+	}
+	token, err := g.newSession()
+	if err != nil {
+		respondError(w, r, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&PssSession{
+		Token:     token,
+		Address:   g.pss.BaseAddr(),
+		PublicKey: g.pss.Crypto.SerializePublicKey(g.pss.PublicKey()),
+	})
+}
+
+// HandlePssKey adds the public key of a peer or a symmetric key to a pss gateway session
+func (s *Server) HandlePssKey(w http.ResponseWriter, r *http.Request) {
+	g := s.pssGateway
+	if g == nil {
+		respondError(w, r, "Pss gateway disabled on this node", http.StatusNotFound)
+		return
+	}
+	token, ok := g.authenticate(r, false)
+	if !ok {
+		respondError(w, r, "invalid session", http.StatusUnauthorized)
+		return
+	}
+	var req PssKeyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, pssMaxRequestSize)).Decode(&req); err != nil {
+		respondError(w, r, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Address) > len(g.pss.BaseAddr()) {
+		respondError(w, r, "address too long", http.StatusBadRequest)
+		return
+	}
+	if g.keysFull(token) {
+		respondError(w, r, "too many keys in the pss session", http.StatusTooManyRequests)
+		return
+	}
+	key := pssSessionKey{topic: req.Topic}
+	var err error
+	switch strings.TrimPrefix(r.URL.Path, "/pss/keys/") {
+	case "public":
+		// public keys are not added to the node key store, messages are sent
+		// to the address recorded in the session
+		pubkey, perr := g.pss.Crypto.UnmarshalPublicKey(req.Key)
+		if perr != nil {
+			respondError(w, r, fmt.Sprintf("invalid public key: %v", perr), http.StatusBadRequest)
+			return
+		}
+		key.id = common.ToHex(g.pss.Crypto.SerializePublicKey(pubkey))
+		key.asymmetric = true
+	case "symmetric":
+		// symmetric keys get a new id each time they are added, so they are not shared among sessions
+		if len(req.Key) == 0 {
+			key.id, err = g.pss.GenerateSymmetricKey(req.Topic, pss.PssAddress(req.Address), true)
+		} else {
+			key.id, err = g.pss.SetSymmetricKey(req.Key, req.Topic, pss.PssAddress(req.Address), true)
+		}
+	default:
+		respondError(w, r, "unknown key type", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	g.mu.Lock()
+	session, ok := g.sessions[token]
+	full := false
+	if ok {
+		// concurrent requests may have filled the session since it was checked
+		if _, exists := session.keys[key]; !exists && len(session.keys) >= pssSessionKeys {
+			full = true
+		} else {
+			session.keys[key] = pss.PssAddress(req.Address)
+		}
+	}
+	g.mu.Unlock()
+	if !ok || full {
+		if !key.asymmetric {
+			g.pss.RemoveSymmetricKey(key.id)
+		}
+		if full {
+			respondError(w, r, "too many keys in the pss session", http.StatusTooManyRequests)
+			return
+		}
+		// the session ended in the meantime
+		respondError(w, r, "invalid session", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&PssKeyResponse{Key: key.id})
+}
+
+// HandlePssSend sends a raw, symmetrically or asymmetrically encrypted message
+// with the keys of the pss gateway session
+func (s *Server) HandlePssSend(w http.ResponseWriter, r *http.Request) {
+	g := s.pssGateway
+	if g == nil {
+		respondError(w, r, "Pss gateway disabled on this node", http.StatusNotFound)
+		return
+	}
+	postPssSendCount.Inc(1)
+	token, ok := g.authenticate(r, false)
+	if !ok {
+		postPssSendFail.Inc(1)
+		respondError(w, r, "invalid session", http.StatusUnauthorized)
+		return
+	}
+	var req PssSendRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, pssMaxRequestSize)).Decode(&req); err != nil {
+		postPssSendFail.Inc(1)
+		respondError(w, r, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Message) == 0 {
+		postPssSendFail.Inc(1)
+		respondError(w, r, "empty message", http.StatusBadRequest)
+		return
+	}
+	var err error
+	switch mode := strings.TrimPrefix(r.URL.Path, "/pss/send/"); mode {
+	case "raw":
+		if !g.raw {
+			postPssSendFail.Inc(1)
+			respondError(w, r, "raw messages disabled", http.StatusForbidden)
+			return
+		}
+		err = g.api.SendRaw(req.Address, req.Topic, req.Message)
+	case "sym", "asym":
+		to, ok := g.recipient(token, pssSessionKey{id: req.Key, topic: req.Topic, asymmetric: mode == "asym"})
+		if !ok {
+			postPssSendFail.Inc(1)
+			respondError(w, r, "unknown key", http.StatusForbidden)
+			return
+		}
+		if mode == "sym" {
+			err = g.api.SendSym(req.Key, req.Topic, req.Message)
+		} else {
+			err = g.pss.SendAsymTo(common.FromHex(req.Key), to, req.Topic, req.Message)
+		}
+	default:
+		postPssSendFail.Inc(1)
+		respondError(w, r, "unknown message type", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		postPssSendFail.Inc(1)
+		respondError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlePssReceive upgrades the request to a websocket receiving the messages on the topic
+//
+// raw messages are received with the raw query parameter if the gateway serves them,
+// encrypted messages are only received with the keys of the session
+func (s *Server) HandlePssReceive(w http.ResponseWriter, r *http.Request) {
+	g := s.pssGateway
+	if g == nil {
+		respondError(w, r, "Pss gateway disabled on this node", http.StatusNotFound)
+		return
+	}
+	getPssRecvCount.Inc(1)
+	token, ok := g.authenticate(r, true)
+	if !ok {
+		respondError(w, r, "invalid session", http.StatusUnauthorized)
+		return
+	}
+	topicbytes, err := hexutil.Decode(strings.TrimPrefix(r.URL.Path, "/pss/receive/"))
+	if err != nil || len(topicbytes) != message.TopicLength {
+		respondError(w, r, "invalid topic", http.StatusBadRequest)
+		return
+	}
+	var topic message.Topic
+	copy(topic[:], topicbytes)
+	raw := r.URL.Query().Get("raw") == "true"
+	if raw && !g.raw {
+		respondError(w, r, "raw messages disabled", http.StatusForbidden)
+		return
+	}
+
+	conn, err := pssUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Debug("pss gateway websocket upgrade failed", "ruid", GetRUID(r.Context()), "err", err)
+		return
+	}
+	defer conn.Close()
+	if !g.subscribe(token, 1) {
+		return
+	}
+	defer g.subscribe(token, -1)
+
+	msgC := make(chan *pss.APIMsg, pssReceiveBuffer)
+	deregister := pssRegister(g.pss, topic, raw, func(msg []byte, _ *p2p.Peer, asymmetric bool, keyid string) error {
+		if keyid != "" {
+			if _, ok := g.recipient(token, pssSessionKey{id: keyid, topic: topic, asymmetric: asymmetric}); !ok {
+				return nil
+			}
+		}
+		select {
+		case msgC <- &pss.APIMsg{Msg: msg, Asymmetric: asymmetric, Key: keyid}:
+		default:
+			getPssRecvDrop.Inc(1)
+		}
+		return nil
+	})
+	defer deregister()
+
+	// the client does not send messages, reading detects the closed connections
+	conn.SetReadLimit(pssMaxRequestSize)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case msg := <-msgC:
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// newSession creates a session and returns its token
+func (g *pssGateway) newSession() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hexutil.Encode(b)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	for t, session := range g.sessions {
+		if session.subs == 0 && now.Sub(session.lastSeen) > pssSessionTTL {
+			g.removeSession(t)
+		}
+	}
+	if len(g.sessions) >= pssSessionCapacity {
+		return "", fmt.Errorf("too many pss sessions")
+	}
+	g.sessions[token] = &pssSession{keys: make(map[pssSessionKey]pss.PssAddress), lastSeen: now}
+	return token, nil
+}
+
+// allowSession returns false if too many sessions were created from the remote address
+func (g *pssGateway) allowSession(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	// a client idle for long enough to refill its burst is in the same state as a new one
+	for h, c := range g.clients {
+		if now.Sub(c.lastSeen) > pssSessionBurst*pssSessionInterval {
+			delete(g.clients, h)
+		}
+	}
+	c, ok := g.clients[host]
+	if !ok {
+		if len(g.clients) >= pssClientCapacity {
+			g.evictClient()
+		}
+		c = &pssClient{limiter: rate.NewLimiter(rate.Every(pssSessionInterval), pssSessionBurst)}
+		g.clients[host] = c
+	}
+	c.lastSeen = now
+	return c.limiter.AllowN(now, 1)
+}
+
+// evictClient removes the remote address which created a session least recently
+// it must be called with the lock held
+func (g *pssGateway) evictClient() {
+	var oldest string
+	var last time.Time
+	for h, c := range g.clients {
+		if last.IsZero() || c.lastSeen.Before(last) {
+			oldest, last = h, c.lastSeen
+		}
+	}
+	delete(g.clients, oldest)
+}
+
+// keysFull returns true if no more keys can be added in the session
+func (g *pssGateway) keysFull(token string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	session, ok := g.sessions[token]
+	return ok && len(session.keys) >= pssSessionKeys
+}
+
+// authenticate returns the session token of the request, the token is sent as a bearer token
+// or, if query is true, as the token query parameter for the clients which cannot set headers on websockets
+func (g *pssGateway) authenticate(r *http.Request, query bool) (string, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" && query {
+		token = r.URL.Query().Get("token")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	session, ok := g.sessions[token]
+	if !ok {
+		return "", false
+	}
+	if session.subs == 0 && time.Since(session.lastSeen) > pssSessionTTL {
+		g.removeSession(token)
+		return "", false
+	}
+	session.lastSeen = time.Now()
+	return token, true
+}
+
+// removeSession ends the session and removes its symmetric keys from the node
+// it must be called with the lock held
+func (g *pssGateway) removeSession(token string) {
+	session, ok := g.sessions[token]
+	if !ok {
+		return
+	}
+	delete(g.sessions, token)
+	for key := range session.keys {
+		if !key.asymmetric {
+			g.pss.RemoveSymmetricKey(key.id)
+		}
+	}
+}
+
+// recipient returns the address the key was added for on the topic in the session,
+// and false if the key was not added in the session
+func (g *pssGateway) recipient(token string, key pssSessionKey) (pss.PssAddress, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	session, ok := g.sessions[token]
+	if !ok {
+		return nil, false
+	}
+	to, ok := session.keys[key]
+	return to, ok
+}
+
+// subscribe counts the open websockets of the session, it returns false if the session ended
+func (g *pssGateway) subscribe(token string, delta int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	session, ok := g.sessions[token]
+	if !ok {
+		return false
+	}
+	session.subs += delta
+	session.lastSeen = time.Now()
+	return true
+}
@@ -0,0 +1,256 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethersphere/swarm/api"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/pss"
+	"github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/storage/pin"
+	"github.com/gorilla/websocket"
+)
+
+// newPssTestServer returns a test server with the pss gateway
+// and a channel of the handlers registered by the websockets
+func newPssTestServer(t *testing.T, raw bool) (*TestSwarmServer, *pss.Pss, chan func([]byte, *p2p.Peer, bool, string) error, func()) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kad := network.NewKademlia(network.PrivateKeyToBzzKey(key), network.NewKadParams())
+	ps, err := pss.New(kad, pss.NewParams().WithPrivateKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+	srv := NewTestSwarmServer(t, func(a *api.API, pinAPI *pin.API) TestServer {
+		server := NewServer(a, pinAPI, nil, "")
+		server.SetPss(ps, raw)
+		return server
+	}, nil, nil)
+
+	handlers := make(chan func([]byte, *p2p.Peer, bool, string) error, 1)
+	register := pssRegister
+	pssRegister = func(_ *pss.Pss, _ message.Topic, _ bool, f func(msg []byte, p *p2p.Peer, asymmetric bool, keyid string) error) func() {
+		handlers <- f
+		return func() {}
+	}
+	return srv, ps, handlers, func() {
+		pssRegister = register
+		srv.Close()
+		ps.Stop()
+	}
+}
+
+func pssTestRequest(t *testing.T, method, url, token string, body interface{}, response interface{}) int {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if response != nil && res.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res.StatusCode
+}
+
+// TestPssGateway tests sending messages with the keys of a session
+// and receiving them on a websocket
+func TestPssGateway(t *testing.T) {
+	srv, ps, handlers, teardown := newPssTestServer(t, true)
+	defer teardown()
+	topic := message.NewTopic([]byte("gateway-test"))
+
+	if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/send/raw", "", &PssSendRequest{Topic: topic, Message: []byte("hello")}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d without session, got %d", http.StatusUnauthorized, code)
+	}
+	var session, other PssSession
+	for _, s := range []*PssSession{&session, &other} {
+		if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/session", "", nil, s); code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+		}
+	}
+	if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/send/raw", session.Token, &PssSendRequest{Topic: topic, Message: []byte("hello")}, nil); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+
+	// keys can only be used in the session which added them
+	var symkey PssKeyResponse
+	if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/keys/symmetric", session.Token, &PssKeyRequest{Topic: topic}, &symkey); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	send := &PssSendRequest{Topic: topic, Key: symkey.Key, Message: []byte("hello")}
+	if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/send/sym", session.Token, send, nil); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/send/sym", other.Token, send, nil); code != http.StatusForbidden {
+		t.Fatalf("expected status %d with the key of another session, got %d", http.StatusForbidden, code)
+	}
+	peerKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubkey PssKeyResponse
+	keyReq := &PssKeyRequest{Topic: topic, Key: crypto.FromECDSAPub(&peerKey.PublicKey)}
+	if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/keys/public", other.Token, keyReq, &pubkey); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/send/asym", other.Token, &PssSendRequest{Topic: topic, Key: pubkey.Key, Message: []byte("hello")}, nil); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+
+	// the websocket receives the messages with the keys of the session
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/pss/receive/" + hexutil.Encode(topic[:]) + "?token=" + session.Token
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var handler func([]byte, *p2p.Peer, bool, string) error
+	select {
+	case handler = <-handlers:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the websocket handler")
+	}
+	handler([]byte("other"), nil, true, pubkey.Key)
+	handler([]byte("sym"), nil, false, symkey.Key)
+	var msg pss.APIMsg
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Msg) != "sym" || msg.Key != symkey.Key {
+		t.Fatalf("expected message of the session, got %q with key %s", msg.Msg, msg.Key)
+	}
+
+	// ended sessions are rejected and their keys removed
+	if code := pssTestRequest(t, http.MethodDelete, srv.URL+"/pss/session", other.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/keys/symmetric", other.Token, &PssKeyRequest{Topic: topic}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d after the session ended, got %d", http.StatusUnauthorized, code)
+	}
+	if code := pssTestRequest(t, http.MethodDelete, srv.URL+"/pss/session", session.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if _, err := ps.GetSymmetricKey(symkey.Key); err == nil {
+		t.Fatal("expected the symmetric key of the ended session removed")
+	}
+}
+
+// TestPssGatewayKeyRecipient tests that keys are bound to the topic and the session they were added in,
+// a session adding the public key of another session does not change the recipient of the other session
+func TestPssGatewayKeyRecipient(t *testing.T) {
+	srv, ps, _, teardown := newPssTestServer(t, false)
+	defer teardown()
+	topic := message.NewTopic([]byte("gateway-test"))
+
+	var session, other PssSession
+	for _, s := range []*PssSession{&session, &other} {
+		if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/session", "", nil, s); code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+		}
+	}
+	peerKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubkey PssKeyResponse
+	keyReq := &PssKeyRequest{Topic: topic, Address: []byte{0x01}, Key: crypto.FromECDSAPub(&peerKey.PublicKey)}
+	if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/keys/public", session.Token, keyReq, &pubkey); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	keyReq.Address = []byte{0x02}
+	if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/keys/public", other.Token, keyReq, nil); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	g := srv.Config.Handler.(*Server).pssGateway
+	to, ok := g.recipient(session.Token, pssSessionKey{id: pubkey.Key, topic: topic, asymmetric: true})
+	if !ok || !bytes.Equal(to, []byte{0x01}) {
+		t.Fatalf("expected recipient 0x01, got %x", to)
+	}
+	if topics, _, _ := ps.GetPublickeyPeers(pubkey.Key); len(topics) != 0 {
+		t.Fatal("expected the public keys of the sessions not to be added to the node key store")
+	}
+
+	// the key is only valid on the topic it was added for
+	otherTopic := message.NewTopic([]byte("other-topic"))
+	if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/send/asym", session.Token, &PssSendRequest{Topic: otherTopic, Key: pubkey.Key, Message: []byte("hello")}, nil); code != http.StatusForbidden {
+		t.Fatalf("expected status %d on another topic, got %d", http.StatusForbidden, code)
+	}
+
+	// raw messages are disabled
+	if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/send/raw", session.Token, &PssSendRequest{Topic: topic, Message: []byte("hello")}, nil); code != http.StatusForbidden {
+		t.Fatalf("expected status %d for raw messages, got %d", http.StatusForbidden, code)
+	}
+}
+
+// TestPssGatewayLimits tests that the sessions created from an address
+// and the keys added in a session are limited
+func TestPssGatewayLimits(t *testing.T) {
+	srv, _, _, teardown := newPssTestServer(t, false)
+	defer teardown()
+
+	var session PssSession
+	for i := 0; i < pssSessionBurst; i++ {
+		if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/session", "", nil, &session); code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+		}
+	}
+	if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/session", "", nil, nil); code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, code)
+	}
+
+	for i := 0; i < pssSessionKeys; i++ {
+		keyReq := &PssKeyRequest{Topic: message.NewTopic([]byte{byte(i)}), Address: []byte{0x01}}
+		if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/keys/symmetric", session.Token, keyReq, nil); code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+		}
+	}
+	keyReq := &PssKeyRequest{Topic: message.NewTopic([]byte("full")), Address: []byte{0x01}}
+	if code := pssTestRequest(t, http.MethodPost, srv.URL+"/pss/keys/symmetric", session.Token, keyReq, nil); code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, code)
+	}
+}
@@ -21,6 +21,7 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -28,11 +29,13 @@ import (
 	"math"
 	"mime"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"os"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -95,7 +98,7 @@ func (m methodHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	rw.WriteHeader(http.StatusMethodNotAllowed)
 }
 
-func NewServer(api *api.API, pinAPI *pin.API, corsString string) *Server {
+func NewServer(api *api.API, pinAPI *pin.API, health *api.HealthChecker, corsString string) *Server {
 	var allowedOrigins []string
 	for _, domain := range strings.Split(corsString, ",") {
 		allowedOrigins = append(allowedOrigins, strings.TrimSpace(domain))
@@ -107,7 +110,7 @@ func NewServer(api *api.API, pinAPI *pin.API, corsString string) *Server {
 		AllowedHeaders: []string{"*"},
 	})
 
-	server := &Server{api: api, pinAPI: pinAPI}
+	server := &Server{api: api, pinAPI: pinAPI, health: health}
 
 	defaultMiddlewares := []Adapter{
 		RecoverPanic,
@@ -209,6 +212,53 @@ func NewServer(api *api.API, pinAPI *pin.API, corsString string) *Server {
 			append(defaultMiddlewares, pinAdapter(false))...,
 		),
 	})
+	mux.Handle("/health", methodHandler{
+		"GET": Adapt(
+			http.HandlerFunc(server.HandleHealth),
+			SetRequestID,
+			InitLoggingResponseWriter,
+		),
+	})
+	mux.Handle("/ready", methodHandler{
+		"GET": Adapt(
+			http.HandlerFunc(server.HandleReady),
+			SetRequestID,
+			InitLoggingResponseWriter,
+		),
+	})
+	mux.Handle("/pss/session", methodHandler{
+		"POST": Adapt(
+			http.HandlerFunc(server.HandlePssSession),
+			SetRequestID,
+			InitLoggingResponseWriter,
+		),
+		"DELETE": Adapt(
+			http.HandlerFunc(server.HandlePssSession),
+			SetRequestID,
+			InitLoggingResponseWriter,
+		),
+	})
+	mux.Handle("/pss/keys/", methodHandler{
+		"POST": Adapt(
+			http.HandlerFunc(server.HandlePssKey),
+			SetRequestID,
+			InitLoggingResponseWriter,
+		),
+	})
+	mux.Handle("/pss/send/", methodHandler{
+		"POST": Adapt(
+			http.HandlerFunc(server.HandlePssSend),
+			SetRequestID,
+			InitLoggingResponseWriter,
+		),
+	})
+	// the response writer of websockets must not be wrapped
+	mux.Handle("/pss/receive/", methodHandler{
+		"GET": Adapt(
+			http.HandlerFunc(server.HandlePssReceive),
+			SetRequestID,
+		),
+	})
 	mux.Handle("/", methodHandler{
 		"GET": Adapt(
 			http.HandlerFunc(server.HandleRootPaths),
@@ -223,7 +273,43 @@ func NewServer(api *api.API, pinAPI *pin.API, corsString string) *Server {
 
 func (s *Server) ListenAndServe(addr string) error {
 	s.listenAddr = addr
-	return http.ListenAndServe(addr, s)
+	conns := &connections{disconnect: make(map[net.Conn]chan struct{})}
+	srv := &http.Server{
+		Addr:        addr,
+		Handler:     s,
+		ConnContext: conns.context,
+		ConnState:   conns.state,
+	}
+	return srv.ListenAndServe()
+}
+
+// connections closes a channel when the client of a connection disconnects,
+// so that work outliving a request, like prefetching, stops with the client
+type connections struct {
+	mu         sync.Mutex
+	disconnect map[net.Conn]chan struct{}
+}
+
+// context sets the disconnect channel of the connection in the context of its requests
+func (c *connections) context(ctx context.Context, conn net.Conn) context.Context {
+	disconnect := make(chan struct{})
+	c.mu.Lock()
+	c.disconnect[conn] = disconnect
+	c.mu.Unlock()
+	return sctx.SetDisconnect(ctx, disconnect)
+}
+
+// state closes the disconnect channel of a connection once it is closed or hijacked
+func (c *connections) state(conn net.Conn, state http.ConnState) {
+	if state != http.StateClosed && state != http.StateHijacked {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if disconnect, ok := c.disconnect[conn]; ok {
+		close(disconnect)
+		delete(c.disconnect, conn)
+	}
 }
 
 // browser API for registering bzz url scheme handlers:
@@ -234,6 +320,8 @@ type Server struct {
 	http.Handler
 	api        *api.API
 	pinAPI     *pin.API
+	health     *api.HealthChecker
+	pssGateway *pssGateway // nil if pss is not served
 	listenAddr string
 }
 
@@ -1126,6 +1214,46 @@ func (s *Server) HandleGetPins(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(&pinnedFiles)
 }
 
+// HandleHealth returns the health report of the node as JSON
+// the response status is 200 as long as the report can be assembled
+func (s *Server) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	log.Debug("handle.get.health", "ruid", GetRUID(r.Context()))
+	if s.health == nil {
+		respondError(w, r, "Health checks disabled on this node", http.StatusNotFound)
+		return
+	}
+	health, err := s.health.Health()
+	if err != nil {
+		respondError(w, r, fmt.Sprintf("error getting health: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
+	json.NewEncoder(w).Encode(health)
+}
+
+// HandleReady returns the readiness report of the node as JSON
+// the response status is 200 if the node meets the readiness thresholds
+// and 503 if it does not
+func (s *Server) HandleReady(w http.ResponseWriter, r *http.Request) {
+	log.Debug("handle.get.ready", "ruid", GetRUID(r.Context()))
+	if s.health == nil {
+		respondError(w, r, "Health checks disabled on this node", http.StatusNotFound)
+		return
+	}
+	readiness, err := s.health.Readiness()
+	if err != nil {
+		respondError(w, r, fmt.Sprintf("error getting readiness: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
+	if !readiness.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(readiness)
+}
+
 // calculateNumberOfChunks calculates the number of chunks in an arbitrary content length
 func calculateNumberOfChunks(contentLength int64, isEncrypted bool) int64 {
 	if contentLength < 4096 {
@@ -45,6 +45,7 @@ import (
 	"github.com/ethersphere/swarm/api"
 	"github.com/ethersphere/swarm/chunk"
 	chunktesting "github.com/ethersphere/swarm/chunk/testing"
+	"github.com/ethersphere/swarm/network"
 	"github.com/ethersphere/swarm/storage"
 	"github.com/ethersphere/swarm/storage/feed"
 	"github.com/ethersphere/swarm/storage/feed/lookup"
@@ -57,7 +58,7 @@ func init() {
 }
 
 func serverFunc(api *api.API, pinAPI *pin.API) TestServer {
-	return NewServer(api, pinAPI, "")
+	return NewServer(api, pinAPI, nil, "")
 }
 
 func newTestSigner() (*feed.GenericSigner, *ecdsa.PrivateKey, error) {
@@ -1275,6 +1276,56 @@ func TestMethodsNotAllowed(t *testing.T) {
 
 }
 
+// TestHealthReady tests the health and readiness endpoints
+func TestHealthReady(t *testing.T) {
+	kad := network.NewKademlia(network.RandomBzzAddr().Over(), network.NewKadParams())
+	health := api.NewHealthChecker(kad, nil, nil, nil)
+	srv := NewTestSwarmServer(t, func(a *api.API, pinAPI *pin.API) TestServer {
+		return NewServer(a, pinAPI, health, "")
+	}, nil, nil)
+	defer srv.Close()
+
+	get := func(path string, expCode int, v interface{}) {
+		t.Helper()
+		res, body := httpDo(http.MethodGet, srv.URL+path, nil, nil, false, t)
+		if res.StatusCode != expCode {
+			t.Fatalf("%s: expected status %d, got %d", path, expCode, res.StatusCode)
+		}
+		if err := json.Unmarshal([]byte(body), v); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+
+	var h api.Health
+	get("/health", http.StatusOK, &h)
+	if h.Kademlia.Connected != 0 {
+		t.Fatalf("expected no connected peers, got %d", h.Kademlia.Connected)
+	}
+	var r api.Readiness
+	get("/ready", http.StatusServiceUnavailable, &r)
+	if r.Ready {
+		t.Fatal("expected node not to be ready without peers")
+	}
+
+	kad.On(network.NewPeer(&network.BzzPeer{BzzAddr: network.RandomBzzAddr()}, kad))
+	get("/health", http.StatusOK, &h)
+	if h.Kademlia.Connected != 1 {
+		t.Fatalf("expected 1 connected peer, got %d", h.Kademlia.Connected)
+	}
+	get("/ready", http.StatusOK, &r)
+	if !r.Ready {
+		t.Fatalf("expected node to be ready, got reasons %v", r.Reasons)
+	}
+
+	// health checks are not available if no checker is set
+	srvNoHealth := NewTestSwarmServer(t, serverFunc, nil, nil)
+	defer srvNoHealth.Close()
+	res, _ := httpDo(http.MethodGet, srvNoHealth.URL+"/ready", nil, nil, false, t)
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.StatusCode)
+	}
+}
+
 func httpDo(httpMethod string, url string, reqBody io.Reader, headers map[string]string, verbose bool, t *testing.T) (*http.Response, string) {
 	// Build the Request
 	req, err := http.NewRequest(httpMethod, url, reqBody)
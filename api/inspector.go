@@ -128,6 +128,12 @@ func (i *Inspector) PeerStreams() (string, error) {
 	return string(v), nil
 }
 
+// SyncProgress returns the pull sync progress of the history of each bin
+// synced from each connected peer
+func (i *Inspector) SyncProgress() ([]stream.PeerSyncProgress, error) {
+	return i.stream.PeerSyncProgress()
+}
+
 func (i *Inspector) StorageIndices() (map[string]int, error) {
 	return i.ls.DebugIndices()
 }
@@ -0,0 +1,162 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/sctx"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// DefaultPrefetchWorkers is the default number of files prefetched concurrently
+const DefaultPrefetchWorkers = 4
+
+var (
+	// maximum number of manifest entries prefetched for a page
+	prefetchMaxEntries = 32
+	// number of bytes read from the start of each prefetched file,
+	// enough for the root chunk and the first data chunks
+	prefetchSize = 4 * chunk.DefaultSize
+	// maximum time spent prefetching the entries of a page
+	prefetchTimeout = 30 * time.Second
+
+	apiPrefetchCount     = metrics.NewRegisteredCounter("api/prefetch/count", nil)
+	apiPrefetchEntries   = metrics.NewRegisteredCounter("api/prefetch/entries", nil)
+	apiPrefetchFail      = metrics.NewRegisteredCounter("api/prefetch/fail", nil)
+	apiPrefetchCancelled = metrics.NewRegisteredCounter("api/prefetch/cancelled", nil)
+)
+
+// prefetchFile retrieves the first chunks of the file with the given address
+var prefetchFile = func(ctx context.Context, fileStore *storage.FileStore, addr storage.Address) error {
+	reader, _ := fileStore.Retrieve(ctx, addr)
+	_, err := reader.ReadAt(make([]byte, prefetchSize), 0)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// Prefetcher speculatively retrieves the files a web page served from a manifest
+// is likely to load next, i.e. the entries under the same prefix as the page
+// (scripts, stylesheets, images), so that their chunks are fetched from the network
+// in parallel instead of one by one as the browser requests them.
+// The number of files retrieved at the same time is bounded across all pages.
+type Prefetcher struct {
+	workers chan struct{}
+}
+
+// NewPrefetcher creates a Prefetcher retrieving at most workers files concurrently
+func NewPrefetcher(workers int) *Prefetcher {
+	return &Prefetcher{
+		workers: make(chan struct{}, workers),
+	}
+}
+
+// isPrefetchable returns true if the content of the entry links other entries
+func isPrefetchable(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/html")
+}
+
+// prefetchDir returns the prefix of the entries next to the one with the given path
+func prefetchDir(path string) string {
+	return path[:strings.LastIndex(path, "/")+1]
+}
+
+// prefetch retrieves in the background the subtries and the first chunks of the files
+// of the trie under dir, except for the entry being served.
+// It outlives the request, which is done once the page is served, and stops
+// after prefetchTimeout or when the client of the page disconnects
+func (p *Prefetcher) prefetch(ctx context.Context, trie *manifestTrie, dir string, served string) {
+	apiPrefetchCount.Inc(1)
+	disconnect := sctx.GetDisconnect(ctx)
+	ctx, cancel := context.WithTimeout(context.Background(), prefetchTimeout)
+	go func() {
+		select {
+		case <-disconnect:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	go func() {
+		defer cancel()
+		entries := p.list(ctx, trie, dir, served)
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		for _, entry := range entries {
+			select {
+			case p.workers <- struct{}{}:
+			case <-ctx.Done():
+				apiPrefetchCancelled.Inc(1)
+				return
+			}
+			if ctx.Err() != nil {
+				<-p.workers
+				apiPrefetchCancelled.Inc(1)
+				return
+			}
+			wg.Add(1)
+			go func(entry *manifestTrieEntry) {
+				defer func() {
+					<-p.workers
+					wg.Done()
+				}()
+				apiPrefetchEntries.Inc(1)
+				if err := prefetchFile(ctx, trie.fileStore, common.Hex2Bytes(entry.Hash)); err != nil {
+					apiPrefetchFail.Inc(1)
+					log.Trace("prefetch failed", "path", entry.Path, "hash", entry.Hash, "err", err)
+				}
+			}(entry)
+		}
+	}()
+}
+
+// list returns at most prefetchMaxEntries file entries of the trie under dir,
+// loading the sibling subtries on the way
+func (p *Prefetcher) list(ctx context.Context, trie *manifestTrie, dir string, served string) (entries []*manifestTrieEntry) {
+	quitC := make(chan bool)
+	var once sync.Once
+	quit := func() { once.Do(func() { close(quitC) }) }
+	defer quit()
+	go func() {
+		select {
+		case <-ctx.Done():
+			quit()
+		case <-quitC:
+		}
+	}()
+	// listing is aborted once enough entries are found or ctx is done
+	trie.listWithPrefix(dir, quitC, func(entry *manifestTrieEntry, _ string) {
+		if len(entries) >= prefetchMaxEntries {
+			quit()
+			return
+		}
+		if entry.Hash == served || entry.ContentType == FeedContentType || entry.Hash == "" {
+			return
+		}
+		entries = append(entries, entry)
+	})
+	return entries
+}
@@ -0,0 +1,212 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/sctx"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// putSite stores the files with the given paths and content types in a manifest
+// and returns its address and the hashes of the files by path
+func putSite(t *testing.T, a *API, files map[string]string) (storage.Address, map[string]string) {
+	t.Helper()
+	tag, err := a.Tags.Create("site", 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := sctx.SetTag(context.Background(), tag.Uid)
+	addr, err := a.NewManifest(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw, err := a.NewManifestWriter(ctx, addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := make(map[string]string)
+	for path, contentType := range files {
+		content := "content of " + path
+		fileAddr, err := mw.AddEntry(ctx, strings.NewReader(content), &ManifestEntry{
+			Path:        path,
+			ContentType: contentType,
+			Size:        int64(len(content)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[path] = fileAddr.Hex()
+	}
+	addr, err = mw.Store()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr, hashes
+}
+
+// TestPrefetch tests that serving a web page prefetches the files under its prefix
+// and that serving other content does not prefetch
+func TestPrefetch(t *testing.T) {
+	defer func(f func(context.Context, *storage.FileStore, storage.Address) error) { prefetchFile = f }(prefetchFile)
+	prefetched := make(chan string)
+	prefetchFile = func(ctx context.Context, fileStore *storage.FileStore, addr storage.Address) error {
+		prefetched <- addr.Hex()
+		return nil
+	}
+
+	testAPI(t, func(a *API, tags *chunk.Tags, _ bool) {
+		a.Prefetcher = NewPrefetcher(2)
+		addr, hashes := putSite(t, a, map[string]string{
+			"app/index.html":     "text/html; charset=utf-8",
+			"app/js/main.js":     "application/javascript",
+			"app/css/style.css":  "text/css",
+			"app/img/logo.png":   "image/png",
+			"other/readme.txt":   "text/plain",
+			"other/another.html": "text/html",
+		})
+
+		if _, _, _, _, err := a.Get(context.Background(), NOOPDecrypt, addr, "app/index.html"); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for i := 0; i < 3; i++ {
+			select {
+			case hash := <-prefetched:
+				got = append(got, hash)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout waiting for prefetch, got %v", got)
+			}
+		}
+		sort.Strings(got)
+		expected := []string{hashes["app/js/main.js"], hashes["app/css/style.css"], hashes["app/img/logo.png"]}
+		sort.Strings(expected)
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Fatalf("expected prefetched %v, got %v", expected, got)
+			}
+		}
+
+		if _, _, _, _, err := a.Get(context.Background(), NOOPDecrypt, addr, "other/readme.txt"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case hash := <-prefetched:
+			t.Fatalf("unexpected prefetch of %s", hash)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+// TestPrefetchCancel tests that prefetching is bounded and stops when the client disconnects
+func TestPrefetchCancel(t *testing.T) {
+	defer func(f func(context.Context, *storage.FileStore, storage.Address) error) { prefetchFile = f }(prefetchFile)
+	started := make(chan string, 10)
+	stopped := make(chan error, 10)
+	prefetchFile = func(ctx context.Context, fileStore *storage.FileStore, addr storage.Address) error {
+		started <- addr.Hex()
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return ctx.Err()
+	}
+
+	testAPI(t, func(a *API, tags *chunk.Tags, _ bool) {
+		a.Prefetcher = NewPrefetcher(1)
+		addr, _ := putSite(t, a, map[string]string{
+			"index.html": "text/html",
+			"a.js":       "application/javascript",
+			"b.js":       "application/javascript",
+			"c.js":       "application/javascript",
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		disconnect := make(chan struct{})
+		ctx = sctx.SetDisconnect(ctx, disconnect)
+		if _, _, _, _, err := a.Get(ctx, NOOPDecrypt, addr, "index.html"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for prefetch")
+		}
+		// a single worker is busy with the first file
+		select {
+		case hash := <-started:
+			t.Fatalf("unexpected concurrent prefetch of %s", hash)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		// prefetching outlives the request
+		cancel()
+		select {
+		case err := <-stopped:
+			t.Fatalf("unexpected prefetch stop after the request is done: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		close(disconnect)
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for prefetch to stop")
+		}
+		select {
+		case hash := <-started:
+			t.Fatalf("unexpected prefetch of %s after cancel", hash)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+// TestPrefetchTimeout tests that prefetching stops after prefetchTimeout
+func TestPrefetchTimeout(t *testing.T) {
+	defer func(f func(context.Context, *storage.FileStore, storage.Address) error) { prefetchFile = f }(prefetchFile)
+	defer func(timeout time.Duration) { prefetchTimeout = timeout }(prefetchTimeout)
+	prefetchTimeout = 100 * time.Millisecond
+	stopped := make(chan error, 10)
+	prefetchFile = func(ctx context.Context, fileStore *storage.FileStore, addr storage.Address) error {
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return ctx.Err()
+	}
+
+	testAPI(t, func(a *API, tags *chunk.Tags, _ bool) {
+		a.Prefetcher = NewPrefetcher(1)
+		addr, _ := putSite(t, a, map[string]string{
+			"index.html": "text/html",
+			"a.js":       "application/javascript",
+		})
+		if _, _, _, _, err := a.Get(context.Background(), NOOPDecrypt, addr, "index.html"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-stopped:
+			if err != context.DeadlineExceeded {
+				t.Fatalf("expected error %v, got %v", context.DeadlineExceeded, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for prefetch to stop")
+		}
+	})
+}
@@ -27,6 +27,7 @@ import (
 	"unicode"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	cli "gopkg.in/urfave/cli.v1"
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
@@ -36,6 +37,8 @@ import (
 
 	bzzapi "github.com/ethersphere/swarm/api"
 	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/pss"
+	pssmessage "github.com/ethersphere/swarm/pss/message"
 )
 
 var (
@@ -61,9 +64,14 @@ var (
 const (
 	SwarmEnvAccount                 = "SWARM_ACCOUNT"
 	SwarmEnvBzzKeyHex               = "SWARM_BZZ_KEY_HEX"
+	SwarmEnvBzzKeyNonce             = "SWARM_BZZ_KEY_NONCE"
+	SwarmEnvOverlayPrefix           = "SWARM_OVERLAY_PREFIX"
+	SwarmEnvOverlayProximity        = "SWARM_OVERLAY_PO"
 	SwarmEnvListenAddr              = "SWARM_LISTEN_ADDR"
 	SwarmEnvPort                    = "SWARM_PORT"
 	SwarmEnvNetworkID               = "SWARM_NETWORK_ID"
+	SwarmEnvNetworkAuthority        = "SWARM_NETWORK_AUTHORITY"
+	SwarmEnvNetworkCredential       = "SWARM_NETWORK_CREDENTIAL"
 	SwarmEnvChequebookAddr          = "SWARM_CHEQUEBOOK_ADDR"
 	SwarmEnvChequebookFactoryAddr   = "SWARM_SWAP_CHEQUEBOOK_FACTORY_ADDR"
 	SwarmEnvSwapSkipDeposit         = "SWARM_SWAP_SKIP_DEPOSIT"
@@ -73,6 +81,11 @@ const (
 	SwarmEnvSwapPaymentThreshold    = "SWARM_SWAP_PAYMENT_THRESHOLD"
 	SwarmEnvSwapDisconnectThreshold = "SWARM_SWAP_DISCONNECT_THRESHOLD"
 	SwarmNoSync                     = "SWARM_NO_SYNC"
+	SwarmEnvSyncReconcile           = "SWARM_SYNC_RECONCILE"
+	SwarmEnvReachabilityInterval    = "SWARM_REACHABILITY_INTERVAL"
+	SwarmEnvReachabilityHide        = "SWARM_REACHABILITY_HIDE"
+	SwarmEnvRateLimitTotal          = "SWARM_RATELIMIT_TOTAL"
+	SwarmEnvRateLimitPeer           = "SWARM_RATELIMIT_PEER"
 	SwarmEnvSwapLogPath             = "SWARM_SWAP_LOG_PATH"
 	SwarmEnvSwapLogLevel            = "SWARM_SWAP_LOG_LEVEL"
 	SwarmEnvLightNodeEnable         = "SWARM_LIGHT_NODE_ENABLE"
@@ -80,13 +93,26 @@ const (
 	SwarmEnvRNSAPI                  = "SWARM_RNS_API"
 	SwarmEnvENSAddr                 = "SWARM_ENS_ADDR"
 	SwarmEnvCORS                    = "SWARM_CORS"
+	SwarmEnvPrefetchWorkers         = "SWARM_PREFETCH_WORKERS"
+	SwarmEnvReadyMinPeers           = "SWARM_READY_MIN_PEERS"
+	SwarmEnvReadyNeighbourhood      = "SWARM_READY_NEIGHBOURHOOD"
+	SwarmEnvReadyMinSync            = "SWARM_READY_MIN_SYNC"
+	SwarmEnvReadyMaxPushBacklog     = "SWARM_READY_MAX_PUSH_BACKLOG"
 	SwarmEnvBootnodes               = "SWARM_BOOTNODES"
 	SwarmEnvPSSEnable               = "SWARM_PSS_ENABLE"
+	SwarmEnvPSSMailbox              = "SWARM_PSS_MAILBOX"
+	SwarmEnvPSSRatchet              = "SWARM_PSS_RATCHET"
+	SwarmEnvPSSDifficulty           = "SWARM_PSS_DIFFICULTY"
+	SwarmEnvPSSTopics               = "SWARM_PSS_TOPICS"
+	SwarmEnvPSSPeerRate             = "SWARM_PSS_PEER_RATE"
+	SwarmEnvPSSGateway              = "SWARM_PSS_GATEWAY"
+	SwarmEnvPSSGatewayRaw           = "SWARM_PSS_GATEWAY_RAW"
 	SwarmEnvStorePath               = "SWARM_STORE_PATH"
 	SwarmEnvStoreCapacity           = "SWARM_STORE_CAPACITY"
 	SwarmEnvStoreCacheCapacity      = "SWARM_STORE_CACHE_CAPACITY"
 	SwarmEnvBootnodeMode            = "SWARM_BOOTNODE_MODE"
 	SwarmEnvNATInterface            = "SWARM_NAT_INTERFACE"
+	SwarmEnvUnderlays               = "SWARM_UNDERLAYS"
 	SwarmAccessPassword             = "SWARM_ACCESS_PASSWORD"
 	SwarmAutoDefaultPath            = "SWARM_AUTO_DEFAULTPATH"
 	SwarmGlobalstoreAPI             = "SWARM_GLOBALSTORE_API"
@@ -191,6 +217,21 @@ func flagsOverride(currentConfig *bzzapi.Config, ctx *cli.Context) *bzzapi.Confi
 	if networkid != 0 && networkid != network.DefaultNetworkID {
 		currentConfig.NetworkID = networkid
 	}
+	if nonce := ctx.GlobalString(SwarmBzzKeyNonceFlag.Name); nonce != "" {
+		currentConfig.BzzKeyNonce = nonce
+	}
+	if prefix := ctx.GlobalString(SwarmOverlayPrefixFlag.Name); prefix != "" {
+		currentConfig.OverlayPrefix = prefix
+	}
+	if ctx.GlobalIsSet(SwarmOverlayProximityFlag.Name) {
+		currentConfig.OverlayProximity = ctx.GlobalInt(SwarmOverlayProximityFlag.Name)
+	}
+	if authority := ctx.GlobalString(SwarmNetworkAuthorityFlag.Name); authority != "" {
+		currentConfig.NetworkAuthority = common.HexToAddress(authority)
+	}
+	if credential := ctx.GlobalString(SwarmNetworkCredentialFlag.Name); credential != "" {
+		currentConfig.NetworkCredential = credential
+	}
 	if ctx.GlobalIsSet(utils.DataDirFlag.Name) {
 		if datadir := ctx.GlobalString(utils.DataDirFlag.Name); datadir != "" {
 			currentConfig.Path = expandPath(datadir)
@@ -203,6 +244,9 @@ func flagsOverride(currentConfig *bzzapi.Config, ctx *cli.Context) *bzzapi.Confi
 	if bzzaddr := ctx.GlobalString(SwarmListenAddrFlag.Name); bzzaddr != "" {
 		currentConfig.ListenAddr = bzzaddr
 	}
+	if ctx.GlobalIsSet(SwarmUnderlaysFlag.Name) {
+		currentConfig.Underlays = ctx.GlobalStringSlice(SwarmUnderlaysFlag.Name)
+	}
 	if ctx.GlobalIsSet(SwarmSwapEnabledFlag.Name) {
 		currentConfig.SwapEnabled = true
 	}
@@ -232,6 +276,21 @@ func flagsOverride(currentConfig *bzzapi.Config, ctx *cli.Context) *bzzapi.Confi
 		val := !ctx.GlobalBool(SwarmNoSyncFlag.Name)
 		currentConfig.SyncEnabled, currentConfig.PushSyncEnabled = val, val // if the flag is set (true) - push and pull sync should be disabled
 	}
+	if ctx.GlobalIsSet(SwarmSyncReconcileFlag.Name) {
+		currentConfig.SyncReconcile = ctx.GlobalBool(SwarmSyncReconcileFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmReachabilityIntervalFlag.Name) {
+		currentConfig.ReachabilityCheckInterval = ctx.GlobalDuration(SwarmReachabilityIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmReachabilityHideFlag.Name) {
+		currentConfig.HideUnreachable = ctx.GlobalBool(SwarmReachabilityHideFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmRateLimitTotalFlag.Name) {
+		currentConfig.RateLimits.Total = ctx.GlobalUint64(SwarmRateLimitTotalFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmRateLimitPeerFlag.Name) {
+		currentConfig.RateLimits.Peer = ctx.GlobalUint64(SwarmRateLimitPeerFlag.Name)
+	}
 	if ctx.GlobalIsSet(SwarmLightNodeEnabled.Name) {
 		currentConfig.LightNodeEnabled = true
 	}
@@ -252,6 +311,18 @@ func flagsOverride(currentConfig *bzzapi.Config, ctx *cli.Context) *bzzapi.Confi
 	if cors := ctx.GlobalString(CorsStringFlag.Name); cors != "" {
 		currentConfig.Cors = cors
 	}
+	if ctx.GlobalIsSet(SwarmReadyMinPeersFlag.Name) {
+		currentConfig.Readiness.MinPeers = ctx.GlobalInt(SwarmReadyMinPeersFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmReadyNeighbourhoodFlag.Name) {
+		currentConfig.Readiness.NeighbourhoodComplete = ctx.GlobalBool(SwarmReadyNeighbourhoodFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmReadyMinSyncFlag.Name) {
+		currentConfig.Readiness.MinSyncProgress = ctx.GlobalFloat64(SwarmReadyMinSyncFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmReadyMaxPushBacklogFlag.Name) {
+		currentConfig.Readiness.MaxPushBacklog = ctx.GlobalInt(SwarmReadyMaxPushBacklogFlag.Name)
+	}
 	if storePath := ctx.GlobalString(SwarmStorePath.Name); storePath != "" {
 		currentConfig.ChunkDbPath = storePath
 	}
@@ -270,6 +341,46 @@ func flagsOverride(currentConfig *bzzapi.Config, ctx *cli.Context) *bzzapi.Confi
 	if ctx.GlobalIsSet(SwarmGlobalStoreAPIFlag.Name) {
 		currentConfig.GlobalStoreAPI = ctx.GlobalString(SwarmGlobalStoreAPIFlag.Name)
 	}
+	if ctx.GlobalIsSet(SwarmPrefetchWorkersFlag.Name) {
+		currentConfig.PrefetchWorkers = ctx.GlobalInt(SwarmPrefetchWorkersFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmPssMailboxFlag.Name) {
+		currentConfig.Pss.Mailbox = ctx.GlobalBool(SwarmPssMailboxFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmPssRatchetFlag.Name) {
+		currentConfig.Pss.Ratchet = ctx.GlobalBool(SwarmPssRatchetFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmPssDifficultyFlag.Name) {
+		currentConfig.Pss.Difficulty = ctx.GlobalInt(SwarmPssDifficultyFlag.Name)
+	}
+	if topics := ctx.GlobalString(SwarmPssTopicsFlag.Name); topics != "" {
+		policy := &pss.PolicyParams{
+			Default: &pss.TopicPolicy{},
+			Topics:  make(map[pssmessage.Topic]pss.TopicPolicy),
+		}
+		for _, t := range strings.Split(topics, ",") {
+			b, err := hexutil.Decode(strings.TrimSpace(t))
+			if err != nil || len(b) != pssmessage.TopicLength {
+				utils.Fatalf("Invalid pss topic %q", t)
+			}
+			var topic pssmessage.Topic
+			copy(topic[:], b)
+			policy.Topics[topic] = pss.TopicPolicy{Forward: true, Deliver: true}
+		}
+		currentConfig.Pss.Policy = policy
+	}
+	if ctx.GlobalIsSet(SwarmPssGatewayFlag.Name) {
+		currentConfig.PssGateway = ctx.GlobalBool(SwarmPssGatewayFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmPssGatewayRawFlag.Name) {
+		currentConfig.PssGatewayRaw = ctx.GlobalBool(SwarmPssGatewayRawFlag.Name)
+	}
+	if ctx.GlobalIsSet(SwarmPssPeerRateFlag.Name) {
+		if currentConfig.Pss.Policy == nil {
+			currentConfig.Pss.Policy = &pss.PolicyParams{}
+		}
+		currentConfig.Pss.Policy.PeerRate = ctx.GlobalFloat64(SwarmPssPeerRateFlag.Name)
+	}
 	if ctx.GlobalBool(SwarmEnablePinningFlag.Name) {
 		currentConfig.EnablePinning = true
 	}
@@ -0,0 +1,64 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of Swarm.
+//
+// Swarm is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Swarm is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Swarm. If not, see <http://www.gnu.org/licenses/>.
+
+// Command credential issues private network credentials.
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/network"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var credentialCommand = cli.Command{
+	Action:             issueCredential,
+	CustomHelpTemplate: helpTemplate,
+	Name:               "credential",
+	Usage:              "issue a private network credential for a node",
+	ArgsUsage:          "<enode>",
+	Flags:              []cli.Flag{SwarmCredentialExpiryFlag},
+	Description: `Signs a credential for the node with the given enode URL or hex encoded node public key using the key of --bzzaccount as the network authority.
+The credential is bound to the node key, so it is only accepted from the node it was issued for.
+The credential is valid on the network given by --bzznetworkid and is printed hex encoded, to be passed to the node with --network-credential.`,
+}
+
+func issueCredential(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) < 1 {
+		utils.Fatalf("Usage: swarm credential <enode>")
+	}
+	node, err := enode.ParseV4(args[0])
+	if err != nil {
+		utils.Fatalf("invalid enode %q: %v", args[0], err)
+	}
+	config, err := buildConfig(ctx)
+	if err != nil {
+		utils.Fatalf("unable to configure swarm: %v", err)
+	}
+	var expiry time.Time
+	if d := ctx.Duration(SwarmCredentialExpiryFlag.Name); d > 0 {
+		expiry = time.Now().Add(d)
+	}
+	c, err := network.NewCredential(getPrivKey(ctx), config.NetworkID, node.ID(), expiry)
+	if err != nil {
+		utils.Fatalf("error issuing credential: %v", err)
+	}
+	fmt.Println(c.Hex())
+}
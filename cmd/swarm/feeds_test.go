@@ -37,7 +37,7 @@ import (
 
 func TestCLIFeedUpdate(t *testing.T) {
 	srv := swarmhttp.NewTestSwarmServer(t, func(api *api.API, pinAPI *pin.API) swarmhttp.TestServer {
-		return swarmhttp.NewServer(api, nil, "")
+		return swarmhttp.NewServer(api, nil, nil, "")
 	}, nil, nil)
 	log.Info("starting a test swarm server")
 	defer srv.Close()
@@ -33,6 +33,29 @@ var (
 		Usage:  "BzzAccount key in hex (for testing)",
 		EnvVar: SwarmEnvBzzKeyHex,
 	}
+	SwarmBzzKeyNonceFlag = cli.StringFlag{
+		Name:   "bzzkey-nonce",
+		Usage:  "Hex encoded nonce mixed into the overlay address, as found by the mine command",
+		EnvVar: SwarmEnvBzzKeyNonce,
+	}
+	SwarmOverlayPrefixFlag = cli.StringFlag{
+		Name:   "overlay-prefix",
+		Usage:  "Hex encoded prefix of the neighbourhood to mine the overlay address for (requires --overlay-po)",
+		EnvVar: SwarmEnvOverlayPrefix,
+	}
+	SwarmOverlayProximityFlag = cli.IntFlag{
+		Name:   "overlay-po",
+		Usage:  "Number of leading bits of the overlay address that must match --overlay-prefix, at most 24",
+		EnvVar: SwarmEnvOverlayProximity,
+	}
+	SwarmMineNonceFlag = cli.BoolFlag{
+		Name:  "nonce",
+		Usage: "Mine a nonce for the key of --bzzaccount instead of a new key",
+	}
+	SwarmSyncProgressIntervalFlag = cli.DurationFlag{
+		Name:  "interval",
+		Usage: "Refresh the sync progress at this interval until interrupted (0 shows it once)",
+	}
 	SwarmListenAddrFlag = cli.StringFlag{
 		Name:   "httpaddr",
 		Usage:  "Swarm HTTP API listening interface",
@@ -48,12 +71,31 @@ var (
 		Usage:  "Announce the IP address of a given network interface (e.g. eth0)",
 		EnvVar: SwarmEnvNATInterface,
 	}
+	SwarmUnderlaysFlag = cli.StringSliceFlag{
+		Name:   "underlay",
+		Usage:  "Additional ip:port address the node is reachable on (e.g. an IPv6 or LAN address), advertised in order after the p2p address, can be repeated",
+		EnvVar: SwarmEnvUnderlays,
+	}
 	SwarmNetworkIdFlag = cli.IntFlag{
 		Name:   "bzznetworkid",
 		Usage:  "Numerical network identifier. The default is the public swarm testnet",
 		Value:  network.DefaultNetworkID,
 		EnvVar: SwarmEnvNetworkID,
 	}
+	SwarmNetworkAuthorityFlag = cli.StringFlag{
+		Name:   "network-authority",
+		Usage:  "Address of the private network authority, only peers with a credential signed by it are accepted",
+		EnvVar: SwarmEnvNetworkAuthority,
+	}
+	SwarmNetworkCredentialFlag = cli.StringFlag{
+		Name:   "network-credential",
+		Usage:  "Hex encoded credential issued by the private network authority",
+		EnvVar: SwarmEnvNetworkCredential,
+	}
+	SwarmCredentialExpiryFlag = cli.DurationFlag{
+		Name:  "expiry",
+		Usage: "Validity period of the issued credential (default no expiry)",
+	}
 	SwarmSwapDepositAmountFlag = cli.StringFlag{
 		Name:   "swap-deposit-amount",
 		Usage:  "Deposit amount for swap chequebook",
@@ -99,6 +141,31 @@ var (
 		Usage:  "disable syncing",
 		EnvVar: SwarmNoSync,
 	}
+	SwarmSyncReconcileFlag = cli.BoolFlag{
+		Name:   "sync-reconcile",
+		Usage:  "Sync the history of pull sync streams by set reconciliation instead of offering all hashes",
+		EnvVar: SwarmEnvSyncReconcile,
+	}
+	SwarmReachabilityIntervalFlag = cli.DurationFlag{
+		Name:   "reachability.interval",
+		Usage:  "Interval in which peers are asked to dial the advertised address of the node to check its reachability (0 disables the checks)",
+		EnvVar: SwarmEnvReachabilityInterval,
+	}
+	SwarmReachabilityHideFlag = cli.BoolFlag{
+		Name:   "reachability.hide",
+		Usage:  "Ask the peers not to advertise the address of the node if they can not dial it",
+		EnvVar: SwarmEnvReachabilityHide,
+	}
+	SwarmRateLimitTotalFlag = cli.Uint64Flag{
+		Name:   "ratelimit.total",
+		Usage:  "Upload bandwidth limit in bytes per second for retrieval, syncing and pss (0 means no limit)",
+		EnvVar: SwarmEnvRateLimitTotal,
+	}
+	SwarmRateLimitPeerFlag = cli.Uint64Flag{
+		Name:   "ratelimit.peer",
+		Usage:  "Upload bandwidth limit in bytes per second to each peer for retrieval, syncing and pss (0 means no limit)",
+		EnvVar: SwarmEnvRateLimitPeer,
+	}
 	SwarmSwapLogPathFlag = cli.StringFlag{
 		Name:   "swap-audit-logpath",
 		Usage:  "Write execution logs of swap audit to the given directory",
@@ -111,7 +178,7 @@ var (
 	}
 	SwarmLightNodeEnabled = cli.BoolFlag{
 		Name:   "lightnode",
-		Usage:  "Enable Swarm LightNode (default false)",
+		Usage:  "Enable Swarm LightNode, which does not store chunks for the network and keeps store.cache.size recent chunks in memory, uploads wait while as many chunks are not push synced and the chunks not yet synced are lost on shutdown (default false)",
 		EnvVar: SwarmEnvLightNodeEnable,
 	}
 	EnsAPIFlag = cli.StringSliceFlag{
@@ -175,6 +242,66 @@ var (
 		Usage:  "Domain on which to send Access-Control-Allow-Origin header (multiple domains can be supplied separated by a ',')",
 		EnvVar: SwarmEnvCORS,
 	}
+	SwarmPrefetchWorkersFlag = cli.IntFlag{
+		Name:   "prefetch.workers",
+		Usage:  "Number of files retrieved concurrently ahead of requests for the pages served over http, 0 disables prefetching",
+		EnvVar: SwarmEnvPrefetchWorkers,
+	}
+	SwarmPssMailboxFlag = cli.BoolFlag{
+		Name:   "pss.mailbox",
+		Usage:  "Keep the pss messages of offline recipients in the neighbourhood and deposit the messages sent in the neighbourhood of their recipients",
+		EnvVar: SwarmEnvPSSMailbox,
+	}
+	SwarmPssRatchetFlag = cli.BoolFlag{
+		Name:   "pss.ratchet",
+		Usage:  "Accept and open forward secret pss sessions with the peers registered for a topic",
+		EnvVar: SwarmEnvPSSRatchet,
+	}
+	SwarmPssDifficultyFlag = cli.IntFlag{
+		Name:   "pss.difficulty",
+		Usage:  "Minimum proof of work difficulty of the pss messages forwarded by the node, 0 forwards all messages",
+		EnvVar: SwarmEnvPSSDifficulty,
+	}
+	SwarmPssTopicsFlag = cli.StringFlag{
+		Name:   "pss.topics",
+		Usage:  "Comma separated hex pss topics forwarded and delivered by the node, the messages on other topics are dropped except for the internal topics (receipts, mailbox, trace, groups, ratchet, push-sync), handshakes use the topics they are made for",
+		EnvVar: SwarmEnvPSSTopics,
+	}
+	SwarmPssPeerRateFlag = cli.Float64Flag{
+		Name:   "pss.peer-rate",
+		Usage:  "Maximum number of pss messages per second received from a peer, 0 for no limit",
+		EnvVar: SwarmEnvPSSPeerRate,
+	}
+	SwarmPssGatewayFlag = cli.BoolFlag{
+		Name:   "pss.gateway",
+		Usage:  "Serve pss over the http proxy with sessions, message sending and websocket subscriptions",
+		EnvVar: SwarmEnvPSSGateway,
+	}
+	SwarmPssGatewayRawFlag = cli.BoolFlag{
+		Name:   "pss.gateway.raw",
+		Usage:  "Allow the pss gateway clients to send and receive raw messages, which are not bound to the keys of their session",
+		EnvVar: SwarmEnvPSSGatewayRaw,
+	}
+	SwarmReadyMinPeersFlag = cli.IntFlag{
+		Name:   "ready-min-peers",
+		Usage:  "Minimum number of connected peers for the node to be reported ready on /ready",
+		EnvVar: SwarmEnvReadyMinPeers,
+	}
+	SwarmReadyNeighbourhoodFlag = cli.BoolFlag{
+		Name:   "ready-neighbourhood",
+		Usage:  "Require connections to all known neighbours for the node to be reported ready on /ready",
+		EnvVar: SwarmEnvReadyNeighbourhood,
+	}
+	SwarmReadyMinSyncFlag = cli.Float64Flag{
+		Name:   "ready-min-sync",
+		Usage:  "Minimum fraction (0-1) of the pull sync history synced for the node to be reported ready on /ready",
+		EnvVar: SwarmEnvReadyMinSync,
+	}
+	SwarmReadyMaxPushBacklogFlag = cli.IntFlag{
+		Name:   "ready-max-push-backlog",
+		Usage:  "Maximum number of chunks awaiting push sync for the node to be reported ready on /ready (0 means no limit)",
+		EnvVar: SwarmEnvReadyMaxPushBacklog,
+	}
 	SwarmStorePath = cli.StringFlag{
 		Name:   "store.path",
 		Usage:  "Path to leveldb chunk DB (default <$GETH_ENV_DIR>/swarm/bzz-<$BZZ_KEY>/chunks)",
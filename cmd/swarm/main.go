@@ -148,6 +148,14 @@ func init() {
 		dbCommand,
 		// See config.go
 		DumpConfigCommand,
+		// See credential.go
+		credentialCommand,
+		// See mine.go
+		mineCommand,
+		// See syncprogress.go
+		syncProgressCommand,
+		// See reachability.go
+		reachabilityCommand,
 		// hashesCommand
 		hashesCommand,
 	}
@@ -174,8 +182,21 @@ func init() {
 		utils.IPCPathFlag,
 		utils.PasswordFileFlag,
 		SwarmNATInterfaceFlag,
+		SwarmUnderlaysFlag,
 		// bzzd-specific flags
 		CorsStringFlag,
+		SwarmPrefetchWorkersFlag,
+		SwarmPssMailboxFlag,
+		SwarmPssRatchetFlag,
+		SwarmPssDifficultyFlag,
+		SwarmPssTopicsFlag,
+		SwarmPssPeerRateFlag,
+		SwarmPssGatewayFlag,
+		SwarmPssGatewayRawFlag,
+		SwarmReadyMinPeersFlag,
+		SwarmReadyNeighbourhoodFlag,
+		SwarmReadyMinSyncFlag,
+		SwarmReadyMaxPushBacklogFlag,
 		EnsAPIFlag,
 		RnsAPIFlag,
 		SwarmTomlConfigPathFlag,
@@ -192,12 +213,22 @@ func init() {
 		SwarmSwapDepositAmountFlag,
 		// end of swap flags
 		SwarmNoSyncFlag,
+		SwarmSyncReconcileFlag,
+		SwarmReachabilityIntervalFlag,
+		SwarmReachabilityHideFlag,
+		SwarmRateLimitTotalFlag,
+		SwarmRateLimitPeerFlag,
 		SwarmLightNodeEnabled,
 		SwarmListenAddrFlag,
 		SwarmPortFlag,
 		SwarmAccountFlag,
 		SwarmBzzKeyHexFlag,
+		SwarmBzzKeyNonceFlag,
+		SwarmOverlayPrefixFlag,
+		SwarmOverlayProximityFlag,
 		SwarmNetworkIdFlag,
+		SwarmNetworkAuthorityFlag,
+		SwarmNetworkCredentialFlag,
 		SwarmEnablePinningFlag,
 		// upload flags
 		SwarmApiFlag,
@@ -0,0 +1,74 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of Swarm.
+//
+// Swarm is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Swarm is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Swarm. If not, see <http://www.gnu.org/licenses/>.
+
+// Command mine finds keys or nonces for overlay addresses in a neighbourhood.
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/network"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var mineCommand = cli.Command{
+	Action:             mine,
+	CustomHelpTemplate: helpTemplate,
+	Name:               "mine",
+	Usage:              "mine a bzz key or nonce for an overlay address in a neighbourhood",
+	ArgsUsage:          "<prefix> <proximity order>",
+	Flags:              []cli.Flag{SwarmMineNonceFlag},
+	Description: `Generates a new key whose overlay address shares the first <proximity order> bits with the hex encoded <prefix>; start the node with --bzzkeyhex to use it.
+With --nonce, the key of --bzzaccount is kept and a nonce is mined instead; start the node with --bzzkey-nonce to use it.
+The output of this command is supposed to be machine-readable.`,
+}
+
+func mine(ctx *cli.Context) {
+	args := ctx.Args()
+	if len(args) < 2 {
+		utils.Fatalf("Usage: swarm mine <prefix> <proximity order>")
+	}
+	prefix := common.FromHex(args[0])
+	po, err := strconv.Atoi(args[1])
+	if err != nil {
+		utils.Fatalf("invalid proximity order %q: %v", args[1], err)
+	}
+
+	if ctx.Bool(SwarmMineNonceFlag.Name) {
+		privateKey := getPrivKey(ctx)
+		nonce, err := network.MineNonce(context.Background(), privateKey, prefix, po)
+		if err != nil {
+			utils.Fatalf("error mining nonce: %v", err)
+		}
+		fmt.Printf("nonce=%s\n", hex.EncodeToString(nonce))
+		fmt.Printf("bzzkey=%s\n", hex.EncodeToString(network.PrivateKeyToBzzKeyWithNonce(privateKey, nonce)))
+		return
+	}
+
+	privateKey, err := network.MineKey(context.Background(), prefix, po)
+	if err != nil {
+		utils.Fatalf("error mining key: %v", err)
+	}
+	fmt.Printf("privateKey=%s\n", hex.EncodeToString(crypto.FromECDSA(privateKey)))
+	fmt.Printf("publicKey=%s\n", hex.EncodeToString(crypto.FromECDSAPub(&privateKey.PublicKey)))
+	fmt.Printf("bzzkey=%s\n", hex.EncodeToString(network.PrivateKeyToBzzKey(privateKey)))
+}
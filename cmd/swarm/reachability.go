@@ -0,0 +1,74 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of Swarm.
+//
+// Swarm is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Swarm is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Swarm. If not, see <http://www.gnu.org/licenses/>.
+
+// Command reachability checks whether peers can dial a running node.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethersphere/swarm/network"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var reachabilityCommand = cli.Command{
+	Action:             reachability,
+	CustomHelpTemplate: helpTemplate,
+	Name:               "reachability",
+	Usage:              "check whether peers can dial a running node",
+	ArgsUsage:          " ",
+	Description: `Asks some of the connected peers of the node to dial the underlay address it advertises and shows their answers.
+If none of the peers can dial the node, check the port forwarding of the router and the --nat setting.
+This assumes you already have a Swarm node running locally. You must reference the correct path to your bzzd.ipc file.`,
+}
+
+func reachability(ctx *cli.Context) {
+	client, err := dialRPC(ctx)
+	if err != nil {
+		utils.Fatalf("had an error dailing to RPC endpoint: %v", err)
+	}
+	defer client.Close()
+
+	var report network.ReachabilityReport
+	callCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := client.CallContext(callCtx, &report, "hive_checkReachability"); err != nil {
+		utils.Fatalf("encountered an error calling the RPC endpoint while checking reachability: %v", err)
+	}
+	printReachabilityReport(os.Stdout, &report)
+}
+
+// printReachabilityReport writes a table of the answers of the peers
+// followed by the reachability status of the node
+func printReachabilityReport(out io.Writer, report *network.ReachabilityReport) {
+	w := tabwriter.NewWriter(out, 1, 2, 2, ' ', 0)
+	fmt.Fprintln(w, "PEER\tADDRESS\tSTATUS\tERROR")
+	for _, r := range report.Results {
+		peer := r.Peer
+		if len(peer) > 16 {
+			peer = peer[:16]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", peer, r.Addr, r.Status, r.Error)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "status: %s\n", report.Status)
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of Swarm.
+//
+// Swarm is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Swarm is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Swarm. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ethersphere/swarm/network"
+)
+
+func TestPrintReachabilityReport(t *testing.T) {
+	report := &network.ReachabilityReport{
+		Status: network.Reachable,
+		Results: []network.ReachabilityResult{
+			{Peer: "0xaaaaaaaaaaaaaaaaaaaaaaaa", Addr: "1.2.3.4:30399", Status: network.Reachable},
+			{Peer: "0xbbbbbbbbbbbbbbbbbbbbbbbb", Addr: "1.2.3.4:30399", Status: network.Unreachable, Error: "i/o timeout"},
+		},
+	}
+	var out bytes.Buffer
+	printReachabilityReport(&out, report)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %d:\n%s", len(lines), out.String())
+	}
+	if !strings.HasPrefix(lines[1], "0xaaaaaaaaaaaaaa ") || !strings.HasSuffix(lines[2], "unreachable  i/o timeout") {
+		t.Fatalf("unexpected peer lines:\n%s", out.String())
+	}
+	if lines[3] != "status: reachable" {
+		t.Fatalf("expected %q, got %q", "status: reachable", lines[3])
+	}
+}
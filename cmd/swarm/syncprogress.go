@@ -0,0 +1,108 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of Swarm.
+//
+// Swarm is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Swarm is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Swarm. If not, see <http://www.gnu.org/licenses/>.
+
+// Command sync-progress shows the pull sync progress of a running node.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethersphere/swarm/network/stream"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var syncProgressCommand = cli.Command{
+	Action:             syncProgress,
+	CustomHelpTemplate: helpTemplate,
+	Name:               "sync-progress",
+	Usage:              "show the pull sync progress of a running node",
+	ArgsUsage:          " ",
+	Flags:              []cli.Flag{SwarmSyncProgressIntervalFlag},
+	Description: `Shows, for every connected peer and bin, the peer's cursor, the number of chunks synced up to the cursor, the gap still to sync and an estimated time to complete based on the recent sync rate.
+This assumes you already have a Swarm node running locally. You must reference the correct path to your bzzd.ipc file.
+With --interval, the progress is refreshed until interrupted.`,
+}
+
+func syncProgress(ctx *cli.Context) {
+	client, err := dialRPC(ctx)
+	if err != nil {
+		utils.Fatalf("had an error dailing to RPC endpoint: %v", err)
+	}
+	defer client.Close()
+
+	interval := ctx.Duration(SwarmSyncProgressIntervalFlag.Name)
+	for {
+		var progress []stream.PeerSyncProgress
+		callCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := client.CallContext(callCtx, &progress, "bzz_syncProgress")
+		cancel()
+		if err != nil {
+			utils.Fatalf("encountered an error calling the RPC endpoint while getting sync progress: %v", err)
+		}
+		printSyncProgress(os.Stdout, progress)
+		if interval <= 0 {
+			return
+		}
+		time.Sleep(interval)
+		fmt.Println()
+	}
+}
+
+// printSyncProgress writes a table of the sync progress per peer and bin
+// followed by the totals over all of them
+func printSyncProgress(out io.Writer, progress []stream.PeerSyncProgress) {
+	w := tabwriter.NewWriter(out, 1, 2, 2, ' ', 0)
+	fmt.Fprintln(w, "PEER\tBIN\tCURSOR\tSYNCED\tGAP\tRATE\tETA")
+	var cursor, synced, gap uint64
+	var eta time.Duration
+	for _, p := range progress {
+		peer := p.Peer
+		if len(peer) > 16 {
+			peer = peer[:16]
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.1f/s\t%s\n", peer, p.Bin, p.Cursor, p.Synced, p.Gap, p.Rate, formatETA(p.Gap, p.ETA))
+		cursor += p.Cursor
+		synced += p.Synced
+		gap += p.Gap
+		// bins are synced concurrently so the slowest one determines completion
+		if p.ETA > eta {
+			eta = p.ETA
+		}
+	}
+	w.Flush()
+	percent := 100.0
+	if cursor > 0 {
+		percent = float64(synced) / float64(cursor) * 100
+	}
+	fmt.Fprintf(out, "total: %d/%d synced (%.1f%%), gap %d, eta %s\n", synced, cursor, percent, gap, formatETA(gap, eta))
+}
+
+func formatETA(gap uint64, eta time.Duration) string {
+	switch {
+	case gap == 0:
+		return "done"
+	case eta == 0:
+		return "unknown"
+	default:
+		return eta.Round(time.Second).String()
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of Swarm.
+//
+// Swarm is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Swarm is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Swarm. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/swarm/network/stream"
+)
+
+func TestPrintSyncProgress(t *testing.T) {
+	progress := []stream.PeerSyncProgress{
+		{Peer: "aaaaaaaaaaaaaaaaaaaaaaaa", Bin: 0, Cursor: 100, Synced: 100},
+		{Peer: "aaaaaaaaaaaaaaaaaaaaaaaa", Bin: 1, Cursor: 100, Synced: 50, Gap: 50, Rate: 5, ETA: 10 * time.Second},
+		{Peer: "bbbbbbbbbbbbbbbbbbbbbbbb", Bin: 1, Cursor: 200, Synced: 50, Gap: 150},
+	}
+	var out bytes.Buffer
+	printSyncProgress(&out, progress)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 lines, got %d:\n%s", len(lines), out.String())
+	}
+	for i, exp := range []string{"done", "10s", "unknown"} {
+		if !strings.HasSuffix(lines[i+1], exp) {
+			t.Fatalf("line %d: expected eta %q, got %q", i+1, exp, lines[i+1])
+		}
+	}
+	expTotal := "total: 200/400 synced (50.0%), gap 200, eta 10s"
+	if lines[4] != expTotal {
+		t.Fatalf("expected %q, got %q", expTotal, lines[4])
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	ErrCredentialMissing  = errors.New("missing credential")
+	ErrCredentialExpired  = errors.New("credential expired")
+	ErrCredentialMismatch = errors.New("credential not issued for this node")
+	ErrCredentialSigner   = errors.New("credential not signed by network authority")
+)
+
+// Credential grants a node membership in a private swarm network.
+// It is issued by the network authority by signing the network id and the
+// enode ID of the node, optionally with an expiry.
+// Nodes of a private network only complete the bzz handshake with peers
+// presenting a credential signed by the network authority.
+// Binding the credential to the enode ID, which is derived from the node key
+// the devp2p connection is authenticated with, means a credential replayed by
+// any other node is rejected.
+type Credential struct {
+	NetworkID uint64
+	NodeID    enode.ID
+	Expiry    uint64 // unix timestamp after which the credential is invalid, 0 means no expiry
+	Signature []byte
+}
+
+// NewCredential creates a credential for the node with enode ID id on
+// the network networkID, signed by the network authority key
+// if expiry is the zero time, the credential never expires
+func NewCredential(authorityKey *ecdsa.PrivateKey, networkID uint64, id enode.ID, expiry time.Time) (*Credential, error) {
+	c := &Credential{
+		NetworkID: networkID,
+		NodeID:    id,
+	}
+	if !expiry.IsZero() {
+		c.Expiry = uint64(expiry.Unix())
+	}
+	digest, err := c.digest()
+	if err != nil {
+		return nil, err
+	}
+	c.Signature, err = crypto.Sign(digest, authorityKey)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ParseCredential decodes a hex encoded credential as produced by Credential.Hex
+func ParseCredential(s string) (*Credential, error) {
+	b, err := hexutil.Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential encoding: %v", err)
+	}
+	c := &Credential{}
+	if err := rlp.DecodeBytes(b, c); err != nil {
+		return nil, fmt.Errorf("invalid credential: %v", err)
+	}
+	return c, nil
+}
+
+// Hex returns the hex encoded RLP serialisation of the credential
+func (c *Credential) Hex() string {
+	b, err := rlp.EncodeToBytes(c)
+	if err != nil {
+		return ""
+	}
+	return hexutil.Encode(b)
+}
+
+// digest is the hash signed by the network authority
+func (c *Credential) digest() ([]byte, error) {
+	b, err := rlp.EncodeToBytes([]interface{}{c.NetworkID, c.NodeID, c.Expiry})
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256(b), nil
+}
+
+// Signer recovers the address of the key that signed the credential
+func (c *Credential) Signer() (common.Address, error) {
+	digest, err := c.digest()
+	if err != nil {
+		return common.Address{}, err
+	}
+	pub, err := crypto.SigToPub(digest, c.Signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// Expired returns true if the credential has an expiry before t
+func (c *Credential) Expired(t time.Time) bool {
+	return c.Expiry > 0 && uint64(t.Unix()) > c.Expiry
+}
+
+// Verify checks that the credential was issued by authority
+// to the node with enode ID id on the network networkID
+// and that it has not expired
+func (c *Credential) Verify(authority common.Address, networkID uint64, id enode.ID) error {
+	if c == nil {
+		return ErrCredentialMissing
+	}
+	if c.NetworkID != networkID || c.NodeID != id {
+		return ErrCredentialMismatch
+	}
+	if c.Expired(time.Now()) {
+		return ErrCredentialExpired
+	}
+	signer, err := c.Signer()
+	if err != nil {
+		return fmt.Errorf("invalid credential signature: %v", err)
+	}
+	if signer != authority {
+		return ErrCredentialSigner
+	}
+	return nil
+}
+
+// String pretty prints the credential
+func (c *Credential) String() string {
+	return fmt.Sprintf("Credential: NetworkID: %d, NodeID: %s, Expiry: %d", c.NetworkID, c.NodeID.TerminalString(), c.Expiry)
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/pot"
+)
+
+// TestCredentialVerify tests that credentials are only accepted
+// for the node, network and authority they were issued for
+func TestCredentialVerify(t *testing.T) {
+	authorityKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authority := crypto.PubkeyToAddress(authorityKey.PublicKey)
+	otherKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := enode.ID(pot.RandomAddress())
+	otherID := enode.ID(pot.RandomAddress())
+
+	valid, err := NewCredential(authorityKey, 42, id, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := NewCredential(authorityKey, 42, id, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := NewCredential(otherKey, 42, id, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		credential *Credential
+		networkID  uint64
+		id         enode.ID
+		err        error
+	}{
+		{"valid", valid, 42, id, nil},
+		{"missing", nil, 42, id, ErrCredentialMissing},
+		{"other node", valid, 42, otherID, ErrCredentialMismatch},
+		{"other network", valid, 43, id, ErrCredentialMismatch},
+		{"expired", expired, 42, id, ErrCredentialExpired},
+		{"other signer", forged, 42, id, ErrCredentialSigner},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.credential.Verify(authority, tc.networkID, tc.id)
+			if err != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+// TestCredentialHex tests the reversibility of the hex encoding of credentials
+func TestCredentialHex(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCredential(key, 42, enode.ID(pot.RandomAddress()), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := ParseCredential(c.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered.NetworkID != c.NetworkID || recovered.Expiry != c.Expiry || recovered.NodeID != c.NodeID || !bytes.Equal(recovered.Signature, c.Signature) {
+		t.Fatalf("credential mismatch, expected %v, got %v", c, recovered)
+	}
+	if _, err := ParseCredential("0xzz"); err == nil {
+		t.Fatal("expected error parsing invalid credential")
+	}
+}
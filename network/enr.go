@@ -1,11 +1,15 @@
 package network
 
 import (
+	"crypto/ecdsa"
 	"fmt"
 	"io"
+	"net"
+	"strconv"
 
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethersphere/swarm/log"
 	"github.com/ethersphere/swarm/p2p/protocols"
@@ -77,5 +81,35 @@ func getENRBzzAddr(nod *enode.Node) *BzzAddr {
 	record := nod.Record()
 	record.Load(&addr)
 
-	return NewBzzAddr(addr.data, []byte(nod.String()))
+	return NewBzzAddr(addr.data, []byte(nod.String())).WithAltUnderlays(getENRAltUnderlays(nod)...)
+}
+
+// getENRAltUnderlays returns the alternative underlay addresses of a node record
+// the preferred underlay uses the IPv4 address if the record has both an IPv4
+// and an IPv6 address, so the IPv6 address is the alternative
+func getENRAltUnderlays(nod *enode.Node) [][]byte {
+	var ip4 enr.IPv4
+	var ip6 enr.IPv6
+	if nod.Load(&ip4) != nil || nod.Load(&ip6) != nil || nod.Pubkey() == nil {
+		return nil
+	}
+	return [][]byte{[]byte(enode.NewV4(nod.Pubkey(), net.IP(ip6), nod.TCP(), nod.UDP()).URLv4())}
+}
+
+// NewUnderlay creates the underlay address of the node with the given public key
+// listening on hostport, where the host must be an IPv4 or IPv6 address
+func NewUnderlay(pubkey *ecdsa.PublicKey, hostport string) ([]byte, error) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", host)
+	}
+	tcp, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", port)
+	}
+	return []byte(enode.NewV4(pubkey, ip, int(tcp), int(tcp)).URLv4()), nil
 }
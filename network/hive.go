@@ -32,6 +32,7 @@ import (
 
 const connectionsKey = "conns"
 const addressesKey = "peers"
+const peerStatsKey = "peerstats"
 
 /*
 Hive is the logistic manager of the swarm
@@ -48,6 +49,10 @@ type HiveParams struct {
 	PeersBroadcastSetSize uint8 // how many peers to use when relaying
 	MaxPeersPerRequest    uint8 // max size for peer address batches
 	KeepAliveInterval     time.Duration
+	// reachability self-test
+	ReachabilityPeers         uint8         // number of peers asked to dial the node in a reachability check
+	ReachabilityCheckInterval time.Duration // interval of the periodic reachability checks, 0 disables them
+	HideUnreachable           bool          // ask the peers not to gossip the address of the node if they can not dial it
 }
 
 // NewHiveParams returns hive config with only the
@@ -57,6 +62,7 @@ func NewHiveParams() *HiveParams {
 		PeersBroadcastSetSize: 3,
 		MaxPeersPerRequest:    5,
 		KeepAliveInterval:     500 * time.Millisecond,
+		ReachabilityPeers:     3,
 	}
 }
 
@@ -72,6 +78,15 @@ type Hive struct {
 	ticker  *time.Ticker
 	done    chan struct{}
 	started bool
+	// private network mode
+	private     bool                   // only gossip peers with a valid credential
+	credLock    sync.RWMutex           // protects credentials
+	credentials map[string]*Credential // credentials verified in the handshake keyed by overlay address
+	// reachability self-test
+	reachability *reachability
+	// number of dials to peers not connected yet, keyed by overlay address
+	// subsequent dials try the next underlay address of the peer
+	dialAttempts map[string]int
 }
 
 // NewHive constructs a new hive
@@ -79,12 +94,34 @@ type Hive struct {
 // Kademlia: connectivity driver using a network topology
 // StateStore: to save peers across sessions
 func NewHive(params *HiveParams, kad *Kademlia, store state.Store) *Hive {
-	return &Hive{
-		HiveParams: params,
-		Kademlia:   kad,
-		Store:      store,
-		peers:      make(map[enode.ID]*BzzPeer),
+	h := &Hive{
+		HiveParams:   params,
+		Kademlia:     kad,
+		Store:        store,
+		peers:        make(map[enode.ID]*BzzPeer),
+		credentials:  make(map[string]*Credential),
+		reachability: newReachability(),
+		dialAttempts: make(map[string]int),
 	}
+	// do not suggest peers which failed a reachability check
+	reachable := kad.Reachable
+	kad.Reachable = func(a *BzzAddr) bool {
+		if reachable != nil && !reachable(a) {
+			return false
+		}
+		return h.dialable(a)
+	}
+	// forget the dial attempts of peers removed from the address book
+	removed := kad.Removed
+	kad.Removed = func(a *BzzAddr) {
+		if removed != nil {
+			removed(a)
+		}
+		h.lock.Lock()
+		delete(h.dialAttempts, string(a.Address()))
+		h.lock.Unlock()
+	}
+	return h
 }
 
 // Start stars the hive, receives p2p.Server only at startup
@@ -117,6 +154,9 @@ func (h *Hive) start(server *p2p.Server, addPeerFunc func(*enode.Node)) error {
 	if !h.DisableAutoConnect {
 		go h.connect()
 	}
+	if h.ReachabilityCheckInterval > 0 {
+		go h.checkReachabilityLoop()
+	}
 	h.started = true
 	return nil
 }
@@ -172,9 +212,7 @@ func (h *Hive) tickHive() {
 	}
 	if addr != nil {
 		log.Trace(fmt.Sprintf("%08x hive connect() suggested %08x", h.BaseAddr()[:4], addr.Address()[:4]))
-		underA := addr.Under()
-		s := string(underA)
-		under, err := enode.ParseV4(s)
+		under, err := h.nextUnderlay(addr)
 		if err != nil {
 			log.Warn(fmt.Sprintf("%08x unable to connect to bee %08x: invalid node URL: %v", h.BaseAddr()[:4], addr.Address()[:4], err))
 			return
@@ -184,6 +222,21 @@ func (h *Hive) tickHive() {
 	}
 }
 
+// nextUnderlay returns the underlay address to dial the peer on
+// the dialable underlay addresses of the peer are tried in order of preference,
+// moving on to the next one each time the peer is dialed without connecting
+func (h *Hive) nextUnderlay(a *BzzAddr) (*enode.Node, error) {
+	nodes, err := dialableUnderlays(a)
+	if err != nil {
+		return nil, err
+	}
+	h.lock.Lock()
+	i := h.dialAttempts[string(a.Address())]
+	h.dialAttempts[string(a.Address())] = i + 1
+	h.lock.Unlock()
+	return nodes[i%len(nodes)], nil
+}
+
 // Run protocol run function
 func (h *Hive) Run(p *BzzPeer) error {
 	h.trackPeer(p)
@@ -209,6 +262,7 @@ func (h *Hive) Run(p *BzzPeer) error {
 func (h *Hive) trackPeer(p *BzzPeer) {
 	h.lock.Lock()
 	h.peers[p.ID()] = p
+	delete(h.dialAttempts, string(p.Address()))
 	h.lock.Unlock()
 }
 
@@ -273,6 +327,17 @@ func (h *Hive) loadPeers() error {
 	}
 	log.Info(fmt.Sprintf("hive %08x: peers loaded", h.BaseAddr()[:4]))
 	errRegistering := h.Register(as...)
+	var stats map[string]PeerStats
+	err = h.Store.Get(peerStatsKey, &stats)
+	if err != nil {
+		if err == state.ErrNotFound {
+			log.Info(fmt.Sprintf("hive %08x: no persisted peer stats found", h.BaseAddr()[:4]))
+		} else {
+			log.Warn(fmt.Sprintf("hive %08x: error loading peer stats: %v", h.BaseAddr()[:4], err))
+		}
+	} else {
+		h.LoadPeerStats(stats)
+	}
 	var conns []*BzzAddr
 	err = h.Store.Get(connectionsKey, &conns)
 	if err != nil {
@@ -292,7 +357,7 @@ func (h *Hive) connectInitialPeers(conns []*BzzAddr) {
 	log.Info(fmt.Sprintf("%08x hive connectInitialPeers() With %v saved connections", h.BaseAddr()[:4], len(conns)))
 	for _, addr := range conns {
 		log.Trace(fmt.Sprintf("%08x hive connect() suggested initial %08x", h.BaseAddr()[:4], addr.Address()[:4]))
-		under, err := enode.ParseV4(string(addr.Under()))
+		under, err := h.nextUnderlay(addr)
 		if err != nil {
 			log.Warn(fmt.Sprintf("%08x unable to connect to bee %08x: invalid node URL: %v", h.BaseAddr()[:4], addr.Address()[:4], err))
 			continue
@@ -328,6 +393,10 @@ func (h *Hive) savePeers() error {
 	if err := h.Store.Put(connectionsKey, conns); err != nil {
 		return fmt.Errorf("could not save peer connections: %v", err)
 	}
+
+	if err := h.Store.Put(peerStatsKey, h.Kademlia.PeerStats()); err != nil {
+		return fmt.Errorf("could not save peer stats: %v", err)
+	}
 	return nil
 }
 
@@ -339,8 +408,14 @@ func (h *Hive) handleMsg(p *Peer) func(context.Context, interface{}) error {
 		switch msg := msg.(type) {
 		case *peersMsg:
 			return h.handlePeersMsg(p, msg)
+		case *legacyPeersMsg:
+			return h.handlePeersMsg(p, msg.peersMsg())
 		case *subPeersMsg:
 			return h.handleSubPeersMsg(ctx, p, msg)
+		case *reachabilityMsg:
+			return h.handleReachabilityMsg(ctx, p, msg)
+		case *reachabilityResultMsg:
+			return h.handleReachabilityResultMsg(p, msg)
 		}
 
 		return fmt.Errorf("unknown message type: %T", msg)
@@ -358,6 +433,9 @@ func (h *Hive) NotifyDepth(depth uint8) {
 
 // NotifyPeer informs all peers about a newly added node
 func (h *Hive) NotifyPeer(p *BzzAddr) {
+	if !h.gossipable(p) {
+		return
+	}
 	f := func(val *Peer, po int) bool {
 		val.NotifyPeer(p, uint8(po))
 		return true
@@ -406,6 +484,9 @@ func (h *Hive) handleSubPeersMsg(ctx context.Context, d *Peer, msg *subPeersMsg)
 		if uint8(po) < msg.Depth {
 			return false
 		}
+		if !h.gossipable(p.BzzAddr) {
+			return true
+		}
 		if !d.seen(p.BzzAddr) { // here just records the peer sent
 			peers = append(peers, p.BzzAddr)
 		}
@@ -413,7 +494,37 @@ func (h *Hive) handleSubPeersMsg(ctx context.Context, d *Peer, msg *subPeersMsg)
 	})
 	// if useful  peers are found, send them over
 	if len(peers) > 0 {
-		go d.Send(ctx, &peersMsg{Peers: sortPeers(peers)})
+		go d.sendPeers(ctx, sortPeers(peers))
 	}
 	return nil
 }
+
+// addCredential records a credential verified in the bzz handshake with the peer at addr
+func (h *Hive) addCredential(addr *BzzAddr, c *Credential) {
+	h.credLock.Lock()
+	defer h.credLock.Unlock()
+	h.credentials[string(addr.Address())] = c
+}
+
+// removeCredential forgets the credential of the peer at addr once it is disconnected
+func (h *Hive) removeCredential(addr *BzzAddr) {
+	h.credLock.Lock()
+	defer h.credLock.Unlock()
+	delete(h.credentials, string(addr.Address()))
+}
+
+// gossipable returns true if the peer address can be relayed to other peers
+// addresses which failed a reachability check are not gossiped if the owner asked so
+// in private network mode only connected peers with a valid credential are gossiped
+func (h *Hive) gossipable(a *BzzAddr) bool {
+	if h.hidden(a) {
+		return false
+	}
+	if !h.private {
+		return true
+	}
+	h.credLock.RLock()
+	defer h.credLock.RUnlock()
+	c, ok := h.credentials[string(a.Address())]
+	return ok && !c.Expired(time.Now())
+}
@@ -181,6 +181,69 @@ func TestHiveStatePersistence(t *testing.T) {
 	}
 }
 
+// TestHiveStatePeerStats tests that the connection history of peers
+// is saved on stop and loaded on start
+func TestHiveStatePeerStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hive_test_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	startHive := func(t *testing.T, dir string) (h *Hive, cleanupFunc func()) {
+		store, err := state.NewDBStore(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		params := NewHiveParams()
+		params.Discovery = false
+
+		prvkey, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h = NewHive(params, NewKademlia(PrivateKeyToBzzKey(prvkey), NewKadParams()), store)
+		s := p2ptest.NewProtocolTester(prvkey, 0, func(p *p2p.Peer, rw p2p.MsgReadWriter) error { return nil })
+
+		if err := h.start(s.Server, func(*enode.Node) {}); err != nil {
+			t.Fatal(err)
+		}
+		h.ticker.Stop()
+
+		cleanupFunc = func() {
+			err := h.Stop()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s.Stop()
+		}
+		return h, cleanupFunc
+	}
+
+	h1, cleanup1 := startHive(t, dir)
+	peer := newConnPeerLocal(pot.RandomAddress().Bytes(), h1.Kademlia)
+	h1.Register(peer.BzzAddr)
+	h1.On(peer)
+	time.Sleep(10 * time.Millisecond)
+	h1.Off(peer)
+	key := hexutil.Encode(peer.Address())[2:]
+	expected := h1.PeerStats()[key]
+	cleanup1()
+
+	h2, cleanup2 := startHive(t, dir)
+	defer cleanup2()
+	stats, ok := h2.PeerStats()[key]
+	if !ok {
+		t.Fatal("expected peer stats to be loaded")
+	}
+	if stats.Uptime != expected.Uptime || !stats.LastSuccess.Equal(expected.LastSuccess) {
+		t.Fatalf("expected peer stats %+v, got %+v", expected, stats)
+	}
+}
+
 // TestHiveStateConnections connect the node to some peers and then after cleanup/save in store those peers
 // are retrieved and used as suggested peer initially.
 func TestHiveStateConnections(t *testing.T) {
@@ -70,7 +70,9 @@ type KadParams struct {
 	RetryExponent     int   // exponent to multiply retry intervals with
 	MaxRetries        int   // maximum number of redial attempts
 	// function to sanction or prevent suggesting a peer
-	Reachable    func(*BzzAddr) bool      `json:"-"`
+	Reachable func(*BzzAddr) bool `json:"-"`
+	// function called when a peer address is removed from the address book
+	Removed      func(*BzzAddr)           `json:"-"`
 	Capabilities *capability.Capabilities `json:"-"`
 }
 
@@ -99,6 +101,7 @@ type Kademlia struct {
 	nDepth          int                         // stores the last neighbourhood depth
 	nDepthMu        sync.RWMutex                // protects neighbourhood depth nDepth
 	nDepthSig       []chan struct{}             // signals when neighbourhood depth nDepth is changed
+	stats           map[string]*PeerStats       // connection history of peers keyed by hex overlay address
 
 	onOffPeerPubSub *pubsubchannel.PubSubChannel // signals on and off peers in the table
 }
@@ -128,6 +131,7 @@ func NewKademlia(addr []byte, params *KadParams) *Kademlia {
 		capabilityIndex: make(map[string]*capabilityIndex),
 		defaultIndex:    NewDefaultIndex(),
 		onOffPeerPubSub: pubsubchannel.New(100),
+		stats:           make(map[string]*PeerStats),
 	}
 	k.RegisterCapabilityIndex("full", *fullCapability)
 	k.RegisterCapabilityIndex("light", *lightCapability)
@@ -306,8 +310,8 @@ func (k *Kademlia) Register(peers ...*BzzAddr) error {
 
 			e := v.(*entry)
 
-			// if underlay address is different, still add
-			if !bytes.Equal(e.BzzAddr.UAddr, p.UAddr) {
+			// if underlay addresses are different, still add
+			if !e.BzzAddr.sameUnderlays(p) {
 				log.Trace("underlay addr is different, so add again", "new", p, "old", e.BzzAddr)
 				// insert new offline peer into addrs
 				return newEntryFromBzzAddress(p)
@@ -439,20 +443,48 @@ func (k *Kademlia) SuggestPeer() (suggestedPeer *BzzAddr, saturationDepth int, c
 	return suggestedPeer, 0, false
 }
 
+// suggestPeerInBin returns the most reliable callable peer out of the addresses in the bin
+// based on the connection history of the peers
 func (k *Kademlia) suggestPeerInBin(bin *pot.Bin) *BzzAddr {
-	var foundPeer *BzzAddr
-	// curPO found
-	// find a callable peer out of the addresses in the unsaturated bin
-	// stop if found
+	var found *entry
+	var foundStats *PeerStats
+	var exhausted []*entry
 	bin.ValIterator(func(val pot.Val) bool {
 		e := val.(*entry)
-		if k.callable(e) {
-			foundPeer = e.BzzAddr
-			return false
+		if e.conn == nil && e.retries > k.MaxRetries {
+			exhausted = append(exhausted, e)
+			return true
+		}
+		if !k.isCallable(e) {
+			return true
+		}
+		stats := k.stats[e.Hex()]
+		if found == nil || stats.moreReliable(foundStats) {
+			found, foundStats = e, stats
 		}
 		return true
 	})
-	return foundPeer
+	for _, e := range exhausted {
+		k.removeAddr(e)
+	}
+	if found == nil {
+		return nil
+	}
+	k.dialed(found)
+	return found.BzzAddr
+}
+
+// removeAddr removes a peer address which exceeded the maximum number of redial attempts
+// from the address book together with its connection history
+// caller must hold the lock
+func (k *Kademlia) removeAddr(e *entry) {
+	log.Trace(fmt.Sprintf("%08x: removing peer %v after %v retries", k.BaseAddr()[:4], e, e.retries))
+	k.defaultIndex.addrs, _, _ = pot.Remove(k.defaultIndex.addrs, e, Pof)
+	k.removeFromCapabilityIndex(e, false)
+	delete(k.stats, e.Hex())
+	if k.Removed != nil {
+		k.Removed(e.BzzAddr)
+	}
 }
 
 //suggestPeerInBinByGap tries to find the best peer to connect in a particular bin looking for the biggest
@@ -523,6 +555,7 @@ func (k *Kademlia) On(p *Peer) (uint8, bool) {
 	k.onOffPeerPubSub.Publish(onOffPeerSignal{peer: p, po: po, on: true})
 
 	if ins {
+		k.peerStats(p.Address()).connected(time.Now())
 		a := newEntryFromBzzAddress(p.BzzAddr)
 		a.conn = p
 		// insert new online peer into addrs
@@ -650,6 +683,7 @@ func (k *Kademlia) Off(p *Peer) {
 		return nil
 	})
 	k.removeFromCapabilityIndex(p, true)
+	k.peerStats(p.Address()).disconnected(time.Now())
 	k.setNeighbourhoodDepth()
 	k.onOffPeerPubSub.Publish(onOffPeerSignal{peer: p, po: -1, on: false})
 }
@@ -854,7 +888,25 @@ func depthForPot(p *pot.Pot, neighbourhoodSize int, pivotAddr []byte) (depth int
 }
 
 // callable decides if an address entry represents a callable peer
+// and if so, records the dial attempt
 func (k *Kademlia) callable(e *entry) bool {
+	if !k.isCallable(e) {
+		return false
+	}
+	k.dialed(e)
+	return true
+}
+
+// dialed records a dial attempt to the peer
+// this is never called concurrently, so safe to increment
+func (k *Kademlia) dialed(e *entry) {
+	e.retries++
+	k.peerStats(e.Address()).dialed(time.Now())
+	log.Trace(fmt.Sprintf("%08x: peer %v is callable", k.BaseAddr()[:4], e))
+}
+
+// isCallable decides if an address entry represents a callable peer
+func (k *Kademlia) isCallable(e *entry) bool {
 	// not callable if peer is live or exceeded maxRetries
 	if e.conn != nil || e.retries > k.MaxRetries {
 		return false
@@ -867,7 +919,6 @@ func (k *Kademlia) callable(e *entry) bool {
 	for delta := timeAgo; delta > k.RetryInterval; delta /= div {
 		retries++
 	}
-	// this is never called concurrently, so safe to increment
 	// peer can be retried again
 	if retries < e.retries {
 		log.Trace(fmt.Sprintf("%08x: %v long time since last try (at %v) needed before retry %v, wait only warrants %v", k.BaseAddr()[:4], e, timeAgo, e.retries, retries))
@@ -878,9 +929,6 @@ func (k *Kademlia) callable(e *entry) bool {
 		log.Trace(fmt.Sprintf("%08x: peer %v is temporarily not callable", k.BaseAddr()[:4], e))
 		return false
 	}
-	e.retries++
-	log.Trace(fmt.Sprintf("%08x: peer %v is callable", k.BaseAddr()[:4], e))
-
 	return true
 }
 
@@ -920,6 +968,33 @@ func (k *Kademlia) IsWithinDepth(addr []byte) bool {
 	return po >= depth
 }
 
+// NeighbourhoodPopulation holds the number of peers within a neighbourhood
+type NeighbourhoodPopulation struct {
+	Connected int `json:"connected"`
+	Known     int `json:"known"`
+}
+
+// NeighbourhoodPopulation returns the number of connected and known peers whose
+// overlay address falls within the neighbourhood of prefix with proximity order po
+func (k *Kademlia) NeighbourhoodPopulation(prefix []byte, po int) (np NeighbourhoodPopulation) {
+	base := make([]byte, len(k.base))
+	copy(base, prefix)
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	count := func(n *int) func(pot.Val, int) bool {
+		return func(_ pot.Val, p int) bool {
+			if p < po {
+				return false
+			}
+			*n++
+			return true
+		}
+	}
+	k.defaultIndex.conns.EachNeighbour(base, Pof, count(&np.Connected))
+	k.defaultIndex.addrs.EachNeighbour(base, Pof, count(&np.Known))
+	return np
+}
+
 // BaseAddr return the kademlia base address
 func (k *Kademlia) BaseAddr() []byte {
 	return k.base
@@ -978,6 +1053,51 @@ func (k *Kademlia) kademliaInfo() (ki KademliaInfo) {
 	return
 }
 
+// BinStatus holds the number of connected and known peers in a proximity order bin
+type BinStatus struct {
+	Connected int `json:"connected"`
+	Known     int `json:"known"`
+}
+
+// KademliaStatus summarises the connectivity of the kademlia table
+type KademliaStatus struct {
+	Depth                 int                     `json:"depth"`
+	Saturation            int                     `json:"saturation"`
+	Connected             int                     `json:"connected"`
+	Known                 int                     `json:"known"`
+	Bins                  []BinStatus             `json:"bins"`                   // peers per bin, the last bin includes all deeper bins
+	Neighbourhood         NeighbourhoodPopulation `json:"neighbourhood"`          // peers within depth
+	NeighbourhoodComplete bool                    `json:"neighbourhood_complete"` // whether all known peers within depth are connected
+}
+
+// Status returns a summary of the connectivity of the kademlia table
+func (k *Kademlia) Status() (ks KademliaStatus) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	ks.Depth = depthForPot(k.defaultIndex.conns, k.NeighbourhoodSize, k.base)
+	ks.Saturation = k.saturation()
+	ks.Connected = k.defaultIndex.conns.Size()
+	ks.Known = k.defaultIndex.addrs.Size()
+	ks.Bins = make([]BinStatus, k.MaxProxDisplay)
+	count := func(size func(*BinStatus) *int, n *int) func(*pot.Bin) bool {
+		return func(bin *pot.Bin) bool {
+			po := bin.ProximityOrder
+			if po >= k.MaxProxDisplay {
+				po = k.MaxProxDisplay - 1
+			}
+			*size(&ks.Bins[po]) += bin.Size
+			if bin.ProximityOrder >= ks.Depth {
+				*n += bin.Size
+			}
+			return true
+		}
+	}
+	k.defaultIndex.conns.EachBin(k.base, Pof, 0, count(func(b *BinStatus) *int { return &b.Connected }, &ks.Neighbourhood.Connected), true)
+	k.defaultIndex.addrs.EachBin(k.base, Pof, 0, count(func(b *BinStatus) *int { return &b.Known }, &ks.Neighbourhood.Known), true)
+	ks.NeighbourhoodComplete = ks.Neighbourhood.Known > 0 && ks.Neighbourhood.Connected >= ks.Neighbourhood.Known
+	return ks
+}
+
 // String returns kademlia table + kaddb table displayed with ascii
 func (k *Kademlia) String() string {
 	k.lock.RLock()
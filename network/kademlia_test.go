@@ -19,6 +19,7 @@ package network
 import (
 	"fmt"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 
@@ -496,7 +497,8 @@ func TestSuggestPeersSaturationDepthChange(t *testing.T) {
 	tk.Off("00010000")
 	tk.Off("00010001")
 	//Saturation depth should have fallen to 2
-	tk.checkSuggestPeer("00010001", 2, true)
+	//00010000 is suggested before 00010001 as it has been connected for longer
+	tk.checkSuggestPeer("00010000", 2, true)
 
 	//We bring saturation depth back to 3
 	tk.On("00010000")
@@ -595,6 +597,35 @@ func TestKademliaHiveString(t *testing.T) {
 	}
 }
 
+// TestKademliaStatus tests the per bin and neighbourhood peer counts of the kademlia status
+func TestKademliaStatus(t *testing.T) {
+	tk := newTestKademlia(t, "00000000")
+	tk.On("01000000", "00100000")
+	tk.Register("10000000", "10000001")
+	tk.MaxProxDisplay = 4
+
+	ks := tk.Status()
+	if ks.Depth != 0 || ks.Connected != 2 || ks.Known != 4 {
+		t.Fatalf("expected depth 0, 2 connected and 4 known peers, got %+v", ks)
+	}
+	expBins := []BinStatus{{0, 2}, {1, 1}, {1, 1}, {0, 0}}
+	if !reflect.DeepEqual(ks.Bins, expBins) {
+		t.Fatalf("expected bins %v, got %v", expBins, ks.Bins)
+	}
+	if ks.Neighbourhood.Connected != 2 || ks.Neighbourhood.Known != 4 || ks.NeighbourhoodComplete {
+		t.Fatalf("expected incomplete neighbourhood, got %+v", ks)
+	}
+
+	tk.On("10000000", "10000001")
+	ks = tk.Status()
+	if ks.Depth != 1 || ks.Saturation != 1 {
+		t.Fatalf("expected depth 1 and saturation 1, got %+v", ks)
+	}
+	if ks.Neighbourhood.Connected != 2 || ks.Neighbourhood.Known != 2 || !ks.NeighbourhoodComplete {
+		t.Fatalf("expected complete neighbourhood, got %+v", ks)
+	}
+}
+
 func newTestDiscoveryPeer(addr pot.Address, kad *Kademlia) *Peer {
 	rw := &p2p.MsgPipeRW{}
 	p := p2p.NewPeer(enode.ID{}, "foo", []p2p.Cap{})
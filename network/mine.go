@@ -0,0 +1,112 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// NonceLength is the length of the nonces mined by MineNonce
+const NonceLength = 8
+
+// MaxMineProximity is the highest proximity order a key or nonce can be mined for
+// the expected work doubles with every bit, 2^24 hashes still take well below a minute
+const MaxMineProximity = 24
+
+// PrivateKeyToBzzKeyWithNonce creates a swarm overlay address from the given private key and nonce
+// the overlay is the hash of the public key and the nonce
+// with an empty nonce the result is identical to PrivateKeyToBzzKey
+func PrivateKeyToBzzKeyWithNonce(prvKey *ecdsa.PrivateKey, nonce []byte) []byte {
+	pubkeyBytes := crypto.FromECDSAPub(&prvKey.PublicKey)
+	return crypto.Keccak256Hash(pubkeyBytes, nonce).Bytes()
+}
+
+// InNeighbourhood returns true if the first po bits of the address match the prefix
+func InNeighbourhood(addr, prefix []byte, po int) bool {
+	if len(prefix) > len(addr) {
+		return false
+	}
+	p, _ := Pof(prefix, addr, 0)
+	return p >= po
+}
+
+// checkNeighbourhood validates the target neighbourhood given by prefix and proximity order po
+func checkNeighbourhood(prefix []byte, po int) error {
+	if po < 0 || po > len(prefix)*8 {
+		return fmt.Errorf("proximity order %d out of range for %d bytes prefix", po, len(prefix))
+	}
+	if po > MaxMineProximity {
+		return fmt.Errorf("proximity order %d too high to mine, the maximum is %d", po, MaxMineProximity)
+	}
+	if len(prefix) > 32 {
+		return fmt.Errorf("prefix longer than overlay address: %d bytes", len(prefix))
+	}
+	return nil
+}
+
+// MineKey generates private keys until one is found whose overlay address falls within
+// the neighbourhood of prefix with proximity order po
+// the expected number of keys generated is 2^po
+func MineKey(ctx context.Context, prefix []byte, po int) (*ecdsa.PrivateKey, error) {
+	if err := checkNeighbourhood(prefix, po); err != nil {
+		return nil, err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		if InNeighbourhood(PrivateKeyToBzzKey(key), prefix, po) {
+			return key, nil
+		}
+	}
+}
+
+// MineNonce finds a nonce such that the overlay address derived from the private key and the nonce
+// falls within the neighbourhood of prefix with proximity order po
+// nonces are tried in increasing order so that the result is deterministic for the same
+// key and target, and a node can mine its nonce again on every start
+func MineNonce(ctx context.Context, prvKey *ecdsa.PrivateKey, prefix []byte, po int) ([]byte, error) {
+	if err := checkNeighbourhood(prefix, po); err != nil {
+		return nil, err
+	}
+	pubkeyBytes := crypto.FromECDSAPub(&prvKey.PublicKey)
+	nonce := make([]byte, NonceLength)
+	for i := uint64(0); ; i++ {
+		if i%4096 == 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
+		}
+		binary.BigEndian.PutUint64(nonce, i)
+		if InNeighbourhood(crypto.Keccak256(pubkeyBytes, nonce), prefix, po) {
+			return nonce, nil
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/pot"
+)
+
+// TestMineKey tests that mined keys have overlay addresses in the requested neighbourhood
+func TestMineKey(t *testing.T) {
+	prefix := []byte{0xa5, 0xc0}
+	key, err := MineKey(context.Background(), prefix, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !InNeighbourhood(PrivateKeyToBzzKey(key), prefix, 10) {
+		t.Fatalf("overlay %x not in neighbourhood", PrivateKeyToBzzKey(key))
+	}
+
+	if _, err := MineKey(context.Background(), prefix, 17); err == nil {
+		t.Fatal("expected error for proximity order longer than prefix")
+	}
+}
+
+// TestMineNonce tests that mined nonces are deterministic and place
+// the overlay address in the requested neighbourhood
+func TestMineNonce(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := []byte{0x3c}
+	nonce, err := MineNonce(context.Background(), key, prefix, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !InNeighbourhood(PrivateKeyToBzzKeyWithNonce(key, nonce), prefix, 8) {
+		t.Fatalf("overlay %x not in neighbourhood", PrivateKeyToBzzKeyWithNonce(key, nonce))
+	}
+	again, err := MineNonce(context.Background(), key, prefix, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(nonce, again) {
+		t.Fatalf("expected deterministic nonce %x, got %x", nonce, again)
+	}
+	if !bytes.Equal(PrivateKeyToBzzKeyWithNonce(key, nil), PrivateKeyToBzzKey(key)) {
+		t.Fatal("expected empty nonce not to change the overlay address")
+	}
+
+	if _, err := MineNonce(context.Background(), key, make([]byte, 32), MaxMineProximity+1); err == nil {
+		t.Fatalf("expected error mining for proximity order %d", MaxMineProximity+1)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := MineNonce(ctx, key, make([]byte, 32), MaxMineProximity); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+// TestNeighbourhoodPopulation tests counting peers in a neighbourhood
+func TestNeighbourhoodPopulation(t *testing.T) {
+	tk := newTestKademlia(t, "00000000")
+	tk.On("10000000", "11000000", "11100000", "01000000")
+	tk.Register("11110000", "11010000")
+
+	prefix := pot.NewAddressFromString("11000000")
+	for _, tc := range []struct {
+		po        int
+		connected int
+		known     int
+	}{
+		{0, 4, 6},
+		{1, 3, 5},
+		{2, 2, 4},
+		{3, 1, 2},
+	} {
+		np := tk.NeighbourhoodPopulation(prefix[:1], tc.po)
+		if np.Connected != tc.connected || np.Known != tc.known {
+			t.Fatalf("po %d: expected %d connected and %d known, got %+v", tc.po, tc.connected, tc.known, np)
+		}
+	}
+}
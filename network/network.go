@@ -1,6 +1,7 @@
 package network
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"encoding/hex"
 	"fmt"
@@ -14,15 +15,37 @@ import (
 	"github.com/ethersphere/swarm/network/capability"
 )
 
+// underlaysVersion is the version of the encoding of the alternative underlay addresses
+const underlaysVersion = 1
+
 // BzzAddr implements the PeerAddr interface
 type BzzAddr struct {
 	OAddr        []byte
-	UAddr        []byte
+	UAddr        []byte   // preferred underlay address
+	AltUAddrs    [][]byte // alternative underlay addresses, eg. for other IP families, in order of preference
 	Capabilities *capability.Capabilities
 }
 
+// underlays is the versioned encoding of the alternative underlay addresses
+type underlays struct {
+	Version uint
+	Addrs   [][]byte
+}
+
 // EncodeRLP implements rlp.Encoder
 func (b *BzzAddr) EncodeRLP(w io.Writer) error {
+	if err := b.encodeRLP(w); err != nil {
+		return err
+	}
+	u, err := rlp.EncodeToBytes(&underlays{Version: underlaysVersion, Addrs: b.AltUAddrs})
+	if err != nil {
+		return err
+	}
+	return rlp.Encode(w, u)
+}
+
+// encodeRLP encodes the overlay, the preferred underlay address and the capabilities
+func (b *BzzAddr) encodeRLP(w io.Writer) error {
 	err := rlp.Encode(w, b.OAddr)
 	if err != nil {
 		return err
@@ -35,15 +58,33 @@ func (b *BzzAddr) EncodeRLP(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	err = rlp.Encode(w, y)
+	return rlp.Encode(w, y)
+}
+
+// DecodeRLP implements rlp.Decoder
+func (b *BzzAddr) DecodeRLP(s *rlp.Stream) error {
+	err := b.decodeRLP(s)
 	if err != nil {
 		return err
 	}
+	u, err := s.Bytes()
+	if err != nil {
+		return fmt.Errorf("underlaysbytes --- %v", err)
+	}
+	var under underlays
+	err = rlp.DecodeBytes(u, &under)
+	if err != nil {
+		return fmt.Errorf("underlays --- %v", err)
+	}
+	if under.Version != underlaysVersion {
+		return fmt.Errorf("underlays --- unsupported version %d", under.Version)
+	}
+	b.AltUAddrs = under.Addrs
 	return nil
 }
 
-// DecodeRLP implements rlp.Decoder
-func (b *BzzAddr) DecodeRLP(s *rlp.Stream) error {
+// decodeRLP decodes the overlay, the preferred underlay address and the capabilities
+func (b *BzzAddr) decodeRLP(s *rlp.Stream) error {
 	var err error
 
 	b.OAddr, err = s.Bytes()
@@ -66,6 +107,20 @@ func (b *BzzAddr) DecodeRLP(s *rlp.Stream) error {
 	return nil
 }
 
+// legacyBzzAddr is the encoding of a BzzAddr without the alternative underlay addresses
+// used with peers running versions 14 and 15 of the bzz and versions 11 and 12 of the hive protocol
+type legacyBzzAddr BzzAddr
+
+// EncodeRLP implements rlp.Encoder
+func (b *legacyBzzAddr) EncodeRLP(w io.Writer) error {
+	return (*BzzAddr)(b).encodeRLP(w)
+}
+
+// DecodeRLP implements rlp.Decoder
+func (b *legacyBzzAddr) DecodeRLP(s *rlp.Stream) error {
+	return (*BzzAddr)(b).decodeRLP(s)
+}
+
 // NewBzzAddr creates a new BzzAddr with the specified byte values for over- and underlayaddresses
 // It will contain an empty capabilities object
 func NewBzzAddr(oaddr []byte, uaddr []byte) *BzzAddr {
@@ -86,11 +141,22 @@ func (a *BzzAddr) Over() []byte {
 	return a.OAddr
 }
 
-// Under returns the underlay address.
+// Under returns the preferred underlay address.
 func (a *BzzAddr) Under() []byte {
 	return a.UAddr
 }
 
+// Underlays returns all the underlay addresses in order of preference.
+func (a *BzzAddr) Underlays() [][]byte {
+	return append([][]byte{a.UAddr}, a.AltUAddrs...)
+}
+
+// WithAltUnderlays is a chained constructor method to set the alternative underlay addresses for a BzzAddr
+func (a *BzzAddr) WithAltUnderlays(uaddrs ...[]byte) *BzzAddr {
+	a.AltUAddrs = uaddrs
+	return a
+}
+
 // ShortString returns shortened versions of overlay and underlay address in a format: shortOver:shortUnder
 // It can be used for logging
 func (a *BzzAddr) ShortString() string {
@@ -126,13 +192,30 @@ func (a *BzzAddr) ID() enode.ID {
 	return n.ID()
 }
 
-// Update updates the underlay address of a peer record
+// Update updates the underlay addresses of a peer record
 func (a *BzzAddr) Update(na *BzzAddr) *BzzAddr {
-	return &BzzAddr{a.OAddr, na.UAddr, a.Capabilities}
+	return &BzzAddr{a.OAddr, na.UAddr, na.AltUAddrs, a.Capabilities}
+}
+
+// sameUnderlays returns true if the two addresses have the same underlay addresses in the same order
+func (a *BzzAddr) sameUnderlays(b *BzzAddr) bool {
+	au, bu := a.Underlays(), b.Underlays()
+	if len(au) != len(bu) {
+		return false
+	}
+	for i := range au {
+		if !bytes.Equal(au[i], bu[i]) {
+			return false
+		}
+	}
+	return true
 }
 
 // String pretty prints the address
 func (a *BzzAddr) String() string {
+	if len(a.AltUAddrs) > 0 {
+		return fmt.Sprintf("%x <%s> <%s> cap:%s", a.OAddr, a.UAddr, bytes.Join(a.AltUAddrs, []byte(" ")), a.Capabilities)
+	}
 	return fmt.Sprintf("%x <%s> cap:%s", a.OAddr, a.UAddr, a.Capabilities)
 }
 
@@ -170,6 +253,7 @@ func PrivateKeyToBzzKey(prvKey *ecdsa.PrivateKey) []byte {
 type EnodeParams struct {
 	PrivateKey *ecdsa.PrivateKey
 	EnodeKey   *ecdsa.PrivateKey
+	Nonce      []byte // optional nonce mixed into the overlay address
 	Lightnode  bool
 	Bootnode   bool
 }
@@ -181,7 +265,7 @@ func NewEnodeRecord(params *EnodeParams) (*enr.Record, error) {
 		return nil, fmt.Errorf("all param private keys must be defined")
 	}
 
-	bzzkeybytes := PrivateKeyToBzzKey(params.PrivateKey)
+	bzzkeybytes := PrivateKeyToBzzKeyWithNonce(params.PrivateKey, params.Nonce)
 
 	var record enr.Record
 	record.Set(NewENRAddrEntry(bzzkeybytes))
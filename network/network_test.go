@@ -12,18 +12,108 @@ import (
 func TestBzzAddrRLPSerialization(t *testing.T) {
 	caps := capability.NewCapabilities()
 	caps.Add(lightCapability)
-	addr := RandomBzzAddr().WithCapabilities(caps)
-	b, err := rlp.EncodeToBytes(addr)
+	for _, addr := range []*BzzAddr{
+		RandomBzzAddr().WithCapabilities(caps),
+		RandomBzzAddr().WithCapabilities(caps).WithAltUnderlays([]byte("enode://a@[::1]:30303"), []byte("enode://a@10.0.0.1:30303")),
+	} {
+		b, err := rlp.EncodeToBytes(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var addrRecovered BzzAddr
+		err = rlp.DecodeBytes(b, &addrRecovered)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !addr.Match(&addrRecovered) {
+			t.Fatalf("bzzaddr mismatch, expected %v, got %v", addr, addrRecovered)
+		}
+	}
+}
+
+// TestPeersMsgRLPSerialization verifies that addresses with and without
+// alternative underlay addresses are recovered from a peers message
+func TestPeersMsgRLPSerialization(t *testing.T) {
+	msg := &peersMsg{
+		Peers: []*BzzAddr{
+			RandomBzzAddr().WithAltUnderlays([]byte("enode://a@[::1]:30303")),
+			RandomBzzAddr(),
+			RandomBzzAddr().WithAltUnderlays([]byte("enode://b@[::1]:30303"), []byte("enode://b@10.0.0.1:30303")),
+		},
+	}
+	b, err := rlp.EncodeToBytes(msg)
 	if err != nil {
 		t.Fatal(err)
 	}
-	var addrRecovered BzzAddr
-	err = rlp.DecodeBytes(b, &addrRecovered)
+	var msgRecovered peersMsg
+	if err := rlp.DecodeBytes(b, &msgRecovered); err != nil {
+		t.Fatal(err)
+	}
+	if len(msgRecovered.Peers) != len(msg.Peers) {
+		t.Fatalf("expected %d peers, got %d", len(msg.Peers), len(msgRecovered.Peers))
+	}
+	for i, addr := range msg.Peers {
+		if !addr.Match(msgRecovered.Peers[i]) {
+			t.Fatalf("bzzaddr mismatch, expected %v, got %v", addr, msgRecovered.Peers[i])
+		}
+	}
+}
+
+// TestLegacyPeersMsgRLPSerialization verifies that the addresses in the peers message of hive
+// protocol version 12 are recovered without their alternative underlay addresses
+func TestLegacyPeersMsgRLPSerialization(t *testing.T) {
+	peers := []*BzzAddr{
+		RandomBzzAddr().WithAltUnderlays([]byte("enode://a@[::1]:30303")),
+		RandomBzzAddr(),
+	}
+	b, err := rlp.EncodeToBytes(newLegacyPeersMsg(peers))
 	if err != nil {
 		t.Fatal(err)
 	}
-	if !addr.Match(&addrRecovered) {
-		t.Fatalf("bzzaddr mismatch, expected %v, got %v", addr, addrRecovered)
+	var msgRecovered legacyPeersMsg
+	if err := rlp.DecodeBytes(b, &msgRecovered); err != nil {
+		t.Fatal(err)
+	}
+	recovered := msgRecovered.peersMsg().Peers
+	if len(recovered) != len(peers) {
+		t.Fatalf("expected %d peers, got %d", len(peers), len(recovered))
+	}
+	for i, addr := range peers {
+		if !bytes.Equal(addr.OAddr, recovered[i].OAddr) || !bytes.Equal(addr.UAddr, recovered[i].UAddr) {
+			t.Fatalf("bzzaddr mismatch, expected %v, got %v", addr, recovered[i])
+		}
+		if recovered[i].AltUAddrs != nil {
+			t.Fatalf("expected no alternative underlays, got %v", recovered[i].AltUAddrs)
+		}
+	}
+}
+
+// TestBzzAddrUnderlaysVersion verifies that addresses with an unknown encoding of the
+// alternative underlay addresses are rejected
+func TestBzzAddrUnderlaysVersion(t *testing.T) {
+	addr := RandomBzzAddr()
+	var buf bytes.Buffer
+	for _, v := range [][]byte{addr.OAddr, addr.UAddr} {
+		if err := rlp.Encode(&buf, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	caps, err := rlp.EncodeToBytes(addr.Capabilities)
+	if err != nil {
+		t.Fatal(err)
+	}
+	under, err := rlp.EncodeToBytes(&underlays{Version: underlaysVersion + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range [][]byte{caps, under} {
+		if err := rlp.Encode(&buf, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var addrRecovered BzzAddr
+	if err := addrRecovered.DecodeRLP(rlp.NewStream(&buf, 0)); err == nil {
+		t.Fatal("expected error decoding unsupported underlays version")
 	}
 }
 
@@ -32,7 +122,7 @@ func (b *BzzAddr) Match(bcmp *BzzAddr) bool {
 	if !bytes.Equal(b.OAddr, bcmp.OAddr) {
 		return false
 	}
-	if !bytes.Equal(b.UAddr, bcmp.UAddr) {
+	if !b.sameUnderlays(bcmp) {
 		return false
 	}
 	if !b.Capabilities.Match(bcmp.Capabilities) {
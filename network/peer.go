@@ -69,10 +69,15 @@ func (d *Peer) NotifyPeer(a *BzzAddr, po uint8) {
 	if (po < d.getDepth() && pot.ProxCmp(d.kad.BaseAddr(), d.Address(), a.Address()) != 1) || d.seen(a) {
 		return
 	}
-	resp := &peersMsg{
-		Peers: []*BzzAddr{a},
+	go d.sendPeers(context.TODO(), []*BzzAddr{a})
+}
+
+// sendPeers sends a peersMsg in the encoding of the hive protocol version run with the peer
+func (d *Peer) sendPeers(ctx context.Context, peers []*BzzAddr) error {
+	if d.Version() < underlaysHiveVersion {
+		return d.Send(ctx, newLegacyPeersMsg(peers))
 	}
-	go d.Send(context.TODO(), resp)
+	return d.Send(ctx, &peersMsg{Peers: peers})
 }
 
 // NotifyDepth sends a subPeers Msg to the receiver notifying them about
@@ -130,6 +135,55 @@ func (msg peersMsg) String() string {
 	return fmt.Sprintf("%T: %v", msg, msg.Peers)
 }
 
+// legacyPeersMsg is the peersMsg of hive protocol versions 11 and 12
+// the peer addresses are encoded without their alternative underlay addresses
+type legacyPeersMsg struct {
+	Peers []*legacyBzzAddr
+}
+
+func newLegacyPeersMsg(peers []*BzzAddr) *legacyPeersMsg {
+	msg := &legacyPeersMsg{}
+	for _, a := range peers {
+		msg.Peers = append(msg.Peers, (*legacyBzzAddr)(a))
+	}
+	return msg
+}
+
+// DecodeRLP implements rlp.Decoder interface
+func (p *legacyPeersMsg) DecodeRLP(s *rlp.Stream) error {
+	_, err := s.List()
+	if err != nil {
+		return err
+	}
+	_, err = s.List()
+	if err != nil {
+		return err
+	}
+	for {
+		var addr legacyBzzAddr
+		err = s.Decode(&addr)
+		if err != nil {
+			break
+		}
+		p.Peers = append(p.Peers, &addr)
+	}
+	return nil
+}
+
+// peersMsg returns the peersMsg with the addresses of the message
+func (p *legacyPeersMsg) peersMsg() *peersMsg {
+	msg := &peersMsg{}
+	for _, a := range p.Peers {
+		msg.Peers = append(msg.Peers, (*BzzAddr)(a))
+	}
+	return msg
+}
+
+// String pretty prints a legacyPeersMsg
+func (msg legacyPeersMsg) String() string {
+	return fmt.Sprintf("%T: %v", msg, msg.peersMsg().Peers)
+}
+
 // subPeers msg is communicating the depth of the overlay table of a peer
 type subPeersMsg struct {
 	Depth uint8
@@ -0,0 +1,150 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/ethersphere/swarm/pot"
+)
+
+// PeerStats is the connection history of a peer address.
+// It is persisted across sessions by the hive so that after a restart
+// kademlia prefers to dial peers that proved reliable before.
+type PeerStats struct {
+	LastSuccess   time.Time     `json:"last_success"`   // start of the last successful connection
+	LastAttempt   time.Time     `json:"last_attempt"`   // time of the last dial attempt
+	FailureStreak int           `json:"failure_streak"` // number of consecutive dial attempts that did not result in a connection
+	Uptime        time.Duration `json:"uptime"`         // accumulated time the peer was connected
+
+	connectedAt time.Time // start of the current connection, zero if not connected
+	dialing     bool      // whether a dial attempt is pending
+}
+
+// dialed records a dial attempt. If the previous attempt did not result in a connection
+// by the time the peer is dialed again, it is counted as a failure
+func (s *PeerStats) dialed(now time.Time) {
+	if s.dialing {
+		s.FailureStreak++
+	}
+	s.dialing = true
+	s.LastAttempt = now
+}
+
+// connected records the start of a connection
+func (s *PeerStats) connected(now time.Time) {
+	s.dialing = false
+	s.FailureStreak = 0
+	s.LastSuccess = now
+	s.connectedAt = now
+}
+
+// disconnected records the end of a connection and accumulates its duration in the uptime
+func (s *PeerStats) disconnected(now time.Time) {
+	if s.connectedAt.IsZero() {
+		return
+	}
+	s.Uptime += now.Sub(s.connectedAt)
+	s.connectedAt = time.Time{}
+}
+
+// snapshot returns a copy of the stats including the duration of the current connection
+func (s *PeerStats) snapshot(now time.Time) PeerStats {
+	c := *s
+	if !c.connectedAt.IsZero() {
+		c.Uptime += now.Sub(c.connectedAt)
+	}
+	c.connectedAt = time.Time{}
+	c.dialing = false
+	return c
+}
+
+// moreReliable returns true if the connection history s is preferable to t
+// nil stats represent peers never dialed
+// peers are ranked by
+// * fewer consecutive failures
+// * having connected successfully before
+// * longer accumulated uptime
+// * more recent successful connection
+func (s *PeerStats) moreReliable(t *PeerStats) bool {
+	if s == nil {
+		s = &PeerStats{}
+	}
+	if t == nil {
+		t = &PeerStats{}
+	}
+	if s.FailureStreak != t.FailureStreak {
+		return s.FailureStreak < t.FailureStreak
+	}
+	if s.LastSuccess.IsZero() != t.LastSuccess.IsZero() {
+		return !s.LastSuccess.IsZero()
+	}
+	if s.Uptime != t.Uptime {
+		return s.Uptime > t.Uptime
+	}
+	return s.LastSuccess.After(t.LastSuccess)
+}
+
+// peerStats returns the connection history for the overlay address, creating it if not found
+// caller must hold the lock
+func (k *Kademlia) peerStats(addr []byte) *PeerStats {
+	key := hex.EncodeToString(addr)
+	s, ok := k.stats[key]
+	if !ok {
+		s = &PeerStats{}
+		k.stats[key] = s
+	}
+	return s
+}
+
+// PeerStats returns the connection history of all peers keyed by
+// the hex encoded overlay address
+func (k *Kademlia) PeerStats() map[string]PeerStats {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	now := time.Now()
+	stats := make(map[string]PeerStats, len(k.stats))
+	for key, s := range k.stats {
+		stats[key] = s.snapshot(now)
+	}
+	return stats
+}
+
+// LoadPeerStats sets the connection history of peers from a previous session
+// stats are keyed by hex encoded overlay address as returned by PeerStats
+// stats of peers not in the address book are discarded, so peers need to be registered first
+func (k *Kademlia) LoadPeerStats(stats map[string]PeerStats) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	known := make(map[string]bool)
+	k.defaultIndex.addrs.Each(func(val pot.Val) bool {
+		known[val.(*entry).Hex()] = true
+		return true
+	})
+	for key, s := range stats {
+		if !known[key] {
+			continue
+		}
+		// a connection recorded in the current session takes precedence
+		if _, ok := k.stats[key]; ok {
+			continue
+		}
+		s := s
+		k.stats[key] = &s
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/swarm/pot"
+)
+
+// TestPeerStatsHistory tests that connections, disconnections and
+// failed dial attempts are recorded in the peer connection history
+func TestPeerStatsHistory(t *testing.T) {
+	tk := newTestKademlia(t, "00000000")
+	tk.Register("10000000")
+	tk.checkSuggestPeer("10000000", 0, false)
+	tk.On("10000000")
+	time.Sleep(10 * time.Millisecond)
+	tk.Off("10000000")
+
+	key := hex.EncodeToString(pot.NewAddressFromString("10000000"))
+	stats, ok := tk.PeerStats()[key]
+	if !ok {
+		t.Fatal("expected peer stats to be recorded")
+	}
+	if stats.LastSuccess.IsZero() {
+		t.Fatal("expected last success to be recorded")
+	}
+	if stats.Uptime < 10*time.Millisecond {
+		t.Fatalf("expected uptime of at least 10ms, got %v", stats.Uptime)
+	}
+	if stats.FailureStreak != 0 {
+		t.Fatalf("expected no failures, got %d", stats.FailureStreak)
+	}
+
+	// dialing again before the previous attempt connected counts as failure
+	s := &PeerStats{}
+	s.dialed(time.Now())
+	s.dialed(time.Now())
+	s.dialed(time.Now())
+	if s.FailureStreak != 2 {
+		t.Fatalf("expected failure streak 2, got %d", s.FailureStreak)
+	}
+	s.connected(time.Now())
+	if s.FailureStreak != 0 {
+		t.Fatalf("expected failure streak reset on connection, got %d", s.FailureStreak)
+	}
+}
+
+// TestSuggestPeerPrefersReliable tests that among callable peers in a bin
+// the one with the best connection history is suggested
+func TestSuggestPeerPrefersReliable(t *testing.T) {
+	tk := newTestKademlia(t, "00000000")
+	tk.Register("10000000", "11000000", "11100000")
+
+	key := func(s string) string {
+		return hex.EncodeToString(pot.NewAddressFromString(s))
+	}
+	tk.LoadPeerStats(map[string]PeerStats{
+		key("10000000"): {FailureStreak: 3},
+		key("11000000"): {LastSuccess: time.Now().Add(-time.Hour), Uptime: time.Hour},
+		key("11100000"): {LastSuccess: time.Now().Add(-time.Hour), Uptime: time.Minute},
+	})
+
+	tk.checkSuggestPeer("11000000", 0, false)
+	tk.On("11000000")
+	tk.checkSuggestPeer("11100000", 0, false)
+}
+
+// TestPeerStatsPruned tests that peers exceeding the maximum number of redial attempts
+// are removed from the address book together with their connection history
+// and that the history of peers not in the address book is not loaded
+func TestPeerStatsPruned(t *testing.T) {
+	tk := newTestKademlia(t, "00000000")
+	tk.MaxRetries = 0
+	var removed []string
+	tk.Removed = func(a *BzzAddr) {
+		removed = append(removed, binStr(a))
+	}
+	tk.Register("10000000")
+
+	key := func(s string) string {
+		return hex.EncodeToString(pot.NewAddressFromString(s))
+	}
+	tk.LoadPeerStats(map[string]PeerStats{
+		key("11000000"): {FailureStreak: 3},
+	})
+	if _, ok := tk.PeerStats()[key("11000000")]; ok {
+		t.Fatal("expected peer stats of unknown peer to be discarded")
+	}
+
+	tk.checkSuggestPeer("10000000", 0, false)
+	if _, ok := tk.PeerStats()[key("10000000")]; !ok {
+		t.Fatal("expected peer stats to be recorded")
+	}
+	tk.checkSuggestPeer("<nil>", 0, false)
+	if len(removed) != 1 || removed[0] != "10000000" {
+		t.Fatalf("expected peer 10000000 to be removed, got %v", removed)
+	}
+	if size := tk.defaultIndex.addrs.Size(); size != 0 {
+		t.Fatalf("expected empty address book, got %d addresses", size)
+	}
+	if _, ok := tk.PeerStats()[key("10000000")]; ok {
+		t.Fatal("expected peer stats to be removed")
+	}
+}
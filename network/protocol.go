@@ -24,6 +24,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -54,24 +55,55 @@ const (
 
 var DefaultTestNetworkID = rand.Uint64()
 
+// the protocol versions which introduced the credential of the handshake,
+// the reachability messages and the alternative underlay addresses of the BzzAddr
+const (
+	credentialBzzVersion    = 15
+	reachabilityHiveVersion = 12
+	underlaysBzzVersion     = 16
+	underlaysHiveVersion    = 13
+)
+
 // BzzSpec is the spec of the generic swarm handshake
 var BzzSpec = &protocols.Spec{
 	Name:       "bzz",
-	Version:    14,
+	Version:    underlaysBzzVersion,
 	MaxMsgSize: 10 * 1024 * 1024,
 	Messages: []interface{}{
 		HandshakeMsg{},
 	},
+	OldVersions: map[uint][]interface{}{
+		14: {
+			publicHandshakeMsg{},
+		},
+		15: {
+			legacyHandshakeMsg{},
+		},
+	},
 }
 
 // DiscoverySpec is the spec for the bzz discovery subprotocols
 var DiscoverySpec = &protocols.Spec{
 	Name:       "hive",
-	Version:    11,
+	Version:    underlaysHiveVersion,
 	MaxMsgSize: 10 * 1024 * 1024,
 	Messages: []interface{}{
 		peersMsg{},
 		subPeersMsg{},
+		reachabilityMsg{},
+		reachabilityResultMsg{},
+	},
+	OldVersions: map[uint][]interface{}{
+		11: {
+			legacyPeersMsg{},
+			subPeersMsg{},
+		},
+		12: {
+			legacyPeersMsg{},
+			subPeersMsg{},
+			reachabilityMsg{},
+			reachabilityResultMsg{},
+		},
 	},
 }
 
@@ -92,6 +124,30 @@ func isLightCapability(c *capability.Capability) bool {
 	return lightCapability.IsSameAs(c)
 }
 
+// NewLightNodeCapabilities returns the capabilities announced by light nodes
+func NewLightNodeCapabilities() *capability.Capabilities {
+	caps := capability.NewCapabilities()
+	caps.Add(newLightCapability())
+	return caps
+}
+
+// NewFullNodeCapabilities returns the capabilities announced by full nodes
+func NewFullNodeCapabilities() *capability.Capabilities {
+	caps := capability.NewCapabilities()
+	caps.Add(newFullCapability())
+	return caps
+}
+
+// IsLightNode returns true if the capabilities are the ones announced by light nodes
+// light nodes do not store chunks, so full nodes do not sync with them,
+// request chunks from them or route messages for other nodes through them
+func IsLightNode(caps *capability.Capabilities) bool {
+	if caps == nil {
+		return false
+	}
+	return isLightCapability(caps.Get(CapabilityID))
+}
+
 // temporary convenience functions for legacy "full node"
 func newFullCapability() *capability.Capability {
 	c := capability.NewCapability(CapabilityID, 16)
@@ -115,6 +171,12 @@ type BzzConfig struct {
 	LightNode    bool // temporarily kept as we still only define light/full on operational level
 	BootnodeMode bool
 	SyncEnabled  bool
+	// private network mode: if NetworkAuthority is set, only peers presenting
+	// a credential signed by the authority complete the handshake
+	NetworkAuthority common.Address
+	Credential       *Credential
+	// RateLimiter limits the bandwidth of the bzz subprotocols, nil if not rate limited
+	RateLimiter *protocols.RateLimiter
 }
 
 // Bzz is the swarm protocol bundle
@@ -128,6 +190,9 @@ type Bzz struct {
 	streamerRun   func(*BzzPeer) error
 	retrievalSpec *protocols.Spec
 	retrievalRun  func(*BzzPeer) error
+	authority     common.Address // network authority in private network mode
+	credential    *Credential    // own credential sent in the handshake
+	rateLimiter   *protocols.RateLimiter
 }
 
 // NewBzz is the swarm protocol constructor
@@ -145,7 +210,11 @@ func NewBzz(config *BzzConfig, kad *Kademlia, store state.Store, streamerSpec, r
 		streamerSpec:  streamerSpec,
 		retrievalRun:  retrievalRun,
 		retrievalSpec: retrievalSpec,
+		authority:     config.NetworkAuthority,
+		credential:    config.Credential,
+		rateLimiter:   config.RateLimiter,
 	}
+	bzz.Hive.private = bzz.isPrivate()
 
 	if config.BootnodeMode {
 		bzz.streamerRun = nil
@@ -154,7 +223,8 @@ func NewBzz(config *BzzConfig, kad *Kademlia, store state.Store, streamerSpec, r
 		bzz.retrievalSpec = nil
 	}
 
-	if !config.SyncEnabled {
+	// light nodes do not store chunks so they never pull sync
+	if !config.SyncEnabled || config.LightNode {
 		bzz.streamerRun = nil
 		bzz.streamerSpec = nil
 	}
@@ -170,15 +240,21 @@ func NewBzz(config *BzzConfig, kad *Kademlia, store state.Store, streamerSpec, r
 	return bzz
 }
 
+// isPrivate returns true if the node runs in private network mode
+func (b *Bzz) isPrivate() bool {
+	return b.authority != (common.Address{})
+}
+
 // Stop Implements node.Service
 func (b *Bzz) Stop() error {
 	return b.Hive.Stop()
 }
 
-// UpdateLocalAddr updates underlayaddress of the running node
-func (b *Bzz) UpdateLocalAddr(byteaddr []byte) *BzzAddr {
+// UpdateLocalAddr updates the preferred and the alternative underlay addresses of the running node
+func (b *Bzz) UpdateLocalAddr(byteaddr []byte, alts ...[]byte) *BzzAddr {
 	b.localAddr = b.localAddr.Update(&BzzAddr{
 		UAddr:        byteaddr,
+		AltUAddrs:    alts,
 		OAddr:        b.localAddr.OAddr,
 		Capabilities: b.localAddr.Capabilities,
 	})
@@ -196,42 +272,34 @@ func (b *Bzz) NodeInfo() interface{} {
 // * handshake/hive
 // * discovery
 func (b *Bzz) Protocols() []p2p.Protocol {
-	protocol := []p2p.Protocol{
-		{
-			Name:     BzzSpec.Name,
-			Version:  BzzSpec.Version,
-			Length:   BzzSpec.Length(),
-			Run:      b.runBzz,
-			NodeInfo: b.NodeInfo,
-		},
-		{
-			Name:     DiscoverySpec.Name,
-			Version:  DiscoverySpec.Version,
-			Length:   DiscoverySpec.Length(),
-			Run:      b.RunProtocol(DiscoverySpec, b.Hive.Run),
-			NodeInfo: b.Hive.NodeInfo,
-			PeerInfo: b.Hive.PeerInfo,
-		},
+	var protocol []p2p.Protocol
+	for _, p := range BzzSpec.Protocols(b.runBzzVersion) {
+		p.NodeInfo = b.NodeInfo
+		protocol = append(protocol, p)
+	}
+	// the subprotocols are advertised in all their supported versions
+	for _, p := range b.runProtocols(DiscoverySpec, b.Hive.Run) {
+		p.NodeInfo = b.Hive.NodeInfo
+		p.PeerInfo = b.Hive.PeerInfo
+		protocol = append(protocol, p)
 	}
 	if b.streamerSpec != nil && b.streamerRun != nil {
-		protocol = append(protocol, p2p.Protocol{
-			Name:    b.streamerSpec.Name,
-			Version: b.streamerSpec.Version,
-			Length:  b.streamerSpec.Length(),
-			Run:     b.RunProtocol(b.streamerSpec, b.streamerRun),
-		})
+		protocol = append(protocol, b.runProtocols(b.streamerSpec, b.streamerRun)...)
 	}
 	if b.retrievalSpec != nil && b.retrievalRun != nil {
-		protocol = append(protocol, p2p.Protocol{
-			Name:    b.retrievalSpec.Name,
-			Version: b.retrievalSpec.Version,
-			Length:  b.retrievalSpec.Length(),
-			Run:     b.RunProtocol(b.retrievalSpec, b.retrievalRun),
-		})
+		protocol = append(protocol, b.runProtocols(b.retrievalSpec, b.retrievalRun)...)
 	}
 	return protocol
 }
 
+// runProtocols returns the p2p protocols for all the supported versions of a subprotocol
+// the BzzPeer passed to run uses the spec of the version negotiated with the peer
+func (b *Bzz) runProtocols(spec *protocols.Spec, run func(*BzzPeer) error) []p2p.Protocol {
+	return spec.Protocols(func(s *protocols.Spec) func(*p2p.Peer, p2p.MsgReadWriter) error {
+		return b.RunProtocol(s, run)
+	})
+}
+
 // APIs returns the APIs offered by bzz
 // * hive
 // Bzz implements the node.Service interface
@@ -279,6 +347,7 @@ func (b *Bzz) RunProtocol(spec *protocols.Spec, run func(*BzzPeer) error) func(*
 			BzzAddr:    handshake.peerAddr,
 			lastActive: time.Now(),
 		}
+		peer.SetRateLimiter(b.rateLimiter)
 
 		log.Debug("peer created", "addr", handshake.peerAddr.String())
 
@@ -294,31 +363,82 @@ func (b *Bzz) performHandshake(p *protocols.Peer, handshake *HandshakeMsg) error
 		close(handshake.done)
 		cancel()
 	}()
-	rsh, err := p.Handshake(ctx, handshake, b.checkHandshake)
+	// the credential is only revealed to an inbound peer after its own credential is verified
+	// the dialer has to send first, the credential being bound to the node key
+	// means it is of no use to a peer that is not a member of the network
+	out := &HandshakeMsg{
+		Version:   handshake.Version,
+		NetworkID: handshake.NetworkID,
+		Addr:      handshake.Addr,
+	}
+	if !p.Inbound() {
+		out.Credential = handshake.Credential
+	}
+	// peers running an old version of the protocol do not know the alternative underlay addresses
+	var hs interface{} = out
+	var legacy *legacyHandshakeMsg
+	switch {
+	case p.Version() < credentialBzzVersion:
+		hs = newPublicHandshakeMsg(out, p.Version())
+	case p.Version() < underlaysBzzVersion:
+		legacy = newLegacyHandshakeMsg(out, p.Version())
+		hs = legacy
+	}
+	rsh, err := p.Handshake(ctx, hs, func(rhs interface{}) error {
+		if err := b.checkHandshake(p, toHandshakeMsg(rhs)); err != nil {
+			return err
+		}
+		out.Credential = handshake.Credential
+		if legacy != nil {
+			legacy.Credential = handshake.Credential
+		}
+		return nil
+	})
 	if err != nil {
 		handshake.err = err
 		return err
 	}
-	handshake.peerAddr = rsh.(*HandshakeMsg).Addr
+	rhs := toHandshakeMsg(rsh)
+	handshake.peerAddr = rhs.Addr
+	if b.isPrivate() {
+		// credential is verified in checkHandshake, record it so that hive can gossip the peer
+		b.Hive.addCredential(rhs.Addr, rhs.Credential)
+	}
 	return nil
 }
 
 // runBzz is the p2p protocol run function for the bzz base protocol
 // that negotiates the bzz handshake
 func (b *Bzz) runBzz(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+	return b.runBzzVersion(BzzSpec)(p, rw)
+}
+
+// runBzzVersion returns the run function of the bzz base protocol
+// for the spec of the version negotiated with the peer
+func (b *Bzz) runBzzVersion(spec *protocols.Spec) func(*p2p.Peer, p2p.MsgReadWriter) error {
+	return func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+		return b.runHandshake(p, rw, spec)
+	}
+}
+
+func (b *Bzz) runHandshake(p *p2p.Peer, rw p2p.MsgReadWriter, spec *protocols.Spec) error {
 	handshake, _ := b.GetOrCreateHandshake(p.ID())
 	if !<-handshake.init {
 		return fmt.Errorf("%08x: bzz already started on peer %08x", b.localAddr.Over()[:4], p.ID().Bytes()[:4])
 	}
 	close(handshake.init)
 	defer b.removeHandshake(p.ID())
-	peer := protocols.NewPeer(p, rw, BzzSpec)
+	peer := protocols.NewPeer(p, rw, spec)
 	err := b.performHandshake(peer, handshake)
 	if err != nil {
 		log.Warn(fmt.Sprintf("%08x: handshake failed with remote peer %08x: %v", b.localAddr.Over()[:4], p.ID().Bytes()[:4], err))
 
 		return err
 	}
+	if b.isPrivate() {
+		// the peer is only gossiped while connected
+		defer b.Hive.removeCredential(handshake.peerAddr)
+	}
 	// fail if we get another handshake
 	msg, err := rw.ReadMsg()
 	if err != nil {
@@ -356,11 +476,13 @@ func (p *BzzPeer) ID() enode.ID {
 * NetworkID: 8 byte integer network identifier
 * Addr: the address advertised by the node including underlay and overlay connecctions
 * Capabilities: the capabilities bitvector
+* Credential: the network membership credential, only required in private networks
 */
 type HandshakeMsg struct {
-	Version   uint64
-	NetworkID uint64
-	Addr      *BzzAddr
+	Version    uint64
+	NetworkID  uint64
+	Addr       *BzzAddr
+	Credential *Credential `rlp:"nil"`
 
 	// peerAddr is the address received in the peer handshake
 	peerAddr *BzzAddr
@@ -372,22 +494,82 @@ type HandshakeMsg struct {
 
 // String pretty prints the handshake
 func (bh *HandshakeMsg) String() string {
-	return fmt.Sprintf("Handshake: Version: %v, NetworkID: %v, Addr: %v, peerAddr: %v", bh.Version, bh.NetworkID, bh.Addr, bh.peerAddr)
+	return fmt.Sprintf("Handshake: Version: %v, NetworkID: %v, Addr: %v, Credential: %v, peerAddr: %v", bh.Version, bh.NetworkID, bh.Addr, bh.Credential, bh.peerAddr)
+}
+
+// legacyHandshakeMsg is the handshake of bzz protocol version 15
+// the address is encoded without the alternative underlay addresses
+type legacyHandshakeMsg struct {
+	Version    uint64
+	NetworkID  uint64
+	Addr       *legacyBzzAddr
+	Credential *Credential `rlp:"nil"`
+}
+
+func newLegacyHandshakeMsg(hs *HandshakeMsg, version uint) *legacyHandshakeMsg {
+	return &legacyHandshakeMsg{
+		Version:    uint64(version),
+		NetworkID:  hs.NetworkID,
+		Addr:       (*legacyBzzAddr)(hs.Addr),
+		Credential: hs.Credential,
+	}
+}
+
+// publicHandshakeMsg is the handshake of bzz protocol version 14
+// which predates private networks, it has no credential
+// peers running it can only join public networks
+type publicHandshakeMsg struct {
+	Version   uint64
+	NetworkID uint64
+	Addr      *legacyBzzAddr
+}
+
+func newPublicHandshakeMsg(hs *HandshakeMsg, version uint) *publicHandshakeMsg {
+	return &publicHandshakeMsg{
+		Version:   uint64(version),
+		NetworkID: hs.NetworkID,
+		Addr:      (*legacyBzzAddr)(hs.Addr),
+	}
 }
 
-// Perform initiates the handshake and validates the remote handshake message
-func (b *Bzz) checkHandshake(hs interface{}) error {
-	rhs := hs.(*HandshakeMsg)
+// toHandshakeMsg returns the handshake received in the encoding of any supported version as a HandshakeMsg
+func toHandshakeMsg(msg interface{}) *HandshakeMsg {
+	switch hs := msg.(type) {
+	case *publicHandshakeMsg:
+		return &HandshakeMsg{
+			Version:   hs.Version,
+			NetworkID: hs.NetworkID,
+			Addr:      (*BzzAddr)(hs.Addr),
+		}
+	case *legacyHandshakeMsg:
+		return &HandshakeMsg{
+			Version:    hs.Version,
+			NetworkID:  hs.NetworkID,
+			Addr:       (*BzzAddr)(hs.Addr),
+			Credential: hs.Credential,
+		}
+	}
+	return msg.(*HandshakeMsg)
+}
+
+// checkHandshake validates the remote handshake message
+// the version must be the version of the protocol negotiated with the peer
+func (b *Bzz) checkHandshake(p *protocols.Peer, rhs *HandshakeMsg) error {
 	if rhs.NetworkID != b.NetworkID {
 		return fmt.Errorf("network id mismatch %d (!= %d)", rhs.NetworkID, b.NetworkID)
 	}
-	if rhs.Version != uint64(BzzSpec.Version) {
-		return fmt.Errorf("version mismatch %d (!= %d)", rhs.Version, BzzSpec.Version)
+	if rhs.Version != uint64(p.Version()) {
+		return fmt.Errorf("version mismatch %d (!= %d)", rhs.Version, p.Version())
 	}
 	// temporary check for valid capability settings, legacy full/light
 	if !isFullCapability(rhs.Addr.Capabilities.Get(0)) && !isLightCapability(rhs.Addr.Capabilities.Get(0)) {
 		return fmt.Errorf("invalid capabilities setting: %s", rhs.Addr.Capabilities)
 	}
+	if b.isPrivate() {
+		if err := rhs.Credential.Verify(b.authority, b.NetworkID, p.ID()); err != nil {
+			return fmt.Errorf("invalid credential: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -406,11 +588,12 @@ func (b *Bzz) GetOrCreateHandshake(peerID enode.ID) (*HandshakeMsg, bool) {
 	handshake, found := b.handshakes[peerID]
 	if !found {
 		handshake = &HandshakeMsg{
-			Version:   uint64(BzzSpec.Version),
-			NetworkID: b.NetworkID,
-			Addr:      b.localAddr,
-			init:      make(chan bool, 1),
-			done:      make(chan struct{}),
+			Version:    uint64(BzzSpec.Version),
+			NetworkID:  b.NetworkID,
+			Addr:       b.localAddr,
+			Credential: b.credential,
+			init:       make(chan bool, 1),
+			done:       make(chan struct{}),
 		}
 		// when handhsake is first created for a remote peer
 		// it is initialised with the init
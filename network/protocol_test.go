@@ -17,7 +17,10 @@
 package network
 
 import (
+	"bytes"
+	"context"
 	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
@@ -37,7 +40,7 @@ import (
 )
 
 const (
-	TestProtocolVersion = 14
+	TestProtocolVersion = 16
 )
 
 var TestProtocolNetworkID = DefaultTestNetworkID
@@ -361,6 +364,195 @@ func TestBzzHandshakeSuccess(t *testing.T) {
 	}
 }
 
+// TestBzzHandshakeOldVersion tests the handshake with a peer running the previous version of the protocol
+// which does not know the alternative underlay addresses
+func TestBzzHandshakeOldVersion(t *testing.T) {
+	prvkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record enr.Record
+	record.Set(NewENRAddrEntry(PrivateKeyToBzzKey(prvkey)))
+	if err := enode.SignV4(&record, prvkey); err != nil {
+		t.Fatal(err)
+	}
+	nod, err := enode.New(enode.V4ID{}, &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := getENRBzzAddr(nod)
+	bzz := newBzz(addr, false)
+	spec, ok := BzzSpec.ForVersion(15)
+	if !ok {
+		t.Fatal("expected version 15 of the protocol to be supported")
+	}
+	pt := p2ptest.NewProtocolTester(prvkey, 1, bzz.runBzzVersion(spec))
+	defer pt.Stop()
+	node := pt.Nodes[0]
+
+	lhs := newLegacyHandshakeMsg(correctBzzHandshake(addr, false), 15)
+	rhs := newLegacyHandshakeMsg(newBzzHandshakeMsg(15, TestProtocolNetworkID, NewBzzAddrFromEnode(node), false), 15)
+	err = pt.TestExchanges(p2ptest.Exchange{
+		Expects: []p2ptest.Expect{{Code: 0, Msg: lhs, Peer: node.ID()}},
+	}, p2ptest.Exchange{
+		Triggers: []p2ptest.Trigger{{Code: 0, Msg: rhs, Peer: node.ID()}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handshake, _ := bzz.GetOrCreateHandshake(node.ID())
+	select {
+	case <-handshake.done:
+		if handshake.err != nil {
+			t.Fatal(handshake.err)
+		}
+		if !bytes.Equal(handshake.peerAddr.Over(), rhs.Addr.OAddr) {
+			t.Fatalf("expected peer address %x, got %x", rhs.Addr.OAddr, handshake.peerAddr.Over())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("test timeout")
+	}
+}
+
+// releasedHandshakeMsg is the handshake of the released bzz protocol version 14
+type releasedHandshakeMsg struct {
+	Version   uint64
+	NetworkID uint64
+	Addr      *legacyBzzAddr
+}
+
+// TestBzzReleasedVersions tests that a node connects to a peer advertising only
+// the released versions 14 of the bzz and 11 of the hive protocol
+func TestBzzReleasedVersions(t *testing.T) {
+	prvkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record enr.Record
+	record.Set(NewENRAddrEntry(PrivateKeyToBzzKey(prvkey)))
+	if err := enode.SignV4(&record, prvkey); err != nil {
+		t.Fatal(err)
+	}
+	nod, err := enode.New(enode.V4ID{}, &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := getENRBzzAddr(nod)
+	bzz := newBzz(addr, false)
+	local := newReleasedVersionsServer(t, prvkey, bzz.Protocols())
+	defer local.Stop()
+
+	remoteKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handshakes := make(chan *releasedHandshakeMsg, 1)
+	depths := make(chan uint8, 1)
+	bzzSpec := &protocols.Spec{
+		Name:       "bzz",
+		Version:    14,
+		MaxMsgSize: 10 * 1024 * 1024,
+		Messages:   []interface{}{releasedHandshakeMsg{}},
+	}
+	hiveSpec := &protocols.Spec{
+		Name:       "hive",
+		Version:    11,
+		MaxMsgSize: 10 * 1024 * 1024,
+		Messages:   []interface{}{legacyPeersMsg{}, subPeersMsg{}},
+	}
+	var remote *p2p.Server
+	remote = newReleasedVersionsServer(t, remoteKey, []p2p.Protocol{
+		{
+			Name:    bzzSpec.Name,
+			Version: bzzSpec.Version,
+			Length:  bzzSpec.Length(),
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				remoteAddr := newBzzHandshakeMsg(14, TestProtocolNetworkID, NewBzzAddr(PrivateKeyToBzzKey(remoteKey), []byte(remote.Self().String())), false).Addr
+				hs := &releasedHandshakeMsg{
+					Version:   14,
+					NetworkID: TestProtocolNetworkID,
+					Addr:      (*legacyBzzAddr)(remoteAddr),
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), bzzHandshakeTimeout)
+				defer cancel()
+				rhs, err := protocols.NewPeer(p, rw, bzzSpec).Handshake(ctx, hs, nil)
+				if err != nil {
+					return err
+				}
+				handshakes <- rhs.(*releasedHandshakeMsg)
+				for {
+					msg, err := rw.ReadMsg()
+					if err != nil {
+						return err
+					}
+					msg.Discard()
+				}
+			},
+		},
+		{
+			Name:    hiveSpec.Name,
+			Version: hiveSpec.Version,
+			Length:  hiveSpec.Length(),
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				return protocols.NewPeer(p, rw, hiveSpec).Run(func(ctx context.Context, msg interface{}) error {
+					if msg, ok := msg.(*subPeersMsg); ok {
+						select {
+						case depths <- msg.Depth:
+						default:
+						}
+					}
+					return nil
+				})
+			},
+		},
+	})
+	defer remote.Stop()
+
+	remote.AddPeer(local.Self())
+	select {
+	case rhs := <-handshakes:
+		if rhs.Version != 14 {
+			t.Fatalf("expected handshake version 14, got %d", rhs.Version)
+		}
+		if !bytes.Equal(rhs.Addr.OAddr, addr.OAddr) {
+			t.Fatalf("expected overlay %x, got %x", addr.OAddr, rhs.Addr.OAddr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the handshake")
+	}
+	select {
+	case <-depths:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the depth notification of the hive protocol")
+	}
+	remoteOver := PrivateKeyToBzzKey(remoteKey)
+	var connected bool
+	bzz.Kademlia.EachConn(nil, 255, func(p *Peer, _ int) bool {
+		connected = bytes.Equal(p.Address(), remoteOver)
+		return !connected
+	})
+	if !connected {
+		t.Fatal("expected the peer running the released versions to be connected")
+	}
+}
+
+func newReleasedVersionsServer(t *testing.T, key *ecdsa.PrivateKey, protocols []p2p.Protocol) *p2p.Server {
+	t.Helper()
+	srv := &p2p.Server{
+		Config: p2p.Config{
+			PrivateKey:  key,
+			MaxPeers:    1,
+			NoDiscovery: true,
+			ListenAddr:  "127.0.0.1:0",
+			Protocols:   protocols,
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
 func TestBzzHandshakeLightNode(t *testing.T) {
 	var lightNodeTests = []struct {
 		name      string
@@ -408,9 +600,127 @@ func TestBzzHandshakeLightNode(t *testing.T) {
 						t.Fatalf("peer LightNode flag is %v, should be %v", cp.String(), nodeCapability.String())
 					}
 				}
+				if IsLightNode(pt.bzz.handshakes[node.ID()].peerAddr.Capabilities) != test.lightNode {
+					t.Fatalf("expected IsLightNode %v", test.lightNode)
+				}
 			case <-time.After(10 * time.Second):
 				t.Fatal("test timeout")
 			}
 		})
 	}
 }
+
+func newPrivateBzzHandshakeTester(prvkey, authorityKey *ecdsa.PrivateKey) (*bzzTester, error) {
+	var record enr.Record
+	bzzkey := PrivateKeyToBzzKey(prvkey)
+	record.Set(NewENRAddrEntry(bzzkey))
+	err := enode.SignV4(&record, prvkey)
+	if err != nil {
+		return nil, err
+	}
+	nod, err := enode.New(enode.V4ID{}, &record)
+	if err != nil {
+		return nil, err
+	}
+	addr := getENRBzzAddr(nod)
+	credential, err := NewCredential(authorityKey, DefaultTestNetworkID, nod.ID(), time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	config := &BzzConfig{
+		Address:          addr,
+		HiveParams:       NewHiveParams(),
+		NetworkID:        DefaultTestNetworkID,
+		NetworkAuthority: crypto.PubkeyToAddress(authorityKey.PublicKey),
+		Credential:       credential,
+	}
+	bzz := NewBzz(config, NewKademlia(addr.OAddr, NewKadParams()), nil, nil, nil, nil, nil)
+	pt := p2ptest.NewProtocolTester(prvkey, 1, bzz.runBzz)
+
+	return &bzzTester{
+		addr:           addr,
+		ProtocolTester: pt,
+		bzz:            bzz,
+	}, nil
+}
+
+// TestBzzHandshakePrivateNetwork tests that in private network mode
+// the handshake only succeeds with peers presenting a valid credential
+// issued for their own node key, and that the credential is forgotten once the peer drops
+func TestBzzHandshakePrivateNetwork(t *testing.T) {
+	authorityKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		issuer *ecdsa.PrivateKey
+		replay bool
+		err    error
+	}{
+		{"valid", authorityKey, false, nil},
+		{"missing", nil, false, ErrCredentialMissing},
+		{"other signer", otherKey, false, ErrCredentialSigner},
+		{"replayed", authorityKey, true, ErrCredentialMismatch},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prvkey, err := crypto.GenerateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, err := newPrivateBzzHandshakeTester(prvkey, authorityKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Stop()
+			node := s.Nodes[0]
+
+			lhs := correctBzzHandshake(s.addr, false)
+			lhs.Credential = s.bzz.credential
+			rhs := newBzzHandshakeMsg(TestProtocolVersion, TestProtocolNetworkID, NewBzzAddrFromEnode(node), false)
+			if tc.replay {
+				// the credential the node sent in its own handshake
+				rhs.Credential = s.bzz.credential
+			} else if tc.issuer != nil {
+				rhs.Credential, err = NewCredential(tc.issuer, TestProtocolNetworkID, node.ID(), time.Time{})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tc.err != nil {
+				err = s.testHandshake(lhs, rhs, &p2ptest.Disconnect{Peer: node.ID(), Error: fmt.Errorf("message handler: (msg code 0): invalid credential: %v", tc.err)})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s.bzz.Hive.gossipable(rhs.Addr) {
+					t.Fatal("expected peer without valid credential not to be gossipable")
+				}
+				return
+			}
+			err = s.testHandshake(lhs, rhs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !s.bzz.Hive.gossipable(rhs.Addr) {
+				t.Fatal("expected peer with valid credential to be gossipable")
+			}
+
+			for _, p := range s.Server.Peers() {
+				p.Disconnect(p2p.DiscRequested)
+			}
+			err = s.TestDisconnected(&p2ptest.Disconnect{Peer: node.ID(), Error: errors.New("disconnect requested")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.bzz.Hive.gossipable(rhs.Addr) {
+				t.Fatal("expected disconnected peer not to be gossipable")
+			}
+		})
+	}
+}
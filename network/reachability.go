@@ -0,0 +1,389 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/log"
+)
+
+/*
+Reachability self-test
+
+A node behind a NAT can connect to peers while the peers can not dial it back
+on its advertised underlay address. To find out, a node asks some of its connected
+peers to dial the underlay address it advertised in the bzz handshake and collects
+their answers in a ReachabilityReport.
+
+The peers only ever dial the IP address the requesting peer is connected from, on the
+TCP port it advertised, and at most once in reachabilityRequestInterval. The IP of the
+advertised address is not used, so the self-test can not be used to make a node dial
+a third party. The dial only opens a TCP connection, which is enough to tell whether
+the port is forwarded.
+
+A peer which fails to dial the address remembers the result for the enode ID of the
+requester for reachabilityRecordTTL and does not suggest the node in its kademlia table
+in the meantime. If the requester sets Hide, the peer also stops gossiping the address
+to its other peers.
+*/
+
+var (
+	// timeout for the peers to answer a reachability check
+	reachabilityTimeout = 10 * time.Second
+	// timeout for dialing the underlay address of a requesting peer
+	reachabilityDialTimeout = 5 * time.Second
+	// minimum interval between two reachability checks answered for the same peer
+	reachabilityRequestInterval = 30 * time.Second
+	// time for which the result of a dial is kept
+	reachabilityRecordTTL = 10 * time.Minute
+	// dialReachability opens a connection to the address of a peer to check
+	// its reachability, it is replaced in tests
+	dialReachability = net.DialTimeout
+	// remoteAddr returns the address of the live connection to a peer, it is replaced in tests
+	remoteAddr = func(p *Peer) net.Addr { return p.RemoteAddr() }
+
+	errNoReachabilityPeers = errors.New("no connected peers to check reachability")
+)
+
+// ReachabilityStatus tells whether a node can be dialed on its advertised underlay address
+type ReachabilityStatus string
+
+const (
+	Reachable           ReachabilityStatus = "reachable"
+	Unreachable         ReachabilityStatus = "unreachable"
+	ReachabilityUnknown ReachabilityStatus = "unknown" // no peer could check the address
+)
+
+// ReachabilityResult is the answer of a single peer to a reachability check
+type ReachabilityResult struct {
+	Peer   string             `json:"peer"`            // overlay address of the peer
+	Addr   string             `json:"addr,omitempty"`  // address the peer dialed
+	Status ReachabilityStatus `json:"status"`          // result of the dial
+	Error  string             `json:"error,omitempty"` // why the address could not be dialed or checked
+}
+
+// ReachabilityReport is the result of a reachability self-test
+type ReachabilityReport struct {
+	Status  ReachabilityStatus   `json:"status"`
+	Time    time.Time            `json:"time"`
+	Results []ReachabilityResult `json:"results"`
+}
+
+// newReachabilityReport aggregates the answers of the peers
+// the node is reachable if any of the peers could dial it and unreachable
+// if none could but at least one tried
+func newReachabilityReport(results []ReachabilityResult) *ReachabilityReport {
+	status := ReachabilityUnknown
+	for _, r := range results {
+		if r.Status == Reachable {
+			status = Reachable
+			break
+		}
+		if r.Status == Unreachable {
+			status = Unreachable
+		}
+	}
+	return &ReachabilityReport{
+		Status:  status,
+		Time:    time.Now(),
+		Results: results,
+	}
+}
+
+// reachabilityMsg asks the peer to dial the underlay address advertised in the handshake
+type reachabilityMsg struct {
+	Ruid uint64
+	Hide bool // do not gossip the address if it can not be dialed
+}
+
+// String pretty prints a reachabilityMsg
+func (msg reachabilityMsg) String() string {
+	return fmt.Sprintf("%T: ruid %d hide %v", msg, msg.Ruid, msg.Hide)
+}
+
+// reachabilityResultMsg is the answer to a reachabilityMsg
+type reachabilityResultMsg struct {
+	Ruid      uint64
+	Addr      string // address which was dialed
+	Dialed    bool   // false if the address was not dialed
+	Reachable bool   // true if the dial succeeded
+	Error     string
+}
+
+// String pretty prints a reachabilityResultMsg
+func (msg reachabilityResultMsg) String() string {
+	return fmt.Sprintf("%T: ruid %d addr %s dialed %v reachable %v error %q", msg, msg.Ruid, msg.Addr, msg.Dialed, msg.Reachable, msg.Error)
+}
+
+// reachabilityRecord is the result of dialing the address of a peer which requested a check
+type reachabilityRecord struct {
+	reachable bool
+	hide      bool
+	checked   time.Time
+}
+
+// reachability holds the state of the reachability checks of the hive
+type reachability struct {
+	mu      sync.Mutex
+	records map[enode.ID]*reachabilityRecord       // results of the checks answered, keyed by enode ID
+	pending map[uint64]chan *reachabilityResultMsg // requests waiting for an answer
+	peers   map[uint64]enode.ID                    // peer each pending request was sent to
+	last    map[enode.ID]time.Time                 // time of the last check answered for a peer
+	report  *ReachabilityReport                    // result of the last self-test
+}
+
+func newReachability() *reachability {
+	return &reachability{
+		records: make(map[enode.ID]*reachabilityRecord),
+		pending: make(map[uint64]chan *reachabilityResultMsg),
+		peers:   make(map[uint64]enode.ID),
+		last:    make(map[enode.ID]time.Time),
+	}
+}
+
+// record returns the unexpired result of dialing the address, or nil
+func (r *reachability) record(a *BzzAddr) *reachabilityRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := a.ID()
+	rec, ok := r.records[id]
+	if !ok {
+		return nil
+	}
+	if time.Since(rec.checked) > reachabilityRecordTTL {
+		delete(r.records, id)
+		return nil
+	}
+	return rec
+}
+
+// prune removes the expired records and request times, must be called with the lock held
+func (r *reachability) prune(now time.Time) {
+	for id, last := range r.last {
+		if now.Sub(last) >= reachabilityRequestInterval {
+			delete(r.last, id)
+		}
+	}
+	for id, rec := range r.records {
+		if now.Sub(rec.checked) > reachabilityRecordTTL {
+			delete(r.records, id)
+		}
+	}
+}
+
+// dialable is composed into KadParams.Reachable
+// it returns false for addresses which recently failed a reachability check
+func (h *Hive) dialable(a *BzzAddr) bool {
+	rec := h.reachability.record(a)
+	return rec == nil || rec.reachable
+}
+
+// hidden returns true for addresses which recently failed a reachability check
+// and which the owner asked not to be gossiped in that case
+func (h *Hive) hidden(a *BzzAddr) bool {
+	rec := h.reachability.record(a)
+	return rec != nil && !rec.reachable && rec.hide
+}
+
+// CheckReachability asks up to ReachabilityPeers connected peers to dial
+// the underlay address of the node and returns their aggregated answers
+func (h *Hive) CheckReachability(ctx context.Context) (*ReachabilityReport, error) {
+	var peers []*Peer
+	h.EachConn(nil, 255, func(p *Peer, _ int) bool {
+		// peers running an old version of the hive protocol do not know the reachability messages
+		if p.Version() < reachabilityHiveVersion {
+			return true
+		}
+		peers = append(peers, p)
+		return len(peers) < int(h.ReachabilityPeers)
+	})
+	if len(peers) == 0 {
+		return nil, errNoReachabilityPeers
+	}
+	ctx, cancel := context.WithTimeout(ctx, reachabilityTimeout)
+	defer cancel()
+
+	results := make([]ReachabilityResult, len(peers))
+	var wg sync.WaitGroup
+	for i, p := range peers {
+		wg.Add(1)
+		go func(i int, p *Peer) {
+			defer wg.Done()
+			results[i] = h.requestReachability(ctx, p)
+		}(i, p)
+	}
+	wg.Wait()
+
+	report := newReachabilityReport(results)
+	h.reachability.mu.Lock()
+	h.reachability.report = report
+	h.reachability.mu.Unlock()
+
+	metrics.GetOrRegisterCounter(fmt.Sprintf("hive/reachability/%s", report.Status), nil).Inc(1)
+	if report.Status == Unreachable {
+		log.Warn("node is not reachable on its advertised address, check the port forwarding and the --nat setting", "results", len(results))
+	} else {
+		log.Debug("reachability check", "status", report.Status)
+	}
+	return report, nil
+}
+
+// Reachability returns the report of the last reachability check, nil if there was none
+func (h *Hive) Reachability() *ReachabilityReport {
+	h.reachability.mu.Lock()
+	defer h.reachability.mu.Unlock()
+	return h.reachability.report
+}
+
+// requestReachability sends a reachabilityMsg to the peer and waits for the answer
+func (h *Hive) requestReachability(ctx context.Context, p *Peer) ReachabilityResult {
+	result := ReachabilityResult{
+		Peer:   hexutil.Encode(p.Address()),
+		Status: ReachabilityUnknown,
+	}
+	ruid := rand.Uint64()
+	c := make(chan *reachabilityResultMsg, 1)
+	r := h.reachability
+	r.mu.Lock()
+	r.pending[ruid] = c
+	r.peers[ruid] = p.ID()
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, ruid)
+		delete(r.peers, ruid)
+		r.mu.Unlock()
+	}()
+
+	if err := p.Send(ctx, &reachabilityMsg{Ruid: ruid, Hide: h.HideUnreachable}); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	select {
+	case msg := <-c:
+		result.Addr = msg.Addr
+		result.Error = msg.Error
+		switch {
+		case msg.Reachable:
+			result.Status = Reachable
+		case msg.Dialed:
+			result.Status = Unreachable
+		}
+	case <-ctx.Done():
+		result.Error = ctx.Err().Error()
+	}
+	return result
+}
+
+// handleReachabilityMsg dials the advertised address of the peer and sends back the result
+func (h *Hive) handleReachabilityMsg(ctx context.Context, d *Peer, msg *reachabilityMsg) error {
+	resp := &reachabilityResultMsg{Ruid: msg.Ruid}
+	now := time.Now()
+	r := h.reachability
+	r.mu.Lock()
+	last, ok := r.last[d.ID()]
+	if ok && now.Sub(last) < reachabilityRequestInterval {
+		r.mu.Unlock()
+		resp.Error = "too many reachability requests"
+		go d.Send(ctx, resp)
+		return nil
+	}
+	r.last[d.ID()] = now
+	r.prune(now)
+	r.mu.Unlock()
+
+	go func() {
+		resp.Addr, resp.Dialed, resp.Reachable, resp.Error = h.dialPeer(d)
+		if resp.Dialed {
+			r.mu.Lock()
+			r.records[d.ID()] = &reachabilityRecord{
+				reachable: resp.Reachable,
+				hide:      msg.Hide,
+				checked:   time.Now(),
+			}
+			r.mu.Unlock()
+		}
+		d.Send(ctx, resp)
+	}()
+	return nil
+}
+
+// dialPeer opens a TCP connection to the advertised port of the peer
+// on the IP address of the live connection to it
+func (h *Hive) dialPeer(d *Peer) (addr string, dialed bool, reachable bool, errString string) {
+	node, err := enode.ParseV4(string(d.Under()))
+	if err != nil {
+		return "", false, false, fmt.Sprintf("invalid underlay address: %v", err)
+	}
+	if node.TCP() == 0 {
+		return "", false, false, "underlay address has no TCP port"
+	}
+	tcp, ok := remoteAddr(d).(*net.TCPAddr)
+	if !ok || tcp.IP == nil || tcp.IP.IsUnspecified() {
+		return "", false, false, "connection has no remote IP"
+	}
+	addr = net.JoinHostPort(tcp.IP.String(), strconv.Itoa(node.TCP()))
+	conn, err := dialReachability("tcp", addr, reachabilityDialTimeout)
+	if err != nil {
+		log.Debug("reachability check: dial failed", "peer", d, "addr", addr, "err", err)
+		return addr, true, false, err.Error()
+	}
+	conn.Close()
+	return addr, true, true, ""
+}
+
+// handleReachabilityResultMsg passes the answer to the waiting request
+// answers arriving after the request timed out are dropped
+func (h *Hive) handleReachabilityResultMsg(d *Peer, msg *reachabilityResultMsg) error {
+	r := h.reachability
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.pending[msg.Ruid]
+	if !ok || r.peers[msg.Ruid] != d.ID() {
+		return nil
+	}
+	delete(r.pending, msg.Ruid)
+	c <- msg
+	return nil
+}
+
+// checkReachabilityLoop runs the reachability self-test every ReachabilityCheckInterval
+func (h *Hive) checkReachabilityLoop() {
+	ticker := time.NewTicker(h.ReachabilityCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := h.CheckReachability(context.Background()); err != nil {
+				log.Debug("reachability check failed", "err", err)
+			}
+		case <-h.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/p2p/protocols"
+	"github.com/ethersphere/swarm/pot"
+)
+
+// reachabilityNode is a hive with the bzz address it advertises
+type reachabilityNode struct {
+	hive *Hive
+	addr *BzzAddr
+	id   enode.ID
+}
+
+func newReachabilityNode(t *testing.T, port int, params *HiveParams) *reachabilityNode {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nod := enode.NewV4(&key.PublicKey, net.IPv4(192, 0, 2, 1), port, 0)
+	oaddr := pot.RandomAddress()
+	addr := NewBzzAddr(oaddr[:], []byte(nod.String()))
+	return &reachabilityNode{
+		hive: NewHive(params, NewKademlia(addr.Over(), NewKadParams()), nil),
+		addr: addr,
+		id:   nod.ID(),
+	}
+}
+
+// connectReachabilityNodes runs the hive protocol between the two nodes over a message pipe
+func connectReachabilityNodes(a, b *reachabilityNode) (disconnect func()) {
+	rwa, rwb := p2p.MsgPipe()
+	peerB := &BzzPeer{Peer: protocols.NewPeer(p2p.NewPeer(b.id, "b", nil), rwa, DiscoverySpec), BzzAddr: b.addr}
+	peerA := &BzzPeer{Peer: protocols.NewPeer(p2p.NewPeer(a.id, "a", nil), rwb, DiscoverySpec), BzzAddr: a.addr}
+	go a.hive.Run(peerB)
+	go b.hive.Run(peerA)
+	return func() {
+		rwa.Close()
+		rwb.Close()
+	}
+}
+
+// waitConn waits until the hive has a connection
+func waitConn(t *testing.T, h *Hive) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		n := 0
+		h.EachConn(nil, 255, func(*Peer, int) bool {
+			n++
+			return true
+		})
+		if n > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestReachabilityCheck tests that a node learns whether a peer can dial its advertised address,
+// that the peer does not suggest and does not gossip an unreachable address if asked so,
+// and that repeated requests are refused
+// the peer dials the IP of the connection on the advertised port, not the advertised IP
+func TestReachabilityCheck(t *testing.T) {
+	defer func(f func(string, string, time.Duration) (net.Conn, error)) { dialReachability = f }(dialReachability)
+	defer func(f func(*Peer) net.Addr) { remoteAddr = f }(remoteAddr)
+	remoteAddr = func(*Peer) net.Addr {
+		return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 41234}
+	}
+	var dialed []string
+	reachable := true
+	dialReachability = func(network, addr string, _ time.Duration) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		if !reachable {
+			return nil, errors.New("connection refused")
+		}
+		c, _ := net.Pipe()
+		return c, nil
+	}
+
+	params := NewHiveParams()
+	params.HideUnreachable = true
+	a := newReachabilityNode(t, 30399, params)
+	b := newReachabilityNode(t, 30400, NewHiveParams())
+	disconnect := connectReachabilityNodes(a, b)
+	defer disconnect()
+	waitConn(t, a.hive)
+
+	report, err := a.hive.CheckReachability(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != Reachable || len(report.Results) != 1 || report.Results[0].Addr != "127.0.0.1:30399" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if len(dialed) != 1 || dialed[0] != "127.0.0.1:30399" {
+		t.Fatalf("expected the advertised address dialed once, got %v", dialed)
+	}
+	if a.hive.Reachability() != report {
+		t.Fatal("expected the last report stored")
+	}
+
+	// a repeated request is refused without dialing
+	report, err = a.hive.CheckReachability(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != ReachabilityUnknown || report.Results[0].Error == "" || len(dialed) != 1 {
+		t.Fatalf("expected the request refused, got %+v", report)
+	}
+
+	defer func(d time.Duration) { reachabilityRequestInterval = d }(reachabilityRequestInterval)
+	reachabilityRequestInterval = 0
+	reachable = false
+	report, err = a.hive.CheckReachability(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != Unreachable || report.Results[0].Error != "connection refused" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if b.hive.Reachable(a.addr) {
+		t.Fatal("expected the unreachable address not to be suggested")
+	}
+	if b.hive.gossipable(a.addr) {
+		t.Fatal("expected the unreachable address not to be gossiped")
+	}
+}
+
+// TestReachabilityReport tests the aggregation of the answers of the peers
+func TestReachabilityReport(t *testing.T) {
+	for _, tc := range []struct {
+		results []ReachabilityStatus
+		status  ReachabilityStatus
+	}{
+		{nil, ReachabilityUnknown},
+		{[]ReachabilityStatus{ReachabilityUnknown, ReachabilityUnknown}, ReachabilityUnknown},
+		{[]ReachabilityStatus{ReachabilityUnknown, Unreachable}, Unreachable},
+		{[]ReachabilityStatus{Unreachable, Reachable, ReachabilityUnknown}, Reachable},
+	} {
+		var results []ReachabilityResult
+		for _, s := range tc.results {
+			results = append(results, ReachabilityResult{Status: s})
+		}
+		if status := newReachabilityReport(results).Status; status != tc.status {
+			t.Errorf("results %v: expected status %s, got %s", tc.results, tc.status, status)
+		}
+	}
+}
+
+// TestReachabilityNoPeers tests that a check without connected peers fails
+func TestReachabilityNoPeers(t *testing.T) {
+	a := newReachabilityNode(t, 30399, NewHiveParams())
+	if _, err := a.hive.CheckReachability(context.Background()); err != errNoReachabilityPeers {
+		t.Fatalf("expected error %v, got %v", errNoReachabilityPeers, err)
+	}
+}
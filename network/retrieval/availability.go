@@ -0,0 +1,346 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package retrieval
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/network/bitvector"
+	"github.com/ethersphere/swarm/network/timeouts"
+	"github.com/ethersphere/swarm/p2p/protocols"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// the first version of the protocol with the ChunkAvailability message
+const availabilityVersion = 3
+
+var (
+	// interval at which the neighbours are sent the summary of the chunks held
+	availabilityInterval = time.Minute
+	// a summary received is no longer used after this time
+	availabilityTTL = 3 * availabilityInterval
+	// bits of the filter per chunk, with the optimal number of hashes
+	// this gives a false positive rate of about 1%
+	availabilityBitsPerChunk = 10
+	availabilityHashes       = 7
+	// the summary sent is extended with the chunks stored since it was built,
+	// it is built anew after this time as garbage collected chunks cannot be removed from it
+	availabilityRebuildInterval = 30 * time.Minute
+	// bounds of the size of the filter in bytes, the maximum size holds about
+	// 840 thousand chunks at the 1% false positive rate, with more chunks in the
+	// neighbourhood the rate grows and more retrieve requests go to peers
+	// which do not hold the chunk
+	availabilityMinSize = 128
+	availabilityMaxSize = 1024 * 1024
+
+	errInvalidAvailability = errors.New("invalid chunk availability")
+)
+
+// ChunkAvailability is the summary of the chunks held by a node in its neighbourhood:
+// a Bloom filter over the addresses of the chunks in its bins from Depth.
+// Nodes send it to their neighbours periodically so that retrieve requests can be sent
+// to the peer that likely holds the chunk rather than one that merely forwards it
+type ChunkAvailability struct {
+	Depth  uint8  // the filter covers the chunks with at least this proximity to the sender
+	Hashes uint8  // number of hash functions
+	Filter []byte // bits of the filter
+}
+
+// bloomFilter is a Bloom filter of chunk addresses on a bit vector
+type bloomFilter struct {
+	bv     *bitvector.BitVector
+	bits   uint64
+	hashes int
+}
+
+func newBloomFilter(size int, hashes int) *bloomFilter {
+	bv, _ := bitvector.NewFromBytes(make([]byte, size), size*8)
+	return &bloomFilter{bv: bv, bits: uint64(size * 8), hashes: hashes}
+}
+
+func bloomFilterFromBytes(b []byte, hashes int) (*bloomFilter, error) {
+	bv, err := bitvector.NewFromBytes(b, len(b)*8)
+	if err != nil {
+		return nil, err
+	}
+	return &bloomFilter{bv: bv, bits: uint64(len(b) * 8), hashes: hashes}, nil
+}
+
+// indexes calls f with the bits of the address by double hashing.
+// Chunk addresses are hashes already, the last bytes are used as the first ones
+// of the addresses in a neighbourhood are the same
+func (b *bloomFilter) indexes(addr chunk.Address, f func(i int) bool) bool {
+	if len(addr) < 32 {
+		return false
+	}
+	h1 := binary.BigEndian.Uint64(addr[16:24])
+	h2 := binary.BigEndian.Uint64(addr[24:32]) | 1
+	for i := 0; i < b.hashes; i++ {
+		if !f(int((h1 + uint64(i)*h2) % b.bits)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bloomFilter) add(addr chunk.Address) {
+	b.indexes(addr, func(i int) bool {
+		b.bv.Set(i)
+		return true
+	})
+}
+
+func (b *bloomFilter) has(addr chunk.Address) bool {
+	return b.indexes(addr, b.bv.Get)
+}
+
+// availabilitySummary is the summary of the chunks held last built by the node
+type availabilitySummary struct {
+	mu     sync.Mutex
+	depth  int
+	filter *bloomFilter
+	size   int              // size of the filter in bytes
+	lasts  map[uint8]uint64 // the last bin ids of the chunks added to the filter
+	built  time.Time
+}
+
+// availability is a chunk availability summary received from a peer
+type availability struct {
+	depth    int
+	filter   *bloomFilter
+	received time.Time
+}
+
+// has returns true if the peer with the given overlay address likely holds the chunk
+func (a *availability) has(peer []byte, addr chunk.Address, now time.Time) bool {
+	if now.Sub(a.received) > availabilityTTL {
+		return false
+	}
+	if chunk.Proximity(peer, addr) < a.depth {
+		return false
+	}
+	return a.filter.has(addr)
+}
+
+func (p *Peer) setAvailability(a *availability) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.availability = a
+}
+
+// holds returns true if the peer likely holds the chunk according to its last summary
+func (p *Peer) holds(addr chunk.Address) bool {
+	p.mtx.Lock()
+	a := p.availability
+	p.mtx.Unlock()
+	return a != nil && a.has(p.BzzAddr.Over(), addr, time.Now())
+}
+
+// handleChunkAvailability stores the summary of the chunks held by a neighbour
+func (r *Retrieval) handleChunkAvailability(ctx context.Context, p *Peer, msg *ChunkAvailability) error {
+	metrics.GetOrRegisterCounter("network/retrieve/availability/received", nil).Inc(1)
+	if network.IsLightNode(p.Capabilities) {
+		return nil
+	}
+	if msg.Hashes == 0 || int(msg.Hashes) > 2*availabilityHashes || len(msg.Filter) < availabilityMinSize || len(msg.Filter) > availabilityMaxSize {
+		return protocols.Break(fmt.Errorf("%w: depth %d, hashes %d, size %d", errInvalidAvailability, msg.Depth, msg.Hashes, len(msg.Filter)))
+	}
+	filter, err := bloomFilterFromBytes(msg.Filter, int(msg.Hashes))
+	if err != nil {
+		return protocols.Break(fmt.Errorf("%w: %v", errInvalidAvailability, err))
+	}
+	p.setAvailability(&availability{
+		depth:    int(msg.Depth),
+		filter:   filter,
+		received: time.Now(),
+	})
+	return nil
+}
+
+// availabilityLoop sends the summary of the chunks held to the neighbours periodically
+func (r *Retrieval) availabilityLoop() {
+	ticker := time.NewTicker(availabilityInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.sendAvailability(); err != nil {
+				r.logger.Debug("sending chunk availability", "err", err)
+			}
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+// sendAvailability sends the summary of the chunks held within depth to the neighbours
+// which support it
+func (r *Retrieval) sendAvailability() error {
+	depth := r.kad.NeighbourhoodDepth()
+	var neighbours []*Peer
+	r.mtx.RLock()
+	for _, p := range r.peers {
+		if p.Version() >= availabilityVersion && chunk.Proximity(p.BzzAddr.Over(), r.kad.BaseAddr()) >= depth {
+			neighbours = append(neighbours, p)
+		}
+	}
+	r.mtx.RUnlock()
+	if len(neighbours) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msg, err := r.availability(ctx, depth)
+	if err != nil {
+		return err
+	}
+	for _, p := range neighbours {
+		if err := p.Send(ctx, msg); err != nil {
+			p.logger.Debug("sending chunk availability", "err", err)
+			continue
+		}
+		metrics.GetOrRegisterCounter("network/retrieve/availability/sent", nil).Inc(1)
+	}
+	return nil
+}
+
+// availability returns the summary of the chunks in the bins from depth.
+// The summary last built is extended with the chunks stored since, unless the depth
+// changed, the chunks no longer fit in the filter or it is due to be built anew
+func (r *Retrieval) availability(ctx context.Context, depth int) (*ChunkAvailability, error) {
+	// the last bin ids bound the number of chunks in the bins
+	lasts := make(map[uint8]uint64)
+	var count uint64
+	for bin := uint8(depth); bin <= chunk.MaxPO; bin++ {
+		last, err := r.netStore.LastPullSubscriptionBinID(bin)
+		if err != nil {
+			return nil, err
+		}
+		lasts[bin] = last
+		count += last
+	}
+	size := int(count) * availabilityBitsPerChunk / 8
+	if size < availabilityMinSize {
+		size = availabilityMinSize
+	} else if size > availabilityMaxSize {
+		size = availabilityMaxSize
+	}
+
+	s := r.summary
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.filter == nil || s.depth != depth || size > s.size || time.Since(s.built) > availabilityRebuildInterval {
+		// leave room for the chunks to come so that the filter is not built anew at every interval
+		s.size = 2 * size
+		if s.size > availabilityMaxSize {
+			s.size = availabilityMaxSize
+		}
+		s.depth = depth
+		s.filter = newBloomFilter(s.size, availabilityHashes)
+		s.lasts = make(map[uint8]uint64)
+		s.built = time.Now()
+		metrics.GetOrRegisterCounter("network/retrieve/availability/build", nil).Inc(1)
+	}
+	for bin, last := range lasts {
+		since := s.lasts[bin]
+		if last <= since {
+			continue
+		}
+		if err := r.iterateBin(ctx, bin, since+1, last, s.filter.add); err != nil {
+			// the chunks added so far are kept, the rest are added from the same bin id next time
+			return nil, err
+		}
+		s.lasts[bin] = last
+	}
+	filter := make([]byte, s.size)
+	copy(filter, s.filter.bv.Bytes())
+	return &ChunkAvailability{
+		Depth:  uint8(depth),
+		Hashes: uint8(availabilityHashes),
+		Filter: filter,
+	}, nil
+}
+
+// iterateBin calls f with the addresses of the chunks in the bin from the bin id since up to last
+func (r *Retrieval) iterateBin(ctx context.Context, bin uint8, since, last uint64, f func(chunk.Address)) error {
+	descriptors, stop := r.netStore.SubscribePull(ctx, bin, since, last)
+	defer stop()
+	timer := time.NewTimer(timeouts.BatchTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case d, ok := <-descriptors:
+			if !ok {
+				return nil
+			}
+			f(d.Address)
+			if d.BinID >= last {
+				return nil
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(timeouts.BatchTimeout)
+		case <-timer.C:
+			// chunks up to last may have been garbage collected
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.quit:
+			return errors.New("retrieval stopped")
+		}
+	}
+}
+
+// findHolder returns the neighbour closest to the chunk which likely holds it
+// according to its chunk availability summary
+func (r *Retrieval) findHolder(req *storage.Request, depth int) (retPeer *network.Peer) {
+	r.kademliaLB.EachBinDesc(req.Addr, func(bin network.LBBin) bool {
+		for _, lbPeer := range bin.LBPeers {
+			id := lbPeer.Peer.ID()
+			if !lbPeer.Peer.HasCap(r.spec.Name) || network.IsLightNode(lbPeer.Peer.Capabilities) {
+				continue
+			}
+			if req.Origin == id || req.SkipPeer(id.String()) {
+				continue
+			}
+			if chunk.Proximity(lbPeer.Peer.Over(), r.kad.BaseAddr()) < depth {
+				continue
+			}
+			p := r.getPeer(id)
+			if p == nil || !p.holds(req.Addr) {
+				continue
+			}
+			retPeer = lbPeer.Peer
+			lbPeer.AddUseCount()
+			return false
+		}
+		return true
+	})
+	if retPeer != nil {
+		metrics.GetOrRegisterCounter("network/retrieve/availability/hit", nil).Inc(1)
+	}
+	return retPeer
+}
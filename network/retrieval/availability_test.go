@@ -0,0 +1,230 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package retrieval
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/chunk"
+	chunktesting "github.com/ethersphere/swarm/chunk/testing"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/p2p/protocols"
+	p2ptest "github.com/ethersphere/swarm/p2p/testing"
+	"github.com/ethersphere/swarm/pot"
+	"github.com/ethersphere/swarm/storage"
+)
+
+// TestBloomFilter tests that the filter has all the addresses added
+// and a low false positive rate
+func TestBloomFilter(t *testing.T) {
+	n := 1000
+	filter := newBloomFilter(n*availabilityBitsPerChunk/8, availabilityHashes)
+	var added []chunk.Address
+	for i := 0; i < n; i++ {
+		addr := pot.RandomAddress()
+		filter.add(addr[:])
+		added = append(added, addr[:])
+	}
+	for _, addr := range added {
+		if !filter.has(addr) {
+			t.Fatalf("expected address %s in the filter", addr)
+		}
+	}
+	var positives int
+	for i := 0; i < 10*n; i++ {
+		addr := pot.RandomAddress()
+		if filter.has(addr[:]) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / float64(10*n); rate > 0.03 {
+		t.Fatalf("false positive rate too high: %v", rate)
+	}
+
+	decoded, err := bloomFilterFromBytes(filter.bv.Bytes(), availabilityHashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range added {
+		if !decoded.has(addr) {
+			t.Fatalf("expected address %s in the decoded filter", addr)
+		}
+	}
+}
+
+// TestChunkAvailabilityExchange tests that a node sends the summary of its chunks
+// to its neighbours and that the summary received tells the chunks held by the peer
+func TestChunkAvailabilityExchange(t *testing.T) {
+	pk, ns, cleanup := newTestNetstore(t)
+	defer cleanup()
+	kad := network.NewKademlia(network.PrivateKeyToBzzKey(pk), network.NewKadParams())
+
+	chunks := chunktesting.GenerateTestRandomChunks(50)
+	if _, err := ns.Put(context.Background(), chunk.ModePutUpload, chunks...); err != nil {
+		t.Fatal(err)
+	}
+
+	tester, r, teardown, err := newRetrievalTester(t, pk, ns, kad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardown()
+	node := tester.Nodes[0]
+
+	msg, err := r.availability(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000 && r.getPeer(node.ID()) == nil; i++ {
+		time.Sleep(1 * time.Millisecond)
+	}
+	if r.getPeer(node.ID()) == nil {
+		t.Fatal("expected peer")
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- r.sendAvailability()
+	}()
+	err = tester.TestExchanges(p2ptest.Exchange{
+		Label: "Chunk availability sent to neighbours",
+		Expects: []p2ptest.Expect{
+			{
+				Code: 2,
+				Msg:  msg,
+				Peer: node.ID(),
+			},
+		},
+	}, p2ptest.Exchange{
+		Label: "Chunk availability received from a neighbour",
+		Triggers: []p2ptest.Trigger{
+			{
+				Code: 2,
+				Msg:  msg,
+				Peer: node.ID(),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	p := r.getPeer(node.ID())
+	for i := 0; i < 1000 && !p.holds(chunks[0].Address()); i++ {
+		time.Sleep(1 * time.Millisecond)
+	}
+	for _, c := range chunks {
+		if !p.holds(c.Address()) {
+			t.Fatalf("expected the peer to hold chunk %s", c.Address())
+		}
+	}
+}
+
+// TestChunkAvailabilityIncremental tests that the summary is extended with the chunks
+// stored since it was built and that it is built anew once it is due
+func TestChunkAvailabilityIncremental(t *testing.T) {
+	pk, ns, cleanup := newTestNetstore(t)
+	defer cleanup()
+	base := network.PrivateKeyToBzzKey(pk)
+	r := New(network.NewKademlia(base, network.NewKadParams()), ns, network.NewBzzAddr(base, nil), nil)
+
+	chunks := chunktesting.GenerateTestRandomChunks(50)
+	if _, err := ns.Put(context.Background(), chunk.ModePutUpload, chunks[:25]...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.availability(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	built := r.summary.built
+
+	if _, err := ns.Put(context.Background(), chunk.ModePutUpload, chunks[25:]...); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := r.availability(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.summary.built != built {
+		t.Fatal("expected the summary to be extended")
+	}
+	filter, err := bloomFilterFromBytes(msg.Filter, int(msg.Hashes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range chunks {
+		if !filter.has(c.Address()) {
+			t.Fatalf("expected chunk %s in the summary", c.Address())
+		}
+	}
+
+	defer func(d time.Duration) { availabilityRebuildInterval = d }(availabilityRebuildInterval)
+	availabilityRebuildInterval = 0
+	if _, err := r.availability(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if r.summary.built == built {
+		t.Fatal("expected the summary to be built anew")
+	}
+}
+
+// TestFindHolder tests that a retrieve request is sent to a neighbour which likely holds the chunk
+// rather than to the peer closest to the chunk, as long as its summary is not expired
+func TestFindHolder(t *testing.T) {
+	addr := network.RandomBzzAddr()
+	kad := network.NewKademlia(addr.Over(), network.NewKadParams())
+	r := New(kad, nil, addr, nil)
+
+	chunkAddr := storage.Address(hash0[:])
+	newPeer := func(id enode.ID, po int) *network.Peer {
+		oaddr := pot.RandomAddressAt(pot.NewAddressFromBytes(chunkAddr), po)
+		bp := &network.BzzPeer{
+			BzzAddr: network.NewBzzAddr(oaddr[:], nil).WithCapabilities(network.NewFullNodeCapabilities()),
+			Peer:    protocols.NewPeer(p2p.NewPeer(id, "dummy", []p2p.Cap{{Name: "bzz-retrieve", Version: availabilityVersion}}), nil, spec),
+		}
+		peer := network.NewPeer(bp, kad)
+		kad.On(peer)
+		r.addPeer(NewPeer(bp, addr))
+		return peer
+	}
+	closest := newPeer(enode.ID{1}, 10)
+	holder := newPeer(enode.ID{2}, 2)
+
+	req := storage.NewRequest(chunkAddr)
+	if p, err := r.findPeerLB(context.Background(), req); err != nil || p.ID() != closest.ID() {
+		t.Fatalf("expected the closest peer without summaries, got %v, %v", p, err)
+	}
+
+	filter := newBloomFilter(availabilityMinSize, availabilityHashes)
+	filter.add(chunkAddr)
+	r.getPeer(holder.ID()).setAvailability(&availability{filter: filter, received: time.Now()})
+	if p, err := r.findPeerLB(context.Background(), req); err != nil || p.ID() != holder.ID() {
+		t.Fatalf("expected the holder of the chunk, got %v, %v", p, err)
+	}
+
+	// expired summaries are not used
+	r.getPeer(holder.ID()).setAvailability(&availability{filter: filter, received: time.Now().Add(-2 * availabilityTTL)})
+	if p, err := r.findPeerLB(context.Background(), req); err != nil || p.ID() != closest.ID() {
+		t.Fatalf("expected the closest peer with an expired summary, got %v, %v", p, err)
+	}
+}
@@ -27,13 +27,26 @@ import (
 	"github.com/ethersphere/swarm/storage"
 )
 
+// number of closed retrievals remembered to recognise duplicate deliveries
+const closedRetrievalsCapacity = 256
+
+var (
+	errUnsolicited     = errors.New("cannot find ruid")
+	errDuplicate       = errors.New("retrieve request already closed")
+	errAddressMismatch = errors.New("retrieve request found but address does not match")
+)
+
 // Peer wraps BzzPeer with a contextual logger and tracks open
 // retrievals for that peer
 type Peer struct {
 	*network.BzzPeer
-	logger     log.Logger             // logger with base and peer address
-	mtx        sync.Mutex             // synchronize retrievals
-	retrievals map[uint]chunk.Address // current ongoing retrievals
+	logger       log.Logger             // logger with base and peer address
+	mtx          sync.Mutex             // synchronize retrievals
+	retrievals   map[uint]chunk.Address // current ongoing retrievals
+	closed       map[uint]struct{}      // recently delivered or expired retrievals
+	closedRing   []uint                 // closed retrievals in the order they are forgotten
+	closedNext   int                    // next position in closedRing
+	availability *availability          // summary of the chunks held by the peer
 }
 
 // NewPeer is the constructor for Peer
@@ -42,6 +55,8 @@ func NewPeer(peer *network.BzzPeer, baseKey *network.BzzAddr) *Peer {
 		BzzPeer:    peer,
 		logger:     log.NewBaseAddressLogger(baseKey.ShortString(), "peer", peer.BzzAddr.ShortString()),
 		retrievals: make(map[uint]chunk.Address),
+		closed:     make(map[uint]struct{}),
+		closedRing: make([]uint, 0, closedRetrievalsCapacity),
 	}
 }
 
@@ -57,7 +72,25 @@ func (p *Peer) expireRetrieval(ruid uint) {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 
+	p.closeRetrieval(ruid)
+}
+
+// closeRetrieval removes the retrieval and remembers its ruid so that a later delivery
+// is recognised as a duplicate, forgetting the oldest one if at capacity.
+// It must be called with the lock held
+func (p *Peer) closeRetrieval(ruid uint) {
 	delete(p.retrievals, ruid)
+	if _, ok := p.closed[ruid]; ok {
+		return
+	}
+	if len(p.closedRing) < closedRetrievalsCapacity {
+		p.closedRing = append(p.closedRing, ruid)
+	} else {
+		delete(p.closed, p.closedRing[p.closedNext])
+		p.closedRing[p.closedNext] = ruid
+		p.closedNext = (p.closedNext + 1) % closedRetrievalsCapacity
+	}
+	p.closed[ruid] = struct{}{}
 }
 
 // chunkReceived is called upon ChunkDelivery message reception
@@ -67,11 +100,14 @@ func (p *Peer) checkRequest(ruid uint, addr storage.Address) error {
 	defer p.mtx.Unlock()
 	v, ok := p.retrievals[ruid]
 	if !ok {
-		return errors.New("cannot find ruid")
+		if _, ok := p.closed[ruid]; ok {
+			return errDuplicate
+		}
+		return errUnsolicited
 	}
-	delete(p.retrievals, ruid) // since we got the delivery we wanted - it is safe to delete the retrieve request
+	p.closeRetrieval(ruid) // since we got the delivery we wanted - it is safe to delete the retrieve request
 	if !bytes.Equal(v, addr) {
-		return errors.New("retrieve request found but address does not match")
+		return errAddressMismatch
 	}
 
 	return nil
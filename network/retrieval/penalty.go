@@ -0,0 +1,213 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package retrieval
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/p2p/protocols"
+)
+
+// faulty chunk deliveries
+type fault int
+
+const (
+	faultInvalid     fault = iota // the chunk is not valid or not the one requested
+	faultUnsolicited              // the chunk was never requested from the peer
+	faultDuplicate                // the chunk was already delivered or the request expired
+)
+
+func (f fault) String() string {
+	switch f {
+	case faultInvalid:
+		return "invalid"
+	case faultUnsolicited:
+		return "unsolicited"
+	default:
+		return "duplicate"
+	}
+}
+
+var (
+	// penalties subtracted from the score of a peer for each faulty delivery
+	faultPenalties = map[fault]float64{
+		faultInvalid:     10,
+		faultUnsolicited: 5,
+		faultDuplicate:   1,
+	}
+	// a peer is disconnected when its score drops to -penaltyThreshold
+	penaltyThreshold = 50.0
+	// the score recovers by half in penaltyHalfLife, so that the occasional
+	// late delivery of an honest peer does not add up to a disconnection
+	penaltyHalfLife = 10 * time.Minute
+	// maximum number of peers whose penalties are kept, the peer with the oldest
+	// faulty delivery is forgotten to make room for a new one
+	penaltiesCapacity = 1024
+)
+
+// PeerPenalties are the faulty chunk deliveries received from a peer
+type PeerPenalties struct {
+	Invalid     uint64    `json:"invalid"`     // invalid chunks or chunks not matching the request
+	Unsolicited uint64    `json:"unsolicited"` // chunks never requested from the peer
+	Duplicate   uint64    `json:"duplicate"`   // chunks delivered twice or after the request expired
+	Refunded    int64     `json:"refunded"`    // accounting amount refunded for the failed retrievals
+	Disconnects uint64    `json:"disconnects"` // number of times the peer was disconnected for reaching the threshold
+	Score       float64   `json:"score"`       // decaying sum of the penalties, the peer is disconnected at -threshold
+	Last        time.Time `json:"last"`        // time of the last faulty delivery
+}
+
+// decay recovers the score for the time passed since the last faulty delivery
+func (p *PeerPenalties) decay(now time.Time) {
+	if p.Score == 0 || p.Last.IsZero() {
+		return
+	}
+	p.Score *= math.Pow(0.5, float64(now.Sub(p.Last))/float64(penaltyHalfLife))
+}
+
+// penalties records the faulty deliveries of the peers by overlay address,
+// so that they are not forgotten when the peer reconnects, for at most penaltiesCapacity peers
+type penalties struct {
+	mu    sync.Mutex
+	peers map[string]*PeerPenalties
+}
+
+func newPenalties() *penalties {
+	return &penalties{
+		peers: make(map[string]*PeerPenalties),
+	}
+}
+
+// add records a faulty delivery and returns true if the peer is to be disconnected
+func (ps *penalties) add(addr []byte, f fault, refunded int64, now time.Time) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	key := hex.EncodeToString(addr)
+	p, ok := ps.peers[key]
+	if !ok {
+		if len(ps.peers) >= penaltiesCapacity {
+			ps.evict()
+		}
+		p = &PeerPenalties{}
+		ps.peers[key] = p
+	}
+	switch f {
+	case faultInvalid:
+		p.Invalid++
+	case faultUnsolicited:
+		p.Unsolicited++
+	default:
+		p.Duplicate++
+	}
+	p.Refunded += refunded
+	p.decay(now)
+	p.Score -= faultPenalties[f]
+	p.Last = now
+	if p.Score > -penaltyThreshold {
+		return false
+	}
+	p.Disconnects++
+	// the score is reset so that the peer is not dropped at the first fault after reconnecting
+	p.Score = 0
+	return true
+}
+
+// evict forgets the peer with the oldest faulty delivery,
+// it must be called with the lock held
+func (ps *penalties) evict() {
+	var (
+		oldest string
+		last   time.Time
+	)
+	for key, p := range ps.peers {
+		if oldest == "" || p.Last.Before(last) {
+			oldest, last = key, p.Last
+		}
+	}
+	delete(ps.peers, oldest)
+}
+
+// snapshot returns the penalties of all the peers with their current scores
+func (ps *penalties) snapshot(now time.Time) map[string]PeerPenalties {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	s := make(map[string]PeerPenalties, len(ps.peers))
+	for key, p := range ps.peers {
+		c := *p
+		c.decay(now)
+		s[key] = c
+	}
+	return s
+}
+
+// penalize records a faulty delivery from the peer and refunds the retrieve request
+// of a failed retrieval. It returns the error wrapped to disconnect the peer
+// if its score reached the threshold.
+// The faulty delivery itself is not charged, as the accounting of a received message
+// is only applied once it is handled without error
+func (r *Retrieval) penalize(p *Peer, f fault, err error) error {
+	metrics.GetOrRegisterCounter(fmt.Sprintf("network/retrieve/penalty/%s", f), nil).Inc(1)
+	var refunded int64
+	if f == faultInvalid {
+		refunded = r.refund(p)
+	}
+	if r.penalties.add(p.BzzAddr.Over(), f, refunded, time.Now()) {
+		metrics.GetOrRegisterCounter("network/retrieve/penalty/disconnect", nil).Inc(1)
+		return protocols.Break(fmt.Errorf("%s chunk delivery, penalty threshold reached: %w", f, err))
+	}
+	return fmt.Errorf("%s chunk delivery: %w", f, err)
+}
+
+// refund credits the price of the retrieve request paid for a retrieval the peer failed
+// and returns the amount refunded
+// only invalid deliveries are refunded, unsolicited and duplicate deliveries answer no
+// request that was paid for. The peer does not refund the request on its side,
+// so the balances of the two nodes differ by the refunded amount
+func (r *Retrieval) refund(p *Peer) int64 {
+	if r.spec.Hook == nil {
+		return 0
+	}
+	amount := -(&RetrieveRequest{}).Price().For(protocols.Sender, 0)
+	if err := r.spec.Hook.Apply(p.Peer, amount, 0); err != nil {
+		p.logger.Warn("refunding failed retrieval", "err", err)
+		return 0
+	}
+	metrics.GetOrRegisterCounter("network/retrieve/penalty/refund", nil).Inc(amount)
+	return amount
+}
+
+// APIVersion is the textual version number of the retrieval API
+const APIVersion = "1.0"
+
+// API provides an API to access the faulty chunk deliveries of the peers
+type API struct {
+	retrieval *Retrieval
+}
+
+// NewAPI creates a new API
+func NewAPI(r *Retrieval) *API {
+	return &API{r}
+}
+
+// Penalties returns the faulty chunk deliveries received by overlay address of the peer
+func (a *API) Penalties() map[string]PeerPenalties {
+	return a.retrieval.penalties.snapshot(time.Now())
+}
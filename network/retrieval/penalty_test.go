@@ -0,0 +1,210 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package retrieval
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/p2p/protocols"
+	p2ptest "github.com/ethersphere/swarm/p2p/testing"
+	"github.com/ethersphere/swarm/pot"
+	"github.com/ethersphere/swarm/swap"
+)
+
+// setPenaltyThreshold sets the penalty threshold and returns a function restoring it
+func setPenaltyThreshold(threshold float64) func() {
+	prev := penaltyThreshold
+	penaltyThreshold = threshold
+	return func() {
+		penaltyThreshold = prev
+	}
+}
+
+// TestPenalties tests the counting of faulty deliveries, the decay of the score
+// and the disconnection at the threshold
+func TestPenalties(t *testing.T) {
+	defer setPenaltyThreshold(20)()
+	ps := newPenalties()
+	addr := pot.RandomAddress()
+	key := hex.EncodeToString(addr[:])
+	now := time.Now()
+
+	if ps.add(addr[:], faultInvalid, 0, now) {
+		t.Fatal("expected no disconnection below the threshold")
+	}
+	if ps.add(addr[:], faultUnsolicited, 0, now) || ps.add(addr[:], faultDuplicate, 0, now) {
+		t.Fatal("expected no disconnection below the threshold")
+	}
+	p := ps.snapshot(now)[key]
+	if p.Invalid != 1 || p.Unsolicited != 1 || p.Duplicate != 1 || p.Score != -16 {
+		t.Fatalf("unexpected penalties %+v", p)
+	}
+
+	// the score is halved after a half life, so another invalid delivery stays below the threshold
+	now = now.Add(penaltyHalfLife)
+	if p := ps.snapshot(now)[key]; p.Score != -8 {
+		t.Fatalf("expected score -8 after a half life, got %v", p.Score)
+	}
+	if ps.add(addr[:], faultInvalid, 0, now) {
+		t.Fatal("expected no disconnection below the threshold")
+	}
+	if !ps.add(addr[:], faultUnsolicited, 0, now) {
+		t.Fatal("expected disconnection at the threshold")
+	}
+	p = ps.snapshot(now)[key]
+	if p.Disconnects != 1 || p.Score != 0 || p.Invalid != 2 || p.Unsolicited != 2 {
+		t.Fatalf("unexpected penalties %+v", p)
+	}
+}
+
+// TestPenaltiesCapacity tests that the peer with the oldest faulty delivery
+// is forgotten once the penalties of penaltiesCapacity peers are kept
+func TestPenaltiesCapacity(t *testing.T) {
+	ps := newPenalties()
+	now := time.Now()
+	addrs := make([][]byte, penaltiesCapacity+1)
+	for i := range addrs {
+		addrs[i] = pot.RandomAddress().Bytes()
+		ps.add(addrs[i], faultUnsolicited, 0, now.Add(time.Duration(i)*time.Second))
+	}
+	s := ps.snapshot(now)
+	if len(s) != penaltiesCapacity {
+		t.Fatalf("expected %d peers, got %d", penaltiesCapacity, len(s))
+	}
+	if _, ok := s[hex.EncodeToString(addrs[0])]; ok {
+		t.Fatal("expected the peer with the oldest faulty delivery to be forgotten")
+	}
+	if _, ok := s[hex.EncodeToString(addrs[penaltiesCapacity])]; !ok {
+		t.Fatal("expected the last peer to be kept")
+	}
+}
+
+type recordBalance struct {
+	amounts []int64
+}
+
+func (b *recordBalance) Add(amount int64, peer *protocols.Peer) error {
+	b.amounts = append(b.amounts, amount)
+	return nil
+}
+
+func (b *recordBalance) Check(amount int64, peer *protocols.Peer) error {
+	return nil
+}
+
+// TestPenaltyBalance tests that the retrieve request of an invalid delivery is refunded
+// and that unsolicited deliveries, which answer no paid request, leave the balance untouched
+func TestPenaltyBalance(t *testing.T) {
+	defer func(h protocols.Hook) { spec.Hook = h }(spec.Hook)
+	balance := &recordBalance{}
+	base := network.NewBzzAddr(pot.RandomAddress().Bytes(), nil)
+	r := New(network.NewKademlia(base.Over(), network.NewKadParams()), nil, base, balance)
+
+	pp := protocols.NewPeer(p2p.NewPeer(enode.ID{1}, "peer", nil), nil, spec)
+	p := NewPeer(network.NewBzzPeer(pp), base)
+	if err := r.penalize(p, faultUnsolicited, errUnsolicited); !errors.Is(err, errUnsolicited) {
+		t.Fatalf("expected error %v, got %v", errUnsolicited, err)
+	}
+	if err := r.penalize(p, faultInvalid, errAddressMismatch); !errors.Is(err, errAddressMismatch) {
+		t.Fatalf("expected error %v, got %v", errAddressMismatch, err)
+	}
+	price := int64(swap.RetrieveRequestPrice)
+	if len(balance.amounts) != 1 || balance.amounts[0] != price {
+		t.Fatalf("expected a refund of %d, got %v", price, balance.amounts)
+	}
+
+	penalties := NewAPI(r).Penalties()[hex.EncodeToString(p.BzzAddr.Over())]
+	if penalties.Invalid != 1 || penalties.Unsolicited != 1 || penalties.Refunded != price {
+		t.Fatalf("unexpected penalties %+v", penalties)
+	}
+}
+
+// TestDuplicateChunkDelivery tests that a delivery for an expired retrieve request
+// is recorded as a duplicate without dropping the peer below the threshold
+func TestDuplicateChunkDelivery(t *testing.T) {
+	pk, ns, cleanup := newTestNetstore(t)
+	defer cleanup()
+	kad := network.NewKademlia(network.PrivateKeyToBzzKey(pk), network.NewKadParams())
+
+	tester, r, teardown, err := newRetrievalTester(t, pk, ns, kad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardown()
+	node := tester.Nodes[0]
+
+	// the unsolicited delivery creates the protocol peer
+	err = tester.TestExchanges(p2ptest.Exchange{
+		Label: "Non-existent RUID chunk delivery",
+		Triggers: []p2ptest.Trigger{
+			{
+				Code: 0,
+				Msg:  &ChunkDelivery{Ruid: 1234, Addr: []byte{0, 1, 2, 3}},
+				Peer: node.ID(),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p *Peer
+	for i := 0; i < 1000 && p == nil; i++ {
+		p = r.getPeer(node.ID())
+		time.Sleep(1 * time.Millisecond)
+	}
+	if p == nil {
+		t.Fatal("expected peer")
+	}
+	p.addRetrieval(1235, []byte{0, 1, 2, 3})
+	p.expireRetrieval(1235)
+
+	err = tester.TestExchanges(p2ptest.Exchange{
+		Label: "Expired RUID chunk delivery",
+		Triggers: []p2ptest.Trigger{
+			{
+				Code: 0,
+				Msg:  &ChunkDelivery{Ruid: 1235, Addr: []byte{0, 1, 2, 3}},
+				Peer: node.ID(),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := hex.EncodeToString(p.BzzAddr.Over())
+	var penalties PeerPenalties
+	for i := 0; i < 1000; i++ {
+		penalties = NewAPI(r).Penalties()[key]
+		if penalties.Duplicate > 0 {
+			break
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	if penalties.Unsolicited != 1 || penalties.Duplicate != 1 || penalties.Disconnects != 0 {
+		t.Fatalf("unexpected penalties %+v", penalties)
+	}
+	if r.getPeer(node.ID()) == nil {
+		t.Fatal("expected the peer not to be dropped below the threshold")
+	}
+}
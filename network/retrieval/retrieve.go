@@ -58,11 +58,19 @@ var (
 
 	spec = &protocols.Spec{
 		Name:       "bzz-retrieve",
-		Version:    2,
+		Version:    availabilityVersion,
 		MaxMsgSize: 10 * 1024 * 1024,
+		Priority:   protocols.PriorityHigh,
 		Messages: []interface{}{
 			ChunkDelivery{},
 			RetrieveRequest{},
+			ChunkAvailability{},
+		},
+		OldVersions: map[uint][]interface{}{
+			2: {
+				ChunkDelivery{},
+				RetrieveRequest{},
+			},
 		},
 	}
 
@@ -97,11 +105,13 @@ type Retrieval struct {
 	baseAddress *network.BzzAddr
 	kad         *network.Kademlia
 	kademliaLB  *network.KademliaLoadBalancer
-	mtx         sync.RWMutex       // protect peer map
-	peers       map[enode.ID]*Peer // compatible peers
-	spec        *protocols.Spec    // protocol spec
-	logger      log.Logger         // custom logger to append a basekey
-	quit        chan struct{}      // shutdown channel
+	mtx         sync.RWMutex         // protect peer map
+	peers       map[enode.ID]*Peer   // compatible peers
+	spec        *protocols.Spec      // protocol spec
+	logger      log.Logger           // custom logger to append a basekey
+	penalties   *penalties           // faulty chunk deliveries by peer
+	summary     *availabilitySummary // summary of the chunks held sent to the neighbours
+	quit        chan struct{}        // shutdown channel
 }
 
 // New returns a new instance of the retrieval protocol handler
@@ -114,6 +124,8 @@ func New(kad *network.Kademlia, ns *storage.NetStore, baseKey *network.BzzAddr,
 		peers:       make(map[enode.ID]*Peer),
 		spec:        spec,
 		logger:      log.NewBaseAddressLogger(baseKey.ShortString()),
+		penalties:   newPenalties(),
+		summary:     &availabilitySummary{},
 		quit:        make(chan struct{}),
 	}
 	if balance != nil && !reflect.ValueOf(balance).IsNil() {
@@ -160,6 +172,8 @@ func (r *Retrieval) handleMsg(p *Peer) func(context.Context, interface{}) error
 			return r.handleRetrieveRequest(ctx, p, msg)
 		case *ChunkDelivery:
 			return r.handleChunkDelivery(ctx, p, msg)
+		case *ChunkAvailability:
+			return r.handleChunkAvailability(ctx, p, msg)
 		}
 		return nil
 	}
@@ -179,7 +193,10 @@ func (r *Retrieval) getOriginPo(req *storage.Request) int {
 
 		// get po between chunk and origin
 		if bytes.Equal(req.Origin.Bytes(), id.Bytes()) {
-			originPo = po
+			// light nodes are not part of the storage topology, their requests are forwarded as our own
+			if !network.IsLightNode(p.Capabilities) {
+				originPo = po
+			}
 			return false
 		}
 
@@ -197,6 +214,11 @@ func (r *Retrieval) findPeerLB(ctx context.Context, req *storage.Request) (retPe
 	// originPo - proximity of the node that made the request; -1 if the request originator is our node;
 	// myPo - this node's proximity with the requested chunk
 	// selectedPeerPo - kademlia suggested node's proximity with the requested chunk (computed further below)
+	// light nodes are not part of the storage topology, they request chunks from the closest full peer
+	if network.IsLightNode(r.baseAddress.Capabilities) {
+		return r.findFullPeer(req)
+	}
+
 	originPo := r.getOriginPo(req)
 	myPo := chunk.Proximity(req.Addr, r.kad.BaseAddr())
 	selectedPeerPo := -1
@@ -215,6 +237,11 @@ func (r *Retrieval) findPeerLB(ctx context.Context, req *storage.Request) (retPe
 		return nil, errors.New("not forwarding request, origin node is closer to chunk than this node")
 	}
 
+	// prefer a neighbour which likely holds the chunk over peers which would forward the request
+	if retPeer = r.findHolder(req, depth); retPeer != nil {
+		return retPeer, nil
+	}
+
 	r.kademliaLB.EachBinDesc(req.Addr, func(bin network.LBBin) bool {
 		for _, lbPeer := range bin.LBPeers {
 			id := lbPeer.Peer.ID()
@@ -224,6 +251,11 @@ func (r *Retrieval) findPeerLB(ctx context.Context, req *storage.Request) (retPe
 				continue
 			}
 
+			// skip light nodes, they do not store chunks
+			if network.IsLightNode(lbPeer.Peer.Capabilities) {
+				continue
+			}
+
 			// do not send request back to peer who asked us. maybe merge with SkipPeer at some point
 			if bytes.Equal(req.Origin.Bytes(), id.Bytes()) {
 				continue
@@ -291,6 +323,29 @@ func (r *Retrieval) findPeerLB(ctx context.Context, req *storage.Request) (retPe
 	return retPeer, nil
 }
 
+// findFullPeer returns the full peer closest to the chunk which was not tried yet
+// regardless of the proximity of our node, used by light nodes
+func (r *Retrieval) findFullPeer(req *storage.Request) (retPeer *network.Peer, err error) {
+	r.kademliaLB.EachBinDesc(req.Addr, func(bin network.LBBin) bool {
+		for _, lbPeer := range bin.LBPeers {
+			if !lbPeer.Peer.HasCap(r.spec.Name) || network.IsLightNode(lbPeer.Peer.Capabilities) {
+				continue
+			}
+			if req.SkipPeer(lbPeer.Peer.ID().String()) {
+				continue
+			}
+			retPeer = lbPeer.Peer
+			lbPeer.AddUseCount()
+			return false
+		}
+		return true
+	})
+	if retPeer == nil {
+		return nil, ErrNoPeerFound
+	}
+	return retPeer, nil
+}
+
 // handleRetrieveRequest handles an incoming retrieve request from a certain Peer
 // if the chunk is found in the localstore it is served immediately, otherwise
 // it results in a new retrieve request to candidate peers in our kademlia
@@ -344,7 +399,15 @@ func (r *Retrieval) handleChunkDelivery(ctx context.Context, p *Peer, msg *Chunk
 	err := p.checkRequest(msg.Ruid, msg.Addr)
 	if err != nil {
 		unsolicitedChunkDelivery.Inc(1)
-		return protocols.Break(fmt.Errorf("unsolicited chunk delivery from peer, ruid %d, addr %s: %w", msg.Ruid, msg.Addr, err))
+		err = fmt.Errorf("ruid %d, addr %s: %w", msg.Ruid, msg.Addr, err)
+		switch {
+		case errors.Is(err, errDuplicate):
+			return r.penalize(p, faultDuplicate, err)
+		case errors.Is(err, errAddressMismatch):
+			return r.penalize(p, faultInvalid, err)
+		default:
+			return r.penalize(p, faultUnsolicited, err)
+		}
 	}
 	var osp opentracing.Span
 	ctx, osp = spancontext.StartSpan(
@@ -374,7 +437,7 @@ func (r *Retrieval) handleChunkDelivery(ctx context.Context, p *Peer, msg *Chunk
 	_, err = r.netStore.Put(ctx, mode, storage.NewChunk(msg.Addr, msg.SData))
 	if err != nil {
 		if err == storage.ErrChunkInvalid {
-			return protocols.Break(fmt.Errorf("netstore putting chunk to localstore: %w", err))
+			return r.penalize(p, faultInvalid, fmt.Errorf("netstore putting chunk to localstore: %w", err))
 		}
 
 		return fmt.Errorf("netstore putting chunk to localstore: %w", err)
@@ -434,6 +497,9 @@ FINDPEER:
 
 func (r *Retrieval) Start(server *p2p.Server) error {
 	r.logger.Info("starting bzz-retrieve")
+	if !network.IsLightNode(r.baseAddress.Capabilities) {
+		go r.availabilityLoop()
+	}
 	return nil
 }
 
@@ -445,25 +511,27 @@ func (r *Retrieval) Stop() error {
 }
 
 func (r *Retrieval) Protocols() []p2p.Protocol {
-	return []p2p.Protocol{
-		{
-			Name:    r.spec.Name,
-			Version: r.spec.Version,
-			Length:  r.spec.Length(),
-			Run:     r.runProtocol,
-		},
-	}
+	return r.spec.Protocols(r.runProtocol)
 }
 
-func (r *Retrieval) runProtocol(p *p2p.Peer, rw p2p.MsgReadWriter) error {
-	peer := protocols.NewPeer(p, rw, r.spec)
-	bp := network.NewBzzPeer(peer)
+func (r *Retrieval) runProtocol(spec *protocols.Spec) func(*p2p.Peer, p2p.MsgReadWriter) error {
+	return func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+		peer := protocols.NewPeer(p, rw, spec)
+		bp := network.NewBzzPeer(peer)
 
-	return r.Run(bp)
+		return r.Run(bp)
+	}
 }
 
 func (r *Retrieval) APIs() []rpc.API {
-	return nil
+	return []rpc.API{
+		{
+			Namespace: "retrieval",
+			Version:   APIVersion,
+			Service:   NewAPI(r),
+			Public:    false,
+		},
+	}
 }
 
 func (r *Retrieval) Spec() *protocols.Spec {
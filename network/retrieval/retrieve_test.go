@@ -43,6 +43,7 @@ import (
 	"github.com/ethersphere/swarm/chunk"
 	chunktesting "github.com/ethersphere/swarm/chunk/testing"
 	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/network/capability"
 	"github.com/ethersphere/swarm/network/simulation"
 	"github.com/ethersphere/swarm/p2p/protocols"
 	p2ptest "github.com/ethersphere/swarm/p2p/testing"
@@ -195,8 +196,10 @@ func TestNoSuitablePeer(t *testing.T) {
 }
 
 // TestUnsolicitedChunkDelivery tests that a node is dropped in response to an unsolicited chunk delivery
+// reaching the penalty threshold
 // this case covers a chunk Ruid that was not previously known to the downstream peer
 func TestUnsolicitedChunkDelivery(t *testing.T) {
+	defer setPenaltyThreshold(faultPenalties[faultUnsolicited])()
 	pk, ns, cleanup := newTestNetstore(t)
 	defer cleanup()
 	bzzAddr := network.PrivateKeyToBzzKey(pk)
@@ -239,6 +242,7 @@ func TestUnsolicitedChunkDelivery(t *testing.T) {
 // TestUnsolicitedChunkDeliveryFaultyAddr tests that a misbehaving node cannot send a chunk delivery
 // over a known retrieve request Ruid with a chunk address that does not match the requested address
 func TestUnsolicitedChunkDeliveryFaultyAddr(t *testing.T) {
+	defer setPenaltyThreshold(faultPenalties[faultInvalid])()
 	pk, ns, cleanup := newTestNetstore(t)
 	defer cleanup()
 	bzzAddr := network.PrivateKeyToBzzKey(pk)
@@ -313,6 +317,7 @@ func TestUnsolicitedChunkDeliveryFaultyAddr(t *testing.T) {
 // TestUnsolicitedChunkDeliveryDouble tests that a misbehaving node cannot send a chunk delivery
 // twice over a known retrieve request Ruid
 func TestUnsolicitedChunkDeliveryDouble(t *testing.T) {
+	defer setPenaltyThreshold(faultPenalties[faultDuplicate])()
 	pk, ns, cleanup := newTestNetstore(t)
 	defer cleanup()
 	bzzAddr := network.PrivateKeyToBzzKey(pk)
@@ -519,6 +524,53 @@ func TestRequestFromPeers(t *testing.T) {
 	}
 }
 
+// TestRequestFromPeersLightNode tests that requests are never sent to light nodes
+// and that light nodes request chunks from full peers
+func TestRequestFromPeersLightNode(t *testing.T) {
+	newPeer := func(kad *network.Kademlia, id enode.ID, caps *capability.Capabilities) *network.Peer {
+		protocolsPeer := protocols.NewPeer(p2p.NewPeer(id, "dummy", []p2p.Cap{{Name: "bzz-retrieve", Version: 1}}), nil, nil)
+		peer := network.NewPeer(&network.BzzPeer{
+			BzzAddr: network.RandomBzzAddr().WithCapabilities(caps),
+			Peer:    protocolsPeer,
+		}, kad)
+		kad.On(peer)
+		return peer
+	}
+	lightID := enode.HexID("3431c3939e1ee2a6345e976a8234f9870152d64879f30bc272a074f6859e75e8")
+	fullID := enode.HexID("4431c3939e1ee2a6345e976a8234f9870152d64879f30bc272a074f6859e75e8")
+
+	for _, lightNode := range []bool{false, true} {
+		caps := network.NewFullNodeCapabilities()
+		if lightNode {
+			caps = network.NewLightNodeCapabilities()
+		}
+		addr := network.RandomBzzAddr().WithCapabilities(caps)
+		kad := network.NewKademlia(addr.OAddr, network.NewKadParams())
+		r := New(kad, nil, addr, nil)
+
+		newPeer(kad, lightID, network.NewLightNodeCapabilities())
+		req := storage.NewRequest(storage.Address(hash0[:]))
+		if _, err := r.findPeerLB(context.Background(), req); err != ErrNoPeerFound {
+			t.Fatalf("light node %v: expected error %v, got %v", lightNode, ErrNoPeerFound, err)
+		}
+
+		newPeer(kad, fullID, network.NewFullNodeCapabilities())
+		peer, err := r.findPeerLB(context.Background(), req)
+		if err != nil {
+			t.Fatalf("light node %v: %v", lightNode, err)
+		}
+		if peer.ID() != fullID {
+			t.Fatalf("light node %v: expected full peer %v, got %v", lightNode, fullID, peer.ID())
+		}
+
+		// requests of light nodes are forwarded as our own
+		req.Origin = lightID
+		if po := r.getOriginPo(req); po != -1 {
+			t.Fatalf("light node %v: expected origin po -1 for light node origin, got %d", lightNode, po)
+		}
+	}
+}
+
 //TestHasPriceImplementation is to check that Retrieval provides priced messages
 func TestHasPriceImplementation(t *testing.T) {
 	price := (&ChunkDelivery{}).Price()
@@ -679,7 +731,7 @@ func newRetrievalTester(t *testing.T, prvkey *ecdsa.PrivateKey, netStore *storag
 	}
 
 	r := New(kad, netStore, network.NewBzzAddr(kad.BaseAddr(), nil), nil)
-	protocolTester := p2ptest.NewProtocolTester(prvkey, 1, r.runProtocol)
+	protocolTester := p2ptest.NewProtocolTester(prvkey, 1, r.runProtocol(r.spec))
 
 	return protocolTester, r, protocolTester.Stop, nil
 }
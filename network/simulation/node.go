@@ -341,12 +341,10 @@ func init() {
 
 // derive a private key for swarm for the node key
 // returns the private key used to generate the bzz key
+// The key is the hash of the node key padded with some arbitrary data, it is not
+// generated by ecdsa.GenerateKey from the seed data as it may read a random number
+// of bytes from it, which gives the services of a node different bzz keys
 func BzzPrivateKeyFromConfig(conf *adapters.NodeConfig) (*ecdsa.PrivateKey, error) {
-	// pad the seed key some arbitrary data as ecdsa.GenerateKey takes 40 bytes seed data
-	privKeyBuf := append(crypto.FromECDSA(conf.PrivateKey), []byte{0x62, 0x7a, 0x7a, 0x62, 0x7a, 0x7a, 0x62, 0x7a}...)
-	bzzPrivateKey, err := ecdsa.GenerateKey(crypto.S256(), bytes.NewReader(privKeyBuf))
-	if err != nil {
-		return nil, err
-	}
-	return bzzPrivateKey, nil
+	seed := crypto.Keccak256(crypto.FromECDSA(conf.PrivateKey), []byte{0x62, 0x7a, 0x7a, 0x62, 0x7a, 0x7a, 0x62, 0x7a})
+	return crypto.ToECDSA(seed)
 }
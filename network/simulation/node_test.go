@@ -315,6 +315,32 @@ func TestUploadSnapshot(t *testing.T) {
 	log.Debug("Done.")
 }
 
+// TestBzzPrivateKeyFromConfig tests that the same bzz key is derived for a node key
+// each time, so that the services of a node have the same overlay address
+func TestBzzPrivateKeyFromConfig(t *testing.T) {
+	conf := adapters.RandomNodeConfig()
+	key, err := BzzPrivateKeyFromConfig(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		k, err := BzzPrivateKeyFromConfig(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k.D.Cmp(key.D) != 0 {
+			t.Fatalf("got a different key on call %d", i)
+		}
+	}
+	other, err := BzzPrivateKeyFromConfig(adapters.RandomNodeConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.D.Cmp(key.D) == 0 {
+		t.Fatal("got the same key for different node keys")
+	}
+}
+
 func TestStartStopNode(t *testing.T) {
 	sim := NewInProc(noopServiceFuncMap)
 	defer sim.Close()
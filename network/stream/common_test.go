@@ -95,6 +95,7 @@ type SyncSimServiceOptions struct {
 	InitialChunkCount     uint64
 	SyncOnlyWithinDepth   bool
 	Autostart             bool
+	DigestSize            int
 	StreamConstructorFunc func(state.Store, *network.BzzAddr, ...StreamProvider) node.Service
 }
 
@@ -156,6 +157,9 @@ func newSyncSimServiceFunc(o *SyncSimServiceOptions) func(ctx *adapters.ServiceC
 			return nil, nil, err
 		}
 		sp := NewSyncProvider(netStore, kad, addr, o.Autostart, o.SyncOnlyWithinDepth)
+		if o.DigestSize > 0 {
+			sp = NewReconcilingSyncProvider(netStore, kad, addr, o.Autostart, o.SyncOnlyWithinDepth, o.DigestSize)
+		}
 		ss := o.StreamConstructorFunc(store, addr, sp)
 
 		cleanup = func() {
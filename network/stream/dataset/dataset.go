@@ -0,0 +1,286 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dataset is an example of an application stream provider for the stream protocol.
+//
+// It replicates named datasets, lists of chunk addresses such as all the chunks under a
+// pinned root, between nodes. Every dataset is a bounded stream keyed by its name, with
+// the chunks indexed by their position in the dataset. A node wanting a dataset requests it
+// from all its peers and the stream registry syncs the chunks it does not have yet, resuming
+// from the synced intervals when peers reconnect or the datasets are requested again with
+// Provider.Request, so that only the chunks added to a dataset since are synced.
+//
+//	p := dataset.NewProvider(localStore, "photos")
+//	registry := stream.New(stateStore, addr, syncProvider, p)
+//
+// and on the nodes serving the dataset
+//
+//	p.Add("photos", addrs...)
+package dataset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/network/stream"
+)
+
+// StreamName is the name of the dataset streams
+const StreamName = "DATASET"
+
+// requestTimeout is the time to wait for requesting the datasets from a peer
+var requestTimeout = 30 * time.Second
+
+var errInvalidKey = errors.New("invalid dataset key")
+
+// Provider is a stream.StreamProvider of datasets
+type Provider struct {
+	store    chunk.Store
+	mu       sync.RWMutex
+	datasets map[string][]chunk.Address     // datasets served to peers
+	want     map[string]bool                // names of the datasets replicated from peers
+	complete map[string]map[enode.ID]uint64 // number of chunks of the dataset synced from a peer
+	peers    map[enode.ID]*stream.Peer      // connected peers
+	quit     chan struct{}
+}
+
+var _ stream.BoundedStreamProvider = (*Provider)(nil)
+
+// NewProvider creates a dataset provider on the given store
+// replicating the datasets with the names in want from all peers
+func NewProvider(store chunk.Store, want ...string) *Provider {
+	p := &Provider{
+		store:    store,
+		datasets: make(map[string][]chunk.Address),
+		want:     make(map[string]bool),
+		complete: make(map[string]map[enode.ID]uint64),
+		peers:    make(map[enode.ID]*stream.Peer),
+		quit:     make(chan struct{}),
+	}
+	for _, name := range want {
+		p.want[name] = true
+	}
+	return p
+}
+
+// Add appends chunk addresses to the dataset with the given name, creating it if it does not exist
+// the chunks have to be in the store of the provider to be served to peers
+func (p *Provider) Add(name string, addrs ...chunk.Address) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.datasets[name] = append(p.datasets[name], addrs...)
+}
+
+// Synced returns the number of chunks of the dataset synced from the peer
+// and whether a non empty dataset was synced from it
+func (p *Provider) Synced(name string, peer enode.ID) (count uint64, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	count, ok = p.complete[name][peer]
+	return count, ok
+}
+
+// NeedData returns true for the chunks not in the store
+func (p *Provider) NeedData(ctx context.Context, addrs ...chunk.Address) ([]bool, error) {
+	has, err := p.store.HasMulti(ctx, addrs...)
+	if err != nil {
+		return nil, err
+	}
+	need := make([]bool, len(has))
+	for i, h := range has {
+		need[i] = !h
+	}
+	return need, nil
+}
+
+// Get the chunks from the store
+func (p *Provider) Get(ctx context.Context, addrs ...chunk.Address) ([]chunk.Chunk, error) {
+	return p.store.GetMulti(ctx, chunk.ModeGetSync, addrs...)
+}
+
+// Put the chunks to the store
+func (p *Provider) Put(ctx context.Context, chs ...chunk.Chunk) (exists []bool, err error) {
+	return p.store.Put(ctx, chunk.ModePutSync, chs...)
+}
+
+// Set is a noop, replicating a dataset does not affect the pull syncing state of its chunks
+func (p *Provider) Set(ctx context.Context, addrs ...chunk.Address) error {
+	return nil
+}
+
+// Subscribe sends the descriptors of the chunks of the dataset with
+// the indexes from from up to to, or the end of the dataset if to is 0
+func (p *Provider) Subscribe(ctx context.Context, key interface{}, from, to uint64) (<-chan chunk.Descriptor, func()) {
+	p.mu.RLock()
+	addrs := p.datasets[key.(string)]
+	p.mu.RUnlock()
+
+	if to == 0 || to > uint64(len(addrs)) {
+		to = uint64(len(addrs))
+	}
+	if from == 0 {
+		from = 1
+	}
+
+	c := make(chan chunk.Descriptor)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	go func() {
+		defer close(c)
+		for i := from; i <= to; i++ {
+			select {
+			case c <- chunk.Descriptor{Address: addrs[i-1], BinID: i}:
+			case <-stop:
+				return
+			case <-p.quit:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, func() {
+		stopOnce.Do(func() { close(stop) })
+	}
+}
+
+// Cursor returns the number of chunks in the dataset
+func (p *Provider) Cursor(key string) (uint64, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return uint64(len(p.datasets[key])), nil
+}
+
+// Request requests the wanted datasets from all connected peers
+// datasets which are already synced from a peer are synced again from where they were completed
+func (p *Provider) Request(ctx context.Context) error {
+	p.mu.RLock()
+	peers := make([]*stream.Peer, 0, len(p.peers))
+	for _, peer := range p.peers {
+		peers = append(peers, peer)
+	}
+	p.mu.RUnlock()
+
+	for _, peer := range peers {
+		if err := p.request(ctx, peer); err != nil {
+			return fmt.Errorf("requesting datasets from peer %s: %w", peer.ID(), err)
+		}
+	}
+	return nil
+}
+
+// request requests the wanted datasets from the peer
+func (p *Provider) request(ctx context.Context, peer *stream.Peer) error {
+	p.mu.RLock()
+	streams := make([]stream.ID, 0, len(p.want))
+	for name := range p.want {
+		streams = append(streams, stream.NewID(StreamName, name))
+	}
+	p.mu.RUnlock()
+	if len(streams) == 0 {
+		return nil
+	}
+	return peer.RequestStreams(ctx, streams...)
+}
+
+// InitPeer requests the wanted datasets from the peer and keeps track
+// of the peer for Request until it disconnects
+func (p *Provider) InitPeer(peer *stream.Peer) {
+	p.mu.Lock()
+	p.peers[peer.ID()] = peer
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.peers, peer.ID())
+		p.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	err := p.request(ctx, peer)
+	cancel()
+	if err != nil {
+		log.Error("requesting datasets", "peer", peer.ID(), "err", err)
+		peer.Drop("error requesting datasets")
+		return
+	}
+
+	select {
+	case <-peer.Done():
+	case <-p.quit:
+	}
+}
+
+// WantStream returns true for the wanted datasets
+func (p *Provider) WantStream(_ *stream.Peer, s stream.ID) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.want[s.Key]
+}
+
+// StreamComplete records that the dataset was synced from the peer
+func (p *Provider) StreamComplete(peer *stream.Peer, s stream.ID, cursor uint64) {
+	if cursor == 0 {
+		return
+	}
+	log.Debug("dataset synced", "peer", peer.ID(), "dataset", s.Key, "chunks", cursor)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.complete[s.Key]; !ok {
+		p.complete[s.Key] = make(map[enode.ID]uint64)
+	}
+	p.complete[s.Key][peer.ID()] = cursor
+}
+
+// StreamName returns the name of the dataset streams
+func (p *Provider) StreamName() string { return StreamName }
+
+// ParseKey returns the dataset name
+func (p *Provider) ParseKey(key string) (interface{}, error) {
+	if key == "" {
+		return nil, errInvalidKey
+	}
+	return key, nil
+}
+
+// EncodeKey returns the dataset name
+func (p *Provider) EncodeKey(key interface{}) (string, error) {
+	name, ok := key.(string)
+	if !ok || name == "" {
+		return "", errInvalidKey
+	}
+	return name, nil
+}
+
+// Autostart is true, wanted datasets are synced as soon as they are received
+func (p *Provider) Autostart() bool { return true }
+
+// Boundedness is true, datasets are synced up to the number of chunks when requested
+func (p *Provider) Boundedness() bool { return true }
+
+// Close the provider
+func (p *Provider) Close() { close(p.quit) }
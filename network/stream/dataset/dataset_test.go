@@ -0,0 +1,155 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package dataset
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/simulations/adapters"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/network/simulation"
+	"github.com/ethersphere/swarm/network/stream"
+	"github.com/ethersphere/swarm/state"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/localstore"
+)
+
+const (
+	bucketKeyLocalStore simulation.BucketKey = "localstore"
+	bucketKeyProvider   simulation.BucketKey = "provider"
+)
+
+// newServiceFunc returns a simulation service of a stream registry
+// with a dataset provider replicating the datasets in want
+func newServiceFunc(want ...string) simulation.ServiceFunc {
+	return func(ctx *adapters.ServiceContext, bucket *sync.Map) (node.Service, func(), error) {
+		addr := network.NewBzzAddrFromEnode(ctx.Config.Node())
+		dir, err := ioutil.TempDir("", "dataset-test")
+		if err != nil {
+			return nil, nil, err
+		}
+		store, err := localstore.New(dir, addr.Over(), nil)
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, nil, err
+		}
+		provider := NewProvider(store, want...)
+		bucket.Store(bucketKeyLocalStore, store)
+		bucket.Store(bucketKeyProvider, provider)
+
+		cleanup := func() {
+			store.Close()
+			os.RemoveAll(dir)
+		}
+		return stream.New(state.NewInmemoryStore(), addr, provider), cleanup, nil
+	}
+}
+
+// addDataset stores count random chunks and adds them to the dataset of the node
+func addDataset(t *testing.T, sim *simulation.Simulation, id enode.ID, name string, count int) []chunk.Address {
+	t.Helper()
+	store := sim.MustNodeItem(id, bucketKeyLocalStore).(*localstore.DB)
+	chunks := storage.GenerateRandomChunks(chunk.DefaultSize, count)
+	if _, err := store.Put(context.Background(), chunk.ModePutUpload, chunks...); err != nil {
+		t.Fatal(err)
+	}
+	addrs := make([]chunk.Address, count)
+	for i, ch := range chunks {
+		addrs[i] = ch.Address()
+	}
+	sim.MustNodeItem(id, bucketKeyProvider).(*Provider).Add(name, addrs...)
+	return addrs
+}
+
+// waitSynced waits until the dataset with count chunks is synced by the node from the peer
+// and checks that all the chunks are in its store
+func waitSynced(t *testing.T, sim *simulation.Simulation, id, peer enode.ID, name string, addrs []chunk.Address) {
+	t.Helper()
+	provider := sim.MustNodeItem(id, bucketKeyProvider).(*Provider)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		count, ok := provider.Synced(name, peer)
+		if ok && count == uint64(len(addrs)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dataset %s not synced, got %d of %d chunks", name, count, len(addrs))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	store := sim.MustNodeItem(id, bucketKeyLocalStore).(*localstore.DB)
+	has, err := store.HasMulti(context.Background(), addrs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, h := range has {
+		if !h {
+			t.Fatalf("chunk %s of dataset %s not synced", addrs[i], name)
+		}
+	}
+}
+
+// TestReplicateDataset tests that a wanted dataset is replicated from a peer
+// and that chunks added to it are synced when it is requested again
+func TestReplicateDataset(t *testing.T) {
+	sim := simulation.NewBzzInProc(map[string]simulation.ServiceFunc{
+		"streamer": newServiceFunc("photos"),
+	}, true)
+	defer sim.Close()
+
+	ids, err := sim.AddNodes(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream, downstream := ids[0], ids[1]
+	photos := addDataset(t, sim, upstream, "photos", 200)
+	// datasets which are not wanted are not replicated
+	other := addDataset(t, sim, upstream, "other", 10)
+
+	if err := sim.Net.Connect(downstream, upstream); err != nil {
+		t.Fatal(err)
+	}
+	waitSynced(t, sim, downstream, upstream, "photos", photos)
+
+	store := sim.MustNodeItem(downstream, bucketKeyLocalStore).(*localstore.DB)
+	has, err := store.HasMulti(context.Background(), other...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range has {
+		if h {
+			t.Fatal("unwanted dataset replicated")
+		}
+	}
+
+	// datasets extended on the upstream peer are synced when requested again
+	photos = append(photos, addDataset(t, sim, upstream, "photos", 50)...)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := sim.MustNodeItem(downstream, bucketKeyProvider).(*Provider).Request(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitSynced(t, sim, downstream, upstream, "photos", photos)
+}
@@ -0,0 +1,254 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package iblt implements an invertible Bloom lookup table of fixed size keys.
+//
+// A table summarises a set of keys in a constant number of cells. Subtracting the
+// table of one set from the table of another with the same number of cells yields
+// a table of the symmetric difference of the two sets, which can be decoded with high
+// probability as long as the difference is at most about half the number of cells.
+// This allows two peers to find the keys one of them is missing by exchanging a single
+// table instead of all the keys.
+package iblt
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+)
+
+const (
+	// KeySize is the size of the keys stored in the table
+	KeySize = 32
+	// hashCount is the number of cells each key is stored in
+	hashCount = 3
+	// cellSize is the size of an encoded cell: count, key sum and hash sum
+	cellSize = 4 + KeySize + 8
+)
+
+var (
+	// ErrInvalidKey is returned when inserting a key with a size other than KeySize
+	ErrInvalidKey = errors.New("invalid key size")
+	// ErrSizeMismatch is returned when subtracting tables of different sizes
+	ErrSizeMismatch = errors.New("table size mismatch")
+	// ErrUndecodable is returned by Decode when the difference is too large for the size of the table
+	ErrUndecodable = errors.New("table can not be decoded")
+
+	errInvalidEncoding = errors.New("invalid table encoding")
+)
+
+// cell holds the sums of all the keys mapped to it
+type cell struct {
+	count   int32         // number of keys inserted minus the number of keys subtracted
+	keySum  [KeySize]byte // xor of the keys
+	hashSum uint64        // xor of the check hashes of the keys
+}
+
+// Table is an invertible Bloom lookup table
+type Table struct {
+	cells []cell
+}
+
+// New creates an empty table with at least the given number of cells
+// the number of cells is rounded up to a multiple of the number of hash functions
+func New(cells int) *Table {
+	if cells < hashCount {
+		cells = hashCount
+	}
+	if r := cells % hashCount; r != 0 {
+		cells += hashCount - r
+	}
+	return &Table{
+		cells: make([]cell, cells),
+	}
+}
+
+// Size returns the number of cells in the table
+func (t *Table) Size() int {
+	return len(t.cells)
+}
+
+// EncodedSize returns the size of the binary encoding of a table with the given number of cells
+func EncodedSize(cells int) int {
+	return 4 + cells*cellSize
+}
+
+// Insert adds a key to the table
+func (t *Table) Insert(key []byte) error {
+	if len(key) != KeySize {
+		return ErrInvalidKey
+	}
+	var k [KeySize]byte
+	copy(k[:], key)
+	t.toggle(k, 1)
+	return nil
+}
+
+// Subtract removes all the keys of o from the table
+// keys in o which are not in the table are recorded with a negative count
+func (t *Table) Subtract(o *Table) error {
+	if len(t.cells) != len(o.cells) {
+		return ErrSizeMismatch
+	}
+	for i := range t.cells {
+		c := &t.cells[i]
+		c.count -= o.cells[i].count
+		for j := range c.keySum {
+			c.keySum[j] ^= o.cells[i].keySum[j]
+		}
+		c.hashSum ^= o.cells[i].hashSum
+	}
+	return nil
+}
+
+// Decode lists the keys in the table
+// after a subtraction, added are the keys only present in the table, removed the keys only present in the subtracted table
+// if the table can not be fully decoded ErrUndecodable is returned
+// the table itself is not modified
+func (t *Table) Decode() (added, removed [][]byte, err error) {
+	d := &Table{
+		cells: make([]cell, len(t.cells)),
+	}
+	copy(d.cells, t.cells)
+
+	var pure []int
+	for i := range d.cells {
+		if d.pure(i) {
+			pure = append(pure, i)
+		}
+	}
+	for len(pure) > 0 {
+		i := pure[len(pure)-1]
+		pure = pure[:len(pure)-1]
+		// the cell may have been emptied by a previous key
+		if !d.pure(i) {
+			continue
+		}
+		c := d.cells[i]
+		key := make([]byte, KeySize)
+		copy(key, c.keySum[:])
+		if c.count > 0 {
+			added = append(added, key)
+		} else {
+			removed = append(removed, key)
+		}
+		for _, j := range d.indexes(c.keySum) {
+			d.cells[j].count -= c.count
+			for b := range c.keySum {
+				d.cells[j].keySum[b] ^= c.keySum[b]
+			}
+			d.cells[j].hashSum ^= c.hashSum
+			if d.pure(j) {
+				pure = append(pure, j)
+			}
+		}
+	}
+	for i := range d.cells {
+		if d.cells[i] != (cell{}) {
+			return nil, nil, ErrUndecodable
+		}
+	}
+	return added, removed, nil
+}
+
+// MarshalBinary encodes the table as the number of cells followed by the cells
+func (t *Table) MarshalBinary() (data []byte, err error) {
+	data = make([]byte, EncodedSize(len(t.cells)))
+	binary.BigEndian.PutUint32(data, uint32(len(t.cells)))
+	b := data[4:]
+	for _, c := range t.cells {
+		binary.BigEndian.PutUint32(b, uint32(c.count))
+		copy(b[4:], c.keySum[:])
+		binary.BigEndian.PutUint64(b[4+KeySize:], c.hashSum)
+		b = b[cellSize:]
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes data according to the Table.MarshalBinary format
+func (t *Table) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return errInvalidEncoding
+	}
+	n := int(binary.BigEndian.Uint32(data))
+	if n == 0 || n%hashCount != 0 || len(data) != EncodedSize(n) {
+		return errInvalidEncoding
+	}
+	t.cells = make([]cell, n)
+	b := data[4:]
+	for i := range t.cells {
+		t.cells[i].count = int32(binary.BigEndian.Uint32(b))
+		copy(t.cells[i].keySum[:], b[4:])
+		t.cells[i].hashSum = binary.BigEndian.Uint64(b[4+KeySize:])
+		b = b[cellSize:]
+	}
+	return nil
+}
+
+// toggle adds the key to all its cells with the given count
+func (t *Table) toggle(key [KeySize]byte, count int32) {
+	h := checkHash(key)
+	for _, i := range t.indexes(key) {
+		c := &t.cells[i]
+		c.count += count
+		for j := range key {
+			c.keySum[j] ^= key[j]
+		}
+		c.hashSum ^= h
+	}
+}
+
+// pure returns true if the cell at index i holds exactly one key
+func (t *Table) pure(i int) bool {
+	c := t.cells[i]
+	if c.count != 1 && c.count != -1 {
+		return false
+	}
+	return c.hashSum == checkHash(c.keySum)
+}
+
+// indexes returns the cells a key is mapped to
+// the table is partitioned into one subtable for each hash function
+// so that a key is always mapped to distinct cells
+func (t *Table) indexes(key [KeySize]byte) (idx [hashCount]int) {
+	m := uint64(len(t.cells) / hashCount)
+	for i := range idx {
+		h := fnv.New64a()
+		h.Write([]byte{byte(i)})
+		h.Write(key[:])
+		idx[i] = i*int(m) + int(mix(h.Sum64())%m)
+	}
+	return idx
+}
+
+// checkHash returns the hash used to verify that a cell holds a single key
+func checkHash(key [KeySize]byte) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{hashCount})
+	h.Write(key[:])
+	return mix(h.Sum64())
+}
+
+// mix is the murmur3 finaliser, it spreads the bits of fnv hashes
+// which are poorly distributed in the low bits used for the cell indexes
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
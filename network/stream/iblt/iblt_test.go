@@ -0,0 +1,152 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package iblt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"sort"
+	"testing"
+)
+
+func randomKeys(t *testing.T, n int) [][]byte {
+	t.Helper()
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = make([]byte, KeySize)
+		if _, err := rand.Read(keys[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return keys
+}
+
+func newTable(t *testing.T, cells int, keys ...[]byte) *Table {
+	t.Helper()
+	table := New(cells)
+	for _, k := range keys {
+		if err := table.Insert(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return table
+}
+
+func checkKeys(t *testing.T, got, exp [][]byte) {
+	t.Helper()
+	less := func(s [][]byte) func(i, j int) bool {
+		return func(i, j int) bool { return bytes.Compare(s[i], s[j]) < 0 }
+	}
+	sort.Slice(got, less(got))
+	sort.Slice(exp, less(exp))
+	if len(got) != len(exp) {
+		t.Fatalf("expected %d keys, got %d", len(exp), len(got))
+	}
+	for i := range got {
+		if !bytes.Equal(got[i], exp[i]) {
+			t.Fatalf("key %d: expected %x, got %x", i, exp[i], got[i])
+		}
+	}
+}
+
+// TestDecodeDifference tests that the symmetric difference of two
+// large sets is decoded from the subtraction of their tables
+func TestDecodeDifference(t *testing.T) {
+	common := randomKeys(t, 10000)
+	onlyA := randomKeys(t, 100)
+	onlyB := randomKeys(t, 50)
+
+	a := newTable(t, 600, append(append([][]byte{}, common...), onlyA...)...)
+	b := newTable(t, 600, append(append([][]byte{}, common...), onlyB...)...)
+	if err := a.Subtract(b); err != nil {
+		t.Fatal(err)
+	}
+	added, removed, err := a.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKeys(t, added, onlyA)
+	checkKeys(t, removed, onlyB)
+
+	// decoding does not modify the table
+	if _, _, err := a.Decode(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDecodeEqual tests that equal sets have an empty difference
+func TestDecodeEqual(t *testing.T) {
+	keys := randomKeys(t, 1000)
+	a := newTable(t, 30, keys...)
+	b := newTable(t, 30, keys...)
+	if err := a.Subtract(b); err != nil {
+		t.Fatal(err)
+	}
+	added, removed, err := a.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 0 || len(removed) != 0 {
+		t.Fatalf("expected empty difference, got %d added and %d removed", len(added), len(removed))
+	}
+}
+
+// TestDecodeTooLarge tests that a difference larger than the table is reported
+func TestDecodeTooLarge(t *testing.T) {
+	a := newTable(t, 30, randomKeys(t, 100)...)
+	if _, _, err := a.Decode(); err != ErrUndecodable {
+		t.Fatalf("expected error %v, got %v", ErrUndecodable, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if err := New(10).Insert(make([]byte, KeySize-1)); err != ErrInvalidKey {
+		t.Fatalf("expected error %v, got %v", ErrInvalidKey, err)
+	}
+	if err := New(10).Subtract(New(20)); err != ErrSizeMismatch {
+		t.Fatalf("expected error %v, got %v", ErrSizeMismatch, err)
+	}
+	for _, data := range [][]byte{nil, {0, 0, 0, 0}, {0, 0, 0, 3}} {
+		if err := new(Table).UnmarshalBinary(data); err == nil {
+			t.Fatalf("expected error decoding %x", data)
+		}
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	keys := randomKeys(t, 20)
+	a := newTable(t, 100, keys...)
+	if a.Size() != 102 {
+		t.Fatalf("expected size rounded to 102 cells, got %d", a.Size())
+	}
+	data, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != EncodedSize(a.Size()) {
+		t.Fatalf("expected encoded size %d, got %d", EncodedSize(a.Size()), len(data))
+	}
+	b := new(Table)
+	if err := b.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	added, _, err := b.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKeys(t, added, keys)
+}
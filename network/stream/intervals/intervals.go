@@ -167,6 +167,25 @@ func (i *Intervals) Last() (end uint64) {
 	return i.ranges[l-1][1]
 }
 
+// Covered returns the number of values up to and including
+// the ceiling that are contained in the intervals.
+func (i *Intervals) Covered(ceiling uint64) (n uint64) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	for _, r := range i.ranges {
+		if r[0] > ceiling {
+			break
+		}
+		end := r[1]
+		if end > ceiling {
+			end = ceiling
+		}
+		n += end - r[0] + 1
+	}
+	return n
+}
+
 // String returns a descriptive representation of range intervals
 // in [] notation, as a list of two element vectors.
 func (i *Intervals) String() string {
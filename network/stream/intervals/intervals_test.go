@@ -471,3 +471,50 @@ func TestMerge(t *testing.T) {
 		}
 	}
 }
+
+func TestCovered(t *testing.T) {
+	for i, tc := range []struct {
+		ranges   [][2]uint64
+		ceiling  uint64
+		expected uint64
+	}{
+		{
+			ranges:   nil,
+			ceiling:  100,
+			expected: 0,
+		},
+		{
+			ranges:   [][2]uint64{{1, 10}},
+			ceiling:  100,
+			expected: 10,
+		},
+		{
+			ranges:   [][2]uint64{{1, 10}},
+			ceiling:  5,
+			expected: 5,
+		},
+		{
+			ranges:   [][2]uint64{{1, 10}, {20, 30}},
+			ceiling:  25,
+			expected: 16,
+		},
+		{
+			ranges:   [][2]uint64{{1, 10}, {20, 30}},
+			ceiling:  15,
+			expected: 10,
+		},
+		{
+			ranges:   [][2]uint64{{5, 10}},
+			ceiling:  4,
+			expected: 0,
+		},
+	} {
+		intervals := NewIntervals(0)
+		intervals.ranges = tc.ranges
+
+		got := intervals.Covered(tc.ceiling)
+		if got != tc.expected {
+			t.Errorf("interval #%d: expected %d, got %d", i, tc.expected, got)
+		}
+	}
+}
@@ -17,6 +17,7 @@
 package stream
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"sync"
@@ -39,11 +40,12 @@ type Peer struct {
 	logger log.Logger
 
 	streamCursorsMu    sync.Mutex
-	streamCursors      map[string]uint64 // key: Stream ID string representation, value: session cursor. Keeps cursors for all streams. when unset - we are not interested in that bin
-	openWants          map[uint]*want    // maintain open wants on the client side
-	openOffers         map[uint]offer    // maintain open offers on the server side
-	clientOpenGetRange map[string]uint   // maintain open GetRange requests to eliminate overlapping requests on the client side
-	serverOpenGetRange map[string]uint   // maintain open GetRange requests to eliminate overlapping requests on the server side
+	streamCursors      map[string]uint64    // key: Stream ID string representation, value: session cursor. Keeps cursors for all streams. when unset - we are not interested in that bin
+	syncRates          map[string]*syncRate // key: Stream ID string representation, value: rate at which the stream history is synced
+	openWants          map[uint]*want       // maintain open wants on the client side
+	openOffers         map[uint]offer       // maintain open offers on the server side
+	clientOpenGetRange map[string]uint      // maintain open GetRange requests to eliminate overlapping requests on the client side
+	serverOpenGetRange map[string]uint      // maintain open GetRange requests to eliminate overlapping requests on the server side
 
 	quit chan struct{} // closed when peer is going offline
 }
@@ -55,6 +57,7 @@ func newPeer(peer *network.BzzPeer, baseAddress *network.BzzAddr, i state.Store,
 		providers:          providers,
 		intervalsStore:     i,
 		streamCursors:      make(map[string]uint64),
+		syncRates:          make(map[string]*syncRate),
 		openWants:          make(map[uint]*want),
 		openOffers:         make(map[uint]offer),
 		clientOpenGetRange: make(map[string]uint),
@@ -95,6 +98,7 @@ func (p *Peer) setCursor(stream ID, cursor uint64) {
 	defer p.streamCursorsMu.Unlock()
 
 	p.streamCursors[stream.String()] = cursor
+	p.syncRates[stream.String()] = newSyncRate(time.Now())
 }
 
 func (p *Peer) deleteCursor(stream ID) {
@@ -102,6 +106,30 @@ func (p *Peer) deleteCursor(stream ID) {
 	defer p.streamCursorsMu.Unlock()
 
 	delete(p.streamCursors, stream.String())
+	delete(p.syncRates, stream.String())
+}
+
+// addSynced records that n chunks of the stream history were synced
+func (p *Peer) addSynced(stream ID, n uint64) {
+	p.streamCursorsMu.Lock()
+	defer p.streamCursorsMu.Unlock()
+
+	if r, ok := p.syncRates[stream.String()]; ok {
+		r.add(time.Now(), n)
+	}
+}
+
+// getSyncRate returns the rate in chunks per second at which the stream history
+// is currently synced
+func (p *Peer) getSyncRate(stream ID) float64 {
+	p.streamCursorsMu.Lock()
+	defer p.streamCursorsMu.Unlock()
+
+	r, ok := p.syncRates[stream.String()]
+	if !ok {
+		return 0
+	}
+	return r.rate(time.Now())
 }
 
 // InitProviders initializes a provider for a certain peer
@@ -113,6 +141,28 @@ func (p *Peer) InitProviders() {
 	}
 }
 
+// RequestStreams asks the peer for the cursors of the given streams, the streams
+// are then synced according to their provider once the cursors are received
+func (p *Peer) RequestStreams(ctx context.Context, streams ...ID) error {
+	for _, stream := range streams {
+		if _, err := p.getOrCreateInterval(p.peerStreamIntervalKey(stream)); err != nil {
+			return fmt.Errorf("creating interval for stream %s: %w", stream, err)
+		}
+	}
+	return p.Send(ctx, &StreamInfoReq{Streams: streams})
+}
+
+// StopStream stops syncing a stream from the peer
+// the synced intervals are kept so that syncing resumes where it stopped when the stream is requested again
+func (p *Peer) StopStream(stream ID) {
+	p.deleteCursor(stream)
+}
+
+// Done returns a channel which is closed when the peer goes offline
+func (p *Peer) Done() <-chan struct{} {
+	return p.quit
+}
+
 // offer represents an open offer from a server to a client as a result of a GetRange message
 // it is stored for reference to requests on the peer.openOffers map
 type offer struct {
@@ -194,6 +244,9 @@ func (p *Peer) sealWant(w *want) error {
 	if err != nil {
 		return err
 	}
+	if !w.head {
+		p.addSynced(w.stream, *w.to-w.from+1)
+	}
 	p.mtx.Lock()
 	delete(p.openWants, w.ruid)
 	s := p.getRangeKey(w.stream, w.head)
@@ -232,3 +285,56 @@ func (p *Peer) peerStreamIntervalKey(stream ID) string {
 func (p *Peer) getRangeKey(id ID, head bool) string {
 	return fmt.Sprintf("%s_%t", id.String(), head)
 }
+
+// syncRateWindow is the period over which the rate of syncing a stream is measured
+var syncRateWindow = time.Minute
+
+// syncRate measures the rate at which chunks of a stream are synced
+// over the last syncRateWindow
+type syncRate struct {
+	start   time.Time    // start of the measurement
+	samples []rateSample // ranges synced within the window, oldest first
+}
+
+type rateSample struct {
+	at time.Time // time the range was synced
+	n  uint64    // number of chunks in the range
+}
+
+func newSyncRate(start time.Time) *syncRate {
+	return &syncRate{start: start}
+}
+
+// add records n chunks synced at time now
+func (r *syncRate) add(now time.Time, n uint64) {
+	r.prune(now)
+	r.samples = append(r.samples, rateSample{at: now, n: n})
+}
+
+// rate returns the number of chunks synced per second within the window
+func (r *syncRate) rate(now time.Time) float64 {
+	r.prune(now)
+	var n uint64
+	for _, s := range r.samples {
+		n += s.n
+	}
+	elapsed := now.Sub(r.start)
+	if elapsed > syncRateWindow {
+		elapsed = syncRateWindow
+	}
+	if elapsed < time.Second {
+		elapsed = time.Second
+	}
+	return float64(n) / elapsed.Seconds()
+}
+
+// prune removes the samples older than the window
+func (r *syncRate) prune(now time.Time) {
+	i := 0
+	for ; i < len(r.samples); i++ {
+		if now.Sub(r.samples[i].at) <= syncRateWindow {
+			break
+		}
+	}
+	r.samples = r.samples[i:]
+}
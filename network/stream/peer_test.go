@@ -0,0 +1,46 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSyncRate tests the measurement of the rate at which a stream is synced
+func TestSyncRate(t *testing.T) {
+	start := time.Now()
+	r := newSyncRate(start)
+
+	if rate := r.rate(start); rate != 0 {
+		t.Fatalf("expected rate 0 without samples, got %v", rate)
+	}
+
+	// the rate is measured since the start while it is shorter than the window
+	r.add(start.Add(5*time.Second), 50)
+	r.add(start.Add(10*time.Second), 50)
+	if rate := r.rate(start.Add(10 * time.Second)); rate != 10 {
+		t.Fatalf("expected rate 10, got %v", rate)
+	}
+
+	// only samples within the window are counted
+	now := start.Add(syncRateWindow + 8*time.Second)
+	r.add(now, 500)
+	if rate := r.rate(now); rate != float64(550)/syncRateWindow.Seconds() {
+		t.Fatalf("expected rate %v, got %v", float64(550)/syncRateWindow.Seconds(), rate)
+	}
+}
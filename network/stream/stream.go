@@ -17,11 +17,13 @@
 package stream
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"math/rand"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -38,6 +40,7 @@ import (
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/network"
 	bv "github.com/ethersphere/swarm/network/bitvector"
+	"github.com/ethersphere/swarm/network/stream/iblt"
 	"github.com/ethersphere/swarm/network/stream/intervals"
 	"github.com/ethersphere/swarm/network/timeouts"
 	"github.com/ethersphere/swarm/p2p/protocols"
@@ -51,6 +54,9 @@ const (
 	MinFrameSize = 16
 )
 
+// reconcileVersion is the protocol version which introduced syncing the stream history by set reconciliation
+const reconcileVersion = 9
+
 var (
 	// Compile time interface check
 	_ node.Service = (*Registry)(nil)
@@ -66,6 +72,9 @@ var (
 	streamChunkDeliveryFail       = metrics.GetOrRegisterCounter("network/stream/delivery_fail", nil)
 	streamRequestNextIntervalFail = metrics.GetOrRegisterCounter("network/stream/next_interval_fail", nil)
 
+	streamReconcileFallback = metrics.GetOrRegisterCounter("network/stream/reconcile_fallback", nil)
+	reconcileMissingGauge   = metrics.GetOrRegisterGauge("network/stream/reconcile_missing", nil)
+
 	headBatchSizeGauge = metrics.GetOrRegisterGauge("network/stream/batch_size_head", nil)
 	batchSizeGauge     = metrics.GetOrRegisterGauge("network/stream/batch_size", nil)
 
@@ -81,8 +90,9 @@ var (
 	// Protocol spec
 	Spec = &protocols.Spec{
 		Name:       "bzz-stream",
-		Version:    8,
+		Version:    reconcileVersion,
 		MaxMsgSize: 10 * 1024 * 1024,
+		Priority:   protocols.PriorityLow,
 		Messages: []interface{}{
 			StreamInfoReq{},
 			StreamInfoRes{},
@@ -90,6 +100,17 @@ var (
 			OfferedHashes{},
 			ChunkDelivery{},
 			WantedHashes{},
+			ReconcileRange{},
+		},
+		OldVersions: map[uint][]interface{}{
+			8: {
+				StreamInfoReq{},
+				StreamInfoRes{},
+				GetRange{},
+				OfferedHashes{},
+				ChunkDelivery{},
+				WantedHashes{},
+			},
 		},
 	}
 
@@ -153,6 +174,8 @@ func (r *Registry) HandleMsg(p *Peer) func(context.Context, interface{}) error {
 			return r.clientHandleStreamInfoRes(ctx, p, msg)
 		case *GetRange:
 			return r.serverHandleGetRange(ctx, p, msg)
+		case *ReconcileRange:
+			return r.serverHandleReconcileRange(ctx, p, msg)
 		case *OfferedHashes:
 			return r.clientHandleOfferedHashes(ctx, p, msg)
 		case *WantedHashes:
@@ -248,12 +271,17 @@ func (r *Registry) clientHandleStreamInfoRes(ctx context.Context, p *Peer, msg *
 		p.setCursor(s.Stream, s.Cursor)
 
 		if provider.Autostart() {
+			// a bounded stream with cursor == 0 is empty and already complete
+			if s.Bounded && s.Cursor == 0 {
+				r.clientStreamComplete(p, provider, s.Stream, s.Cursor)
+				continue
+			}
 			// don't request historical ranges for streams with cursor == 0
 			if s.Cursor > 0 {
 				p.logger.Debug("requesting history stream", "stream", s.Stream, "cursor", s.Cursor)
 				// fetch everything from beginning till s.Cursor
 				go func() {
-					err := r.clientRequestStreamRange(ctx, p, provider, s.Stream, s.Cursor)
+					err := r.clientRequestStreamHistory(ctx, p, provider, s.Stream, s.Cursor)
 					// todo: return DropError
 					if err != nil {
 						p.Drop("had an error sending initial GetRange for historical stream")
@@ -303,11 +331,88 @@ func (r *Registry) clientRequestStreamRange(ctx context.Context, p *Peer, provid
 	// nothing to do - the next interval is bigger than the cursor or theinterval is empty
 	if from > cursor || empty {
 		p.logger.Debug("peer.requestStreamRange stream finished", "stream", stream, "cursor", cursor)
+		r.clientStreamComplete(p, provider, stream, cursor)
 		return nil
 	}
 	return r.clientCreateSendWant(ctx, p, stream, from, &cursor, false)
 }
 
+// clientRequestStreamHistory requests the history of a stream up to the supplied cursor position
+// by set reconciliation if the provider and the peer support it, otherwise by requesting the range. reconciliation
+// is skipped when offering the hashes of the remaining range costs less than sending the digest
+func (r *Registry) clientRequestStreamHistory(ctx context.Context, p *Peer, provider StreamProvider, stream ID, cursor uint64) error {
+	reconciler, ok := provider.(SetReconciler)
+	if !ok || reconciler.DigestSize() == 0 || p.Version() < reconcileVersion {
+		return r.clientRequestStreamRange(ctx, p, provider, stream, cursor)
+	}
+	p.logger.Debug("clientRequestStreamHistory", "stream", stream, "cursor", cursor)
+
+	from, _, empty, err := p.nextInterval(stream, 0)
+	if err != nil {
+		return protocols.Break(err)
+	}
+	if from > cursor || empty {
+		p.logger.Debug("peer.requestStreamHistory stream finished", "stream", stream, "cursor", cursor)
+		r.clientStreamComplete(p, provider, stream, cursor)
+		return nil
+	}
+	if (cursor-from+1)*HashSize <= uint64(iblt.EncodedSize(reconciler.DigestSize())) {
+		return r.clientCreateSendWant(ctx, p, stream, from, &cursor, false)
+	}
+
+	key, err := provider.ParseKey(stream.Key)
+	if err != nil {
+		return protocols.Break(fmt.Errorf("parsing stream key for stream %s: %w", stream, err))
+	}
+	var (
+		table     = iblt.New(reconciler.DigestSize())
+		insertErr error
+	)
+	err = reconciler.LocalSet(ctx, p, key, func(addr chunk.Address) bool {
+		insertErr = table.Insert(addr)
+		return insertErr == nil
+	})
+	if err == nil {
+		err = insertErr
+	}
+	if err != nil {
+		return fmt.Errorf("building digest for stream %s: %w", stream, err)
+	}
+	digest, err := table.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	g := ReconcileRange{
+		Ruid:      uint(rand.Uint32()),
+		Stream:    stream,
+		From:      from,
+		To:        cursor,
+		BatchSize: BatchSize,
+		Digest:    digest,
+	}
+	if !r.clientCreateWant(p, g.Ruid, stream, from, &cursor, false) {
+		return nil
+	}
+
+	p.logger.Trace("clientRequestStreamHistory", "ruid", g.Ruid, "stream", g.Stream, "from", g.From, "to", g.To, "digest", len(digest))
+
+	return p.Send(ctx, g)
+}
+
+// clientStreamComplete is called when the history of a stream is synced up to the cursor
+// the cursor of a bounded stream is removed, as the stream is done, and the provider notified
+func (r *Registry) clientStreamComplete(p *Peer, provider StreamProvider, stream ID, cursor uint64) {
+	if !provider.Boundedness() {
+		return
+	}
+	p.logger.Debug("bounded stream complete", "stream", stream, "cursor", cursor)
+	p.deleteCursor(stream)
+	if bp, ok := provider.(BoundedStreamProvider); ok {
+		bp.StreamComplete(p, stream, cursor)
+	}
+}
+
 func (r *Registry) clientCreateSendWant(ctx context.Context, p *Peer, stream ID, from uint64, to *uint64, head bool) error {
 	g := GetRange{
 		Ruid:      uint(rand.Uint32()),
@@ -316,20 +421,32 @@ func (r *Registry) clientCreateSendWant(ctx context.Context, p *Peer, stream ID,
 		To:        to,
 		BatchSize: BatchSize,
 	}
+	if !r.clientCreateWant(p, g.Ruid, stream, from, to, head) {
+		return nil
+	}
+
+	p.logger.Trace("clientCreateSendWant", "ruid", g.Ruid, "stream", g.Stream, "from", g.From, "to", to)
+
+	return p.Send(ctx, g)
+}
 
+// clientCreateWant stores an open want for the peer. it returns false if
+// a range of the stream is already requested from the peer
+func (r *Registry) clientCreateWant(p *Peer, ruid uint, stream ID, from uint64, to *uint64, head bool) bool {
 	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
 	s := p.getRangeKey(stream, head)
 	if v, ok := p.clientOpenGetRange[s]; ok {
 		p.logger.Warn("batch already requested, skipping", "stream", stream, "head", head, "from", from, "to", to, "existing ruid", v)
-		p.mtx.Unlock()
-		return nil
+		return false
 	}
-	p.clientOpenGetRange[s] = g.Ruid
+	p.clientOpenGetRange[s] = ruid
 
-	p.openWants[g.Ruid] = &want{
-		ruid:   g.Ruid,
-		stream: g.Stream,
-		from:   g.From,
+	p.openWants[ruid] = &want{
+		ruid:   ruid,
+		stream: stream,
+		from:   from,
 		to:     to,
 		head:   head,
 		hashes: make(map[string]struct{}),
@@ -338,11 +455,7 @@ func (r *Registry) clientCreateSendWant(ctx context.Context, p *Peer, stream ID,
 
 		requested: time.Now(),
 	}
-	p.mtx.Unlock()
-
-	p.logger.Trace("clientCreateSendWant", "ruid", g.Ruid, "stream", g.Stream, "from", g.From, "to", to)
-
-	return p.Send(ctx, g)
+	return true
 }
 
 // serverHandleGetRange is handled by the server and sends in response an OfferedHashes message
@@ -452,6 +565,100 @@ func (r *Registry) serverHandleGetRange(ctx context.Context, p *Peer, msg *GetRa
 	return nil
 }
 
+// serverHandleReconcileRange is handled by the server and sends in response an OfferedHashes message
+// with the chunks of the stream up to msg.To that are missing from the digest of the client.
+// if the difference can not be decoded from the digest, the range is offered as for a GetRange message
+// only the offered chunks are set as synced, once the client responds to the offer and they are delivered
+func (r *Registry) serverHandleReconcileRange(ctx context.Context, p *Peer, msg *ReconcileRange) error {
+	provider := r.getProvider(msg.Stream)
+	if provider == nil {
+		return protocols.Break(fmt.Errorf("unsupported provider"))
+	}
+
+	p.logger.Debug("serverHandleReconcileRange", "ruid", msg.Ruid, "from", msg.From, "to", msg.To)
+	start := time.Now()
+	defer func(start time.Time) {
+		metrics.GetOrRegisterResettingTimer("network/stream/handle_reconcile_range/total-time", nil).UpdateSince(start)
+	}(start)
+
+	digest := new(iblt.Table)
+	if err := digest.UnmarshalBinary(msg.Digest); err != nil {
+		return protocols.Break(fmt.Errorf("decoding digest, ruid %d: %w", msg.Ruid, err))
+	}
+	key, err := provider.ParseKey(msg.Stream.Key)
+	if err != nil {
+		return protocols.Break(fmt.Errorf("parsing stream key for stream %s: %w", msg.Stream, err))
+	}
+
+	// the digest summarises all the chunks of the client, so the difference
+	// is taken against the whole stream and not only the requested range
+	var (
+		table     = iblt.New(digest.Size())
+		insertErr error
+	)
+	descriptors, stop := provider.Subscribe(ctx, key, 1, msg.To)
+	completed := iterateDescriptors(ctx, descriptors, msg.To, p.quit, func(d chunk.Descriptor) bool {
+		insertErr = table.Insert(d.Address)
+		return insertErr == nil
+	})
+	stop()
+	if !completed {
+		return nil
+	}
+	if insertErr != nil {
+		return protocols.Break(fmt.Errorf("building digest, ruid %d: %w", msg.Ruid, insertErr))
+	}
+	if err := table.Subtract(digest); err != nil {
+		return protocols.Break(fmt.Errorf("subtracting digest, ruid %d: %w", msg.Ruid, err))
+	}
+	missing, _, err := table.Decode()
+	if reconcileTestHook != nil {
+		// call the test function if it is set
+		reconcileTestHook(len(missing), err)
+	}
+	if err != nil {
+		p.logger.Debug("reconciliation failed, offering range", "ruid", msg.Ruid, "stream", msg.Stream, "err", err)
+		streamReconcileFallback.Inc(1)
+		to := msg.To
+		return r.serverHandleGetRange(ctx, p, &GetRange{
+			Ruid:      msg.Ruid,
+			Stream:    msg.Stream,
+			From:      msg.From,
+			To:        &to,
+			BatchSize: msg.BatchSize,
+		})
+	}
+	reconcileMissingGauge.Update(int64(len(missing)))
+
+	offered := OfferedHashes{
+		Ruid:      msg.Ruid,
+		LastIndex: msg.To,
+		Hashes:    bytes.Join(missing, nil),
+	}
+	if len(missing) > 0 {
+		p.mtx.Lock()
+		p.openOffers[msg.Ruid] = offer{
+			ruid:      msg.Ruid,
+			stream:    msg.Stream,
+			hashes:    offered.Hashes,
+			requested: time.Now(),
+		}
+		p.mtx.Unlock()
+	}
+	if err := p.Send(ctx, offered); err != nil {
+		p.mtx.Lock()
+		delete(p.openOffers, msg.Ruid)
+		p.mtx.Unlock()
+		return protocols.Break(fmt.Errorf("sending reconciled offered hashes, ruid %d: %w", msg.Ruid, err))
+	}
+	return nil
+}
+
+// reconcileTestHook is called by the server with the number of chunks
+// missing on the client or the error decoding the difference. This
+// function pointer must be nil in production.
+var reconcileTestHook func(missing int, err error)
+
 // clientHandleOfferedHashes handles the OfferedHashes wire protocol message (Peer is the server)
 func (r *Registry) clientHandleOfferedHashes(ctx context.Context, p *Peer, msg *OfferedHashes) error {
 	w, err := p.getWant(msg.Ruid)
@@ -919,6 +1126,34 @@ func (r *Registry) serverCollectBatch(ctx context.Context, p *Peer, provider Str
 	return batch, *batchStartID, batchEndID, false, nil
 }
 
+// iterateDescriptors calls f with the descriptors received from a provider subscription until the one with
+// the bin id to is received, the subscription is closed, f returns false or no descriptor is received within
+// timeouts.BatchTimeout, which happens when the chunk with the bin id to is no longer stored
+// it returns false if the iteration was interrupted by ctx or quit
+func iterateDescriptors(ctx context.Context, descriptors <-chan chunk.Descriptor, to uint64, quit <-chan struct{}, f func(chunk.Descriptor) bool) bool {
+	timer := time.NewTimer(timeouts.BatchTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case d, ok := <-descriptors:
+			if !ok || !f(d) || d.BinID >= to {
+				return true
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(timeouts.BatchTimeout)
+		case <-timer.C:
+			return true
+		case <-ctx.Done():
+			return false
+		case <-quit:
+			return false
+		}
+	}
+}
+
 // requestSubsequentRange checks the cursor for the current stream, and in case needed - requests the next range
 func (r *Registry) requestSubsequentRange(ctx context.Context, p *Peer, provider StreamProvider, w *want, lastIndex uint64) error {
 	cur, ok := p.getCursor(w.stream)
@@ -1041,6 +1276,98 @@ func (r *Registry) PeerInfo() (*PeerInfo, error) {
 	return info, nil
 }
 
+// BinSyncProgress holds the pull sync progress of the history of a bin
+// aggregated over all peers the bin is synced from
+type BinSyncProgress struct {
+	Bin    int    `json:"bin"`    // proximity order bin
+	Peers  int    `json:"peers"`  // number of peers the bin is synced from
+	Cursor uint64 `json:"cursor"` // sum of the peers' stream cursors at the start of the sync session
+	Synced uint64 `json:"synced"` // number of chunks up to the cursors already synced
+}
+
+// PeerSyncProgress holds the pull sync progress of the history of a bin from a peer
+type PeerSyncProgress struct {
+	Peer      string        `json:"peer"`      // overlay address of the peer
+	Bin       int           `json:"bin"`       // proximity order bin
+	Cursor    uint64        `json:"cursor"`    // the peer's stream cursor at the start of the sync session
+	Synced    uint64        `json:"synced"`    // number of chunks up to the cursor already synced
+	Gap       uint64        `json:"gap"`       // number of chunks up to the cursor not yet synced
+	Intervals string        `json:"intervals"` // locally synced intervals of the stream
+	Rate      float64       `json:"rate"`      // chunks synced per second recently
+	ETA       time.Duration `json:"eta"`       // estimated time to sync the gap at the current rate, 0 if unknown or synced
+}
+
+// PeerSyncProgress returns the pull sync progress for all bins synced from
+// each connected peer, ordered by peer and bin
+func (r *Registry) PeerSyncProgress() ([]PeerSyncProgress, error) {
+	r.mtx.RLock()
+	peers := make([]*Peer, 0, len(r.peers))
+	for _, p := range r.peers {
+		peers = append(peers, p)
+	}
+	r.mtx.RUnlock()
+	sort.Slice(peers, func(i, j int) bool {
+		return bytes.Compare(peers[i].OAddr, peers[j].OAddr) < 0
+	})
+
+	var progress []PeerSyncProgress
+	for _, p := range peers {
+		for po := uint8(0); po <= chunk.MaxPO; po++ {
+			stream := NewID(syncStreamName, encodeSyncKey(po))
+			cursor, ok := p.getCursor(stream)
+			if !ok {
+				continue
+			}
+			i := &intervals.Intervals{}
+			p.mtx.RLock()
+			err := p.intervalsStore.Get(p.peerStreamIntervalKey(stream), i)
+			p.mtx.RUnlock()
+			if err != nil && err != state.ErrNotFound {
+				return nil, err
+			}
+			synced := i.Covered(cursor)
+			ps := PeerSyncProgress{
+				Peer:      hex.EncodeToString(p.OAddr),
+				Bin:       int(po),
+				Cursor:    cursor,
+				Synced:    synced,
+				Gap:       cursor - synced,
+				Intervals: i.String(),
+				Rate:      p.getSyncRate(stream),
+			}
+			if ps.Gap > 0 && ps.Rate > 0 {
+				ps.ETA = time.Duration(float64(ps.Gap) / ps.Rate * float64(time.Second))
+			}
+			progress = append(progress, ps)
+		}
+	}
+	return progress, nil
+}
+
+// SyncProgress returns the pull sync progress for all bins that
+// are synced from at least one peer, ordered by bin
+func (r *Registry) SyncProgress() ([]BinSyncProgress, error) {
+	peerProgress, err := r.PeerSyncProgress()
+	if err != nil {
+		return nil, err
+	}
+	var bins [chunk.MaxPO + 1]BinSyncProgress
+	for _, p := range peerProgress {
+		bins[p.Bin].Peers++
+		bins[p.Bin].Cursor += p.Cursor
+		bins[p.Bin].Synced += p.Synced
+	}
+	var progress []BinSyncProgress
+	for po, b := range bins {
+		if b.Peers == 0 {
+			continue
+		}
+		b.Bin = po
+		progress = append(progress, b)
+	}
+	return progress, nil
+}
+
 // LastReceivedChunkTime returns the time when the last chunk
 // was received by syncing. This method is used in api.Inspector
 // to detect when the syncing is complete.
@@ -39,6 +39,10 @@ const (
 	syncStreamName   = "SYNC"
 	cacheCapacity    = 10000
 	setCacheCapacity = 80000 // 80000 * 32 = ~2.5mb mem footprint, 80K chunks ~=330 megs of data
+
+	// DefaultDigestSize is the number of cells of the set reconciliation digests, ~45kb on the wire
+	// allowing to reconcile bins which differ by a few hundred chunks
+	DefaultDigestSize = 1024
 )
 
 var (
@@ -58,6 +62,7 @@ type syncProvider struct {
 	setCacheMtx             sync.RWMutex      // set cache mutex
 	setCache                *lru.Cache        // cache to reduce load on localstore to not set the same chunk as synced
 	logger                  log.Logger        // logger that appends the base address to loglines
+	digestSize              int               // number of cells of set reconciliation digests, 0 disables reconciliation
 }
 
 // NewSyncProvider creates a new sync provider that is used by the stream protocol to sink data and control its behaviour
@@ -87,6 +92,14 @@ func NewSyncProvider(ns *storage.NetStore, kad *network.Kademlia, baseAddr *netw
 	}
 }
 
+// NewReconcilingSyncProvider creates a new sync provider which syncs the history of the streams
+// by set reconciliation with digests of digestSize cells instead of offering all the hashes, see SetReconciler
+func NewReconcilingSyncProvider(ns *storage.NetStore, kad *network.Kademlia, baseAddr *network.BzzAddr, autostart bool, syncOnlyWithinDepth bool, digestSize int) StreamProvider {
+	s := NewSyncProvider(ns, kad, baseAddr, autostart, syncOnlyWithinDepth).(*syncProvider)
+	s.digestSize = digestSize
+	return s
+}
+
 // NeedData checks if we need to retrieve the supplied addrs from the upstream peer
 func (s *syncProvider) NeedData(ctx context.Context, addrs ...chunk.Address) ([]bool, error) {
 	var (
@@ -263,6 +276,50 @@ func (s *syncProvider) Subscribe(ctx context.Context, key interface{}, from, to
 	return s.netStore.SubscribePull(ctx, bin, from, to)
 }
 
+// DigestSize returns the number of cells of set reconciliation digests
+func (s *syncProvider) DigestSize() int {
+	return s.digestSize
+}
+
+// LocalSet iterates the chunks in the localstore which are in the bin of the peer given by the stream key
+// if the bin is closer to us than the peer, these are the chunks in our bin with the same proximity
+// order, otherwise the chunks in our bins from the proximity order of the peer that are in the bin of the peer
+func (s *syncProvider) LocalSet(ctx context.Context, p *Peer, key interface{}, f func(chunk.Address) bool) error {
+	bin := key.(uint8)
+	peerPO := uint8(chunk.Proximity(p.BzzAddr.Over(), s.kad.BaseAddr()))
+	start, end := bin, bin
+	if bin >= peerPO {
+		start, end = peerPO, chunk.MaxPO
+	}
+
+	for b := start; b <= end; b++ {
+		last, err := s.netStore.LastPullSubscriptionBinID(b)
+		if err != nil {
+			return err
+		}
+		if last == 0 {
+			continue
+		}
+		descriptors, stop := s.netStore.SubscribePull(ctx, b, 0, last)
+		next := true
+		completed := iterateDescriptors(ctx, descriptors, last, s.quit, func(d chunk.Descriptor) bool {
+			if bin >= peerPO && chunk.Proximity(d.Address, p.BzzAddr.Over()) != int(bin) {
+				return true
+			}
+			next = f(d.Address)
+			return next
+		})
+		stop()
+		if !completed {
+			return errors.New("local set iteration interrupted")
+		}
+		if !next {
+			return nil
+		}
+	}
+	return nil
+}
+
 // Cursor gets the cursor from the localstore for a given stream key
 func (s *syncProvider) Cursor(k string) (cursor uint64, err error) {
 	key, err := s.ParseKey(k)
@@ -358,18 +415,11 @@ func (s *syncProvider) updateSyncSubscriptions(p *Peer, subBins, quitBins []int)
 	if l := len(subBins); l > 0 {
 		streams := make([]ID, l)
 		for i, po := range subBins {
-
-			stream := NewID(s.StreamName(), encodeSyncKey(uint8(po)))
-			_, err := p.getOrCreateInterval(p.peerStreamIntervalKey(stream))
-			if err != nil {
-				p.logger.Error("got an error while trying to register initial streams", "stream", stream)
-			}
-
-			streams[i] = stream
+			streams[i] = NewID(s.StreamName(), encodeSyncKey(uint8(po)))
 		}
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
-		if err := p.Send(ctx, &StreamInfoReq{Streams: streams}); err != nil {
+		if err := p.RequestStreams(ctx, streams...); err != nil {
 			p.logger.Error("error establishing subsequent subscription", "err", err)
 			p.Drop("error establishing subsequent subscription")
 			return
@@ -216,6 +216,88 @@ func TestTwoNodesSyncWithGaps(t *testing.T) {
 	}
 }
 
+// TestSyncProgress tests that the pull sync progress reported by the registry
+// reaches the cursors of the peer once all historical chunks are synced
+func TestSyncProgress(t *testing.T) {
+	sim := simulation.NewBzzInProc(map[string]simulation.ServiceFunc{
+		serviceNameStream: newSyncSimServiceFunc(&SyncSimServiceOptions{Autostart: true}),
+	}, false)
+	defer sim.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	uploadNode, err := sim.AddNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadStore := sim.MustNodeItem(uploadNode, bucketKeyFileStore).(chunk.Store)
+	mustUploadChunks(ctx, t, uploadStore, 100)
+
+	syncNode, err := sim.AddNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	progress, err := nodeRegistry(sim, syncNode).SyncProgress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) != 0 {
+		t.Fatalf("expected no sync progress without peers, got %v", progress)
+	}
+
+	if err := sim.Net.Connect(uploadNode, syncNode); err != nil {
+		t.Fatal(err)
+	}
+	syncStore := sim.MustNodeItem(syncNode, bucketKeyFileStore).(chunk.Store)
+	if err := waitChunks(syncStore, 100, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		progress, err = nodeRegistry(sim, syncNode).SyncProgress()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cursors, synced uint64
+		for _, p := range progress {
+			if p.Peers != 1 {
+				t.Fatalf("bin %d: expected 1 peer, got %d", p.Bin, p.Peers)
+			}
+			cursors += p.Cursor
+			synced += p.Synced
+		}
+		if cursors == 100 && synced == cursors {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("sync progress not complete: %v", progress)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	peerProgress, err := nodeRegistry(sim, syncNode).PeerSyncProgress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peerProgress) != len(progress) {
+		t.Fatalf("expected progress for %d bins, got %d", len(progress), len(peerProgress))
+	}
+	uploadAddr := hex.EncodeToString(nodeKademlia(sim, uploadNode).BaseAddr())
+	for i, p := range peerProgress {
+		if p.Peer != uploadAddr {
+			t.Fatalf("expected progress from peer %s, got %s", uploadAddr, p.Peer)
+		}
+		if p.Bin != progress[i].Bin || p.Cursor != progress[i].Cursor || p.Synced != p.Cursor {
+			t.Fatalf("bin %d: peer progress %+v does not match %+v", progress[i].Bin, p, progress[i])
+		}
+		if p.Gap != 0 || p.ETA != 0 {
+			t.Fatalf("bin %d: expected no gap and no eta, got %+v", p.Bin, p)
+		}
+	}
+}
+
 // TestTheeNodesUnionHistoricalSync brings up three nodes, uploads content too all of them and then
 // asserts that all of them have the union of all 3 local stores (depth is assumed to be 0)
 func TestThreeNodesUnionHistoricalSync(t *testing.T) {
@@ -260,6 +342,75 @@ func TestThreeNodesUnionHistoricalSync(t *testing.T) {
 	}
 }
 
+// TestTwoNodesReconcileHistoricalSync brings up two nodes which already share most of their chunks
+// and asserts that the history of large bins is synced by set reconciliation, offering only the
+// chunks missing on the downstream peer, and that both nodes end up with the union of their chunks
+func TestTwoNodesReconcileHistoricalSync(t *testing.T) {
+	const (
+		commonCount = 1000
+		uniqueCount = 10
+	)
+	var (
+		mu              sync.Mutex
+		reconciled      int
+		missing         int
+		reconcileErrors int
+	)
+	reconcileTestHook = func(m int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			reconcileErrors++
+			return
+		}
+		reconciled++
+		missing += m
+	}
+	defer func() { reconcileTestHook = nil }()
+
+	sim := simulation.NewBzzInProc(map[string]simulation.ServiceFunc{
+		"bzz-sync": newSyncSimServiceFunc(&SyncSimServiceOptions{Autostart: true, DigestSize: 120}),
+	}, false)
+	defer sim.Close()
+
+	common := storage.GenerateRandomChunks(chunk.DefaultSize, commonCount)
+	nodeIDs := []enode.ID{}
+	for i := 0; i < 2; i++ {
+		node, err := sim.AddNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodeIDs = append(nodeIDs, node)
+		store := sim.MustNodeItem(node, bucketKeyLocalStore).(*localstore.DB)
+		chunks := append(storage.GenerateRandomChunks(chunk.DefaultSize, uniqueCount), common...)
+		if _, err := store.Put(context.Background(), chunk.ModePutUpload, chunks...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sim.Net.ConnectNodesFull(nodeIDs); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range nodeIDs {
+		nodeStore := sim.MustNodeItem(n, bucketKeyFileStore).(*storage.FileStore)
+		if err := waitChunks(nodeStore, commonCount+2*uniqueCount, 10*time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if reconciled == 0 {
+		t.Fatal("expected history to be synced by set reconciliation")
+	}
+	if reconcileErrors > 0 {
+		t.Fatalf("expected all reconciliations to succeed, %d failed", reconcileErrors)
+	}
+	if missing > 2*uniqueCount {
+		t.Fatalf("expected at most %d missing chunks offered, got %d", 2*uniqueCount, missing)
+	}
+}
+
 // TestFullSync performs a series of subtests where a number of nodes are
 // connected to the single (chunk uploading) node.
 func TestFullSync(t *testing.T) {
@@ -33,6 +33,18 @@ import (
 // which is to decide whether to retrieve data or not), retrieving cursors from the data store, the
 // implementation of which streams to maintain with a certain peer and providing functionality
 // to expose, parse and encode values related to the string represntation of the stream
+//
+// Applications register their own streams by passing providers to New next to the sync provider.
+// Providers are identified by StreamName, which has to be unique per Registry and the same on
+// all the nodes exchanging the streams. A stream of a provider is identified by its key and is an
+// ordered sequence of chunks indexed from 1, the index of the last chunk is the stream cursor.
+// The Registry keeps track of the synced intervals of every stream per peer, so that only the
+// chunks not synced in a previous session are requested again.
+//
+// Streams are requested by the downstream peer: InitPeer is called for every connected peer
+// and requests the streams wanted from that peer with Peer.RequestStreams. Bounded streams
+// (Boundedness returns true) are synced up to the cursor returned by the upstream peer and then
+// complete, see BoundedStreamProvider. Unbounded streams keep on syncing new chunks past the cursor.
 type StreamProvider interface {
 
 	// NeedData informs the caller whether a certain chunk needs to be fetched from another peer or not
@@ -48,16 +60,22 @@ type StreamProvider interface {
 	Set(ctx context.Context, addrs ...chunk.Address) error
 
 	// Subscribe to a data stream from an arbitrary data source
+	// the descriptors of the chunks with indexes from from up to and including to have to be sent
+	// in increasing index order, a to of 0 means no upper bound. the channel should be closed
+	// once the chunk with the index to is sent, or when the returned stop function is called
 	Subscribe(ctx context.Context, key interface{}, from, to uint64) (<-chan chunk.Descriptor, func())
 
 	// Cursor returns the last known Cursor for a given Stream Key string
+	// a stream which does not exist has a cursor of 0
 	Cursor(string) (uint64, error)
 
 	// InitPeer is a provider specific implementation on how to maintain running streams with
 	// an arbitrary Peer. This method should always be run in a separate goroutine
+	// it requests the wanted streams with Peer.RequestStreams, and should return when Peer.Done is closed
 	InitPeer(p *Peer)
 
 	// WantStream indicates if we are interested in a stream
+	// it is checked when the cursor of a requested stream is received and before every batch
 	WantStream(*Peer, ID) bool
 
 	// StreamName returns the Name of the Stream (see ID)
@@ -70,6 +88,7 @@ type StreamProvider interface {
 	EncodeKey(interface{}) (string, error)
 
 	// Autostart indicates if the stream should autostart
+	// streams which do not autostart are not synced after their cursor is received
 	Autostart() bool
 
 	// Boundedness indicates if the stream is bounded or not
@@ -79,6 +98,32 @@ type StreamProvider interface {
 	Close()
 }
 
+// BoundedStreamProvider is implemented by providers of bounded streams which need to know
+// when a stream is synced from a peer. Once a bounded stream is synced up to its cursor, the
+// Registry forgets the cursor so that the stream can be requested again, for example after
+// the upstream peer extended it, and only the new chunks are synced
+type BoundedStreamProvider interface {
+	StreamProvider
+
+	// StreamComplete is called when all the chunks of the stream up to cursor are synced from peer p
+	StreamComplete(p *Peer, stream ID, cursor uint64)
+}
+
+// SetReconciler is implemented by stream providers which can sync the history of a stream
+// by set reconciliation. Instead of the upstream peer offering all the hashes of the history
+// in batches, the downstream peer sends a digest of the chunks it already stores and
+// the upstream peer only offers the chunks missing from it
+type SetReconciler interface {
+
+	// DigestSize returns the number of cells of the digests sent to the upstream peer, bounding
+	// the number of differences that can be reconciled. Zero disables set reconciliation
+	DigestSize() int
+
+	// LocalSet calls f with the address of every chunk in the local storage which belongs to the
+	// stream with the given key on the upstream peer p, until f returns false
+	LocalSet(ctx context.Context, p *Peer, key interface{}, f func(chunk.Address) bool) error
+}
+
 // StreamInfoReq is a request to get information about particular streams
 type StreamInfoReq struct {
 	Streams []ID
@@ -106,6 +151,20 @@ type GetRange struct {
 	BatchSize uint
 }
 
+// ReconcileRange is a message sent from the downstream peer to the upstream peer asking for the chunks
+// of a stream up to To that are missing from the set summarised by Digest, an iblt.Table of all the chunks of
+// the stream stored by the downstream peer. The upstream peer responds with an OfferedHashes message of the
+// missing chunks with LastIndex set to To. If the difference can not be decoded from the digest the upstream
+// peer falls back to offering the hashes from From as in response to a GetRange message
+type ReconcileRange struct {
+	Ruid      uint
+	Stream    ID
+	From      uint64
+	To        uint64
+	BatchSize uint
+	Digest    []byte
+}
+
 // OfferedHashes is a message sent from the upstream peer to the downstream peer allowing the latter
 // to selectively ask for chunks within a particular requested interval
 type OfferedHashes struct {
@@ -0,0 +1,74 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+var errNoUnderlay = errors.New("no valid underlay address")
+
+var (
+	ipv6Once sync.Once
+	ipv6     bool
+)
+
+// hasIPv6 returns true if the host has a global IPv6 address to dial IPv6 underlay addresses from
+// it is replaced in tests
+var hasIPv6 = func() bool {
+	ipv6Once.Do(func() {
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.To4() == nil && n.IP.IsGlobalUnicast() {
+				ipv6 = true
+				return
+			}
+		}
+	})
+	return ipv6
+}
+
+// dialableUnderlays returns the underlay addresses of the peer in order of preference
+// leaving out the invalid ones and the ones with an IP family the host can not dial
+// if the host can not dial any of the addresses of the peer, all the valid ones are returned
+func dialableUnderlays(a *BzzAddr) ([]*enode.Node, error) {
+	var valid, dialable []*enode.Node
+	for _, u := range a.Underlays() {
+		n, err := enode.ParseV4(string(u))
+		if err != nil {
+			continue
+		}
+		valid = append(valid, n)
+		if ip := n.IP(); ip == nil || ip.To4() != nil || ip.IsLoopback() || hasIPv6() {
+			dialable = append(dialable, n)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, errNoUnderlay
+	}
+	if len(dialable) == 0 {
+		return valid, nil
+	}
+	return dialable, nil
+}
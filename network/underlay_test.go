@@ -0,0 +1,139 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+// newDualStackAddr returns an address with an IPv4 underlay, an invalid one and an IPv6 one
+func newDualStackAddr(t *testing.T) *BzzAddr {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip6, err := NewUnderlay(&key.PublicKey, "[2001:db8::1]:30399")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip4, err := NewUnderlay(&key.PublicKey, "1.2.3.4:30399")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewBzzAddr(make([]byte, 32), ip4).WithAltUnderlays([]byte("invalid"), ip6)
+}
+
+// TestDialableUnderlays tests that the underlay addresses are dialed in order of preference
+// and that IPv6 addresses are only dialed if the host has IPv6 connectivity
+func TestDialableUnderlays(t *testing.T) {
+	defer func(f func() bool) { hasIPv6 = f }(hasIPv6)
+	addr := newDualStackAddr(t)
+
+	hasIPv6 = func() bool { return true }
+	nodes, err := dialableUnderlays(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || !nodes[0].IP().Equal(net.ParseIP("1.2.3.4")) || !nodes[1].IP().Equal(net.ParseIP("2001:db8::1")) {
+		t.Fatalf("unexpected underlays %v", nodes)
+	}
+
+	hasIPv6 = func() bool { return false }
+	nodes, err = dialableUnderlays(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || !nodes[0].IP().Equal(net.ParseIP("1.2.3.4")) {
+		t.Fatalf("unexpected underlays %v", nodes)
+	}
+
+	// an IPv6 only peer is still dialed
+	nodes, err = dialableUnderlays(NewBzzAddr(addr.OAddr, addr.AltUAddrs[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 {
+		t.Fatalf("expected 1 underlay, got %v", nodes)
+	}
+
+	if _, err := dialableUnderlays(NewBzzAddr(addr.OAddr, []byte("invalid"))); err != errNoUnderlay {
+		t.Fatalf("expected error %v, got %v", errNoUnderlay, err)
+	}
+}
+
+// TestHiveNextUnderlay tests that the hive rotates through the underlay addresses
+// of a peer it can not connect to and forgets the attempts when the peer is removed
+func TestHiveNextUnderlay(t *testing.T) {
+	defer func(f func() bool) { hasIPv6 = f }(hasIPv6)
+	hasIPv6 = func() bool { return true }
+	addr := newDualStackAddr(t)
+	h := NewHive(NewHiveParams(), NewKademlia(make([]byte, 32), NewKadParams()), nil)
+
+	for i, exp := range []string{"1.2.3.4", "2001:db8::1", "1.2.3.4"} {
+		n, err := h.nextUnderlay(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !n.IP().Equal(net.ParseIP(exp)) {
+			t.Fatalf("dial %d: expected %s, got %s", i, exp, n.IP())
+		}
+	}
+
+	// dial attempts are forgotten once the peer is removed from the address book
+	h.Removed(addr)
+	if _, ok := h.dialAttempts[string(addr.Address())]; ok {
+		t.Fatal("expected dial attempts to be removed")
+	}
+}
+
+// TestENRAltUnderlays tests that a node record with an IPv4 and an IPv6 address
+// gives an IPv6 alternative underlay address
+func TestENRAltUnderlays(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r enr.Record
+	r.Set(NewENRAddrEntry(make([]byte, 32)))
+	r.Set(enr.IPv4(net.ParseIP("1.2.3.4")))
+	r.Set(enr.IPv6(net.ParseIP("2001:db8::1")))
+	r.Set(enr.TCP(30399))
+	if err := enode.SignV4(&r, key); err != nil {
+		t.Fatal(err)
+	}
+	nod, err := enode.New(enode.V4ID{}, &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := getENRBzzAddr(nod)
+	if len(addr.AltUAddrs) != 1 {
+		t.Fatalf("expected 1 alternative underlay, got %d", len(addr.AltUAddrs))
+	}
+	alt, err := enode.ParseV4(string(addr.AltUAddrs[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !alt.IP().Equal(net.ParseIP("2001:db8::1")) || alt.TCP() != 30399 || alt.ID() != nod.ID() {
+		t.Fatalf("unexpected alternative underlay %s", addr.AltUAddrs[0])
+	}
+}
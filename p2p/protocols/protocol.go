@@ -23,6 +23,8 @@ devp2p subprotocols by abstracting away code standardly shared by protocols.
 * provide the forever loop to read incoming messages
 * standardise error handling related to communication
 * standardised	handshake negotiation
+* advertise several versions of a protocol with per version message codes, so that
+  peers run the highest version both support
 * TODO: automatic generation of wire protocol specification for peers
 
 */
@@ -82,13 +84,27 @@ type Spec struct {
 	// each message must have a single unique data type
 	Messages []interface{}
 
+	// OldVersions are the message lists of the older versions of the protocol
+	// which are still supported, keyed by version number
+	// all the supported versions are advertised, and the version run with a peer
+	// is the highest one supported by both nodes, so that nodes which have not
+	// upgraded yet can still connect during a rollout (see Protocols)
+	OldVersions map[uint][]interface{}
+
 	//hook for accounting (could be extended to multiple hooks in the future)
 	Hook Hook
 
+	// Priority is the quality of service class of the protocol messages
+	// when the peer has a RateLimiter, protocols with PriorityNone are not rate limited
+	Priority Priority
+
 	initOnce sync.Once
 	codes    map[reflect.Type]uint64
 	types    map[uint64]reflect.Type
 
+	versionsOnce sync.Once
+	versions     []*Spec // specs of all the supported versions in ascending order
+
 	// if the protocol does not allow extending the p2p msg to propagate context
 	// even if context not disabled, context will propagate only tracing is enabled
 	DisableContext bool
@@ -149,6 +165,7 @@ type Peer struct {
 	running         bool         // if running is true async go routines are dispatched in the event loop
 	mtx             sync.RWMutex // guards running
 	handleMsgPauser MsgPauser    //  message pauser, should be used only in tests
+	limiter         *RateLimiter // limits the bandwidth of sent messages, nil if not rate limited
 }
 
 // NewPeer constructs a new peer
@@ -171,6 +188,17 @@ func NewPeer(peer *p2p.Peer, rw p2p.MsgReadWriter, spec *Spec) *Peer {
 	}
 }
 
+// Version returns the version of the protocol run with the peer
+func (p *Peer) Version() uint {
+	return p.spec.Version
+}
+
+// SetRateLimiter sets the rate limiter messages sent to the peer wait on
+// it must be set before the protocol is run
+func (p *Peer) SetRateLimiter(l *RateLimiter) {
+	p.limiter = l
+}
+
 // Run starts the forever loop that handles incoming messages.
 // The handler argument is a function which is called for each message received
 // from the remote peer, a returned error causes the loop to exit
@@ -304,6 +332,13 @@ func (p *Peer) Send(ctx context.Context, msg interface{}) error {
 		size = len(r)
 	}
 
+	// wait for the bandwidth to send the message
+	if p.limiter != nil {
+		if err := p.limiter.Wait(ctx, p.ID(), p.spec.Name, p.spec.Priority, size); err != nil {
+			return err
+		}
+	}
+
 	// if the accounting hook is set, do accounting logic
 	if p.spec.Hook != nil {
 		// validate that this operation would succeed...
@@ -413,6 +448,7 @@ func (p *Peer) handleMsg(msg p2p.Msg, handle func(ctx context.Context, msg inter
 // * expects a remote handshake back of the same type
 // * the dialing peer needs to send the handshake first and then waits for remote
 // * the listening peer waits for the remote handshake and then sends it
+//   only if it passed verify
 // returns the remote handshake and an error
 func (p *Peer) Handshake(ctx context.Context, hs interface{}, verify func(interface{}) error) (interface{}, error) {
 	if _, ok := p.spec.GetCode(hs); !ok {
@@ -423,20 +459,24 @@ func (p *Peer) Handshake(ctx context.Context, hs interface{}, verify func(interf
 	errc := make(chan error, 2)
 
 	send := func() { errc <- p.Send(ctx, hs) }
-	receive := func() {
-		errc <- p.receive(func(ctx context.Context, msg interface{}) error {
+	receive := func() error {
+		err := p.receive(func(ctx context.Context, msg interface{}) error {
 			rhs = msg
 			if verify != nil {
 				return verify(rhs)
 			}
 			return nil
 		})
+		errc <- err
+		return err
 	}
 
 	go func() {
+		// the inbound side only sends its handshake once the remote one is verified
 		if p.Inbound() {
-			receive()
-			send()
+			if receive() == nil {
+				send()
+			}
 		} else {
 			send()
 			receive()
@@ -0,0 +1,369 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package protocols
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// Priority is the quality of service class of a protocol
+// when the upload bandwidth is rate limited, messages of protocols with a higher
+// priority are sent before waiting messages of protocols with a lower priority
+type Priority uint8
+
+const (
+	PriorityNone   Priority = iota // not rate limited, for control protocols such as the hive
+	PriorityLow                    // bulk transfers such as pull syncing
+	PriorityMedium                 // push syncing and pss
+	PriorityHigh                   // interactive retrieval
+
+	numPriorities = int(PriorityHigh) + 1
+)
+
+// rateLimitPruneInterval is the interval in which idle peer and protocol buckets are removed
+var rateLimitPruneInterval = time.Minute
+
+// RateLimits are the upload bandwidth limits in bytes per second, 0 means no limit
+type RateLimits struct {
+	Total     uint64            // limit for the messages of all the rate limited protocols
+	Peer      uint64            // limit for the messages to each peer
+	Protocols map[string]uint64 // limits for the messages of each protocol by name
+}
+
+// NewRateLimits returns rate limits with no limits set
+func NewRateLimits() *RateLimits {
+	return &RateLimits{
+		Protocols: make(map[string]uint64),
+	}
+}
+
+// copy returns a deep copy of the limits
+func (r RateLimits) copy() RateLimits {
+	c := r
+	c.Protocols = make(map[string]uint64, len(r.Protocols))
+	for name, rate := range r.Protocols {
+		c.Protocols[name] = rate
+	}
+	return c
+}
+
+// bucket is a token bucket of bytes refilled at its rate up to a burst of one second
+type bucket struct {
+	rate    float64            // bytes per second, 0 means no limit
+	tokens  float64            // bytes which can be sent, negative after sending a message larger than the burst
+	last    time.Time          // time of the last refill
+	waiting [numPriorities]int // number of messages waiting for each priority
+}
+
+func newBucket(rate uint64, now time.Time) *bucket {
+	return &bucket{
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   now,
+	}
+}
+
+func (b *bucket) setRate(rate uint64) {
+	b.rate = float64(rate)
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if b.rate > 0 {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+}
+
+// delay returns the time to wait until a message of the given size can be sent
+// messages larger than the burst wait until the bucket is full
+func (b *bucket) delay(size float64) time.Duration {
+	if b.rate == 0 {
+		return 0
+	}
+	if size > b.rate {
+		size = b.rate
+	}
+	if b.tokens >= size {
+		return 0
+	}
+	return time.Duration((size - b.tokens) / b.rate * float64(time.Second))
+}
+
+// preempted returns true if messages with a higher priority are waiting on the bucket
+func (b *bucket) preempted(priority Priority) bool {
+	if b.rate == 0 {
+		return false
+	}
+	for p := int(priority) + 1; p < numPriorities; p++ {
+		if b.waiting[p] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *bucket) take(size float64) {
+	if b.rate > 0 {
+		b.tokens -= size
+	}
+}
+
+// idle returns true if the bucket is in the same state as a new bucket
+func (b *bucket) idle() bool {
+	for _, n := range b.waiting {
+		if n > 0 {
+			return false
+		}
+	}
+	return b.rate == 0 || b.tokens >= b.rate
+}
+
+// RateLimiter limits the upload bandwidth of protocol messages
+// with a token bucket for all the messages, one for each protocol and one for each peer.
+// A message is sent when all three buckets have enough tokens and no messages of a
+// protocol with a higher priority are waiting on them, so that bulk transfers such as
+// syncing can not starve interactive retrievals sharing the same connections.
+// A single rate limiter is shared by all the protocols of a node.
+type RateLimiter struct {
+	mu        sync.Mutex
+	limits    RateLimits
+	total     *bucket
+	protocols map[string]*bucket
+	peers     map[enode.ID]*bucket
+	changed   chan struct{} // closed when tokens are taken, waiting messages give up or the limits change
+	pruned    time.Time
+}
+
+// NewRateLimiter creates a rate limiter with the given limits
+// if limits is nil, there are no limits until they are set with SetLimits
+func NewRateLimiter(limits *RateLimits) *RateLimiter {
+	if limits == nil {
+		limits = NewRateLimits()
+	}
+	now := time.Now()
+	return &RateLimiter{
+		limits:    limits.copy(),
+		total:     newBucket(limits.Total, now),
+		protocols: make(map[string]*bucket),
+		peers:     make(map[enode.ID]*bucket),
+		changed:   make(chan struct{}),
+		pruned:    now,
+	}
+}
+
+// Limits returns the current limits
+func (l *RateLimiter) Limits() RateLimits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limits.copy()
+}
+
+// SetLimits replaces the limits, the new limits also apply to the messages already waiting
+func (l *RateLimiter) SetLimits(limits RateLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limits = limits.copy()
+	l.total.setRate(limits.Total)
+	for name, b := range l.protocols {
+		b.setRate(limits.Protocols[name])
+	}
+	for _, b := range l.peers {
+		b.setRate(limits.Peer)
+	}
+	l.notify()
+}
+
+// SetTotalLimit sets the limit for the messages of all the rate limited protocols, 0 removes the limit
+func (l *RateLimiter) SetTotalLimit(rate uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limits.Total = rate
+	l.total.setRate(rate)
+	l.notify()
+}
+
+// SetPeerLimit sets the limit for the messages to each peer, 0 removes the limit
+func (l *RateLimiter) SetPeerLimit(rate uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limits.Peer = rate
+	for _, b := range l.peers {
+		b.setRate(rate)
+	}
+	l.notify()
+}
+
+// SetProtocolLimit sets the limit for the messages of the protocol with the given name, 0 removes the limit
+func (l *RateLimiter) SetProtocolLimit(name string, rate uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if rate == 0 {
+		delete(l.limits.Protocols, name)
+	} else {
+		l.limits.Protocols[name] = rate
+	}
+	if b, ok := l.protocols[name]; ok {
+		b.setRate(rate)
+	}
+	l.notify()
+}
+
+// Wait blocks until a message of the given size and protocol can be sent to the peer
+// or the context is done, in which case the context error is returned
+// messages of protocols with PriorityNone are never rate limited
+func (l *RateLimiter) Wait(ctx context.Context, peer enode.ID, protocol string, priority Priority, size int) error {
+	if priority == PriorityNone {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.limited() {
+		return nil
+	}
+	start := time.Now()
+	l.prune(start)
+	buckets := []*bucket{l.total, l.protocolBucket(protocol, start), l.peerBucket(peer, start)}
+	for _, b := range buckets {
+		b.waiting[priority]++
+	}
+	defer func() {
+		for _, b := range buckets {
+			b.waiting[priority]--
+		}
+		l.notify()
+		metrics.GetOrRegisterResettingTimer("peer/ratelimit/wait_t", nil).UpdateSince(start)
+	}()
+
+	n := float64(size)
+	for {
+		now := time.Now()
+		var wait time.Duration
+		preempted := false
+		for _, b := range buckets {
+			b.refill(now)
+			if b.preempted(priority) {
+				preempted = true
+			}
+			if d := b.delay(n); d > wait {
+				wait = d
+			}
+		}
+		if !preempted && wait == 0 {
+			for _, b := range buckets {
+				b.take(n)
+			}
+			return nil
+		}
+
+		// wait for the tokens or for the messages with higher priority to be sent
+		changed := l.changed
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		l.mu.Unlock()
+		var err error
+		select {
+		case <-timeout:
+		case <-changed:
+		case <-ctx.Done():
+			metrics.GetOrRegisterCounter("peer/ratelimit/cancelled", nil).Inc(1)
+			err = ctx.Err()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		l.mu.Lock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// limited returns true if any limit is set
+func (l *RateLimiter) limited() bool {
+	if l.limits.Total > 0 || l.limits.Peer > 0 {
+		return true
+	}
+	for _, rate := range l.limits.Protocols {
+		if rate > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *RateLimiter) protocolBucket(name string, now time.Time) *bucket {
+	b, ok := l.protocols[name]
+	if !ok {
+		b = newBucket(l.limits.Protocols[name], now)
+		l.protocols[name] = b
+	}
+	return b
+}
+
+func (l *RateLimiter) peerBucket(id enode.ID, now time.Time) *bucket {
+	b, ok := l.peers[id]
+	if !ok {
+		b = newBucket(l.limits.Peer, now)
+		l.peers[id] = b
+	}
+	return b
+}
+
+// prune removes the idle peer and protocol buckets, as they would be recreated in the same state
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < rateLimitPruneInterval {
+		return
+	}
+	l.pruned = now
+	for name, b := range l.protocols {
+		if b.refill(now); b.idle() {
+			delete(l.protocols, name)
+		}
+	}
+	for id, b := range l.peers {
+		if b.refill(now); b.idle() {
+			delete(l.peers, id)
+		}
+	}
+}
+
+// notify wakes up all the waiting messages
+func (l *RateLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
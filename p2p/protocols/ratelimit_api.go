@@ -0,0 +1,55 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package protocols
+
+// Textual version number of rate limit API
+const RateLimitVersion = "1.0"
+
+// RateLimitApi provides an API to inspect and adjust the bandwidth limits
+type RateLimitApi struct {
+	limiter *RateLimiter
+}
+
+// NewRateLimitApi creates a new RateLimitApi
+func NewRateLimitApi(l *RateLimiter) *RateLimitApi {
+	return &RateLimitApi{l}
+}
+
+// Limits returns the current limits in bytes per second
+func (a *RateLimitApi) Limits() RateLimits {
+	return a.limiter.Limits()
+}
+
+// SetLimits replaces all the limits
+func (a *RateLimitApi) SetLimits(limits RateLimits) {
+	a.limiter.SetLimits(limits)
+}
+
+// SetTotal sets the limit for the messages of all protocols, 0 removes the limit
+func (a *RateLimitApi) SetTotal(rate uint64) {
+	a.limiter.SetTotalLimit(rate)
+}
+
+// SetPeer sets the limit for the messages to each peer, 0 removes the limit
+func (a *RateLimitApi) SetPeer(rate uint64) {
+	a.limiter.SetPeerLimit(rate)
+}
+
+// SetProtocol sets the limit for the messages of the protocol with the given name, 0 removes the limit
+func (a *RateLimitApi) SetProtocol(name string, rate uint64) {
+	a.limiter.SetProtocolLimit(name, rate)
+}
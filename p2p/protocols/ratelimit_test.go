@@ -0,0 +1,199 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package protocols
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// TestRateLimiterThroughput tests that the total, protocol and peer limits
+// limit the bandwidth after the burst of one second
+func TestRateLimiterThroughput(t *testing.T) {
+	peer := enode.ID{1}
+	for _, tc := range []struct {
+		name   string
+		limits RateLimits
+	}{
+		{"total", RateLimits{Total: 50000}},
+		{"peer", RateLimits{Peer: 50000}},
+		{"protocol", RateLimits{Protocols: map[string]uint64{"test": 50000}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewRateLimiter(&tc.limits)
+			start := time.Now()
+			// the burst of 50000 bytes is sent immediately, the rest takes a second
+			for i := 0; i < 10; i++ {
+				if err := l.Wait(context.Background(), peer, "test", PriorityLow, 10000); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if elapsed := time.Since(start); elapsed < 900*time.Millisecond || elapsed > 2*time.Second {
+				t.Fatalf("expected sending to take about a second, took %v", elapsed)
+			}
+		})
+	}
+}
+
+// TestRateLimiterUnlimited tests that messages are not delayed without limits,
+// for protocols without priority and for other protocols and peers than the limited ones
+func TestRateLimiterUnlimited(t *testing.T) {
+	l := NewRateLimiter(nil)
+	limited := NewRateLimiter(&RateLimits{Protocols: map[string]uint64{"limited": 1000}})
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := l.Wait(context.Background(), enode.ID{1}, "test", PriorityLow, 10000); err != nil {
+			t.Fatal(err)
+		}
+		if err := limited.Wait(context.Background(), enode.ID{1}, "test", PriorityLow, 10000); err != nil {
+			t.Fatal(err)
+		}
+		if err := limited.Wait(context.Background(), enode.ID{1}, "limited", PriorityNone, 10000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("expected no delay, took %v", elapsed)
+	}
+}
+
+// TestRateLimiterPriority tests that waiting messages with a higher priority
+// are sent before the messages with a lower priority waiting longer
+func TestRateLimiterPriority(t *testing.T) {
+	l := NewRateLimiter(&RateLimits{Total: 1000000})
+	ctx := context.Background()
+	// empty the bucket
+	if err := l.Wait(ctx, enode.ID{1}, "sync", PriorityLow, 1000000); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var order []Priority
+	var wg sync.WaitGroup
+	send := func(priority Priority, peer enode.ID) {
+		defer wg.Done()
+		if err := l.Wait(ctx, peer, "test", priority, 100000); err != nil {
+			t.Error(err)
+			return
+		}
+		mu.Lock()
+		order = append(order, priority)
+		mu.Unlock()
+	}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go send(PriorityLow, enode.ID{1})
+	}
+	time.Sleep(20 * time.Millisecond)
+	wg.Add(2)
+	go send(PriorityMedium, enode.ID{2})
+	go send(PriorityHigh, enode.ID{3})
+	wg.Wait()
+
+	expected := []Priority{PriorityHigh, PriorityMedium, PriorityLow, PriorityLow, PriorityLow}
+	if len(order) != len(expected) {
+		t.Fatalf("expected %d messages sent, got %d", len(expected), len(order))
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("expected messages sent in order %v, got %v", expected, order)
+		}
+	}
+}
+
+// TestRateLimiterCancel tests that waiting stops when the context is done
+// and that a cancelled message does not block messages with a lower priority
+func TestRateLimiterCancel(t *testing.T) {
+	l := NewRateLimiter(&RateLimits{Total: 10000})
+	if err := l.Wait(context.Background(), enode.ID{1}, "test", PriorityLow, 10000); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, enode.ID{1}, "test", PriorityHigh, 10000); err != context.DeadlineExceeded {
+		t.Fatalf("expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+	if l.total.waiting[PriorityHigh] != 0 {
+		t.Fatalf("expected no waiting messages, got %d", l.total.waiting[PriorityHigh])
+	}
+}
+
+// TestRateLimiterSetLimits tests that changing the limits applies to the waiting messages
+func TestRateLimiterSetLimits(t *testing.T) {
+	l := NewRateLimiter(&RateLimits{Peer: 1000})
+	if err := l.Wait(context.Background(), enode.ID{1}, "test", PriorityLow, 1000); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- l.Wait(context.Background(), enode.ID{1}, "test", PriorityLow, 1000)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	api := NewRateLimitApi(l)
+	api.SetProtocol("test", 5000)
+	api.SetPeer(0)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("waiting message not sent after removing the limit")
+	}
+
+	limits := api.Limits()
+	if limits.Peer != 0 || limits.Total != 0 || limits.Protocols["test"] != 5000 {
+		t.Fatalf("unexpected limits %+v", limits)
+	}
+	api.SetProtocol("test", 0)
+	if _, ok := api.Limits().Protocols["test"]; ok {
+		t.Fatal("expected protocol limit removed")
+	}
+}
+
+// TestRateLimiterConcurrentSetters tests that concurrent changes of different limits do not overwrite each other
+func TestRateLimiterConcurrentSetters(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		l := NewRateLimiter(nil)
+		api := NewRateLimitApi(l)
+		var wg sync.WaitGroup
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			api.SetTotal(1000)
+		}()
+		go func() {
+			defer wg.Done()
+			api.SetPeer(2000)
+		}()
+		go func() {
+			defer wg.Done()
+			api.SetProtocol("pss", 3000)
+		}()
+		wg.Wait()
+		limits := api.Limits()
+		if limits.Total != 1000 || limits.Peer != 2000 || limits.Protocols["pss"] != 3000 {
+			t.Fatalf("unexpected limits %+v", limits)
+		}
+	}
+}
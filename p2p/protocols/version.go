@@ -0,0 +1,80 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package protocols
+
+import (
+	"sort"
+
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+// Versions returns the specs of all the supported versions of the protocol in ascending
+// order of version, the last one is the spec itself
+// the specs of the old versions share all the settings of the spec except the
+// version and the messages
+func (s *Spec) Versions() []*Spec {
+	s.versionsOnce.Do(func() {
+		for v, messages := range s.OldVersions {
+			if v >= s.Version {
+				continue
+			}
+			s.versions = append(s.versions, &Spec{
+				Name:           s.Name,
+				Version:        v,
+				MaxMsgSize:     s.MaxMsgSize,
+				Messages:       messages,
+				Hook:           s.Hook,
+				Priority:       s.Priority,
+				DisableContext: s.DisableContext,
+			})
+		}
+		sort.Slice(s.versions, func(i, j int) bool {
+			return s.versions[i].Version < s.versions[j].Version
+		})
+		s.versions = append(s.versions, s)
+	})
+	return s.versions
+}
+
+// ForVersion returns the spec of the given version of the protocol
+// and false if the version is not supported
+func (s *Spec) ForVersion(version uint) (*Spec, bool) {
+	for _, v := range s.Versions() {
+		if v.Version == version {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// Protocols returns a p2p protocol for each supported version of the protocol
+// the run function is called with the spec of the version to construct its run function
+// devp2p matches the protocols advertised by the two nodes and runs only
+// the highest version of the protocol they both support, with the message codes
+// of that version, so the handlers can find out the version with Peer.Version
+func (s *Spec) Protocols(run func(*Spec) func(*p2p.Peer, p2p.MsgReadWriter) error) []p2p.Protocol {
+	var protocols []p2p.Protocol
+	for _, v := range s.Versions() {
+		protocols = append(protocols, p2p.Protocol{
+			Name:    v.Name,
+			Version: v.Version,
+			Length:  v.Length(),
+			Run:     run(v),
+		})
+	}
+	return protocols
+}
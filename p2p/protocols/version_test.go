@@ -0,0 +1,161 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package protocols
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+type versionPing struct{ N uint }
+type versionNew struct{}
+type versionPong struct{ N uint }
+
+// newVersionedSpec returns a spec of version 3 which still supports version 1,
+// where versionNew was added in version 2 shifting the code of versionPong
+func newVersionedSpec() *Spec {
+	return &Spec{
+		Name:       "versioned",
+		Version:    3,
+		MaxMsgSize: 1024,
+		Messages:   []interface{}{versionPing{}, versionNew{}, versionPong{}},
+		OldVersions: map[uint][]interface{}{
+			1: {versionPing{}, versionPong{}},
+		},
+	}
+}
+
+// TestSpecVersions tests the specs of the supported versions
+func TestSpecVersions(t *testing.T) {
+	spec := newVersionedSpec()
+	spec.OldVersions[4] = []interface{}{versionPing{}}
+	versions := spec.Versions()
+	if len(versions) != 2 || versions[0].Version != 1 || versions[1] != spec {
+		t.Fatalf("unexpected versions %v", versions)
+	}
+	v1, ok := spec.ForVersion(1)
+	if !ok {
+		t.Fatal("expected version 1 supported")
+	}
+	if code, _ := v1.GetCode(&versionPong{}); code != 1 {
+		t.Fatalf("expected code 1 in version 1, got %d", code)
+	}
+	if _, ok := v1.GetCode(&versionNew{}); ok {
+		t.Fatal("expected versionNew not to be part of version 1")
+	}
+	if code, _ := spec.GetCode(&versionPong{}); code != 2 {
+		t.Fatalf("expected code 2 in version 3, got %d", code)
+	}
+	if _, ok := spec.ForVersion(2); ok {
+		t.Fatal("expected version 2 not supported")
+	}
+	protocols := spec.Protocols(func(*Spec) func(*p2p.Peer, p2p.MsgReadWriter) error { return nil })
+	if len(protocols) != 2 || protocols[0].Version != 1 || protocols[0].Length != 2 || protocols[1].Version != 3 || protocols[1].Length != 3 {
+		t.Fatalf("unexpected protocols %v", protocols)
+	}
+}
+
+// TestVersionNegotiation tests that a node supporting old versions of a protocol
+// runs the highest version supported by the peer, with the message codes of that version
+func TestVersionNegotiation(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		remote  *Spec
+		version uint
+	}{
+		{"old", &Spec{Name: "versioned", Version: 1, MaxMsgSize: 1024, Messages: []interface{}{versionPing{}, versionPong{}}}, 1},
+		{"new", newVersionedSpec(), 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			localVersion := make(chan uint, 1)
+			pongs := make(chan uint, 1)
+			local := newVersionServer(t, newVersionedSpec(), func(p *Peer) error {
+				localVersion <- p.Version()
+				if err := p.Send(context.Background(), &versionPing{N: 42}); err != nil {
+					return err
+				}
+				return p.Run(func(ctx context.Context, msg interface{}) error {
+					if pong, ok := msg.(*versionPong); ok {
+						pongs <- pong.N
+					}
+					return nil
+				})
+			})
+			defer local.Stop()
+			remoteVersion := make(chan uint, 1)
+			remote := newVersionServer(t, tc.remote, func(p *Peer) error {
+				remoteVersion <- p.Version()
+				return p.Run(func(ctx context.Context, msg interface{}) error {
+					if ping, ok := msg.(*versionPing); ok {
+						return p.Send(ctx, &versionPong{N: ping.N})
+					}
+					return nil
+				})
+			})
+			defer remote.Stop()
+
+			local.AddPeer(remote.Self())
+			for _, c := range []chan uint{localVersion, remoteVersion} {
+				select {
+				case v := <-c:
+					if v != tc.version {
+						t.Fatalf("expected version %d, got %d", tc.version, v)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("timeout waiting for the protocol to run")
+				}
+			}
+			select {
+			case n := <-pongs:
+				if n != 42 {
+					t.Fatalf("expected pong 42, got %d", n)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout waiting for pong")
+			}
+		})
+	}
+}
+
+func newVersionServer(t *testing.T, spec *Spec, run func(*Peer) error) *p2p.Server {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &p2p.Server{
+		Config: p2p.Config{
+			PrivateKey:  key,
+			MaxPeers:    1,
+			NoDiscovery: true,
+			ListenAddr:  "127.0.0.1:0",
+			Protocols: spec.Protocols(func(s *Spec) func(*p2p.Peer, p2p.MsgReadWriter) error {
+				return func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+					return run(NewPeer(p, rw, s))
+				}
+			}),
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
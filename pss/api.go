@@ -187,6 +187,81 @@ func (pssapi *API) GetPeerAddress(pubkeyhex string, topic message.Topic) (PssAdd
 	return pssapi.Pss.getPeerAddress(pubkeyhex, topic)
 }
 
+// GetDifficulty returns the minimum proof of work difficulty of the messages on the topic forwarded by the node
+func (pssapi *API) GetDifficulty(topic message.Topic) int {
+	return pssapi.Pss.Difficulty(topic)
+}
+
+// GetTopicPolicies returns the policies of the topics by topic
+func (pssapi *API) GetTopicPolicies() map[string]TopicPolicy {
+	policies := make(map[string]TopicPolicy)
+	for topic, policy := range pssapi.Pss.TopicPolicies() {
+		policies[topic.String()] = policy
+	}
+	return policies
+}
+
+// GetTopicStats returns the message counters of the topics with a policy by topic
+func (pssapi *API) GetTopicStats() map[string]TopicStats {
+	stats := make(map[string]TopicStats)
+	for topic, s := range pssapi.Pss.TopicStats() {
+		stats[topic.String()] = s
+	}
+	return stats
+}
+
+// Trace sends a trace probe to the address and returns the route of the probe and of the reply of its recipient
+func (pssapi *API) Trace(ctx context.Context, addr hexutil.Bytes) (*Trace, error) {
+	return pssapi.Pss.Trace(ctx, PssAddress(addr))
+}
+
+// AdminAPI sets the difficulties and the policies of the messages forwarded by the node,
+// it is served on the non-public pssadmin namespace
+type AdminAPI struct {
+	pss *Pss
+}
+
+// NewAdminAPI creates a new AdminAPI
+func NewAdminAPI(ps *Pss) *AdminAPI {
+	return &AdminAPI{pss: ps}
+}
+
+// SetDifficulty sets the minimum proof of work difficulty of the messages forwarded by the node
+func (api *AdminAPI) SetDifficulty(difficulty int) error {
+	return api.pss.SetDifficulty(difficulty)
+}
+
+// SetTopicDifficulty sets the minimum proof of work difficulty of the messages on the topic forwarded by the node
+func (api *AdminAPI) SetTopicDifficulty(topic message.Topic, difficulty int) error {
+	return api.pss.SetTopicDifficulty(topic, difficulty)
+}
+
+// RemoveTopicDifficulty removes the minimum proof of work difficulty of the topic
+func (api *AdminAPI) RemoveTopicDifficulty(topic message.Topic) {
+	api.pss.RemoveTopicDifficulty(topic)
+}
+
+// SetTopicPolicy sets the policy of the node for the messages on the topic
+func (api *AdminAPI) SetTopicPolicy(topic message.Topic, policy TopicPolicy) error {
+	return api.pss.SetTopicPolicy(topic, policy)
+}
+
+// RemoveTopicPolicy removes the policy of the topic
+func (api *AdminAPI) RemoveTopicPolicy(topic message.Topic) {
+	api.pss.RemoveTopicPolicy(topic)
+}
+
+// SetDefaultPolicy sets the policy of the topics without one, null forwards and delivers all their messages
+// the internal topics are not subject to the default policy
+func (api *AdminAPI) SetDefaultPolicy(policy *TopicPolicy) error {
+	return api.pss.SetDefaultPolicy(policy)
+}
+
+// SetPeerRate sets the maximum number of messages per second received from a peer
+func (api *AdminAPI) SetPeerRate(rate float64, burst int) error {
+	return api.pss.SetPeerRate(rate, burst)
+}
+
 func validateMsg(msg []byte) error {
 	if len(msg) == 0 {
 		return errors.New("invalid message length")
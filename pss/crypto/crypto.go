@@ -93,6 +93,7 @@ type KeyStore interface {
 	GetSymmetricKey(id string) ([]byte, error)
 	GenerateSymmetricKey() (string, error)
 	AddSymmetricKey(bytes []byte) (string, error)
+	DeleteSymmetricKey(id string) bool
 
 	// Key serialization
 	SerializePublicKey(pub *ecdsa.PublicKey) []byte
@@ -408,6 +409,18 @@ func (crypto *defaultCryptoBackend) AddSymmetricKey(key []byte) (string, error)
 	return id, nil
 }
 
+// DeleteSymmetricKey removes the symmetric key with the id from the store
+// and returns false if there was no such key
+func (crypto *defaultCryptoBackend) DeleteSymmetricKey(id string) bool {
+	crypto.keyMu.Lock()
+	defer crypto.keyMu.Unlock()
+	if crypto.symKeys[id] == nil {
+		return false
+	}
+	delete(crypto.symKeys, id)
+	return true
+}
+
 // === Key conversion ===
 
 // FromECDSA exports a public key into a binary dump.
@@ -236,6 +236,47 @@ func TestForwardBasic(t *testing.T) {
 	}
 }
 
+// TestForwardLightNode tests that messages are only forwarded to light nodes
+// if they can be the recipient, as light nodes do not forward messages
+func TestForwardLightNode(t *testing.T) {
+	base := pot.RandomAddress()
+	light := pot.RandomAddressAt(base, 5)
+	full := pot.RandomAddressAt(base, 3)
+	peerAddresses := []pot.Address{light, full}
+
+	kad := network.NewKademlia(base[:], network.NewKadParams())
+	ps := createPss(t, kad)
+	defer ps.Stop()
+	lp := newTestDiscoveryPeer(light, kad)
+	lp.Capabilities = network.NewLightNodeCapabilities()
+	kad.On(lp)
+	addPeers(kad, []pot.Address{full})
+
+	closeToLight := pot.RandomAddressAt(light, 10)
+	for _, c := range []testCase{
+		{
+			name:      "Send close to light node",
+			recipient: closeToLight[:],
+			peers:     peerAddresses,
+			expected:  []int{1},
+		},
+		{
+			name:      "Send direct to light node",
+			recipient: light[:],
+			peers:     peerAddresses,
+			expected:  []int{0},
+		},
+		{
+			name:      "Send to light node neighbourhood",
+			recipient: light[:1],
+			peers:     peerAddresses,
+			expected:  []int{0, 1},
+		},
+	} {
+		testForwardMsg(t, ps, &c)
+	}
+}
+
 // this function tests the forwarding of a single message. the recipient address is passed as param,
 // along with addresses of all peers, and indices of those peers which are expected to receive the message.
 func testForwardMsg(t *testing.T, ps *Pss, c *testCase) {
@@ -0,0 +1,465 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+const (
+	groupIDSize      = 16
+	defaultMaxGroups = 256 // max number of groups a node creates or joins
+)
+
+var (
+	groupTopic = message.NewTopic([]byte("pss-group"))
+
+	errGroupNotFound = errors.New("group not found")
+	errGroupNotOwner = errors.New("not the owner of the group")
+	errGroupLimit    = errors.New("too many groups")
+	errGroupOwner    = errors.New("group owner not registered for the topic")
+)
+
+// groupMember is a member of a group in the membership updates
+type groupMember struct {
+	PubKey  []byte
+	Address []byte
+}
+
+// groupMsg is the membership update sent by the owner of a group to its members
+type groupMsg struct {
+	ID      []byte
+	Topic   message.Topic
+	Address []byte // address the messages are sent to, empty for fan-out to the members
+	Epoch   uint32 // incremented on every key rotation
+	Key     []byte
+	Members []groupMember
+	Removed bool // the recipient was removed from the group
+}
+
+// group is the state of a group on a member
+type group struct {
+	id      string
+	topic   message.Topic
+	address PssAddress
+	owner   string // public key of the owner, who manages the membership
+	epoch   uint32
+	keyID   string                // id of the current group key in the key store
+	prevKey string                // id of the previous group key, kept for the messages in flight until the next rotation
+	members map[string]PssAddress // addresses of the members by public key, including the owner
+}
+
+// GroupController manages groups of pss nodes sharing a symmetric key on a topic.
+//
+// The owner of a group, the node which created it, invites members by their public key
+// and removes them. The membership and the group key are sent to the members in
+// asymmetric messages, so that they are only accepted from the owner. Invites are only
+// accepted from owners registered for the topic of the group with SetPeerPublicKey,
+// and a node is in at most defaultMaxGroups groups.
+// Removing a member rotates the group key, the previous key is no longer used for sending
+// and is removed from the key store on the next rotation. The keys of a group are removed
+// once the node leaves it or is removed from it.
+//
+// The messages of a group are encrypted with the group key and dispatched to the
+// handlers of its topic with the id of the key. They are sent to every member (fan-out),
+// or once to the address of the group for groups whose members are in the same
+// neighbourhood, to be received with proximity handlers.
+type GroupController struct {
+	pss    *Pss
+	mu     sync.Mutex
+	groups map[string]*group
+
+	sendFunc func(to []byte, topic message.Topic, msg []byte, asymmetric bool, key []byte) error // sends a group message, Pss.send unless overridden in tests
+}
+
+// SetGroupController enables groups on the pss node
+//
+// Must be called before starting the pss node service
+func SetGroupController(p *Pss) *GroupController {
+	ctl := &GroupController{
+		pss:      p,
+		groups:   make(map[string]*group),
+		sendFunc: p.send,
+	}
+	p.Register(&groupTopic, NewHandler(ctl.handler))
+	p.addAPI(rpc.API{
+		Namespace: "pss",
+		Version:   "1.0",
+		Service:   NewGroupAPI(ctl),
+		Public:    true,
+	})
+	return ctl
+}
+
+func (ctl *GroupController) self() string {
+	return common.ToHex(ctl.pss.Crypto.SerializePublicKey(ctl.pss.PublicKey()))
+}
+
+// Create creates a group on the topic owned by the node and returns its id.
+// If address is set, the messages of the group are sent to it instead of every member
+func (ctl *GroupController) Create(topic message.Topic, address PssAddress) (string, error) {
+	if err := validateAddress(address); err != nil {
+		return "", err
+	}
+	id := make([]byte, groupIDSize)
+	if _, err := crand.Read(id); err != nil {
+		return "", err
+	}
+	keyID, err := ctl.generateKey(topic, address)
+	if err != nil {
+		return "", err
+	}
+	g := &group{
+		id:      hexutil.Encode(id),
+		topic:   topic,
+		address: address,
+		owner:   ctl.self(),
+		keyID:   keyID,
+		members: map[string]PssAddress{ctl.self(): ctl.pss.BaseAddr()},
+	}
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	if len(ctl.groups) >= defaultMaxGroups {
+		ctl.pss.RemoveSymmetricKey(keyID)
+		return "", errGroupLimit
+	}
+	ctl.groups[g.id] = g
+	metrics.GetOrRegisterCounter("pss/group/create", nil).Inc(1)
+	return g.id, nil
+}
+
+// Invite adds the peer with the given public key, registered for the topic of the group,
+// to the group and sends it the group key
+func (ctl *GroupController) Invite(id string, pubkeyid string) error {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	g, err := ctl.owned(id)
+	if err != nil {
+		return err
+	}
+	address, err := ctl.pss.getPeerAddress(pubkeyid, g.topic)
+	if err != nil {
+		return err
+	}
+	g.members[pubkeyid] = address
+	metrics.GetOrRegisterCounter("pss/group/invite", nil).Inc(1)
+	return ctl.update(g)
+}
+
+// Remove removes the member with the given public key from the group
+// and sends a new group key to the remaining members
+func (ctl *GroupController) Remove(id string, pubkeyid string) error {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	g, err := ctl.owned(id)
+	if err != nil {
+		return err
+	}
+	address, ok := g.members[pubkeyid]
+	if !ok || pubkeyid == g.owner {
+		return fmt.Errorf("%s is not a member of group %s", pubkeyid, id)
+	}
+	delete(g.members, pubkeyid)
+	keyID, err := ctl.generateKey(g.topic, g.address)
+	if err != nil {
+		return err
+	}
+	ctl.rotate(g, keyID)
+	g.epoch++
+	metrics.GetOrRegisterCounter("pss/group/remove", nil).Inc(1)
+	// the removed member is notified so that it drops the group
+	if err := ctl.sendUpdate(pubkeyid, address, &groupMsg{ID: common.FromHex(g.id), Epoch: g.epoch, Removed: true}); err != nil {
+		log.Warn("pss group removal notification failed", "group", id, "member", pubkeyid, "err", err)
+	}
+	return ctl.update(g)
+}
+
+// Leave drops the group and its keys, the owner of the group
+// notifies the members that they are removed
+func (ctl *GroupController) Leave(id string) error {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	g, ok := ctl.groups[id]
+	if !ok {
+		return errGroupNotFound
+	}
+	if g.owner == ctl.self() {
+		for pubkeyid, address := range g.members {
+			if pubkeyid == g.owner {
+				continue
+			}
+			if err := ctl.sendUpdate(pubkeyid, address, &groupMsg{ID: common.FromHex(g.id), Epoch: g.epoch + 1, Removed: true}); err != nil {
+				log.Warn("pss group removal notification failed", "group", id, "member", pubkeyid, "err", err)
+			}
+		}
+	}
+	ctl.drop(g)
+	metrics.GetOrRegisterCounter("pss/group/leave", nil).Inc(1)
+	return nil
+}
+
+// Send sends a message to the members of the group
+func (ctl *GroupController) Send(id string, msg []byte) error {
+	ctl.mu.Lock()
+	g, ok := ctl.groups[id]
+	if !ok {
+		ctl.mu.Unlock()
+		return errGroupNotFound
+	}
+	topic, address, keyID := g.topic, g.address, g.keyID
+	var to []PssAddress
+	for pubkeyid, addr := range g.members {
+		if pubkeyid != ctl.self() {
+			to = append(to, addr)
+		}
+	}
+	ctl.mu.Unlock()
+
+	key, err := ctl.pss.GetSymmetricKey(keyID)
+	if err != nil {
+		return err
+	}
+	metrics.GetOrRegisterCounter("pss/group/send", nil).Inc(1)
+	if len(address) > 0 {
+		return ctl.sendFunc(address, topic, msg, false, key)
+	}
+	for _, addr := range to {
+		if err := ctl.sendFunc(addr, topic, msg, false, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Members returns the public keys of the members of the group
+func (ctl *GroupController) Members(id string) ([]string, error) {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	g, ok := ctl.groups[id]
+	if !ok {
+		return nil, errGroupNotFound
+	}
+	var members []string
+	for pubkeyid := range g.members {
+		members = append(members, pubkeyid)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// owned returns the group with the given id if the node is its owner
+func (ctl *GroupController) owned(id string) (*group, error) {
+	g, ok := ctl.groups[id]
+	if !ok {
+		return nil, errGroupNotFound
+	}
+	if g.owner != ctl.self() {
+		return nil, errGroupNotOwner
+	}
+	return g, nil
+}
+
+// generateKey generates a group key, kept until the group is rotated
+func (ctl *GroupController) generateKey(topic message.Topic, address PssAddress) (string, error) {
+	keyID, err := ctl.pss.Crypto.GenerateSymmetricKey()
+	if err != nil {
+		return "", err
+	}
+	ctl.pss.addSymmetricKeyToPool(keyID, topic, address, true, true)
+	return keyID, nil
+}
+
+// rotate replaces the key of the group, the current key is kept as the previous key
+// until the next rotation and the previous key is removed
+func (ctl *GroupController) rotate(g *group, keyID string) {
+	if g.prevKey != "" {
+		ctl.pss.RemoveSymmetricKey(g.prevKey)
+	}
+	ctl.pss.unprotectSymmetricKey(g.keyID, g.topic)
+	g.prevKey = g.keyID
+	g.keyID = keyID
+}
+
+// drop deletes the group and removes its keys
+func (ctl *GroupController) drop(g *group) {
+	ctl.pss.RemoveSymmetricKey(g.keyID)
+	if g.prevKey != "" {
+		ctl.pss.RemoveSymmetricKey(g.prevKey)
+	}
+	delete(ctl.groups, g.id)
+}
+
+// update sends the membership and the key of the group to its members
+func (ctl *GroupController) update(g *group) error {
+	key, err := ctl.pss.GetSymmetricKey(g.keyID)
+	if err != nil {
+		return err
+	}
+	msg := &groupMsg{
+		ID:      common.FromHex(g.id),
+		Topic:   g.topic,
+		Address: g.address,
+		Epoch:   g.epoch,
+		Key:     key,
+	}
+	for pubkeyid, address := range g.members {
+		msg.Members = append(msg.Members, groupMember{PubKey: common.FromHex(pubkeyid), Address: address})
+	}
+	for pubkeyid, address := range g.members {
+		if pubkeyid == g.owner {
+			continue
+		}
+		if err := ctl.sendUpdate(pubkeyid, address, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ctl *GroupController) sendUpdate(pubkeyid string, address PssAddress, msg *groupMsg) error {
+	payload, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		return err
+	}
+	return ctl.sendFunc(address, groupTopic, payload, true, common.FromHex(pubkeyid))
+}
+
+// handler handles the membership updates sent by the owners of the groups
+func (ctl *GroupController) handler(msg []byte, _ *p2p.Peer, asymmetric bool, keyid string) error {
+	// the owner is only authenticated by the signature of asymmetric messages
+	if !asymmetric {
+		return nil
+	}
+	var update groupMsg
+	if err := rlp.DecodeBytes(msg, &update); err != nil {
+		return fmt.Errorf("invalid group message: %v", err)
+	}
+	id := hexutil.Encode(update.ID)
+
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	g, ok := ctl.groups[id]
+	if ok && g.owner != keyid {
+		return fmt.Errorf("group %s update not from its owner", id)
+	}
+	if ok && update.Epoch < g.epoch {
+		return nil
+	}
+	if update.Removed {
+		if ok {
+			ctl.drop(g)
+			metrics.GetOrRegisterCounter("pss/group/removed", nil).Inc(1)
+		}
+		return nil
+	}
+
+	members := make(map[string]PssAddress)
+	for _, m := range update.Members {
+		members[common.ToHex(m.PubKey)] = m.Address
+	}
+	if _, ok := members[ctl.self()]; !ok {
+		return fmt.Errorf("group %s update without us", id)
+	}
+	if !ok {
+		if _, err := ctl.pss.getPeerAddress(keyid, update.Topic); err != nil {
+			return errGroupOwner
+		}
+		if len(ctl.groups) >= defaultMaxGroups {
+			return errGroupLimit
+		}
+	}
+	if !ok || update.Epoch > g.epoch {
+		keyID, err := ctl.pss.setSymmetricKey(update.Key, update.Topic, update.Address, true, true)
+		if err != nil {
+			return err
+		}
+		if ok {
+			ctl.rotate(g, keyID)
+		} else {
+			g = &group{
+				id:    id,
+				topic: update.Topic,
+				owner: keyid,
+				keyID: keyID,
+			}
+			ctl.groups[id] = g
+			metrics.GetOrRegisterCounter("pss/group/join", nil).Inc(1)
+		}
+	}
+	g.address = update.Address
+	g.epoch = update.Epoch
+	g.members = members
+	return nil
+}
+
+// GroupAPI is the API of the pss groups
+type GroupAPI struct {
+	ctrl *GroupController
+}
+
+// NewGroupAPI creates a new GroupAPI
+func NewGroupAPI(ctl *GroupController) *GroupAPI {
+	return &GroupAPI{ctrl: ctl}
+}
+
+// CreateGroup creates a group on the topic and returns its id. The messages of the group
+// are sent to every member, or to the given address if it is not empty
+func (api *GroupAPI) CreateGroup(topic message.Topic, address PssAddress) (string, error) {
+	return api.ctrl.Create(topic, address)
+}
+
+// InviteToGroup adds the peer (public key) registered for the topic of the group to the group
+func (api *GroupAPI) InviteToGroup(id string, pubkeyid string) error {
+	return api.ctrl.Invite(id, pubkeyid)
+}
+
+// RemoveFromGroup removes the member (public key) from the group and rotates the group key
+func (api *GroupAPI) RemoveFromGroup(id string, pubkeyid string) error {
+	return api.ctrl.Remove(id, pubkeyid)
+}
+
+// LeaveGroup drops the group and its keys, the members of an owned group are removed
+func (api *GroupAPI) LeaveGroup(id string) error {
+	return api.ctrl.Leave(id)
+}
+
+// SendToGroup sends a message to the members of the group, they receive it
+// on the topic of the group
+func (api *GroupAPI) SendToGroup(id string, msg hexutil.Bytes) error {
+	if err := validateMsg(msg); err != nil {
+		return err
+	}
+	return api.ctrl.Send(id, msg)
+}
+
+// GetGroupMembers returns the public keys of the members of the group
+func (api *GroupAPI) GetGroupMembers(id string) ([]string, error) {
+	return api.ctrl.Members(id)
+}
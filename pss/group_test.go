@@ -0,0 +1,224 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// groupTestNode is a pss node with groups recording the messages received on a topic
+type groupTestNode struct {
+	ps       *Pss
+	groups   *GroupController
+	received []string
+}
+
+// newGroupTestNodes creates pss nodes with groups, the messages sent by a node
+// are encrypted and processed by the node with the recipient address
+func newGroupTestNodes(t *testing.T, n int, topic message.Topic) ([]*groupTestNode, func()) {
+	t.Helper()
+	pssNodes, stop := newTestPssNodes(t, n)
+	deliver := newTestDelivery(pssNodes)
+	var nodes []*groupTestNode
+	for _, ps := range pssNodes {
+		from := ps
+		node := &groupTestNode{ps: ps, groups: SetGroupController(ps)}
+		node.groups.sendFunc = func(to []byte, topic message.Topic, msg []byte, asymmetric bool, key []byte) error {
+			return deliver(from, to, topic, msg, asymmetric, key)
+		}
+		ps.Register(&topic, NewHandler(func(msg []byte, _ *p2p.Peer, _ bool, _ string) error {
+			node.received = append(node.received, string(msg))
+			return nil
+		}))
+		nodes = append(nodes, node)
+	}
+	return nodes, stop
+}
+
+// TestGroup tests that the messages of a group are received by its members only
+// and that removing a member rotates the group key
+func TestGroup(t *testing.T) {
+	topic := message.NewTopic([]byte("group-test"))
+	nodes, teardown := newGroupTestNodes(t, 4, topic)
+	defer teardown()
+	owner, alice, bob, eve := nodes[0], nodes[1], nodes[2], nodes[3]
+
+	id, err := owner.groups.Create(topic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, member := range []*groupTestNode{alice, bob} {
+		if err := owner.ps.SetPeerPublicKey(member.ps.PublicKey(), topic, member.ps.BaseAddr()); err != nil {
+			t.Fatal(err)
+		}
+		if err := member.ps.SetPeerPublicKey(owner.ps.PublicKey(), topic, owner.ps.BaseAddr()); err != nil {
+			t.Fatal(err)
+		}
+		if err := owner.groups.Invite(id, toPubKeyID(t, member.ps)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	members, err := alice.groups.Members(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 3 {
+		t.Fatalf("expected 3 members, got %v", members)
+	}
+	if err := alice.groups.Invite(id, toPubKeyID(t, eve.ps)); err != errGroupNotOwner {
+		t.Fatalf("expected error %v, got %v", errGroupNotOwner, err)
+	}
+
+	if err := alice.groups.Send(id, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	for i, node := range []*groupTestNode{owner, bob} {
+		if fmt.Sprint(node.received) != "[hello]" {
+			t.Fatalf("node %d: expected message received, got %v", i, node.received)
+		}
+	}
+	if len(eve.received) != 0 || len(alice.received) != 0 {
+		t.Fatalf("unexpected messages received %v, %v", eve.received, alice.received)
+	}
+
+	aliceKey := alice.groups.groups[id].keyID
+	if err := owner.groups.Remove(id, toPubKeyID(t, bob.ps)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bob.groups.groups[id]; ok {
+		t.Fatal("expected the removed member to drop the group")
+	}
+	if alice.groups.groups[id].keyID == aliceKey {
+		t.Fatal("expected the group key to be rotated")
+	}
+	if err := owner.groups.Send(id, []byte("without bob")); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(alice.received) != "[without bob]" {
+		t.Fatalf("expected message received, got %v", alice.received)
+	}
+	if len(bob.received) != 1 {
+		t.Fatalf("unexpected messages received by the removed member %v", bob.received)
+	}
+
+	// updates are only accepted from the owner
+	if err := alice.groups.handler(nil, nil, true, toPubKeyID(t, eve.ps)); err == nil {
+		t.Fatal("expected error on invalid update")
+	}
+	payload, err := rlp.EncodeToBytes(&groupMsg{ID: common.FromHex(id), Epoch: 10, Removed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.groups.handler(payload, nil, true, toPubKeyID(t, eve.ps)); err == nil {
+		t.Fatal("expected error on update not from the owner")
+	}
+	if _, ok := alice.groups.groups[id]; !ok {
+		t.Fatal("expected the group to be kept")
+	}
+}
+
+// TestGroupInvite tests that invites are only accepted from the owners registered for the topic,
+// that the number of groups is bounded and that the keys of the groups left are removed
+func TestGroupInvite(t *testing.T) {
+	topic := message.NewTopic([]byte("group-test"))
+	nodes, teardown := newGroupTestNodes(t, 3, topic)
+	defer teardown()
+	owner, alice, bob := nodes[0], nodes[1], nodes[2]
+	for _, member := range []*groupTestNode{alice, bob} {
+		if err := owner.ps.SetPeerPublicKey(member.ps.PublicKey(), topic, member.ps.BaseAddr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bob.ps.SetPeerPublicKey(owner.ps.PublicKey(), topic, owner.ps.BaseAddr()); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := owner.groups.Create(topic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := owner.groups.Invite(id, toPubKeyID(t, alice.ps)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := alice.groups.groups[id]; ok {
+		t.Fatal("expected the invite of an owner not registered to be rejected")
+	}
+
+	if err := alice.ps.SetPeerPublicKey(owner.ps.PublicKey(), topic, owner.ps.BaseAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if err := owner.groups.Invite(id, toPubKeyID(t, alice.ps)); err != nil {
+		t.Fatal(err)
+	}
+	g, ok := alice.groups.groups[id]
+	if !ok {
+		t.Fatal("expected the invite to be accepted")
+	}
+	keyID := g.keyID
+
+	// the previous key is removed on the next rotation
+	for i := 0; i < 2; i++ {
+		if err := owner.groups.Invite(id, toPubKeyID(t, bob.ps)); err != nil {
+			t.Fatal(err)
+		}
+		if err := owner.groups.Remove(id, toPubKeyID(t, bob.ps)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := alice.ps.GetSymmetricKey(keyID); (err == nil) != (i == 0) {
+			t.Fatalf("rotation %d: unexpected previous key lookup error %v", i, err)
+		}
+	}
+	keyID = alice.groups.groups[id].keyID
+
+	if err := alice.groups.Leave(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := alice.groups.groups[id]; ok {
+		t.Fatal("expected the group to be dropped")
+	}
+	if _, err := alice.ps.GetSymmetricKey(keyID); err == nil {
+		t.Fatal("expected the group key to be removed")
+	}
+	if err := owner.groups.Leave(id); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < defaultMaxGroups; i++ {
+		if _, err := alice.groups.Create(topic, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := alice.groups.Create(topic, nil); err != errGroupLimit {
+		t.Fatalf("expected error %v, got %v", errGroupLimit, err)
+	}
+	id, err = owner.groups.Create(topic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := owner.groups.Invite(id, toPubKeyID(t, alice.ps)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := alice.groups.groups[id]; ok {
+		t.Fatal("expected the invite to be rejected above the limit of groups")
+	}
+}
@@ -121,6 +121,25 @@ func (ks *KeyStore) addSymmetricKeyToPool(keyid string, topic message.Topic, add
 	}
 }
 
+// allows the garbage collection of a symmetric key once it is no longer
+// in the collection of keys used for decryption
+func (ks *KeyStore) unprotectSymmetricKey(keyid string, topic message.Topic) {
+	ks.mx.Lock()
+	defer ks.mx.Unlock()
+	if psp, ok := ks.symKeyPool[keyid][topic]; ok {
+		psp.protected = false
+	}
+}
+
+// RemoveSymmetricKey removes a symmetric key from the key pool on all topics
+// and from the crypto backend, the key can no longer be used to send or decrypt messages
+func (ks *KeyStore) RemoveSymmetricKey(keyid string) {
+	ks.mx.Lock()
+	delete(ks.symKeyPool, keyid)
+	ks.mx.Unlock()
+	ks.Crypto.DeleteSymmetricKey(keyid)
+}
+
 // Returns all recorded topic and address combination for a specific public key
 func (ks *KeyStore) GetPublickeyPeers(keyid string) (topic []message.Topic, address []PssAddress, err error) {
 	ks.mx.RLock()
@@ -0,0 +1,541 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/pss/internal/ttlset"
+	"github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/state"
+	"github.com/tilinna/clock"
+)
+
+const (
+	defaultMailboxTTL           = 7 * 24 * time.Hour // time a message is kept for an offline recipient
+	defaultMailboxCapacity      = 256                // max number of messages kept per recipient
+	defaultMailboxTotalCapacity = 64 * 1024          // max number of messages kept for all recipients
+	defaultMailboxFetchTimeout  = 10 * time.Second   // time to wait for the deliveries of a fetch
+	mailboxDeliveryBatch        = 32                 // max number of messages in a delivery or an ack
+	mailboxAckInterval          = 10 * time.Second   // interval at which the messages received directly are acknowledged
+	mailboxSignatureTTL         = time.Minute        // time a signed fetch or ack is valid, limits replays
+	mailboxKeyPrefix            = "pss_mailbox_"
+)
+
+// mailbox message codes
+const (
+	mailboxDeposit  = iota // sender to the neighbourhood of the recipient, stores a message
+	mailboxFetch           // recipient to its neighbourhood, requests the stored messages
+	mailboxDelivery        // neighbourhood to the recipient, the stored messages
+	mailboxAck             // recipient to its neighbourhood, the messages delivered can be deleted
+)
+
+var (
+	mailboxTopic = message.NewTopic([]byte("pss-mailbox"))
+
+	errMailboxFull      = errors.New("mailbox full")
+	errMailboxStoreFull = errors.New("mailbox store full")
+	errMailboxSignature = errors.New("invalid mailbox message signature")
+)
+
+// MailboxParams are the parameters of the mailbox service
+type MailboxParams struct {
+	TTL           time.Duration // time a message is kept for an offline recipient
+	Capacity      int           // max number of messages kept per recipient
+	TotalCapacity int           // max number of messages kept for all recipients
+	FetchTimeout  time.Duration // time to wait for the deliveries of a fetch
+	Nonce         []byte        // nonce mixed into the overlay address of the node, see network.PrivateKeyToBzzKeyWithNonce
+}
+
+// NewMailboxParams returns the default mailbox parameters
+func NewMailboxParams() *MailboxParams {
+	return &MailboxParams{
+		TTL:           defaultMailboxTTL,
+		Capacity:      defaultMailboxCapacity,
+		TotalCapacity: defaultMailboxTotalCapacity,
+		FetchTimeout:  defaultMailboxFetchTimeout,
+	}
+}
+
+// WithNonce sets the nonce of the overlay address of the node, which is needed
+// to prove the ownership of the address in the fetch and ack messages
+func (params *MailboxParams) WithNonce(nonce []byte) *MailboxParams {
+	params.Nonce = nonce
+	return params
+}
+
+// mailboxMsg is the payload of the raw pss messages of the mailbox service
+//
+// fetch and ack messages are signed with the key of the recipient, the overlay address
+// of the recipient must be derived from the public key and the nonce
+type mailboxMsg struct {
+	Code      uint8
+	To        []byte             // overlay address of the recipient
+	Msgs      []*message.Message // deposit and delivery: the encrypted messages
+	Digests   [][]byte           // ack: the digests of the messages delivered
+	Nonce     []byte             // fetch and ack: the nonce of the overlay address of the recipient
+	Time      uint64             // fetch and ack: unix time of the signature
+	Signature []byte             // fetch and ack: signature of the recipient
+}
+
+// signedDigest returns the hash signed in fetch and ack messages
+func (msg *mailboxMsg) signedDigest() ([]byte, error) {
+	b, err := rlp.EncodeToBytes([]interface{}{msg.Code, msg.To, msg.Digests, msg.Nonce, msg.Time})
+	if err != nil {
+		return nil, err
+	}
+	return ethCrypto.Keccak256(b), nil
+}
+
+// sign signs a fetch or ack message with the key of the node
+func (m *Mailbox) sign(msg *mailboxMsg) error {
+	msg.Nonce = m.params.Nonce
+	msg.Time = uint64(time.Now().Unix())
+	digest, err := msg.signedDigest()
+	if err != nil {
+		return err
+	}
+	msg.Signature, err = ethCrypto.Sign(digest, m.pss.privateKey)
+	return err
+}
+
+// verify checks that a fetch or ack message was recently signed by the owner of the recipient address
+func (msg *mailboxMsg) verify() error {
+	t := time.Unix(int64(msg.Time), 0)
+	if time.Since(t) > mailboxSignatureTTL || time.Until(t) > mailboxSignatureTTL {
+		return errMailboxSignature
+	}
+	digest, err := msg.signedDigest()
+	if err != nil {
+		return err
+	}
+	pub, err := ethCrypto.SigToPub(digest, msg.Signature)
+	if err != nil {
+		return errMailboxSignature
+	}
+	if !bytes.Equal(ethCrypto.Keccak256(ethCrypto.FromECDSAPub(pub), msg.Nonce), msg.To) {
+		return errMailboxSignature
+	}
+	return nil
+}
+
+// mailboxEntry is a message kept for an offline recipient
+type mailboxEntry struct {
+	Msg    []byte    // rlp encoded message
+	Stored time.Time // time the message was deposited
+}
+
+// Mailbox is the store-and-forward service of pss for offline recipients.
+//
+// Messages sent to a full overlay address are also deposited in the neighbourhood
+// of the recipient, where the nodes running the service keep them, still encrypted,
+// until the recipient fetches and acknowledges them or they expire.
+// The recipient fetches its messages with the pss_fetchMailbox API when it reconnects,
+// they are dispatched to the handlers of their topic as if they were just received.
+//
+// Fetches and acknowledgements are signed by the recipient, the nodes keeping the
+// messages check that the signer owns the overlay address. Messages received directly
+// are acknowledged as well, so that their copies are dropped.
+type Mailbox struct {
+	pss       *Pss
+	store     state.Store
+	params    *MailboxParams
+	delivered *ttlset.TTLSet // digests of the messages received, to drop duplicate deliveries
+	count     uint64         // number of messages delivered from mailboxes
+
+	mu   sync.Mutex // protects size and the writes to the store
+	size int        // number of messages kept for all recipients
+
+	ackMu sync.Mutex
+	acks  [][]byte // digests of the messages received directly, not yet acknowledged
+
+	sendFunc func(to PssAddress, msg []byte) error // sends a mailbox message, sendRaw unless overridden in tests
+}
+
+// SetMailbox runs the mailbox service on the pss node, keeping messages in store
+//
+// Must be called before starting the pss node service
+func SetMailbox(p *Pss, params *MailboxParams, store state.Store) *Mailbox {
+	m := &Mailbox{
+		pss:    p,
+		store:  store,
+		params: params,
+		delivered: ttlset.New(&ttlset.Config{
+			EntryTTL: params.TTL,
+			Clock:    clock.Realtime(),
+		}),
+	}
+	m.sendFunc = m.sendRaw
+	err := store.Iterate(mailboxKeyPrefix, func(_, _ []byte) (bool, error) {
+		m.size++
+		return false, nil
+	})
+	if err != nil {
+		log.Warn("pss mailbox size unknown", "err", err)
+	}
+	p.mailbox = m
+	p.Register(&mailboxTopic, NewHandler(m.handle).WithRaw().WithProxBin())
+	p.addAPI(rpc.API{
+		Namespace: "pss",
+		Version:   "1.0",
+		Service:   NewMailboxAPI(m),
+		Public:    true,
+	})
+	go m.gcLoop()
+	return m
+}
+
+// deposit sends a copy of a message sent to a full address to the neighbourhood of the recipient
+func (m *Mailbox) deposit(msg *message.Message) {
+	if len(msg.To) != addressLength {
+		return
+	}
+	if err := m.send(msg.To, &mailboxMsg{Code: mailboxDeposit, To: msg.To, Msgs: []*message.Message{msg}}); err != nil {
+		log.Warn("pss mailbox deposit failed", "to", label(msg.To), "err", err)
+	}
+}
+
+// received records a message received directly, so that its copy in the mailboxes is dropped
+// and acknowledges it with the next batch
+func (m *Mailbox) received(msg *message.Message) {
+	digest := msg.Digest()
+	m.delivered.Add(digest)
+	m.ackMu.Lock()
+	m.acks = append(m.acks, digest[:])
+	full := len(m.acks) >= mailboxDeliveryBatch
+	m.ackMu.Unlock()
+	if full {
+		go m.flushAcks()
+	}
+}
+
+// flushAcks acknowledges the messages received directly since the last flush
+func (m *Mailbox) flushAcks() {
+	m.ackMu.Lock()
+	digests := m.acks
+	m.acks = nil
+	m.ackMu.Unlock()
+	if len(digests) == 0 {
+		return
+	}
+	if err := m.ack(digests); err != nil {
+		log.Debug("pss mailbox ack failed", "err", err)
+	}
+}
+
+// ack asks our neighbourhood to delete the copies of the messages
+func (m *Mailbox) ack(digests [][]byte) error {
+	to := m.pss.BaseAddr()
+	msg := &mailboxMsg{Code: mailboxAck, To: to, Digests: digests}
+	if err := m.sign(msg); err != nil {
+		return err
+	}
+	return m.send(to, msg)
+}
+
+// Fetch requests the messages kept for us by our neighbourhood,
+// and returns the number of messages delivered before the fetch timeout
+func (m *Mailbox) Fetch(ctx context.Context) (int, error) {
+	start := atomic.LoadUint64(&m.count)
+	to := m.pss.BaseAddr()
+	msg := &mailboxMsg{Code: mailboxFetch, To: to}
+	if err := m.sign(msg); err != nil {
+		return 0, err
+	}
+	if err := m.send(to, msg); err != nil {
+		return 0, err
+	}
+	metrics.GetOrRegisterCounter("pss/mailbox/fetch", nil).Inc(1)
+	select {
+	case <-time.After(m.params.FetchTimeout):
+	case <-ctx.Done():
+	}
+	return int(atomic.LoadUint64(&m.count) - start), nil
+}
+
+func (m *Mailbox) send(to []byte, msg *mailboxMsg) error {
+	payload, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		return err
+	}
+	return m.sendFunc(to, payload)
+}
+
+// sendRaw sends a mailbox message as a raw pss message
+func (m *Mailbox) sendRaw(to PssAddress, msg []byte) error {
+	return m.pss.SendRaw(to, mailboxTopic, msg, m.pss.msgTTL)
+}
+
+// handle handles the mailbox messages for which we are in the neighbourhood of the recipient
+func (m *Mailbox) handle(payload []byte, _ *p2p.Peer, _ bool, _ string) error {
+	var msg mailboxMsg
+	if err := rlp.DecodeBytes(payload, &msg); err != nil {
+		return fmt.Errorf("invalid mailbox message: %v", err)
+	}
+	if len(msg.To) != addressLength {
+		return fmt.Errorf("invalid mailbox recipient %x", msg.To)
+	}
+	self := bytes.Equal(msg.To, m.pss.BaseAddr())
+	switch msg.Code {
+	case mailboxDeposit:
+		// the recipient received the message directly
+		if self {
+			return nil
+		}
+		for _, pssmsg := range msg.Msgs {
+			if err := m.put(msg.To, pssmsg); err != nil {
+				return err
+			}
+		}
+	case mailboxFetch:
+		if self {
+			return nil
+		}
+		if err := msg.verify(); err != nil {
+			metrics.GetOrRegisterCounter("pss/mailbox/unsigned", nil).Inc(1)
+			return err
+		}
+		return m.deliver(msg.To)
+	case mailboxDelivery:
+		if !self {
+			return nil
+		}
+		return m.receive(msg.Msgs)
+	case mailboxAck:
+		if self {
+			return nil
+		}
+		if err := msg.verify(); err != nil {
+			metrics.GetOrRegisterCounter("pss/mailbox/unsigned", nil).Inc(1)
+			return err
+		}
+		for _, digest := range msg.Digests {
+			if err := m.delete(mailboxKey(msg.To, digest)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid mailbox message code %d", msg.Code)
+	}
+	return nil
+}
+
+func mailboxKey(to []byte, digest []byte) string {
+	return mailboxKeyPrefix + hex.EncodeToString(to) + "_" + hex.EncodeToString(digest)
+}
+
+// put keeps a message for the recipient
+func (m *Mailbox) put(to []byte, msg *message.Message) error {
+	if !bytes.Equal(msg.To, to) || msg.Flags.Raw {
+		return fmt.Errorf("invalid mailbox deposit for %x", to)
+	}
+	digest := msg.Digest()
+	key := mailboxKey(to, digest[:])
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.has(key) {
+		return nil
+	}
+	if m.size >= m.params.TotalCapacity {
+		metrics.GetOrRegisterCounter("pss/mailbox/storefull", nil).Inc(1)
+		return errMailboxStoreFull
+	}
+	var n int
+	err := m.store.Iterate(mailboxKeyPrefix+hex.EncodeToString(to), func(_, _ []byte) (bool, error) {
+		n++
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	if n >= m.params.Capacity {
+		metrics.GetOrRegisterCounter("pss/mailbox/full", nil).Inc(1)
+		return errMailboxFull
+	}
+	encoded, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		return err
+	}
+	if err := m.store.Put(key, &mailboxEntry{Msg: encoded, Stored: time.Now()}); err != nil {
+		return err
+	}
+	m.size++
+	metrics.GetOrRegisterCounter("pss/mailbox/deposit", nil).Inc(1)
+	return nil
+}
+
+// has returns true if a message is kept under the key, must be called with the lock held
+// entries which cannot be decoded exist as well, so that gc deletes them
+func (m *Mailbox) has(key string) bool {
+	var entry mailboxEntry
+	return m.store.Get(key, &entry) != state.ErrNotFound
+}
+
+// delete deletes a message kept for a recipient if it exists
+func (m *Mailbox) delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.has(key) {
+		return nil
+	}
+	if err := m.store.Delete(key); err != nil {
+		return err
+	}
+	m.size--
+	return nil
+}
+
+// deliver sends the messages kept for the recipient in batches
+func (m *Mailbox) deliver(to []byte) error {
+	var msgs []*message.Message
+	err := m.store.Iterate(mailboxKeyPrefix+hex.EncodeToString(to), func(_, value []byte) (bool, error) {
+		entry, err := decodeMailboxEntry(value)
+		if err != nil {
+			return false, err
+		}
+		if time.Since(entry.Stored) > m.params.TTL {
+			return false, nil
+		}
+		var msg message.Message
+		if err := rlp.DecodeBytes(entry.Msg, &msg); err != nil {
+			return false, err
+		}
+		msgs = append(msgs, &msg)
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	for len(msgs) > 0 {
+		n := len(msgs)
+		if n > mailboxDeliveryBatch {
+			n = mailboxDeliveryBatch
+		}
+		if err := m.send(to, &mailboxMsg{Code: mailboxDelivery, To: to, Msgs: msgs[:n]}); err != nil {
+			return err
+		}
+		metrics.GetOrRegisterCounter("pss/mailbox/delivery", nil).Inc(int64(n))
+		msgs = msgs[n:]
+	}
+	return nil
+}
+
+// receive dispatches the messages delivered from our mailbox to their handlers
+// and acknowledges them, including the ones received before
+func (m *Mailbox) receive(msgs []*message.Message) error {
+	var digests [][]byte
+	for _, msg := range msgs {
+		if !m.pss.isSelfRecipient(msg) {
+			continue
+		}
+		digest := msg.Digest()
+		digests = append(digests, digest[:])
+		if m.delivered.Has(digest) {
+			continue
+		}
+		m.delivered.Add(digest)
+		// expired messages are processed as well, they were kept for us
+		if err := m.pss.process(msg, false, false); err != nil {
+			log.Debug("pss mailbox message not for us", "err", err)
+			continue
+		}
+		atomic.AddUint64(&m.count, 1)
+	}
+	if len(digests) == 0 {
+		return nil
+	}
+	return m.ack(digests)
+}
+
+// gcLoop deletes the expired messages periodically
+// and acknowledges the messages received directly
+func (m *Mailbox) gcLoop() {
+	ticker := time.NewTicker(defaultCleanInterval)
+	defer ticker.Stop()
+	ackTicker := time.NewTicker(mailboxAckInterval)
+	defer ackTicker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.gc()
+			m.delivered.GC()
+		case <-ackTicker.C:
+			m.flushAcks()
+		case <-m.pss.quitC:
+			return
+		}
+	}
+}
+
+func (m *Mailbox) gc() {
+	var expired []string
+	err := m.store.Iterate(mailboxKeyPrefix, func(key, value []byte) (bool, error) {
+		entry, err := decodeMailboxEntry(value)
+		if err != nil || time.Since(entry.Stored) > m.params.TTL {
+			expired = append(expired, string(key))
+		}
+		return false, nil
+	})
+	if err != nil {
+		log.Warn("pss mailbox gc failed", "err", err)
+	}
+	for _, key := range expired {
+		if err := m.delete(key); err != nil {
+			log.Warn("pss mailbox gc failed", "key", key, "err", err)
+		}
+	}
+	metrics.GetOrRegisterCounter("pss/mailbox/expired", nil).Inc(int64(len(expired)))
+}
+
+func decodeMailboxEntry(value []byte) (*mailboxEntry, error) {
+	entry := &mailboxEntry{}
+	if err := json.Unmarshal(value, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// MailboxAPI is the API of the mailbox service
+type MailboxAPI struct {
+	mailbox *Mailbox
+}
+
+// NewMailboxAPI creates a new MailboxAPI
+func NewMailboxAPI(m *Mailbox) *MailboxAPI {
+	return &MailboxAPI{mailbox: m}
+}
+
+// FetchMailbox requests the messages kept for the node by its neighbourhood while it was offline.
+// The messages are dispatched to the handlers and subscriptions of their topics,
+// it returns the number of messages delivered
+func (api *MailboxAPI) FetchMailbox(ctx context.Context) (int, error) {
+	return api.mailbox.Fetch(ctx)
+}
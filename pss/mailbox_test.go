@@ -0,0 +1,294 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/pss/crypto"
+	"github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/state"
+)
+
+// mailboxTestNode is a pss node running the mailbox service
+type mailboxTestNode struct {
+	ps      *Pss
+	mailbox *Mailbox
+	store   *state.DBStore
+}
+
+// newMailboxTestNodes creates pss nodes running the mailbox service
+// which are all in the neighbourhood of each other: the mailbox messages
+// sent by a node are handled by all the others
+// the overlay addresses of the nodes are derived from their keys
+func newMailboxTestNodes(t *testing.T, n int, params *MailboxParams) ([]*mailboxTestNode, func()) {
+	t.Helper()
+	pssNodes, stop := newTestPssNodes(t, n)
+	var nodes []*mailboxTestNode
+	for _, ps := range pssNodes {
+		store := state.NewInmemoryStore()
+		nodes = append(nodes, &mailboxTestNode{ps: ps, mailbox: SetMailbox(ps, params, store), store: store})
+	}
+	for _, node := range nodes {
+		from := node
+		node.mailbox.sendFunc = func(to PssAddress, msg []byte) error {
+			for _, node := range nodes {
+				if node == from {
+					continue
+				}
+				if err := node.mailbox.handle(msg, nil, false, ""); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return nodes, func() {
+		stop()
+		for _, node := range nodes {
+			node.store.Close()
+		}
+	}
+}
+
+func (n *mailboxTestNode) count(t *testing.T) (count int) {
+	t.Helper()
+	err := n.store.Iterate(mailboxKeyPrefix, func(_, _ []byte) (bool, error) {
+		count++
+		return false, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// TestMailbox tests that a message sent to an offline recipient is kept in its neighbourhood,
+// delivered to its handlers when it fetches its mailbox, and deleted once acknowledged
+func TestMailbox(t *testing.T) {
+	params := NewMailboxParams()
+	params.FetchTimeout = 10 * time.Millisecond
+	nodes, teardown := newMailboxTestNodes(t, 3, params)
+	defer teardown()
+	sender, box, recipient := nodes[0], nodes[1], nodes[2]
+
+	topic := message.NewTopic([]byte("mailbox-test"))
+	received := make(chan []byte, 10)
+	recipient.ps.Register(&topic, NewHandler(func(msg []byte, _ *p2p.Peer, _ bool, _ string) error {
+		received <- msg
+		return nil
+	}))
+
+	if err := sender.ps.SetPeerPublicKey(recipient.ps.PublicKey(), topic, recipient.ps.BaseAddr()); err != nil {
+		t.Fatal(err)
+	}
+	pubkeyid := toPubKeyID(t, recipient.ps)
+	payload := []byte("hello offline")
+	if err := sender.ps.SendAsym(pubkeyid, topic, payload); err != nil {
+		t.Fatal(err)
+	}
+	if c := box.count(t); c != 1 {
+		t.Fatalf("expected 1 message in the mailbox, got %d", c)
+	}
+
+	n, err := NewMailboxAPI(recipient.mailbox).FetchMailbox(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 message fetched, got %d", n)
+	}
+	select {
+	case msg := <-received:
+		if !bytes.Equal(msg, payload) {
+			t.Fatalf("expected message %q, got %q", payload, msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the message")
+	}
+	if c := box.count(t); c != 0 {
+		t.Fatalf("expected the acknowledged message to be deleted, got %d", c)
+	}
+
+	// a message received directly is not delivered again from the mailbox, but acknowledged
+	msg := testMailboxMsg(t, sender, recipient, topic, payload)
+	if err := recipient.ps.process(msg, false, false); err != nil {
+		t.Fatal(err)
+	}
+	<-received
+	if err := box.mailbox.put(recipient.ps.BaseAddr(), msg); err != nil {
+		t.Fatal(err)
+	}
+	n, err = recipient.mailbox.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected no new message fetched, got %d", n)
+	}
+	select {
+	case msg := <-received:
+		t.Fatalf("unexpected message %q", msg)
+	default:
+	}
+	if c := box.count(t); c != 0 {
+		t.Fatalf("expected the acknowledged message to be deleted, got %d", c)
+	}
+
+	// a message received directly is acknowledged with the next batch of acks
+	msg = testMailboxMsg(t, sender, recipient, topic, []byte("direct"))
+	if err := box.mailbox.put(recipient.ps.BaseAddr(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := recipient.ps.process(msg, false, false); err != nil {
+		t.Fatal(err)
+	}
+	<-received
+	recipient.mailbox.flushAcks()
+	if c := box.count(t); c != 0 {
+		t.Fatalf("expected the message received directly to be deleted, got %d", c)
+	}
+}
+
+// TestMailboxSignature tests that fetches and acks are only accepted
+// if signed recently by the owner of the recipient address
+func TestMailboxSignature(t *testing.T) {
+	nodes, teardown := newMailboxTestNodes(t, 3, NewMailboxParams())
+	defer teardown()
+	sender, box, recipient := nodes[0], nodes[1], nodes[2]
+
+	topic := message.NewTopic([]byte("mailbox-test"))
+	msg := testMailboxMsg(t, sender, recipient, topic, []byte("hello"))
+	if err := box.mailbox.put(recipient.ps.BaseAddr(), msg); err != nil {
+		t.Fatal(err)
+	}
+	digest := msg.Digest()
+
+	for _, tc := range []struct {
+		name string
+		ack  func() *mailboxMsg
+	}{
+		{"unsigned", func() *mailboxMsg {
+			return &mailboxMsg{Code: mailboxAck, To: recipient.ps.BaseAddr(), Digests: [][]byte{digest[:]}}
+		}},
+		{"other signer", func() *mailboxMsg {
+			ack := &mailboxMsg{Code: mailboxAck, To: recipient.ps.BaseAddr(), Digests: [][]byte{digest[:]}}
+			if err := sender.mailbox.sign(ack); err != nil {
+				t.Fatal(err)
+			}
+			return ack
+		}},
+		{"expired", func() *mailboxMsg {
+			ack := &mailboxMsg{Code: mailboxAck, To: recipient.ps.BaseAddr(), Digests: [][]byte{digest[:]}}
+			if err := recipient.mailbox.sign(ack); err != nil {
+				t.Fatal(err)
+			}
+			ack.Time -= uint64(2 * mailboxSignatureTTL / time.Second)
+			return ack
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := rlp.EncodeToBytes(tc.ack())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := box.mailbox.handle(payload, nil, false, ""); err != errMailboxSignature {
+				t.Fatalf("expected error %v, got %v", errMailboxSignature, err)
+			}
+			if c := box.count(t); c != 1 {
+				t.Fatalf("expected the message kept, got %d", c)
+			}
+		})
+	}
+
+	if err := recipient.mailbox.ack([][]byte{digest[:]}); err != nil {
+		t.Fatal(err)
+	}
+	if c := box.count(t); c != 0 {
+		t.Fatalf("expected the acknowledged message to be deleted, got %d", c)
+	}
+}
+
+// TestMailboxLimits tests that the messages kept for a recipient are bounded and expire
+func TestMailboxLimits(t *testing.T) {
+	params := NewMailboxParams()
+	params.Capacity = 2
+	params.TotalCapacity = 3
+	nodes, teardown := newMailboxTestNodes(t, 3, params)
+	defer teardown()
+	sender, box, recipient := nodes[0], nodes[1], nodes[2]
+
+	topic := message.NewTopic([]byte("mailbox-test"))
+	to := recipient.ps.BaseAddr()
+	for i := 0; i < params.Capacity; i++ {
+		if err := box.mailbox.put(to, testMailboxMsg(t, sender, recipient, topic, []byte{byte(i)})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := box.mailbox.put(to, testMailboxMsg(t, sender, recipient, topic, []byte("full"))); err != errMailboxFull {
+		t.Fatalf("expected error %v, got %v", errMailboxFull, err)
+	}
+	// the messages kept for all recipients are bounded as well
+	if err := box.mailbox.put(sender.ps.BaseAddr(), testMailboxMsg(t, recipient, sender, topic, []byte("other"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := box.mailbox.put(box.ps.BaseAddr(), testMailboxMsg(t, sender, box, topic, []byte("store full"))); err != errMailboxStoreFull {
+		t.Fatalf("expected error %v, got %v", errMailboxStoreFull, err)
+	}
+
+	box.mailbox.gc()
+	if c := box.count(t); c != params.TotalCapacity {
+		t.Fatalf("expected %d messages kept, got %d", params.TotalCapacity, c)
+	}
+	params.TTL = 0
+	box.mailbox.gc()
+	if c := box.count(t); c != 0 {
+		t.Fatalf("expected expired messages to be deleted, got %d", c)
+	}
+	if box.mailbox.size != 0 {
+		t.Fatalf("expected the size of the mailbox to be 0, got %d", box.mailbox.size)
+	}
+}
+
+func toPubKeyID(t *testing.T, ps *Pss) string {
+	t.Helper()
+	return common.ToHex(ps.Crypto.SerializePublicKey(ps.PublicKey()))
+}
+
+// testMailboxMsg returns a message from sender to recipient encrypted with its public key
+func testMailboxMsg(t *testing.T, sender, recipient *mailboxTestNode, topic message.Topic, payload []byte) *message.Message {
+	t.Helper()
+	envelope, err := sender.ps.Crypto.Wrap(payload, &crypto.WrapParams{
+		Sender:   sender.ps.privateKey,
+		Receiver: recipient.ps.PublicKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := message.New(message.Flags{})
+	msg.To = recipient.ps.BaseAddr()
+	msg.Expire = uint32(time.Now().Add(time.Minute).Unix())
+	msg.Topic = topic
+	msg.Payload = envelope
+	return msg
+}
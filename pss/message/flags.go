@@ -11,11 +11,13 @@ import (
 type Flags struct {
 	Raw       bool // message is flagged as raw or with external encryption
 	Symmetric bool // message is symmetrically encrypted
+	Trace     bool // forwarders append a hop record to the message
 }
 
 const flagsLength = 1
 const flagSymmetric = 1 << 0
 const flagRaw = 1 << 1
+const flagTrace = 1 << 2
 
 // ErrIncorrectFlagsFieldLength is returned when the incoming flags field length is incorrect
 var ErrIncorrectFlagsFieldLength = errors.New("Incorrect flags field length in message")
@@ -31,11 +33,17 @@ func (f *Flags) DecodeRLP(s *rlp.Stream) error {
 	}
 	f.Symmetric = flagsBytes[0]&flagSymmetric != 0
 	f.Raw = flagsBytes[0]&flagRaw != 0
+	f.Trace = flagsBytes[0]&flagTrace != 0
 	return nil
 }
 
 // EncodeRLP implements the rlp.Encoder interface
 func (f *Flags) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, []byte{f.byte()})
+}
+
+// byte returns the wire encoding of the flags
+func (f *Flags) byte() byte {
 	var flags byte
 	if f.Raw {
 		flags |= flagRaw
@@ -43,6 +51,8 @@ func (f *Flags) EncodeRLP(w io.Writer) error {
 	if f.Symmetric {
 		flags |= flagSymmetric
 	}
-
-	return rlp.Encode(w, []byte{flags})
+	if f.Trace {
+		flags |= flagTrace
+	}
+	return flags
 }
@@ -2,8 +2,10 @@ package message
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -14,6 +16,8 @@ type Message struct {
 	Expire  uint32
 	Topic   Topic
 	Payload []byte
+	Stamps  []Stamp // optional, the first stamp is checked by the forwarders
+	Hops    []Hop   // optional, the forwarders of traced messages
 }
 
 const digestLength = 32 // byte length of digest used for pss cache (currently same as swarm chunk hash)
@@ -40,6 +44,42 @@ func (msg *Message) Digest() Digest {
 	return d
 }
 
+// EncodeRLP implements the rlp.Encoder interface, the optional fields are only encoded if they are set
+func (msg *Message) EncodeRLP(w io.Writer) error {
+	fields := []interface{}{msg.To, &msg.Flags, msg.Expire, msg.Topic, msg.Payload}
+	if len(msg.Stamps) > 0 || len(msg.Hops) > 0 {
+		fields = append(fields, msg.Stamps)
+	}
+	if len(msg.Hops) > 0 {
+		fields = append(fields, msg.Hops)
+	}
+	return rlp.Encode(w, fields)
+}
+
+// DecodeRLP implements the rlp.Decoder interface, the optional fields of messages without them are nil
+func (msg *Message) DecodeRLP(s *rlp.Stream) error {
+	if _, err := s.List(); err != nil {
+		return err
+	}
+	for _, field := range []interface{}{&msg.To, &msg.Flags, &msg.Expire, &msg.Topic, &msg.Payload} {
+		if err := s.Decode(field); err != nil {
+			return err
+		}
+	}
+	msg.Stamps, msg.Hops = nil, nil
+	for _, field := range []interface{}{&msg.Stamps, &msg.Hops} {
+		if err := s.Decode(field); err == rlp.EOL {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(msg.Stamps) == 0 {
+		msg.Stamps = nil
+	}
+	return s.ListEnd()
+}
+
 // String representation of a PSS message
 func (msg *Message) String() string {
 	return fmt.Sprintf("PssMsg: Recipient: %s, Topic: %v", common.ToHex(msg.To), msg.Topic.String())
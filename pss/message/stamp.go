@@ -0,0 +1,122 @@
+package message
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/sha3"
+)
+
+// MaxDifficulty is the highest proof of work difficulty that can be required from a message
+const MaxDifficulty = 32
+
+// ErrInvalidDifficulty is returned when the difficulty is out of range
+var ErrInvalidDifficulty = errors.New("invalid difficulty")
+
+// ErrNoPostageStamp is returned when the message has no postage stamp
+var ErrNoPostageStamp = errors.New("no postage stamp")
+
+// Stamp proves that the sender of a message paid for sending it,
+// either with a proof of work nonce or with a postage stamp,
+// the signature of the message digest by the issuer of a swap chequebook
+type Stamp struct {
+	Nonce      []byte         // proof of work nonce
+	Chequebook common.Address // chequebook of the postage stamp
+	Signature  []byte         // signature of the postage stamp
+}
+
+// Difficulty returns the proof of work difficulty of the message,
+// the number of leading zero bits of the hash of its digest and nonce
+func (msg *Message) Difficulty() int {
+	if len(msg.Stamps) == 0 || len(msg.Stamps[0].Nonce) == 0 {
+		return 0
+	}
+	return difficulty(msg.stampDigest(), msg.Stamps[0].Nonce)
+}
+
+// Mine stamps the message with a proof of work of at least the given difficulty
+func (msg *Message) Mine(ctx context.Context, target int) error {
+	if target < 0 || target > MaxDifficulty {
+		return ErrInvalidDifficulty
+	}
+	digest := msg.stampDigest()
+	nonce := make([]byte, 8)
+	for i := uint64(0); ; i++ {
+		if i%1024 == 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+		}
+		binary.BigEndian.PutUint64(nonce, i)
+		if difficulty(digest, nonce) >= target {
+			msg.Stamps = []Stamp{{Nonce: nonce}}
+			return nil
+		}
+	}
+}
+
+// SignStamp stamps the message with a postage stamp of the chequebook signed with the key of its issuer
+func (msg *Message) SignStamp(chequebook common.Address, key *ecdsa.PrivateKey) error {
+	sig, err := crypto.Sign(stampHash(msg.stampDigest(), chequebook), key)
+	if err != nil {
+		return err
+	}
+	msg.Stamps = []Stamp{{Chequebook: chequebook, Signature: sig}}
+	return nil
+}
+
+// PostageStamp returns the chequebook of the postage stamp of the message and the address which signed it
+func (msg *Message) PostageStamp() (chequebook common.Address, signer common.Address, err error) {
+	if len(msg.Stamps) == 0 || len(msg.Stamps[0].Signature) == 0 {
+		return chequebook, signer, ErrNoPostageStamp
+	}
+	stamp := msg.Stamps[0]
+	pubkey, err := crypto.SigToPub(stampHash(msg.stampDigest(), stamp.Chequebook), stamp.Signature)
+	if err != nil {
+		return chequebook, signer, err
+	}
+	return stamp.Chequebook, crypto.PubkeyToAddress(*pubkey), nil
+}
+
+// stampDigest is the digest the stamps of the message commit to, it covers the expiry
+// and the flags as well as the message digest, so that forwarders cannot change them
+func (msg *Message) stampDigest() Digest {
+	var expire [4]byte
+	binary.BigEndian.PutUint32(expire[:], msg.Expire)
+	digest := msg.Digest()
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(digest[:])
+	hasher.Write(expire[:])
+	hasher.Write([]byte{msg.Flags.byte()})
+	d := Digest{}
+	copy(d[:], hasher.Sum(nil))
+	return d
+}
+
+func difficulty(digest Digest, nonce []byte) int {
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(digest[:])
+	hasher.Write(nonce)
+	n := 0
+	for _, b := range hasher.Sum(nil) {
+		n += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return n
+}
+
+func stampHash(digest Digest, chequebook common.Address) []byte {
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(digest[:])
+	hasher.Write(chequebook[:])
+	return hasher.Sum(nil)
+}
@@ -0,0 +1,105 @@
+package message_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+func newStampTestMessage() *message.Message {
+	msg := message.New(message.Flags{})
+	msg.To = RandomArray(1, common.AddressLength)
+	msg.Expire = 1
+	msg.Topic = message.NewTopic([]byte("stamp"))
+	msg.Payload = RandomArray(2, 100)
+	return msg
+}
+
+func TestMine(t *testing.T) {
+	msg := newStampTestMessage()
+	if msg.Difficulty() != 0 {
+		t.Fatalf("expected difficulty 0, got %d", msg.Difficulty())
+	}
+	if err := msg.Mine(context.Background(), message.MaxDifficulty+1); err != message.ErrInvalidDifficulty {
+		t.Fatalf("expected error %v, got %v", message.ErrInvalidDifficulty, err)
+	}
+	digest := msg.Digest()
+	if err := msg.Mine(context.Background(), 12); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Difficulty() < 12 {
+		t.Fatalf("expected difficulty at least 12, got %d", msg.Difficulty())
+	}
+	if msg.Digest() != digest {
+		t.Fatal("expected the digest not to depend on the stamp")
+	}
+
+	// the proof of work is bound to the message, including its expiry and flags
+	for _, change := range []func(*message.Message){
+		func(m *message.Message) { m.Payload = RandomArray(3, 100) },
+		func(m *message.Message) { m.Expire++ },
+		func(m *message.Message) { m.Flags.Trace = true },
+	} {
+		changed := *msg
+		change(&changed)
+		if changed.Difficulty() >= 12 {
+			t.Fatalf("unexpected difficulty of a changed message %d", changed.Difficulty())
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := msg.Mine(ctx, message.MaxDifficulty); err != context.Canceled {
+		t.Fatalf("expected error %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestPostageStamp(t *testing.T) {
+	msg := newStampTestMessage()
+	if _, _, err := msg.PostageStamp(); err != message.ErrNoPostageStamp {
+		t.Fatalf("expected error %v, got %v", message.ErrNoPostageStamp, err)
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chequebook := common.HexToAddress("0x1234")
+	if err := msg.SignStamp(chequebook, key); err != nil {
+		t.Fatal(err)
+	}
+	stampChequebook, signer, err := msg.PostageStamp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stampChequebook != chequebook || signer != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Fatalf("unexpected postage stamp %x signed by %x", stampChequebook, signer)
+	}
+
+	// stamps are carried over the wire
+	data, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded message.Message
+	if err := rlp.DecodeBytes(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(msg.Stamps[0].Signature, decoded.Stamps[0].Signature) || decoded.Stamps[0].Chequebook != chequebook {
+		t.Fatalf("expected decoded stamp %v, got %v", msg.Stamps, decoded.Stamps)
+	}
+
+	// the signature is bound to the message, including its expiry
+	decoded.Expire++
+	if _, signer, _ := decoded.PostageStamp(); signer == crypto.PubkeyToAddress(key.PublicKey) {
+		t.Fatal("expected the signer of a message with a changed expiry to differ")
+	}
+	decoded.Payload = RandomArray(3, 100)
+	if _, signer, _ := decoded.PostageStamp(); signer == crypto.PubkeyToAddress(key.PublicKey) {
+		t.Fatal("expected the signer of a changed message to differ")
+	}
+}
@@ -0,0 +1,55 @@
+package message
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/sha3"
+)
+
+// MaxHops is the highest number of hops recorded in a traced message
+const MaxHops = 32
+
+// Hop records a node which forwarded a traced message
+type Hop struct {
+	Address   []byte // overlay address of the forwarder
+	Time      uint64 // unix time in nanoseconds at which the message was forwarded
+	Signature []byte // signature of the message digest, address and time by the forwarder
+}
+
+// AddHop appends a hop of the forwarder with the given overlay address, signed with its key,
+// to a traced message which has less than MaxHops hops
+// It returns whether the hop was added
+func (msg *Message) AddHop(address []byte, key *ecdsa.PrivateKey) (bool, error) {
+	if !msg.Flags.Trace || len(msg.Hops) >= MaxHops {
+		return false, nil
+	}
+	hop := Hop{
+		Address: address,
+		Time:    uint64(time.Now().UnixNano()),
+	}
+	sig, err := crypto.Sign(hopHash(msg.Digest(), hop.Address, hop.Time), key)
+	if err != nil {
+		return false, err
+	}
+	hop.Signature = sig
+	msg.Hops = append(msg.Hops, hop)
+	return true, nil
+}
+
+// Signer returns the public key which signed the hop of the message with the given digest
+func (hop *Hop) Signer(digest Digest) (*ecdsa.PublicKey, error) {
+	return crypto.SigToPub(hopHash(digest, hop.Address, hop.Time), hop.Signature)
+}
+
+func hopHash(digest Digest, address []byte, t uint64) []byte {
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(digest[:])
+	hasher.Write(address)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], t)
+	hasher.Write(b[:])
+	return hasher.Sum(nil)
+}
@@ -0,0 +1,63 @@
+package message_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+func TestHops(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := message.New(message.Flags{Raw: true})
+	msg.To = RandomArray(1, 32)
+	msg.Topic = message.NewTopic([]byte("trace"))
+	msg.Payload = RandomArray(2, 100)
+	if added, err := msg.AddHop(RandomArray(3, 32), key); err != nil || added {
+		t.Fatalf("expected no hop added to message without trace flag, got %t, %v", added, err)
+	}
+
+	msg.Flags.Trace = true
+	for i := 0; i < message.MaxHops+1; i++ {
+		added, err := msg.AddHop(RandomArray(i, 32), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != (i < message.MaxHops) {
+			t.Fatalf("hop %d: unexpected added %t", i, added)
+		}
+	}
+
+	// the hops are encoded with and without stamps
+	for _, stamps := range [][]message.Stamp{nil, {{Nonce: []byte{1}}}} {
+		msg.Stamps = stamps
+		b, err := rlp.EncodeToBytes(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded message.Message
+		if err := rlp.DecodeBytes(b, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !decoded.Flags.Trace || len(decoded.Stamps) != len(stamps) || len(decoded.Hops) != message.MaxHops {
+			t.Fatalf("unexpected decoded message %v with %d stamps and %d hops", decoded.Flags, len(decoded.Stamps), len(decoded.Hops))
+		}
+		for i, hop := range decoded.Hops {
+			if !bytes.Equal(hop.Address, RandomArray(i, 32)) {
+				t.Fatalf("hop %d: expected address %x, got %x", i, RandomArray(i, 32), hop.Address)
+			}
+			signer, err := hop.Signer(decoded.Digest())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if crypto.PubkeyToAddress(*signer) != crypto.PubkeyToAddress(key.PublicKey) {
+				t.Fatalf("hop %d: unexpected signer", i)
+			}
+		}
+	}
+}
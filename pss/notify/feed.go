@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/feed"
+	"github.com/ethersphere/swarm/storage/feed/lookup"
+)
+
+// DefaultFeedInterval is the default interval between the lookups of the latest update of a watched feed
+const DefaultFeedInterval = 30 * time.Second
+
+// FeedUpdates watches a Swarm feed and sends the data of each new update of the feed on the returned channel
+// It looks up the latest update of the feed every interval until the context is done
+// The data of the latest update found on the first lookup is sent as well
+func FeedUpdates(ctx context.Context, handler *feed.Handler, fd *feed.Feed, interval time.Duration) <-chan []byte {
+	if interval == 0 {
+		interval = DefaultFeedInterval
+	}
+	updateC := make(chan []byte)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var lastKey storage.Address
+		for {
+			_, err := handler.Lookup(ctx, feed.NewQueryLatest(fd, lookup.NoClue))
+			if err == nil {
+				key, data, err := handler.GetContent(fd)
+				if err == nil && !bytes.Equal(key, lastKey) {
+					lastKey = key
+					select {
+					case updateC <- data:
+					case <-ctx.Done():
+						return
+					}
+				}
+			} else {
+				log.Debug("feed notifier lookup failed", "feed", fd.Hex(), "err", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return updateC
+}
+
+// NewFeedNotifier is used by a notification service provider to create a notification service
+// which notifies its subscribers with the data of each new update of a Swarm feed
+// The feed is looked up every interval, DefaultFeedInterval if zero
+// Subscribers receive the data of the latest update when they subscribe
+// The returned function stops the notification service
+func (c *Controller) NewFeedNotifier(name string, threshold int, handler *feed.Handler, fd *feed.Feed, interval time.Duration) (func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	remove, err := c.NewNotifier(name, threshold, FeedUpdates(ctx, handler, fd, interval))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return func() {
+		cancel()
+		remove()
+	}, nil
+}
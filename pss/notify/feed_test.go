@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/storage/feed"
+)
+
+// TestFeedUpdates tests that the data of each new update of a feed is sent on the update channel
+func TestFeedUpdates(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "notify-feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(datadir)
+	handler, err := feed.NewTestHandler(datadir, &feed.HandlerParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+
+	privkey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := feed.NewGenericSigner(privkey)
+	topic, err := feed.NewTopic("notify", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := &feed.Feed{Topic: topic, User: signer.Address()}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	update := func(data string) {
+		request, err := handler.NewRequest(ctx, fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.SetData([]byte(data))
+		if err := request.Sign(signer); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := handler.Update(ctx, request); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	update("plugh")
+	updateC := FeedUpdates(ctx, handler.Handler, fd, 10*time.Millisecond)
+	for i, expected := range []string{"plugh", "xyzzy"} {
+		select {
+		case data := <-updateC:
+			if string(data) != expected {
+				t.Fatalf("expected update '%s', got '%s'", expected, data)
+			}
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+		if i == 0 {
+			update("xyzzy")
+		}
+	}
+	select {
+	case data := <-updateC:
+		t.Fatalf("unexpected update '%s'", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/ethersphere/swarm/log"
 	"github.com/ethersphere/swarm/pss"
 	"github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/state"
 )
 
 const (
@@ -72,9 +73,9 @@ func NewMsgFromPayload(payload []byte) (*Msg, error) {
 
 // a notifier has one sendBin entry for each address space it sends messages to
 type sendBin struct {
-	address  pss.PssAddress
-	symKeyId string
-	count    int
+	address     pss.PssAddress
+	symKeyId    string
+	subscribers map[string]bool // public key ids of the subscribers in the bin
 }
 
 // represents a single notification service
@@ -85,6 +86,7 @@ type notifier struct {
 	threshold int           // amount of address bytes used in bins
 	updateC   <-chan []byte
 	quitC     chan struct{}
+	latest    []byte // last notification, sent to new subscribers with the symmetric key
 }
 
 func (n *notifier) removeSubscription() {
@@ -96,6 +98,7 @@ type subscription struct {
 	pubkeyId string
 	address  pss.PssAddress
 	handler  func(string, []byte) error
+	dereg    func() // deregisters the handler of the notifications, nil until the symmetric key is received
 }
 
 // Controller is the interface to control, add and remove notification services and subscriptions
@@ -103,7 +106,9 @@ type Controller struct {
 	pss           *pss.Pss
 	notifiers     map[string]*notifier
 	subscriptions map[string]*subscription
+	store         state.Store // nil if the notifiers and subscriptions are not persisted
 	mu            sync.Mutex
+	quitC         chan struct{}
 }
 
 // NewController creates a new Controller object
@@ -112,11 +117,18 @@ func NewController(ps *pss.Pss) *Controller {
 		pss:           ps,
 		notifiers:     make(map[string]*notifier),
 		subscriptions: make(map[string]*subscription),
+		quitC:         make(chan struct{}),
 	}
 	ctrl.pss.Register(&controlTopic, pss.NewHandler(ctrl.Handler))
+	go ctrl.watchPeers()
 	return ctrl
 }
 
+// Close stops the resubscriptions of the controller when the node reconnects
+func (c *Controller) Close() {
+	close(c.quitC)
+}
+
 // IsActive is used to check if a notification service exists for a specified id string
 // Returns true if exists, false if not
 func (c *Controller) IsActive(name string) bool {
@@ -137,23 +149,30 @@ func (c *Controller) isActive(name string) bool {
 func (c *Controller) Subscribe(name string, pubkey *ecdsa.PublicKey, address pss.PssAddress, handler func(string, []byte) error) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	msg := NewMsg(MsgCodeStart, name, c.pss.BaseAddr())
 	c.pss.SetPeerPublicKey(pubkey, controlTopic, address)
-	pubkeyId := hexutil.Encode(c.pss.Crypto.SerializePublicKey(pubkey))
-	smsg, err := rlp.EncodeToBytes(msg)
-	if err != nil {
+	sub := &subscription{
+		pubkeyId: hexutil.Encode(c.pss.Crypto.SerializePublicKey(pubkey)),
+		address:  address,
+		handler:  handler,
+	}
+	if err := c.sendStart(name, sub); err != nil {
 		return err
 	}
-	err = c.pss.SendAsym(pubkeyId, controlTopic, smsg)
+	if prev, ok := c.subscriptions[name]; ok {
+		sub.dereg = prev.dereg
+	}
+	c.subscriptions[name] = sub
+	return c.saveSubscription(name, sub)
+}
+
+// sendStart requests the start of the notifications from the provider of the subscription
+func (c *Controller) sendStart(name string, sub *subscription) error {
+	msg := NewMsg(MsgCodeStart, name, c.pss.BaseAddr())
+	smsg, err := rlp.EncodeToBytes(msg)
 	if err != nil {
 		return err
 	}
-	c.subscriptions[name] = &subscription{
-		pubkeyId: pubkeyId,
-		address:  address,
-		handler:  handler,
-	}
-	return nil
+	return c.pss.SendAsym(sub.pubkeyId, controlTopic, smsg)
 }
 
 // Unsubscribe, perhaps unsurprisingly, undoes the effects of Subscribe
@@ -174,8 +193,11 @@ func (c *Controller) Unsubscribe(name string) error {
 	if err != nil {
 		return err
 	}
+	if sub.dereg != nil {
+		sub.dereg()
+	}
 	delete(c.subscriptions, name)
-	return nil
+	return c.deleteSubscription(name)
 }
 
 // NewNotifier is used by a notification service provider to create a new notification service
@@ -190,7 +212,7 @@ func (c *Controller) NewNotifier(name string, threshold int, updateC <-chan []by
 		return nil, fmt.Errorf("Notification service %s already exists in controller", name)
 	}
 	quitC := make(chan struct{})
-	c.notifiers[name] = &notifier{
+	ntfr := &notifier{
 		bins:      make(map[string]*sendBin),
 		topic:     message.NewTopic([]byte(name)),
 		threshold: threshold,
@@ -198,6 +220,11 @@ func (c *Controller) NewNotifier(name string, threshold int, updateC <-chan []by
 		quitC:     quitC,
 		//contentFunc: contentFunc,
 	}
+	if err := c.loadNotifier(name, ntfr); err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.notifiers[name] = ntfr
 	c.mu.Unlock()
 	go func() {
 		for {
@@ -224,7 +251,7 @@ func (c *Controller) RemoveNotifier(name string) error {
 	}
 	currentNotifier.removeSubscription()
 	delete(c.notifiers, name)
-	return nil
+	return c.deleteNotifier(name)
 }
 
 // Notify is called by a notification service provider to issue a new notification
@@ -242,6 +269,10 @@ func (c *Controller) notify(name string, data []byte) error {
 	if err != nil {
 		return err
 	}
+	c.notifiers[name].latest = data
+	if err := c.saveNotifier(name); err != nil {
+		log.Warn("Failed to save notifier", "name", name, "err", err)
+	}
 	for _, m := range c.notifiers[name].bins {
 		log.Debug("sending pss notify", "name", name, "addr", fmt.Sprintf("%x", m.address), "topic", fmt.Sprintf("%x", c.notifiers[name].topic), "data", data)
 		go func(m *sendBin) {
@@ -255,9 +286,9 @@ func (c *Controller) notify(name string, data []byte) error {
 }
 
 // check if we already have the bin
-// if we do, retrieve the symkey from it and increment the count
+// if we do, retrieve the symkey from it and add the subscriber
 // if we dont make a new symkey and a new bin entry
-func (c *Controller) addToBin(ntfr *notifier, address []byte) (symKeyId string, pssAddress pss.PssAddress, err error) {
+func (c *Controller) addToBin(ntfr *notifier, address []byte, pubkeyId string) (symKeyId string, pssAddress pss.PssAddress, err error) {
 
 	// parse the address from the message and truncate if longer than our bins threshold
 	if len(address) > ntfr.threshold {
@@ -268,7 +299,7 @@ func (c *Controller) addToBin(ntfr *notifier, address []byte) (symKeyId string,
 	hexAddress := fmt.Sprintf("%x", address)
 	currentBin, ok := ntfr.bins[hexAddress]
 	if ok {
-		currentBin.count++
+		currentBin.subscribers[pubkeyId] = true
 		symKeyId = currentBin.symKeyId
 	} else {
 		symKeyId, err = c.pss.GenerateSymmetricKey(ntfr.topic, pssAddress, false)
@@ -276,9 +307,9 @@ func (c *Controller) addToBin(ntfr *notifier, address []byte) (symKeyId string,
 			return "", nil, err
 		}
 		ntfr.bins[hexAddress] = &sendBin{
-			address:  address,
-			symKeyId: symKeyId,
-			count:    1,
+			address:     address,
+			symKeyId:    symKeyId,
+			subscribers: map[string]bool{pubkeyId: true},
 		}
 	}
 	return symKeyId, pssAddress, nil
@@ -302,10 +333,13 @@ func (c *Controller) handleStartMsg(msg *Msg, keyid string) (err error) {
 	}
 
 	// add to or open new bin
-	symKeyId, pssAddress, err := c.addToBin(currentNotifier, msg.Payload)
+	symKeyId, pssAddress, err := c.addToBin(currentNotifier, msg.Payload, keyid)
 	if err != nil {
 		return err
 	}
+	if err := c.saveNotifier(msg.namestring); err != nil {
+		return err
+	}
 
 	// add to address book for send initial notify
 	symkey, err := c.pss.GetSymmetricKey(symKeyId)
@@ -317,8 +351,8 @@ func (c *Controller) handleStartMsg(msg *Msg, keyid string) (err error) {
 		return err
 	}
 
-	// TODO this is set to zero-length byte pending decision on protocol for initial message, whether it should include message or not, and how to trigger the initial message so that current state of Swarm feed is sent upon subscription
-	notify := []byte{}
+	// the initial message is the last notification, so that the current state of a Swarm feed is sent upon subscription
+	notify := currentNotifier.latest
 	replyMsg := NewMsg(MsgCodeNotifyWithKey, msg.namestring, make([]byte, len(notify)+symKeyLength))
 	copy(replyMsg.Payload, notify)
 	copy(replyMsg.Payload[len(notify):], symkey)
@@ -330,17 +364,35 @@ func (c *Controller) handleStartMsg(msg *Msg, keyid string) (err error) {
 }
 
 func (c *Controller) handleNotifyWithKeyMsg(msg *Msg) error {
+	sub, ok := c.subscriptions[msg.namestring]
+	if !ok {
+		return fmt.Errorf("Notification received on unknown subscription '%s'", msg.namestring)
+	}
+	if len(msg.Payload) < symKeyLength {
+		return fmt.Errorf("Notification with key too short: %d", len(msg.Payload))
+	}
 	symkey := msg.Payload[len(msg.Payload)-symKeyLength:]
 	topic := message.NewTopic(msg.Name)
 
 	// \TODO keep track of and add actual address
 	updaterAddr := pss.PssAddress([]byte{})
 	c.pss.SetSymmetricKey(symkey, topic, updaterAddr, true)
-	c.pss.Register(&topic, pss.NewHandler(c.Handler))
-	return c.subscriptions[msg.namestring].handler(msg.namestring, msg.Payload[:len(msg.Payload)-symKeyLength])
+	// resubscriptions receive the key again, but the handler is registered only once
+	if sub.dereg == nil {
+		sub.dereg = c.pss.Register(&topic, pss.NewHandler(c.Handler))
+	}
+	return sub.handler(msg.namestring, msg.Payload[:len(msg.Payload)-symKeyLength])
 }
 
-func (c *Controller) handleStopMsg(msg *Msg) error {
+func (c *Controller) handleNotifyMsg(msg *Msg) error {
+	sub, ok := c.subscriptions[msg.namestring]
+	if !ok {
+		return fmt.Errorf("Notification received on unknown subscription '%s'", msg.namestring)
+	}
+	return sub.handler(msg.namestring, msg.Payload)
+}
+
+func (c *Controller) handleStopMsg(msg *Msg, keyid string) error {
 	// if name is not registered for notifications we will not react
 	currentNotifier, ok := c.notifiers[msg.namestring]
 	if !ok {
@@ -359,11 +411,11 @@ func (c *Controller) handleStopMsg(msg *Msg) error {
 	if !ok {
 		return fmt.Errorf("found no active bin for address %s", hexAddress)
 	}
-	currentBin.count--
-	if currentBin.count == 0 { // if no more clients in this bin, remove it
+	delete(currentBin.subscribers, keyid)
+	if len(currentBin.subscribers) == 0 { // if no more clients in this bin, remove it
 		delete(currentNotifier.bins, hexAddress)
 	}
-	return nil
+	return c.saveNotifier(msg.namestring)
 }
 
 // Handler is the pss topic handler to be used to process notification service messages
@@ -385,9 +437,9 @@ func (c *Controller) Handler(smsg []byte, p *p2p.Peer, asymmetric bool, keyid st
 	case MsgCodeNotifyWithKey:
 		return c.handleNotifyWithKeyMsg(msg)
 	case MsgCodeNotify:
-		return c.subscriptions[msg.namestring].handler(msg.namestring, msg.Payload)
+		return c.handleNotifyMsg(msg)
 	case MsgCodeStop:
-		return c.handleStopMsg(msg)
+		return c.handleStopMsg(msg, keyid)
 	}
 
 	return fmt.Errorf("Invalid message code: %d", msg.Code)
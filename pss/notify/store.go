@@ -0,0 +1,199 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/pss"
+	"github.com/ethersphere/swarm/state"
+)
+
+const (
+	subscriptionKeyPrefix = "notify_subscription_"
+	notifierKeyPrefix     = "notify_notifier_"
+)
+
+// the persisted subscription of a client
+type subscriptionRecord struct {
+	PubkeyId string        `json:"pubkeyid"`
+	Address  hexutil.Bytes `json:"address"`
+}
+
+// the persisted bin of a notifier
+type binRecord struct {
+	Address     hexutil.Bytes `json:"address"`
+	SymKey      hexutil.Bytes `json:"symkey"`
+	Subscribers []string      `json:"subscribers"`
+}
+
+// the persisted notifier of a notification service provider
+type notifierRecord struct {
+	Bins   []binRecord   `json:"bins"`
+	Latest hexutil.Bytes `json:"latest"`
+}
+
+// SetStore persists the notifiers and subscriptions of the controller in the store,
+// so that they survive restarts of the node.
+// It restores the subscriptions persisted before and requests their notifications again,
+// the notifications are passed to the handler.
+// The notifiers are restored with their subscribers when they are created with NewNotifier,
+// so SetStore should be called before creating them.
+func (c *Controller) SetStore(store state.Store, handler func(string, []byte) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = store
+	return store.Iterate(subscriptionKeyPrefix, func(key, value []byte) (bool, error) {
+		name := strings.TrimPrefix(string(key), subscriptionKeyPrefix)
+		var rec subscriptionRecord
+		if err := json.Unmarshal(value, &rec); err != nil {
+			return true, err
+		}
+		if _, ok := c.subscriptions[name]; ok {
+			return false, nil
+		}
+		pubkeyBytes, err := hexutil.Decode(rec.PubkeyId)
+		if err != nil {
+			return true, err
+		}
+		pubkey, err := c.pss.Crypto.UnmarshalPublicKey(pubkeyBytes)
+		if err != nil {
+			return true, err
+		}
+		if err := c.pss.SetPeerPublicKey(pubkey, controlTopic, pss.PssAddress(rec.Address)); err != nil {
+			return true, err
+		}
+		sub := &subscription{
+			pubkeyId: rec.PubkeyId,
+			address:  pss.PssAddress(rec.Address),
+			handler:  handler,
+		}
+		c.subscriptions[name] = sub
+		// the subscription is requested again when the node reconnects if this fails
+		if err := c.sendStart(name, sub); err != nil {
+			log.Warn("Failed to restore subscription", "name", name, "err", err)
+		}
+		return false, nil
+	})
+}
+
+func (c *Controller) saveSubscription(name string, sub *subscription) error {
+	if c.store == nil {
+		return nil
+	}
+	return c.store.Put(subscriptionKeyPrefix+name, &subscriptionRecord{
+		PubkeyId: sub.pubkeyId,
+		Address:  hexutil.Bytes(sub.address),
+	})
+}
+
+func (c *Controller) deleteSubscription(name string) error {
+	if c.store == nil {
+		return nil
+	}
+	return c.store.Delete(subscriptionKeyPrefix + name)
+}
+
+// saveNotifier persists the bins and the last notification of the notifier
+func (c *Controller) saveNotifier(name string) error {
+	ntfr, ok := c.notifiers[name]
+	if c.store == nil || !ok {
+		return nil
+	}
+	rec := &notifierRecord{Latest: ntfr.latest}
+	for _, bin := range ntfr.bins {
+		symkey, err := c.pss.GetSymmetricKey(bin.symKeyId)
+		if err != nil {
+			return err
+		}
+		b := binRecord{Address: hexutil.Bytes(bin.address), SymKey: symkey}
+		for pubkeyId := range bin.subscribers {
+			b.Subscribers = append(b.Subscribers, pubkeyId)
+		}
+		rec.Bins = append(rec.Bins, b)
+	}
+	return c.store.Put(notifierKeyPrefix+name, rec)
+}
+
+// loadNotifier restores the bins and the last notification of the notifier if it was persisted
+func (c *Controller) loadNotifier(name string, ntfr *notifier) error {
+	if c.store == nil {
+		return nil
+	}
+	var rec notifierRecord
+	if err := c.store.Get(notifierKeyPrefix+name, &rec); err != nil {
+		if err == state.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	ntfr.latest = rec.Latest
+	for _, b := range rec.Bins {
+		symKeyId, err := c.pss.SetSymmetricKey(b.SymKey, ntfr.topic, pss.PssAddress(b.Address), false)
+		if err != nil {
+			return err
+		}
+		bin := &sendBin{
+			address:     pss.PssAddress(b.Address),
+			symKeyId:    symKeyId,
+			subscribers: make(map[string]bool),
+		}
+		for _, pubkeyId := range b.Subscribers {
+			bin.subscribers[pubkeyId] = true
+		}
+		ntfr.bins[fmt.Sprintf("%x", []byte(b.Address))] = bin
+	}
+	return nil
+}
+
+func (c *Controller) deleteNotifier(name string) error {
+	if c.store == nil {
+		return nil
+	}
+	return c.store.Delete(notifierKeyPrefix + name)
+}
+
+// watchPeers requests the notifications of all subscriptions again
+// when the node reconnects after it lost all its peers
+func (c *Controller) watchPeers() {
+	sub := c.pss.SubscribeToPeerChanges()
+	defer sub.Unsubscribe()
+	connected := c.connected()
+	for {
+		select {
+		case <-c.quitC:
+			return
+		case _, ok := <-sub.ReceiveChannel():
+			if !ok {
+				return
+			}
+			wasConnected := connected
+			connected = c.connected()
+			if connected && !wasConnected {
+				c.resubscribe()
+			}
+		}
+	}
+}
+
+func (c *Controller) connected() (connected bool) {
+	c.pss.EachConn(nil, 255, func(_ *network.Peer, _ int) bool {
+		connected = true
+		return false
+	})
+	return connected
+}
+
+// resubscribe requests the notifications of all subscriptions again
+func (c *Controller) resubscribe() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, sub := range c.subscriptions {
+		if err := c.sendStart(name, sub); err != nil {
+			log.Warn("Failed to resubscribe", "name", name, "err", err)
+		}
+	}
+}
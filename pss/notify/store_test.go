@@ -0,0 +1,194 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/pss"
+	"github.com/ethersphere/swarm/state"
+)
+
+func newTestController(t *testing.T, privkey *ecdsa.PrivateKey) (*Controller, func()) {
+	t.Helper()
+	kad := network.NewKademlia(network.PrivateKeyToBzzKey(privkey), network.NewKadParams())
+	ps, err := pss.New(kad, pss.NewParams().WithPrivateKey(privkey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+	ctrl := NewController(ps)
+	return ctrl, func() {
+		ctrl.Close()
+		ps.Stop()
+	}
+}
+
+func encodeTestMsg(t *testing.T, code byte, name string, payload []byte) []byte {
+	t.Helper()
+	smsg, err := rlp.EncodeToBytes(NewMsg(code, name, payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return smsg
+}
+
+// TestStoreNotifier tests that the subscribers of a notifier are restored after a restart
+func TestStoreNotifier(t *testing.T) {
+	store := state.NewInmemoryStore()
+	defer store.Close()
+	providerKey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKeyId := hexutil.Encode(crypt.SerializePublicKey(&clientKey.PublicKey))
+	name := "foo.eth"
+
+	ctrl, stop := newTestController(t, providerKey)
+	if err := ctrl.SetStore(store, nil); err != nil {
+		t.Fatal(err)
+	}
+	updateC := make(chan []byte)
+	if _, err := ctrl.NewNotifier(name, 2, updateC); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctrl.Handler(encodeTestMsg(t, MsgCodeStart, name, []byte{0x12, 0x34, 0x56}), nil, true, clientKeyId); err != nil {
+		t.Fatal(err)
+	}
+	// a resubscription does not add the client again
+	if err := ctrl.Handler(encodeTestMsg(t, MsgCodeStart, name, []byte{0x12, 0x34, 0x56}), nil, true, clientKeyId); err != nil {
+		t.Fatal(err)
+	}
+	ctrl.mu.Lock()
+	bin := ctrl.notifiers[name].bins["1234"]
+	ctrl.mu.Unlock()
+	if bin == nil || len(bin.subscribers) != 1 {
+		t.Fatalf("expected one subscriber in bin, got %v", bin)
+	}
+	symkey, err := ctrl.pss.GetSymmetricKey(bin.symKeyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctrl.notify(name, []byte("plugh")); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+
+	ctrl, stop = newTestController(t, providerKey)
+	defer stop()
+	if err := ctrl.SetStore(store, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctrl.NewNotifier(name, 2, updateC); err != nil {
+		t.Fatal(err)
+	}
+	ctrl.mu.Lock()
+	ntfr := ctrl.notifiers[name]
+	bin = ntfr.bins["1234"]
+	ctrl.mu.Unlock()
+	if !bytes.Equal(ntfr.latest, []byte("plugh")) {
+		t.Fatalf("expected latest notification 'plugh', got '%s'", ntfr.latest)
+	}
+	if bin == nil || !bin.subscribers[clientKeyId] {
+		t.Fatalf("expected restored subscriber in bin, got %v", bin)
+	}
+	restoredKey, err := ctrl.pss.GetSymmetricKey(bin.symKeyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(symkey, restoredKey) {
+		t.Fatal("expected the symmetric key of the bin restored")
+	}
+
+	if err := ctrl.Handler(encodeTestMsg(t, MsgCodeStop, name, []byte{0x12, 0x34}), nil, true, clientKeyId); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctrl.RemoveNotifier(name); err != nil {
+		t.Fatal(err)
+	}
+	var rec notifierRecord
+	if err := store.Get(notifierKeyPrefix+name, &rec); err != state.ErrNotFound {
+		t.Fatalf("expected removed notifier deleted from store, got %v", err)
+	}
+}
+
+// TestStoreSubscription tests that the subscriptions of a client are restored after a restart
+func TestStoreSubscription(t *testing.T) {
+	store := state.NewInmemoryStore()
+	defer store.Close()
+	providerKey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "foo.eth"
+
+	ctrl, stop := newTestController(t, clientKey)
+	if err := ctrl.SetStore(store, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctrl.Subscribe(name, &providerKey.PublicKey, pss.PssAddress{0x12}, func(string, []byte) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+
+	ctrl, stop = newTestController(t, clientKey)
+	defer stop()
+	var notifications [][]byte
+	if err := ctrl.SetStore(store, func(s string, b []byte) error {
+		if s != name {
+			t.Fatalf("expected notification of '%s', got '%s'", name, s)
+		}
+		notifications = append(notifications, b)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ctrl.mu.Lock()
+	sub, ok := ctrl.subscriptions[name]
+	ctrl.mu.Unlock()
+	if !ok {
+		t.Fatal("expected subscription restored")
+	}
+	if sub.pubkeyId != hexutil.Encode(crypt.SerializePublicKey(&providerKey.PublicKey)) || !bytes.Equal(sub.address, pss.PssAddress{0x12}) {
+		t.Fatalf("unexpected restored subscription %v", sub)
+	}
+
+	// the notifications of the restored subscription are passed to the handler
+	payload := append([]byte("plugh"), make([]byte, symKeyLength)...)
+	for i := 0; i < 2; i++ {
+		if err := ctrl.Handler(encodeTestMsg(t, MsgCodeNotifyWithKey, name, payload), nil, true, sub.pubkeyId); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ctrl.Handler(encodeTestMsg(t, MsgCodeNotify, name, []byte("xyzzy")), nil, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 3 || string(notifications[0]) != "plugh" || string(notifications[2]) != "xyzzy" {
+		t.Fatalf("unexpected notifications %q", notifications)
+	}
+	if err := ctrl.Handler(encodeTestMsg(t, MsgCodeNotify, "bar.eth", []byte("xyzzy")), nil, false, ""); err == nil {
+		t.Fatal("expected error on notification of unknown subscription")
+	}
+
+	if err := ctrl.Unsubscribe(name); err != nil {
+		t.Fatal(err)
+	}
+	var rec subscriptionRecord
+	if err := store.Get(subscriptionKeyPrefix+name, &rec); err != state.ErrNotFound {
+		t.Fatalf("expected removed subscription deleted from store, got %v", err)
+	}
+}
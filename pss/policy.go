@@ -0,0 +1,346 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/pss/message"
+	"golang.org/x/time/rate"
+)
+
+var errInvalidRate = errors.New("invalid rate")
+
+// TopicPolicy is the policy of the node for the messages on a topic
+type TopicPolicy struct {
+	Forward bool    `json:"forward"` // forward the messages on the topic
+	Deliver bool    `json:"deliver"` // deliver the messages on the topic to the handlers of the node
+	Rate    float64 `json:"rate"`    // maximum number of messages on the topic forwarded per second, zero for no limit
+	Burst   int     `json:"burst"`   // number of messages forwarded above the rate, defaults to the rate
+}
+
+// PolicyParams are the parameters of the topic policies of the node
+type PolicyParams struct {
+	Default   *TopicPolicy                  // policy of the topics without one, nil forwards and delivers them
+	Topics    map[message.Topic]TopicPolicy // policies of the topics
+	PeerRate  float64                       // maximum number of messages received from a peer per second, zero for no limit
+	PeerBurst int                           // number of messages received from a peer above the rate, defaults to the rate
+}
+
+// TopicStats counts the messages on a topic with a policy
+type TopicStats struct {
+	Received  uint64 `json:"received"`  // messages received from peers
+	Forwarded uint64 `json:"forwarded"` // messages forwarded to peers
+	Delivered uint64 `json:"delivered"` // messages delivered to the handlers of the node
+	Dropped   uint64 `json:"dropped"`   // messages dropped by the policy
+}
+
+// topicPolicy is a topic policy with its rate limiter and counters
+type topicPolicy struct {
+	TopicPolicy
+	limiter *rate.Limiter // nil if the forwarded messages are not limited
+	stats   TopicStats
+	name    string // name of the metrics of the topic
+}
+
+// policy decides which topics the node forwards and delivers
+// and limits the rate of the messages forwarded on a topic and received from a peer
+//
+// the internal topics of pss, like receipts, mailbox and trace, and the topics of the
+// PubSub, like push-sync, are not subject to the default policy so that denying all
+// other topics does not break them, they only follow a policy set for the topic
+type policy struct {
+	mu        sync.RWMutex
+	def       *topicPolicy // nil if the topics without a policy are forwarded and delivered
+	topics    map[message.Topic]*topicPolicy
+	internal  map[message.Topic]bool
+	peerRate  float64
+	peerBurst int
+	peers     map[enode.ID]*rate.Limiter
+}
+
+// internalTopics are the topics of the pss services, allowed regardless of the default policy
+var internalTopics = []message.Topic{receiptTopic, mailboxTopic, traceTopic, groupTopic, ratchetTopic, streamTopic}
+
+func newPolicy(params *PolicyParams) (*policy, error) {
+	pol := &policy{
+		topics:   make(map[message.Topic]*topicPolicy),
+		internal: make(map[message.Topic]bool),
+		peers:    make(map[enode.ID]*rate.Limiter),
+	}
+	for _, topic := range internalTopics {
+		pol.internal[topic] = true
+	}
+	if params == nil {
+		return pol, nil
+	}
+	if params.Default != nil {
+		if err := pol.setDefault(*params.Default); err != nil {
+			return nil, err
+		}
+	}
+	for topic, tp := range params.Topics {
+		if err := pol.setTopic(topic, tp); err != nil {
+			return nil, err
+		}
+	}
+	if err := pol.setPeerRate(params.PeerRate, params.PeerBurst); err != nil {
+		return nil, err
+	}
+	return pol, nil
+}
+
+func newTopicPolicy(name string, tp TopicPolicy) (*topicPolicy, error) {
+	limiter, err := newLimiter(tp.Rate, tp.Burst)
+	if err != nil {
+		return nil, err
+	}
+	return &topicPolicy{TopicPolicy: tp, limiter: limiter, name: name}, nil
+}
+
+// newLimiter returns a rate limiter, nil if the rate is zero
+func newLimiter(r float64, burst int) (*rate.Limiter, error) {
+	if r < 0 || burst < 0 || math.IsNaN(r) || math.IsInf(r, 0) {
+		return nil, errInvalidRate
+	}
+	if r == 0 {
+		return nil, nil
+	}
+	if burst == 0 {
+		burst = int(math.Ceil(r))
+	}
+	return rate.NewLimiter(rate.Limit(r), burst), nil
+}
+
+func (pol *policy) setDefault(tp TopicPolicy) error {
+	def, err := newTopicPolicy("default", tp)
+	if err != nil {
+		return err
+	}
+	pol.mu.Lock()
+	defer pol.mu.Unlock()
+	pol.def = def
+	return nil
+}
+
+func (pol *policy) removeDefault() {
+	pol.mu.Lock()
+	defer pol.mu.Unlock()
+	pol.def = nil
+}
+
+func (pol *policy) setTopic(topic message.Topic, tp TopicPolicy) error {
+	next, err := newTopicPolicy(fmt.Sprintf("%x", topic[:]), tp)
+	if err != nil {
+		return err
+	}
+	pol.mu.Lock()
+	defer pol.mu.Unlock()
+	if prev, ok := pol.topics[topic]; ok {
+		next.stats = prev.loadStats()
+	}
+	pol.topics[topic] = next
+	return nil
+}
+
+func (pol *policy) removeTopic(topic message.Topic) {
+	pol.mu.Lock()
+	defer pol.mu.Unlock()
+	delete(pol.topics, topic)
+}
+
+func (pol *policy) setPeerRate(r float64, burst int) error {
+	if _, err := newLimiter(r, burst); err != nil {
+		return err
+	}
+	pol.mu.Lock()
+	defer pol.mu.Unlock()
+	pol.peerRate = r
+	pol.peerBurst = burst
+	pol.peers = make(map[enode.ID]*rate.Limiter)
+	return nil
+}
+
+// get returns the policy of the topic, nil if the topic is forwarded and delivered without limits
+func (pol *policy) get(topic message.Topic) *topicPolicy {
+	pol.mu.RLock()
+	defer pol.mu.RUnlock()
+	if tp, ok := pol.topics[topic]; ok {
+		return tp
+	}
+	if pol.internal[topic] {
+		return nil
+	}
+	return pol.def
+}
+
+// addInternal exempts the topic from the default policy
+func (pol *policy) addInternal(topic message.Topic) {
+	pol.mu.Lock()
+	defer pol.mu.Unlock()
+	pol.internal[topic] = true
+}
+
+// received counts a message received from a peer and returns whether it may be forwarded and delivered
+func (pol *policy) received(topic message.Topic) (forward bool, deliver bool) {
+	tp := pol.get(topic)
+	if tp == nil {
+		return true, true
+	}
+	tp.count(&tp.stats.Received, "received")
+	if !tp.Forward && !tp.Deliver {
+		tp.count(&tp.stats.Dropped, "dropped")
+	}
+	return tp.Forward, tp.Deliver
+}
+
+// forward returns whether a message on the topic may be forwarded within the rate limit of the topic
+func (pol *policy) forward(topic message.Topic) bool {
+	tp := pol.get(topic)
+	if tp == nil {
+		return true
+	}
+	if !tp.Forward || (tp.limiter != nil && !tp.limiter.Allow()) {
+		tp.count(&tp.stats.Dropped, "dropped")
+		return false
+	}
+	tp.count(&tp.stats.Forwarded, "forwarded")
+	return true
+}
+
+// delivered counts a message delivered to the handlers of the node
+func (pol *policy) delivered(topic message.Topic) {
+	if tp := pol.get(topic); tp != nil {
+		tp.count(&tp.stats.Delivered, "delivered")
+	}
+}
+
+// deliver returns whether a message on the topic wrapped in a message on another topic,
+// like the messages with receipts, may be delivered to the handlers of the node
+func (pol *policy) deliver(topic message.Topic) bool {
+	tp := pol.get(topic)
+	if tp == nil {
+		return true
+	}
+	if !tp.Deliver {
+		tp.count(&tp.stats.Dropped, "dropped")
+		return false
+	}
+	tp.count(&tp.stats.Delivered, "delivered")
+	return true
+}
+
+// allowPeer returns whether a message from the peer is within the rate limit of the peers
+func (pol *policy) allowPeer(id enode.ID) bool {
+	pol.mu.Lock()
+	defer pol.mu.Unlock()
+	if pol.peerRate == 0 {
+		return true
+	}
+	limiter, ok := pol.peers[id]
+	if !ok {
+		limiter, _ = newLimiter(pol.peerRate, pol.peerBurst)
+		pol.peers[id] = limiter
+	}
+	return limiter.Allow()
+}
+
+func (pol *policy) removePeer(id enode.ID) {
+	pol.mu.Lock()
+	defer pol.mu.Unlock()
+	delete(pol.peers, id)
+}
+
+// policies returns the policies of the topics
+func (pol *policy) policies() map[message.Topic]TopicPolicy {
+	pol.mu.RLock()
+	defer pol.mu.RUnlock()
+	policies := make(map[message.Topic]TopicPolicy, len(pol.topics))
+	for topic, tp := range pol.topics {
+		policies[topic] = tp.TopicPolicy
+	}
+	return policies
+}
+
+// stats returns the counters of the topics with a policy
+func (pol *policy) stats() map[message.Topic]TopicStats {
+	pol.mu.RLock()
+	defer pol.mu.RUnlock()
+	stats := make(map[message.Topic]TopicStats, len(pol.topics))
+	for topic, tp := range pol.topics {
+		stats[topic] = tp.loadStats()
+	}
+	return stats
+}
+
+// count increments a counter of the topic and its metric,
+// the messages on topics without their own policy are counted under the default policy
+func (tp *topicPolicy) count(counter *uint64, name string) {
+	atomic.AddUint64(counter, 1)
+	metrics.GetOrRegisterCounter(fmt.Sprintf("pss/policy/%s/%s", tp.name, name), nil).Inc(1)
+}
+
+func (tp *topicPolicy) loadStats() TopicStats {
+	return TopicStats{
+		Received:  atomic.LoadUint64(&tp.stats.Received),
+		Forwarded: atomic.LoadUint64(&tp.stats.Forwarded),
+		Delivered: atomic.LoadUint64(&tp.stats.Delivered),
+		Dropped:   atomic.LoadUint64(&tp.stats.Dropped),
+	}
+}
+
+// SetTopicPolicy sets the policy of the node for the messages on the topic
+func (p *Pss) SetTopicPolicy(topic message.Topic, tp TopicPolicy) error {
+	return p.policy.setTopic(topic, tp)
+}
+
+// RemoveTopicPolicy removes the policy of the topic, its messages are subject to the default policy
+func (p *Pss) RemoveTopicPolicy(topic message.Topic) {
+	p.policy.removeTopic(topic)
+}
+
+// SetDefaultPolicy sets the policy of the topics without one,
+// nil forwards and delivers their messages without limits
+// the internal topics are not subject to the default policy
+func (p *Pss) SetDefaultPolicy(tp *TopicPolicy) error {
+	if tp == nil {
+		p.policy.removeDefault()
+		return nil
+	}
+	return p.policy.setDefault(*tp)
+}
+
+// SetPeerRate sets the maximum number of messages per second received from a peer, zero for no limit
+func (p *Pss) SetPeerRate(r float64, burst int) error {
+	return p.policy.setPeerRate(r, burst)
+}
+
+// TopicPolicies returns the policies of the topics
+func (p *Pss) TopicPolicies() map[message.Topic]TopicPolicy {
+	return p.policy.policies()
+}
+
+// TopicStats returns the message counters of the topics with a policy
+func (p *Pss) TopicStats() map[message.Topic]TopicStats {
+	return p.policy.stats()
+}
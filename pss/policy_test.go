@@ -0,0 +1,187 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/testutil"
+)
+
+// TestTopicPolicy tests that the messages are forwarded and delivered according to the policies of their topics
+func TestTopicPolicy(t *testing.T) {
+	privkey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := newTestPss(privkey, nil, nil)
+	defer ps.Stop()
+
+	allowed := message.NewTopic([]byte("allowed"))
+	denied := message.NewTopic([]byte("denied"))
+	relayed := message.NewTopic([]byte("relayed"))
+	limited := message.NewTopic([]byte("limited"))
+	if err := ps.SetDefaultPolicy(&TopicPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	for topic, policy := range map[message.Topic]TopicPolicy{
+		allowed: {Forward: true, Deliver: true},
+		relayed: {Forward: true},
+		limited: {Forward: true, Rate: 1, Burst: 2},
+	} {
+		if err := ps.SetTopicPolicy(topic, policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ps.SetTopicPolicy(allowed, TopicPolicy{Rate: -1}); err != errInvalidRate {
+		t.Fatalf("expected error %v, got %v", errInvalidRate, err)
+	}
+
+	delivered := make(map[message.Topic]int)
+	for _, topic := range []message.Topic{allowed, denied, relayed} {
+		topic := topic
+		ps.Register(&topic, NewHandler(func(msg []byte, _ *p2p.Peer, _ bool, _ string) error {
+			delivered[topic]++
+			return nil
+		}).WithRaw())
+	}
+
+	n := 0
+	handle := func(topic message.Topic, to []byte) {
+		n++
+		msg := message.New(message.Flags{Raw: true})
+		msg.To = to
+		msg.Expire = uint32(time.Now().Add(time.Minute).Unix())
+		msg.Topic = topic
+		msg.Payload = testutil.RandomBytes(n, 32)
+		if err := ps.handlePssMsg(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, topic := range []message.Topic{allowed, denied, relayed} {
+		handle(topic, ps.BaseAddr())
+	}
+	for i := 0; i < 3; i++ {
+		handle(limited, testutil.RandomBytes(100+i, addressLength))
+	}
+
+	if delivered[allowed] != 1 || delivered[denied] != 0 || delivered[relayed] != 0 {
+		t.Fatalf("unexpected deliveries %v", delivered)
+	}
+	stats := ps.TopicStats()
+	expected := map[message.Topic]TopicStats{
+		allowed: {Received: 1, Delivered: 1},
+		relayed: {Received: 1, Forwarded: 1},
+		limited: {Received: 3, Forwarded: 2, Dropped: 1},
+	}
+	for topic, s := range expected {
+		if stats[topic] != s {
+			t.Fatalf("topic %x: expected stats %+v, got %+v", topic, s, stats[topic])
+		}
+	}
+	if s := ps.policy.def.loadStats(); s.Received != 1 || s.Dropped != 1 {
+		t.Fatalf("unexpected stats of the default policy %+v", s)
+	}
+
+	// without policies all topics are forwarded and delivered
+	ps.RemoveTopicPolicy(allowed)
+	if err := ps.SetDefaultPolicy(nil); err != nil {
+		t.Fatal(err)
+	}
+	handle(denied, ps.BaseAddr())
+	if delivered[denied] != 1 {
+		t.Fatalf("expected message delivered without policy, got %v", delivered)
+	}
+	if len(ps.TopicPolicies()) != 2 {
+		t.Fatalf("expected 2 topic policies, got %v", ps.TopicPolicies())
+	}
+}
+
+// TestPeerRate tests that the messages received from each peer are limited
+func TestPeerRate(t *testing.T) {
+	pol, err := newPolicy(&PolicyParams{PeerRate: 1, PeerBurst: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := enode.ID{1}, enode.ID{2}
+	for i := 0; i < 2; i++ {
+		if !pol.allowPeer(a) {
+			t.Fatalf("expected message %d allowed", i)
+		}
+	}
+	if pol.allowPeer(a) {
+		t.Fatal("expected message above the peer rate dropped")
+	}
+	if !pol.allowPeer(b) {
+		t.Fatal("expected message from another peer allowed")
+	}
+	pol.removePeer(a)
+	if !pol.allowPeer(a) {
+		t.Fatal("expected message allowed after the peer reconnected")
+	}
+
+	if _, err := newPolicy(&PolicyParams{PeerRate: -1}); err != errInvalidRate {
+		t.Fatalf("expected error %v, got %v", errInvalidRate, err)
+	}
+}
+
+// TestTopicPolicyInternal tests that the internal topics are not subject to the default policy
+// and that the policies are only set over the non-public api
+func TestTopicPolicyInternal(t *testing.T) {
+	privkey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := newTestPss(privkey, nil, nil)
+	defer ps.Stop()
+	if err := ps.SetDefaultPolicy(&TopicPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+
+	pubsub := NewPubSub(ps, time.Minute)
+	defer pubsub.Register("pubsub-test", false, func([]byte, *p2p.Peer) error { return nil })()
+	for _, topic := range append(internalTopics, message.NewTopic([]byte("pubsub-test"))) {
+		if forward, deliver := ps.policy.received(topic); !forward || !deliver {
+			t.Fatalf("topic %x: expected internal topic forwarded and delivered", topic)
+		}
+	}
+	if forward, deliver := ps.policy.received(message.NewTopic([]byte("other"))); forward || deliver {
+		t.Fatal("expected other topics denied by the default policy")
+	}
+	// a policy of an internal topic applies
+	if err := ps.SetTopicPolicy(receiptTopic, TopicPolicy{Forward: true}); err != nil {
+		t.Fatal(err)
+	}
+	if ps.policy.deliver(receiptTopic) {
+		t.Fatal("expected the policy of the internal topic to deny delivery")
+	}
+
+	for _, api := range ps.APIs() {
+		if _, ok := api.Service.(*AdminAPI); ok && (api.Public || api.Namespace == "pss") {
+			t.Fatalf("expected the admin api served on a non-public namespace, got %s public %v", api.Namespace, api.Public)
+		}
+		if _, ok := api.Service.(*API); ok && api.Namespace != "pss" {
+			t.Fatalf("unexpected namespace %s", api.Namespace)
+		}
+	}
+}
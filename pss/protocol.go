@@ -21,6 +21,7 @@ package pss
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
@@ -33,6 +34,8 @@ import (
 
 const (
 	IsActiveProtocol = true
+
+	protocolMsgOverhead = 32 // maximum size of the encoding of a ProtocolMsg without its payload
 )
 
 // Convenience wrapper for devp2p protocol messages for transport over pss
@@ -116,6 +119,66 @@ func (prw *PssReadWriter) injectMsg(msg p2p.Msg) error {
 	return nil
 }
 
+// StreamReadWriter runs devp2p protocols over a reliable stream, such as a pss Stream
+//
+// Implements p2p.MsgReadWriter
+type StreamReadWriter struct {
+	rw         io.ReadWriter
+	stream     *rlp.Stream
+	maxMsgSize uint32
+	mu         sync.Mutex
+}
+
+// NewStreamReadWriter returns a StreamReadWriter on the stream,
+// reading messages up to the maximum size
+func NewStreamReadWriter(rw io.ReadWriter, maxMsgSize uint32) *StreamReadWriter {
+	return &StreamReadWriter{
+		rw:         rw,
+		stream:     rlp.NewStream(rw, 0),
+		maxMsgSize: maxMsgSize,
+	}
+}
+
+// Implements p2p.MsgReader
+func (srw *StreamReadWriter) ReadMsg() (p2p.Msg, error) {
+	if _, size, err := srw.stream.Kind(); err != nil {
+		return p2p.Msg{}, err
+	} else if size > uint64(srw.maxMsgSize)+protocolMsgOverhead {
+		return p2p.Msg{}, fmt.Errorf("pss stream message too large: %d bytes", size)
+	}
+	var payload ProtocolMsg
+	if err := srw.stream.Decode(&payload); err != nil {
+		return p2p.Msg{}, err
+	}
+	return p2p.Msg{
+		Code:       payload.Code,
+		Size:       uint32(len(payload.Payload)),
+		ReceivedAt: time.Now(),
+		Payload:    bytes.NewReader(payload.Payload),
+	}, nil
+}
+
+// Implements p2p.MsgWriter
+func (srw *StreamReadWriter) WriteMsg(msg p2p.Msg) error {
+	rlpdata := make([]byte, msg.Size)
+	if _, err := io.ReadFull(msg.Payload, rlpdata); err != nil {
+		return err
+	}
+	pmsg, err := rlp.EncodeToBytes(ProtocolMsg{
+		Code:    msg.Code,
+		Size:    msg.Size,
+		Payload: rlpdata,
+	})
+	if err != nil {
+		return err
+	}
+	// messages are written whole
+	srw.mu.Lock()
+	defer srw.mu.Unlock()
+	_, err = srw.rw.Write(pmsg)
+	return err
+}
+
 // Convenience object for emulation devp2p over pss
 type Protocol struct {
 	*Pss
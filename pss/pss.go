@@ -52,7 +52,7 @@ const (
 	defaultCleanInterval       = time.Minute * 10
 	defaultOutboxCapacity      = 50
 	protocolName               = "pss"
-	protocolVersion            = 2
+	protocolVersion            = 3
 	CapabilityID               = capability.CapabilityID(1)
 	capabilitiesSend           = 0 // node sends pss messages
 	capabilitiesReceive        = 1 // node processes pss messages
@@ -69,9 +69,16 @@ var spec = &protocols.Spec{
 	Name:       protocolName,
 	Version:    protocolVersion,
 	MaxMsgSize: defaultMaxMsgSize,
+	Priority:   protocols.PriorityMedium,
 	Messages: []interface{}{
 		message.Message{},
 	},
+	// version 2 peers do not know the stamps and hops of the message
+	OldVersions: map[uint][]interface{}{
+		2: {
+			message.Message{},
+		},
+	},
 }
 
 // abstraction to enable access to p2p.protocols.Peer.Send
@@ -98,6 +105,10 @@ type Params struct {
 	SymKeyCacheCapacity int
 	AllowRaw            bool // If true, enables sending and receiving messages without builtin pss encryption
 	AllowForward        bool
+	Mailbox             bool          // If true, keeps the messages of offline recipients in the neighbourhood, see Mailbox
+	Ratchet             bool          // If true, opens forward secret sessions with the registered peers, see Ratchet
+	Difficulty          int           // Minimum proof of work difficulty of the forwarded messages, see SetDifficulty
+	Policy              *PolicyParams `toml:"-"` // Topics forwarded and delivered by the node and their rate limits, nil for all topics
 }
 
 // Sane defaults for Pss
@@ -130,9 +141,9 @@ type Pss struct {
 	peers   map[string]*protocols.Peer // keep track of all peers sitting on the pssmsg routing layer
 	peersMu sync.RWMutex
 
-	msgTTL    time.Duration
-	capstring string
-	outbox    *outbox.Outbox
+	msgTTL     time.Duration
+	capstrings map[string]bool // capabilities of the supported protocol versions
+	outbox     *outbox.Outbox
 
 	// message handling
 	handlers           map[message.Topic]map[*handler]bool // topic and version based pss payload handlers. See pss.Handle()
@@ -140,6 +151,19 @@ type Pss struct {
 	topicHandlerCaps   map[message.Topic]*handlerCaps // caches capabilities of each topic's handlers
 	topicHandlerCapsMu sync.RWMutex
 
+	// bandwidth
+	rateLimiter *protocols.RateLimiter // shared with the other protocols of the node, nil if not rate limited
+
+	// store-and-forward for offline recipients, nil if not enabled
+	mailbox *Mailbox
+
+	// spam protection
+	stamps *stamps
+	policy *policy
+
+	// trace probes waiting for their replies
+	traces *traces
+
 	// process
 	quitC chan struct{}
 }
@@ -156,12 +180,20 @@ func New(k *network.Kademlia, params *Params) (*Pss, error) {
 	if params.privateKey == nil {
 		return nil, errors.New("missing private key for pss")
 	}
+	if params.Difficulty < 0 || params.Difficulty > message.MaxDifficulty {
+		return nil, message.ErrInvalidDifficulty
+	}
+
+	pol, err := newPolicy(params.Policy)
+	if err != nil {
+		return nil, err
+	}
 
 	clock := clock.Realtime() //TODO: Clock should be injected by Params so it can be mocked.
 
-	c := p2p.Cap{
-		Name:    protocolName,
-		Version: protocolVersion,
+	capstrings := make(map[string]bool)
+	for _, v := range spec.Versions() {
+		capstrings[p2p.Cap{Name: v.Name, Version: v.Version}.String()] = true
 	}
 	ps := &Pss{
 		Kademlia: k,
@@ -171,12 +203,16 @@ func New(k *network.Kademlia, params *Params) (*Pss, error) {
 		privateKey: params.privateKey,
 		quitC:      make(chan struct{}),
 
-		peers:     make(map[string]*protocols.Peer),
-		msgTTL:    params.MsgTTL,
-		capstring: c.String(),
+		peers:      make(map[string]*protocols.Peer),
+		msgTTL:     params.MsgTTL,
+		capstrings: capstrings,
 
 		handlers:         make(map[message.Topic]map[*handler]bool),
 		topicHandlerCaps: make(map[message.Topic]*handlerCaps),
+
+		stamps: newStamps(params.Difficulty),
+		policy: pol,
+		traces: newTraces(),
 	}
 	ps.forwardCache = ttlset.New(&ttlset.Config{
 		EntryTTL: params.CacheTTL,
@@ -245,19 +281,28 @@ func (p *Pss) Stop() error {
 	return nil
 }
 
+// SetRateLimiter sets the rate limiter the messages sent to peers wait on
+// it must be set before the node is started
+func (p *Pss) SetRateLimiter(l *protocols.RateLimiter) {
+	p.rateLimiter = l
+}
+
 func (p *Pss) Protocols() []p2p.Protocol {
-	return []p2p.Protocol{
-		{
-			Name:    spec.Name,
-			Version: spec.Version,
-			Length:  spec.Length(),
-			Run:     p.Run,
-		},
-	}
+	return spec.Protocols(func(s *protocols.Spec) func(*p2p.Peer, p2p.MsgReadWriter) error {
+		return func(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
+			return p.run(peer, rw, s)
+		}
+	})
 }
 
 func (p *Pss) Run(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
+	return p.run(peer, rw, spec)
+}
+
+// run runs the protocol with the peer using the spec of the negotiated version
+func (p *Pss) run(peer *p2p.Peer, rw p2p.MsgReadWriter, spec *protocols.Spec) error {
 	pp := protocols.NewPeer(peer, rw, spec)
+	pp.SetRateLimiter(p.rateLimiter)
 	p.addPeer(pp)
 	defer p.removePeer(pp)
 	handle := func(ctx context.Context, msg interface{}) error {
@@ -285,6 +330,7 @@ func (p *Pss) removePeer(peer *protocols.Peer) {
 	defer p.peersMu.Unlock()
 	log.Trace("removing peer", "id", peer.Peer.Info().ID)
 	delete(p.peers, peer.Peer.Info().ID)
+	p.policy.removePeer(peer.ID())
 }
 
 func (p *Pss) APIs() []rpc.API {
@@ -295,6 +341,12 @@ func (p *Pss) APIs() []rpc.API {
 			Service:   NewAPI(p),
 			Public:    true,
 		},
+		{
+			Namespace: "pssadmin",
+			Version:   "1.0",
+			Service:   NewAdminAPI(p),
+			Public:    false,
+		},
 	}
 	apis = append(apis, p.auxAPIs...)
 	return apis
@@ -428,6 +480,11 @@ func (p *Pss) handle(ctx context.Context, peer *protocols.Peer, msg interface{})
 	if !ok {
 		return fmt.Errorf("invalid message type %s", msg)
 	}
+	if peer != nil && !p.policy.allowPeer(peer.ID()) {
+		metrics.GetOrRegisterCounter("pss/policy/peer/dropped", nil).Inc(1)
+		log.Trace("pss filtered message above the peer rate", "peer", peer.ID())
+		return nil
+	}
 	return p.handlePssMsg(ctx, pssmsg)
 }
 
@@ -448,9 +505,19 @@ func (p *Pss) handlePssMsg(ctx context.Context, pssmsg *message.Message) error {
 		log.Trace("pss relay block-cache match (process)", "from", hex.EncodeToString(p.Kademlia.BaseAddr()), "to", (hex.EncodeToString(pssmsg.To)))
 		return nil
 	}
+	if err := p.checkStamp(pssmsg); err != nil {
+		metrics.GetOrRegisterCounter("pss/stamp/reject", nil).Inc(1)
+		log.Trace("pss filtered message without stamp", "topic", label(pssmsg.Topic[:]), "err", err)
+		return nil
+	}
 	p.addFwdCache(pssmsg)
 
 	psstopic := pssmsg.Topic
+	forward, deliver := p.policy.received(psstopic)
+	if !forward && !deliver {
+		log.Trace("pss filtered message denied by topic policy", "topic", label(psstopic[:]))
+		return nil
+	}
 
 	// raw is simplest handler contingency to check, so check that first
 	var isRaw bool
@@ -470,17 +537,19 @@ func (p *Pss) handlePssMsg(ctx context.Context, pssmsg *message.Message) error {
 	if prox, ok := p.isProxTopicHandlerCaps(psstopic); ok {
 		isProx = prox
 	}
-	isRecipient := p.isSelfPossibleRecipient(pssmsg, isProx)
+	isRecipient := deliver && p.isSelfPossibleRecipient(pssmsg, isProx)
 	if !isRecipient {
 		log.Trace("pss msg forwarding ===>", "pss", hex.EncodeToString(p.BaseAddr()), "prox", isProx)
-		p.enqueue(pssmsg)
+		p.relay(pssmsg)
 		return nil
 	}
 
 	log.Trace("pss msg processing <===", "pss", hex.EncodeToString(p.BaseAddr()), "prox", isProx, "raw", isRaw, "topic", label(pssmsg.Topic[:]))
 	if err := p.process(pssmsg, isRaw, isProx); err != nil {
-		p.enqueue(pssmsg)
+		p.relay(pssmsg)
+		return nil
 	}
+	p.policy.delivered(psstopic)
 	return nil
 }
 
@@ -516,7 +585,13 @@ func (p *Pss) process(pssmsg *message.Message, raw bool, prox bool) error {
 	}
 
 	if len(pssmsg.To) < addressLength || prox {
-		p.enqueue(pssmsg)
+		p.relay(pssmsg)
+	}
+	if p.mailbox != nil && !raw && p.isSelfRecipient(pssmsg) {
+		p.mailbox.received(pssmsg)
+	}
+	if raw && psstopic == traceTopic {
+		return p.handleTrace(pssmsg)
 	}
 	p.executeHandlers(psstopic, payload, from, raw, prox, asymmetric, keyid)
 	return nil
@@ -590,6 +665,19 @@ func (p *Pss) enqueue(msg *message.Message) {
 	p.outbox.Enqueue(outboxMsg)
 }
 
+// relay forwards a message received from a peer if the topic policy allows it,
+// the node appends its hop to traced messages
+func (p *Pss) relay(msg *message.Message) {
+	if !p.policy.forward(msg.Topic) {
+		log.Trace("pss filtered forwarding denied by topic policy", "topic", label(msg.Topic[:]))
+		return
+	}
+	if msg.Flags.Trace {
+		p.addHop(msg)
+	}
+	p.enqueue(msg)
+}
+
 // Send a raw message (any encryption is responsibility of calling client)
 //
 // Will fail if raw messages are disallowed
@@ -609,6 +697,9 @@ func (p *Pss) SendRaw(address PssAddress, topic message.Topic, msg []byte, messa
 	pssMsg.Expire = uint32(time.Now().Add(messageTTL).Unix())
 	pssMsg.Payload = msg
 	pssMsg.Topic = topic
+	if err := p.stamp(context.Background(), pssMsg); err != nil {
+		return err
+	}
 
 	p.addFwdCache(pssMsg)
 
@@ -645,6 +736,20 @@ func (p *Pss) SendAsym(pubkeyid string, topic message.Topic, msg []byte) error {
 	return p.send(psp.address, topic, msg, true, common.FromHex(pubkeyid))
 }
 
+// SendAsymTo sends a message using asymmetric encryption to the given address
+//
+// Unlike SendAsym, the public key does not need to be linked to the topic,
+// so that clients sharing the node do not depend on each others' keys
+func (p *Pss) SendAsymTo(pubkey []byte, address PssAddress, topic message.Topic, msg []byte) error {
+	if err := validateAddress(address); err != nil {
+		return err
+	}
+	if _, err := p.Crypto.UnmarshalPublicKey(pubkey); err != nil {
+		return fmt.Errorf("Cannot unmarshal pubkey: %x", pubkey)
+	}
+	return p.send(address, topic, msg, true, pubkey)
+}
+
 // Send is payload agnostic, and will accept any byte slice as payload
 // It generates an envelope for the specified recipient and topic,
 // and wraps the message payload in it.
@@ -683,8 +788,14 @@ func (p *Pss) send(to []byte, topic message.Topic, msg []byte, asymmetric bool,
 	pssMsg.Expire = uint32(time.Now().Add(p.msgTTL).Unix())
 	pssMsg.Payload = envelope
 	pssMsg.Topic = topic
+	if err := p.stamp(context.Background(), pssMsg); err != nil {
+		return err
+	}
 
 	p.enqueue(pssMsg)
+	if p.mailbox != nil {
+		p.mailbox.deposit(pssMsg)
+	}
 	return nil
 }
 
@@ -698,7 +809,7 @@ func sendMsg(p *Pss, sp *network.Peer, msg *message.Message) bool {
 	var isPssEnabled bool
 	info := sp.Info()
 	for _, capability := range info.Caps {
-		if capability == p.capstring {
+		if p.capstrings[capability] {
 			isPssEnabled = true
 			break
 		}
@@ -715,6 +826,13 @@ func sendMsg(p *Pss, sp *network.Peer, msg *message.Message) bool {
 		return false
 	}
 
+	// version 2 peers would fail to decode and drop the connection
+	if pp.Version() < 3 && (msg.Stamps != nil || msg.Hops != nil) {
+		m := *msg
+		m.Stamps = nil
+		m.Hops = nil
+		msg = &m
+	}
 	err := pp.Send(context.TODO(), msg)
 	if err != nil {
 		metrics.GetOrRegisterCounter("pss/pp/send/error", nil).Inc(1)
@@ -769,6 +887,10 @@ func (p *Pss) forward(msg *message.Message) error {
 			return false
 		}
 		for _, lbPeer := range bin.LBPeers {
+			// light nodes do not forward messages, only send to them if they can be the recipient
+			if bin.ProximityOrder < luminosityRadius && network.IsLightNode(lbPeer.Peer.Capabilities) {
+				continue
+			}
 			if sendFunc(p, lbPeer.Peer, msg) {
 				lbPeer.AddUseCount()
 				sent++
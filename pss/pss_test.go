@@ -529,6 +529,65 @@ func TestPeerCapabilityMismatch(t *testing.T) {
 
 }
 
+// TestOldVersionPeer tests that messages are sent to peers running version 2 of the protocol
+// without the stamps and hops they would fail to decode
+func TestOldVersionPeer(t *testing.T) {
+	privkey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kad := network.NewKademlia(network.RandomBzzAddr().Over(), network.NewKadParams())
+	ps := newTestPss(privkey, kad, nil)
+	defer ps.Stop()
+
+	oldSpec, ok := spec.ForVersion(2)
+	if !ok {
+		t.Fatal("expected version 2 of the protocol to be supported")
+	}
+	rw, rrw := p2p.MsgPipe()
+	defer rw.Close()
+	addr := network.RandomBzzAddr()
+	pp := protocols.NewPeer(p2p.NewPeer(enode.ID{0x01}, common.ToHex(addr.Over()), []p2p.Cap{{Name: protocolName, Version: 2}}), rw, oldSpec)
+	ps.addPeer(pp)
+	sp := network.NewPeer(&network.BzzPeer{Peer: pp, BzzAddr: network.NewBzzAddr(addr.Over(), nil)}, kad)
+
+	msg := message.New(message.Flags{Trace: true})
+	msg.To = addr.Over()
+	msg.Expire = uint32(time.Now().Add(time.Second).Unix())
+	msg.Payload = []byte("foo")
+	msg.Stamps = []message.Stamp{{Nonce: []byte{1}}}
+	msg.Hops = []message.Hop{{Address: ps.BaseAddr()}}
+
+	sent := make(chan bool)
+	go func() {
+		sent <- sendMsg(ps, sp, msg)
+	}()
+	m, err := rrw.ReadMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the message as decoded by version 2 peers
+	var old struct {
+		To      []byte
+		Flags   message.Flags
+		Expire  uint32
+		Topic   message.Topic
+		Payload []byte
+	}
+	if err := m.Decode(&old); err != nil {
+		t.Fatalf("version 2 peer failed to decode the message: %v", err)
+	}
+	if !<-sent {
+		t.Fatal("expected message to be sent")
+	}
+	if !bytes.Equal(old.Payload, msg.Payload) {
+		t.Fatalf("expected payload %x, got %x", msg.Payload, old.Payload)
+	}
+	if msg.Stamps == nil || msg.Hops == nil {
+		t.Fatal("expected the original message to be left intact")
+	}
+}
+
 // verifies that message handlers for raw messages only are invoked when minimum one handler for the topic exists in which raw messages are explicitly allowed
 func TestRawAllow(t *testing.T) {
 	// set up pss like so many times before
@@ -1534,7 +1593,6 @@ func newServices(allowRaw bool) map[string]simulation.ServiceFunc {
 			if err != nil {
 				return nil, nil, err
 			}
-			addr.OAddr = network.PrivateKeyToBzzKey(bzzPrivateKey)
 			bucket.Store(simulation.BucketKeyBzzPrivateKey, bzzPrivateKey)
 			hp := network.NewHiveParams()
 			hp.Discovery = false
@@ -1553,12 +1611,8 @@ func newServices(allowRaw bool) map[string]simulation.ServiceFunc {
 			privkey, err := ethCrypto.GenerateKey()
 			pssp := NewParams().WithPrivateKey(privkey)
 			pssp.AllowRaw = allowRaw
-			bzzPrivateKey, err := simulation.BzzPrivateKeyFromConfig(ctx.Config)
-			if err != nil {
-				return nil, nil, err
-			}
-			bzzKey := network.PrivateKeyToBzzKey(bzzPrivateKey)
-			pskad := kademlia(ctx.Config.ID, bzzKey)
+			// the snapshot connections are made for the overlays derived from the enodes
+			pskad := kademlia(ctx.Config.ID, network.NewBzzAddrFromEnode(ctx.Config.Node()).Over())
 			bucket.Store(simulation.BucketKeyKademlia, pskad)
 			ps, err := New(pskad, pssp)
 			if err != nil {
@@ -1633,6 +1687,71 @@ func newTestPssStart(privkey *ecdsa.PrivateKey, kad *network.Kademlia, ppextra *
 	return ps
 }
 
+// newTestPssNodes creates n started pss nodes in the neighbourhood of each other,
+// with overlay addresses derived from their keys, and a function stopping them
+func newTestPssNodes(t *testing.T, n int) ([]*Pss, func()) {
+	t.Helper()
+	var nodes []*Pss
+	for i := 0; i < n; i++ {
+		privkey, err := ethCrypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		kp := network.NewKadParams()
+		kp.NeighbourhoodSize = 3
+		nodes = append(nodes, newTestPss(privkey, network.NewKademlia(network.PrivateKeyToBzzKey(privkey), kp), nil))
+	}
+	return nodes, func() {
+		for _, ps := range nodes {
+			ps.Stop()
+		}
+	}
+}
+
+// setTestPeers registers the public keys of the pss nodes with each other for the topic
+func setTestPeers(t *testing.T, topic message.Topic, a, b *Pss) {
+	t.Helper()
+	if err := a.SetPeerPublicKey(b.PublicKey(), topic, b.BaseAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetPeerPublicKey(a.PublicKey(), topic, a.BaseAddr()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestDelivery returns a function sending messages between the pss nodes,
+// the messages sent by a node are encrypted and processed by the nodes with the recipient address
+func newTestDelivery(nodes []*Pss) func(p *Pss, to PssAddress, topic message.Topic, msg []byte, asymmetric bool, key []byte) error {
+	return func(p *Pss, to PssAddress, topic message.Topic, msg []byte, asymmetric bool, key []byte) error {
+		params := &crypto.WrapParams{Sender: p.privateKey}
+		if asymmetric {
+			pubkey, err := p.Crypto.UnmarshalPublicKey(key)
+			if err != nil {
+				return err
+			}
+			params.Receiver = pubkey
+		} else {
+			params.SymmetricKey = key
+		}
+		envelope, err := p.Crypto.Wrap(msg, params)
+		if err != nil {
+			return err
+		}
+		pssMsg := message.New(message.Flags{Symmetric: !asymmetric})
+		pssMsg.To = to
+		pssMsg.Expire = uint32(time.Now().Add(time.Minute).Unix())
+		pssMsg.Topic = topic
+		pssMsg.Payload = envelope
+		for _, node := range nodes {
+			if node != p && bytes.HasPrefix(node.BaseAddr(), to) {
+				// messages the node cannot decrypt are dropped
+				node.process(pssMsg, false, false)
+			}
+		}
+		return nil
+	}
+}
+
 // API calls for test/development use
 type APITest struct {
 	*Pss
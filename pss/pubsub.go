@@ -26,6 +26,7 @@ import (
 )
 
 // PubSub implements the pushsync.PubSub interface using pss
+// its topics are not subject to the default topic policy of the node
 type PubSub struct {
 	pss        *Pss
 	messageTTL time.Duration // expire duration of a pubsub message. Depends on the use case.
@@ -44,14 +45,19 @@ func (p *PubSub) BaseAddr() []byte {
 	return p.pss.BaseAddr()
 }
 
+// isPssPeer returns true for pss capable peers which store chunks
 func isPssPeer(bp *network.BzzPeer) bool {
-	return bp.HasCap(protocolName)
+	return bp.HasCap(protocolName) && !network.IsLightNode(bp.Capabilities)
 }
 
 // IsClosestTo returns true is self is the closest known node to addr
 // as uniquely defined by the MSB XOR distance
 // among pss capable peers
+// light nodes do not store chunks so they are never the closest
 func (p *PubSub) IsClosestTo(addr []byte) bool {
+	if network.IsLightNode(p.pss.Capabilities) {
+		return false
+	}
 	return p.pss.IsClosestTo(addr, isPssPeer)
 }
 
@@ -65,6 +71,7 @@ func (p *PubSub) Register(topic string, prox bool, handler func(msg []byte, p *p
 		h = h.WithProxBin()
 	}
 	pt := message.NewTopic([]byte(topic))
+	p.pss.policy.addInternal(pt)
 	return p.pss.Register(&pt, h)
 }
 
@@ -72,5 +79,6 @@ func (p *PubSub) Register(topic string, prox bool, handler func(msg []byte, p *p
 func (p *PubSub) Send(to []byte, topic string, msg []byte) error {
 	defer metrics.GetOrRegisterResettingTimer("pss/pubsub/send", nil).UpdateSince(time.Now())
 	pt := message.NewTopic([]byte(topic))
+	p.pss.policy.addInternal(pt)
 	return p.pss.SendRaw(PssAddress(to), pt, msg, p.messageTTL)
 }
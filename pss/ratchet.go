@@ -0,0 +1,697 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/state"
+)
+
+const (
+	defaultRatchetMaxSkip    = 1000                // max number of message keys skipped in a chain, and kept per session
+	defaultRatchetSessionTTL = 30 * 24 * time.Hour // sessions without messages for this long are deleted
+	defaultRatchetSkippedTTL = 24 * time.Hour      // skipped message keys are kept for this long
+	ratchetSessionIDSize     = 16
+	ratchetNonceSize         = 12
+	ratchetKeyPrefix         = "pss_ratchet_"
+)
+
+var (
+	ratchetTopic = message.NewTopic([]byte("pss-ratchet"))
+
+	ratchetInfoRoot    = []byte("pss-ratchet-root")
+	ratchetInfoMessage = []byte("pss-ratchet-message")
+
+	errRatchetSessionNotFound = errors.New("ratchet session not found")
+	errRatchetTooManySkipped  = errors.New("too many skipped ratchet messages")
+	errRatchetPeer            = errors.New("ratchet session from a peer not registered for the topic")
+)
+
+// RatchetParams are the parameters of the ratchet sessions
+type RatchetParams struct {
+	MaxSkip    int           // max number of message keys skipped in a chain, and kept per session
+	SessionTTL time.Duration // sessions without messages for this long are deleted
+	SkippedTTL time.Duration // skipped message keys are kept for this long
+}
+
+// NewRatchetParams returns the default ratchet parameters
+func NewRatchetParams() *RatchetParams {
+	return &RatchetParams{
+		MaxSkip:    defaultRatchetMaxSkip,
+		SessionTTL: defaultRatchetSessionTTL,
+		SkippedTTL: defaultRatchetSkippedTTL,
+	}
+}
+
+// ratchetHeader is sent in the clear (within the pss asymmetric envelope)
+// and authenticated with the message
+type ratchetHeader struct {
+	Session []byte
+	Topic   message.Topic // topic of the session, the messages are dispatched to its handlers
+	DH      []byte        // current ratchet public key of the sender
+	PN      uint32        // number of messages in the previous sending chain
+	N       uint32        // number of the message in the current sending chain
+}
+
+// ratchetMsg is the payload of the pss messages of the ratchet sessions
+type ratchetMsg struct {
+	Header     ratchetHeader
+	Ciphertext []byte
+}
+
+// ratchetSession is the state of a session, persisted after every message
+type ratchetSession struct {
+	ID      string
+	Peer    string        // hex of the identity public key of the peer
+	Topic   message.Topic // topic the messages of the session are dispatched to
+	Address PssAddress    // overlay address of the peer
+	DHs     []byte        // our ratchet private key, nil for our identity key until the first ratchet step
+	DHr     []byte        // the ratchet public key of the peer
+	RK      []byte        // root key
+	CKs     []byte        // sending chain key
+	CKr     []byte        // receiving chain key
+	Ns      uint32
+	Nr      uint32
+	PN      uint32
+	Skipped map[string]*ratchetSkipped // message keys of the skipped messages, by ratchet public key and number
+	Updated time.Time                  // time of the last message sent or received
+}
+
+// ratchetSkipped is the message key of a message not received yet
+type ratchetSkipped struct {
+	Key     []byte
+	Skipped time.Time
+}
+
+// Ratchet provides forward secret sessions between two pss nodes with the double ratchet
+// algorithm, complementing the symmetric keys exchanged by the handshake which are reused
+// until their limit or expiry.
+//
+// Every message is encrypted with its own key derived from a chain that only moves forward,
+// so that keys compromised later do not expose the messages before (forward secrecy).
+// Each reply starts new chains from a fresh Diffie-Hellman exchange, so that a session
+// heals once the peers exchange messages after a compromise (post-compromise security).
+//
+// Sessions are opened with the identity key of the peer registered with SetPeerPublicKey,
+// which also gives its address. The first messages are therefore only as secure as the
+// identity keys until the peer replies. The messages are sent in pss asymmetric envelopes
+// so that the sender is authenticated, and dispatched to the handlers of the topic of the
+// session with the session id as the key id. Sessions are only accepted from the peers
+// registered for their topic, on topics with handlers.
+//
+// Sessions without messages for SessionTTL are deleted, and skipped message keys are
+// dropped after SkippedTTL or, the oldest first, to keep at most MaxSkip per session.
+type Ratchet struct {
+	pss      *Pss
+	store    state.Store
+	params   *RatchetParams
+	mu       sync.Mutex
+	sessions map[string]*ratchetSession // sessions in use, all sessions are in the store
+
+	sendFunc func(to []byte, topic message.Topic, msg []byte, asymmetric bool, key []byte) error // sends a ratchet message, Pss.send unless overridden in tests
+}
+
+// SetRatchet enables ratchet sessions on the pss node, keeping their state in store
+//
+// Must be called before starting the pss node service
+func SetRatchet(p *Pss, params *RatchetParams, store state.Store) *Ratchet {
+	r := &Ratchet{
+		pss:      p,
+		store:    store,
+		params:   params,
+		sessions: make(map[string]*ratchetSession),
+		sendFunc: p.send,
+	}
+	p.Register(&ratchetTopic, NewHandler(r.handle))
+	p.addAPI(rpc.API{
+		Namespace: "pss",
+		Version:   "1.0",
+		Service:   NewRatchetAPI(r),
+		Public:    true,
+	})
+	go r.gcLoop()
+	return r
+}
+
+// NewSession opens a session with the peer with the given public key,
+// which must be registered for the topic
+func (r *Ratchet) NewSession(pubkeyid string, topic message.Topic) (string, error) {
+	pubkey, err := r.pss.Crypto.UnmarshalPublicKey(common.FromHex(pubkeyid))
+	if err != nil {
+		return "", fmt.Errorf("invalid public key %s: %v", pubkeyid, err)
+	}
+	address, err := r.pss.getPeerAddress(pubkeyid, topic)
+	if err != nil {
+		return "", err
+	}
+	id := make([]byte, ratchetSessionIDSize)
+	if _, err := crand.Read(id); err != nil {
+		return "", err
+	}
+	sk, err := r.sharedSecret(pubkey, id)
+	if err != nil {
+		return "", err
+	}
+	dhs, err := ethCrypto.GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	dh, err := ecdh(dhs, pubkey)
+	if err != nil {
+		return "", err
+	}
+	rk, cks := kdfRK(sk, dh)
+	s := &ratchetSession{
+		ID:      hexutil.Encode(id),
+		Peer:    pubkeyid,
+		Topic:   topic,
+		Address: address,
+		DHs:     ethCrypto.FromECDSA(dhs),
+		DHr:     ethCrypto.CompressPubkey(pubkey),
+		RK:      rk,
+		CKs:     cks,
+		Skipped: make(map[string]*ratchetSkipped),
+		Updated: time.Now(),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.save(s); err != nil {
+		return "", err
+	}
+	metrics.GetOrRegisterCounter("pss/ratchet/session", nil).Inc(1)
+	return s.ID, nil
+}
+
+// Send sends a message on the session
+func (r *Ratchet) Send(id string, msg []byte) error {
+	r.mu.Lock()
+	s, err := r.get(id)
+	if err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	next := s.clone()
+	next.Updated = time.Now()
+	rmsg, err := next.encrypt(r.pss, msg)
+	if err == nil {
+		err = r.save(next)
+	}
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	payload, err := rlp.EncodeToBytes(rmsg)
+	if err != nil {
+		return err
+	}
+	metrics.GetOrRegisterCounter("pss/ratchet/send", nil).Inc(1)
+	return r.sendFunc(next.Address, ratchetTopic, payload, true, common.FromHex(next.Peer))
+}
+
+// Close deletes the session
+func (r *Ratchet) Close(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, id)
+	return r.store.Delete(ratchetKeyPrefix + id)
+}
+
+// handle decrypts the messages of the sessions and dispatches them to the handlers of their topic
+func (r *Ratchet) handle(msg []byte, _ *p2p.Peer, asymmetric bool, keyid string) error {
+	// the sender is only authenticated by the signature of asymmetric messages
+	if !asymmetric {
+		return nil
+	}
+	var rmsg ratchetMsg
+	if err := rlp.DecodeBytes(msg, &rmsg); err != nil {
+		return fmt.Errorf("invalid ratchet message: %v", err)
+	}
+	s, plaintext, err := r.receive(keyid, &rmsg)
+	if err != nil {
+		metrics.GetOrRegisterCounter("pss/ratchet/fail", nil).Inc(1)
+		return err
+	}
+	metrics.GetOrRegisterCounter("pss/ratchet/receive", nil).Inc(1)
+	r.pss.executeHandlers(s.Topic, plaintext, s.Address, false, false, false, s.ID)
+	return nil
+}
+
+// receive decrypts a message from the peer with the given public key,
+// opening the session if it is the first message received on it
+func (r *Ratchet) receive(pubkeyid string, msg *ratchetMsg) (*ratchetSession, []byte, error) {
+	id := hexutil.Encode(msg.Header.Session)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, err := r.get(id)
+	switch {
+	case err == errRatchetSessionNotFound:
+		s, err = r.accept(pubkeyid, &msg.Header)
+		if err != nil {
+			return nil, nil, err
+		}
+	case err != nil:
+		return nil, nil, err
+	case s.Peer != pubkeyid:
+		return nil, nil, fmt.Errorf("ratchet session %s not with %s", id, pubkeyid)
+	}
+	next := s.clone()
+	next.Updated = time.Now()
+	next.expireSkipped(r.params.SkippedTTL)
+	plaintext, err := next.decrypt(r.pss, &msg.Header, msg.Ciphertext, r.params.MaxSkip)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := r.save(next); err != nil {
+		return nil, nil, err
+	}
+	return next, plaintext, nil
+}
+
+// accept starts the session opened by the peer with the given public key,
+// if it is registered for the topic of the session and the topic has handlers,
+// the first ratchet step is done with our identity key
+func (r *Ratchet) accept(pubkeyid string, header *ratchetHeader) (*ratchetSession, error) {
+	if len(header.Session) != ratchetSessionIDSize || header.PN != 0 {
+		return nil, fmt.Errorf("invalid ratchet session %x", header.Session)
+	}
+	address, err := r.pss.getPeerAddress(pubkeyid, header.Topic)
+	if err != nil || len(r.pss.getHandlers(header.Topic)) == 0 {
+		return nil, errRatchetPeer
+	}
+	pubkey, err := r.pss.Crypto.UnmarshalPublicKey(common.FromHex(pubkeyid))
+	if err != nil {
+		return nil, err
+	}
+	sk, err := r.sharedSecret(pubkey, header.Session)
+	if err != nil {
+		return nil, err
+	}
+	metrics.GetOrRegisterCounter("pss/ratchet/accept", nil).Inc(1)
+	return &ratchetSession{
+		ID:      hexutil.Encode(header.Session),
+		Peer:    pubkeyid,
+		Topic:   header.Topic,
+		Address: address,
+		RK:      sk,
+		Skipped: make(map[string]*ratchetSkipped),
+	}, nil
+}
+
+// sharedSecret derives the initial root key of a session from the identity keys
+func (r *Ratchet) sharedSecret(pubkey *ecdsa.PublicKey, id []byte) ([]byte, error) {
+	dh, err := ecdh(r.pss.privateKey, pubkey)
+	if err != nil {
+		return nil, err
+	}
+	return hkdf(id, dh, ratchetInfoRoot, 32), nil
+}
+
+// get returns the session with the given id, loading it from the store if not in use
+func (r *Ratchet) get(id string) (*ratchetSession, error) {
+	if s, ok := r.sessions[id]; ok {
+		return s, nil
+	}
+	s := &ratchetSession{}
+	if err := r.store.Get(ratchetKeyPrefix+id, s); err != nil {
+		if err == state.ErrNotFound {
+			return nil, errRatchetSessionNotFound
+		}
+		return nil, err
+	}
+	if s.Skipped == nil {
+		s.Skipped = make(map[string]*ratchetSkipped)
+	}
+	r.sessions[id] = s
+	return s, nil
+}
+
+func (r *Ratchet) save(s *ratchetSession) error {
+	if err := r.store.Put(ratchetKeyPrefix+s.ID, s); err != nil {
+		return err
+	}
+	r.sessions[s.ID] = s
+	return nil
+}
+
+// gcLoop deletes the expired sessions periodically
+func (r *Ratchet) gcLoop() {
+	ticker := time.NewTicker(defaultCleanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.gc()
+		case <-r.pss.quitC:
+			return
+		}
+	}
+}
+
+// gc deletes the sessions without messages for SessionTTL
+func (r *Ratchet) gc() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var expired []string
+	err := r.store.Iterate(ratchetKeyPrefix, func(_, value []byte) (bool, error) {
+		s := &ratchetSession{}
+		if err := json.Unmarshal(value, s); err != nil {
+			return false, err
+		}
+		if time.Since(s.Updated) > r.params.SessionTTL {
+			expired = append(expired, s.ID)
+		}
+		return false, nil
+	})
+	if err != nil {
+		log.Warn("pss ratchet gc failed", "err", err)
+	}
+	for _, id := range expired {
+		delete(r.sessions, id)
+		if err := r.store.Delete(ratchetKeyPrefix + id); err != nil {
+			log.Warn("pss ratchet session delete failed", "session", id, "err", err)
+		}
+	}
+	if len(expired) > 0 {
+		metrics.GetOrRegisterCounter("pss/ratchet/expired", nil).Inc(int64(len(expired)))
+	}
+}
+
+// sessionsWith returns the ids of the sessions with the peer with the given public key
+func (r *Ratchet) sessionsWith(pubkeyid string) (ids []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err = r.store.Iterate(ratchetKeyPrefix, func(_, value []byte) (bool, error) {
+		s := &ratchetSession{}
+		if err := json.Unmarshal(value, s); err != nil {
+			return false, err
+		}
+		if s.Peer == pubkeyid {
+			ids = append(ids, s.ID)
+		}
+		return false, nil
+	})
+	return ids, err
+}
+
+// clone returns a copy of the session to update, the session is only replaced once
+// a message is processed successfully
+func (s *ratchetSession) clone() *ratchetSession {
+	c := *s
+	c.Skipped = make(map[string]*ratchetSkipped, len(s.Skipped))
+	for k, v := range s.Skipped {
+		c.Skipped[k] = v
+	}
+	return &c
+}
+
+// dhKey returns our current ratchet private key
+func (s *ratchetSession) dhKey(p *Pss) (*ecdsa.PrivateKey, error) {
+	if s.DHs == nil {
+		return p.privateKey, nil
+	}
+	return ethCrypto.ToECDSA(s.DHs)
+}
+
+func (s *ratchetSession) encrypt(p *Pss, plaintext []byte) (*ratchetMsg, error) {
+	dhs, err := s.dhKey(p)
+	if err != nil {
+		return nil, err
+	}
+	var mk []byte
+	s.CKs, mk = kdfCK(s.CKs)
+	header := ratchetHeader{
+		Session: common.FromHex(s.ID),
+		Topic:   s.Topic,
+		DH:      ethCrypto.CompressPubkey(&dhs.PublicKey),
+		PN:      s.PN,
+		N:       s.Ns,
+	}
+	s.Ns++
+	ciphertext, err := seal(mk, plaintext, &header)
+	if err != nil {
+		return nil, err
+	}
+	return &ratchetMsg{Header: header, Ciphertext: ciphertext}, nil
+}
+
+func (s *ratchetSession) decrypt(p *Pss, header *ratchetHeader, ciphertext []byte, maxSkip int) ([]byte, error) {
+	key := skippedKey(header.DH, header.N)
+	if skipped, ok := s.Skipped[key]; ok {
+		delete(s.Skipped, key)
+		return open(skipped.Key, ciphertext, header)
+	}
+	if !bytes.Equal(header.DH, s.DHr) {
+		if err := s.skip(header.PN, maxSkip); err != nil {
+			return nil, err
+		}
+		if err := s.step(p, header); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.skip(header.N, maxSkip); err != nil {
+		return nil, err
+	}
+	var mk []byte
+	s.CKr, mk = kdfCK(s.CKr)
+	s.Nr++
+	return open(mk, ciphertext, header)
+}
+
+// skip keeps the message keys of the receiving chain up to the given message number,
+// dropping the oldest skipped keys to keep at most maxSkip
+func (s *ratchetSession) skip(until uint32, maxSkip int) error {
+	if s.CKr == nil {
+		return nil
+	}
+	if until < s.Nr {
+		return nil
+	}
+	if int(until-s.Nr) > maxSkip {
+		return errRatchetTooManySkipped
+	}
+	s.evictSkipped(len(s.Skipped) + int(until-s.Nr) - maxSkip)
+	now := time.Now()
+	for s.Nr < until {
+		var mk []byte
+		s.CKr, mk = kdfCK(s.CKr)
+		s.Skipped[skippedKey(s.DHr, s.Nr)] = &ratchetSkipped{Key: mk, Skipped: now}
+		s.Nr++
+	}
+	return nil
+}
+
+// evictSkipped drops the n oldest skipped message keys
+func (s *ratchetSession) evictSkipped(n int) {
+	if n <= 0 {
+		return
+	}
+	keys := make([]string, 0, len(s.Skipped))
+	for k := range s.Skipped {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return s.Skipped[keys[i]].Skipped.Before(s.Skipped[keys[j]].Skipped)
+	})
+	if n > len(keys) {
+		n = len(keys)
+	}
+	for _, k := range keys[:n] {
+		delete(s.Skipped, k)
+	}
+	metrics.GetOrRegisterCounter("pss/ratchet/evicted", nil).Inc(int64(n))
+}
+
+// expireSkipped drops the message keys skipped for longer than ttl
+func (s *ratchetSession) expireSkipped(ttl time.Duration) {
+	for k, skipped := range s.Skipped {
+		if time.Since(skipped.Skipped) > ttl {
+			delete(s.Skipped, k)
+		}
+	}
+}
+
+// step is the Diffie-Hellman ratchet step on a new ratchet public key of the peer
+func (s *ratchetSession) step(p *Pss, header *ratchetHeader) error {
+	dhr, err := ethCrypto.DecompressPubkey(header.DH)
+	if err != nil {
+		return fmt.Errorf("invalid ratchet key: %v", err)
+	}
+	dhs, err := s.dhKey(p)
+	if err != nil {
+		return err
+	}
+	dh, err := ecdh(dhs, dhr)
+	if err != nil {
+		return err
+	}
+	s.PN = s.Ns
+	s.Ns = 0
+	s.Nr = 0
+	s.DHr = header.DH
+	s.RK, s.CKr = kdfRK(s.RK, dh)
+	if dhs, err = ethCrypto.GenerateKey(); err != nil {
+		return err
+	}
+	if dh, err = ecdh(dhs, dhr); err != nil {
+		return err
+	}
+	s.DHs = ethCrypto.FromECDSA(dhs)
+	s.RK, s.CKs = kdfRK(s.RK, dh)
+	return nil
+}
+
+func skippedKey(dh []byte, n uint32) string {
+	return fmt.Sprintf("%x/%d", dh, n)
+}
+
+func ecdh(prv *ecdsa.PrivateKey, pub *ecdsa.PublicKey) ([]byte, error) {
+	return ecies.ImportECDSA(prv).GenerateShared(ecies.ImportECDSAPublic(pub), 32, 0)
+}
+
+// hkdf is the HMAC based key derivation function of RFC 5869 with SHA-256
+func hkdf(salt, secret, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+	var out, t []byte
+	for i := byte(1); len(out) < length; i++ {
+		expand := hmac.New(sha256.New, prk)
+		expand.Write(t)
+		expand.Write(info)
+		expand.Write([]byte{i})
+		t = expand.Sum(nil)
+		out = append(out, t...)
+	}
+	return out[:length]
+}
+
+// kdfRK derives the next root key and a chain key from a Diffie-Hellman output
+func kdfRK(rk, dh []byte) ([]byte, []byte) {
+	out := hkdf(rk, dh, ratchetInfoRoot, 64)
+	return out[:32], out[32:]
+}
+
+// kdfCK derives the next chain key and a message key
+func kdfCK(ck []byte) ([]byte, []byte) {
+	next := hmac.New(sha256.New, ck)
+	next.Write([]byte{2})
+	mk := hmac.New(sha256.New, ck)
+	mk.Write([]byte{1})
+	return next.Sum(nil), mk.Sum(nil)
+}
+
+// aead returns the cipher and the nonce of a message key,
+// a message key encrypts a single message
+func aead(mk []byte) (cipher.AEAD, []byte, error) {
+	out := hkdf(nil, mk, ratchetInfoMessage, 32+ratchetNonceSize)
+	block, err := aes.NewCipher(out[:32])
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gcm, out[32:], nil
+}
+
+func seal(mk []byte, plaintext []byte, header *ratchetHeader) ([]byte, error) {
+	gcm, nonce, err := aead(mk)
+	if err != nil {
+		return nil, err
+	}
+	ad, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nil, nonce, plaintext, ad), nil
+}
+
+func open(mk []byte, ciphertext []byte, header *ratchetHeader) ([]byte, error) {
+	gcm, nonce, err := aead(mk)
+	if err != nil {
+		return nil, err
+	}
+	ad, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		log.Trace("ratchet message decryption failed", "session", hexutil.Encode(header.Session), "n", header.N, "err", err)
+		return nil, errors.New("ratchet message decryption failed")
+	}
+	return plaintext, nil
+}
+
+// RatchetAPI is the API of the ratchet sessions
+type RatchetAPI struct {
+	ratchet *Ratchet
+}
+
+// NewRatchetAPI creates a new RatchetAPI
+func NewRatchetAPI(r *Ratchet) *RatchetAPI {
+	return &RatchetAPI{ratchet: r}
+}
+
+// NewSession opens a forward secret session with the peer (public key) registered for the topic
+// and returns its id. The messages received on the session are delivered to the subscriptions
+// of the topic with the session id as their key
+func (api *RatchetAPI) NewSession(pubkeyid string, topic message.Topic) (string, error) {
+	return api.ratchet.NewSession(pubkeyid, topic)
+}
+
+// SendSession sends a message on the session
+func (api *RatchetAPI) SendSession(id string, msg hexutil.Bytes) error {
+	if err := validateMsg(msg); err != nil {
+		return err
+	}
+	return api.ratchet.Send(id, msg)
+}
+
+// CloseSession deletes the state of the session
+func (api *RatchetAPI) CloseSession(id string) error {
+	return api.ratchet.Close(id)
+}
+
+// GetSessions returns the ids of the sessions with the peer (public key)
+func (api *RatchetAPI) GetSessions(pubkeyid string) ([]string, error) {
+	return api.ratchet.sessionsWith(pubkeyid)
+}
@@ -0,0 +1,279 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/state"
+)
+
+// ratchetTestNode is a pss node with ratchet sessions
+// recording the messages it sends and receives
+type ratchetTestNode struct {
+	ps       *Pss
+	ratchet  *Ratchet
+	store    *state.DBStore
+	sent     [][]byte
+	received []string
+}
+
+func newRatchetTestNodes(t *testing.T, topic message.Topic) (*ratchetTestNode, *ratchetTestNode, func()) {
+	t.Helper()
+	pssNodes, stop := newTestPssNodes(t, 2)
+	var nodes []*ratchetTestNode
+	for _, ps := range pssNodes {
+		store := state.NewInmemoryStore()
+		node := &ratchetTestNode{ps: ps, ratchet: SetRatchet(ps, NewRatchetParams(), store), store: store}
+		node.ratchet.sendFunc = func(_ []byte, _ message.Topic, msg []byte, _ bool, _ []byte) error {
+			node.sent = append(node.sent, msg)
+			return nil
+		}
+		ps.Register(&topic, NewHandler(func(msg []byte, _ *p2p.Peer, asymmetric bool, keyid string) error {
+			node.received = append(node.received, fmt.Sprintf("%s:%s", keyid, msg))
+			return nil
+		}))
+		nodes = append(nodes, node)
+	}
+	a, b := nodes[0], nodes[1]
+	setTestPeers(t, topic, a.ps, b.ps)
+	return a, b, func() {
+		stop()
+		for _, node := range nodes {
+			node.store.Close()
+		}
+	}
+}
+
+// deliver delivers the i-th message sent by the node to the peer
+func (n *ratchetTestNode) deliver(t *testing.T, peer *ratchetTestNode, i int) error {
+	return peer.ratchet.handle(n.sent[i], nil, true, toPubKeyID(t, n.ps))
+}
+
+// TestRatchetSession tests that the messages of a session are delivered to the handlers
+// of its topic in both directions, out of order, and only once
+func TestRatchetSession(t *testing.T) {
+	topic := message.NewTopic([]byte("ratchet-test"))
+	a, b, teardown := newRatchetTestNodes(t, topic)
+	defer teardown()
+
+	id, err := a.ratchet.NewSession(toPubKeyID(t, b.ps), topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"one", "two", "three"} {
+		if err := a.ratchet.Send(id, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bytes.Equal(a.sent[0], a.sent[1]) {
+		t.Fatal("expected messages encrypted with different keys")
+	}
+	// out of order
+	for _, i := range []int{1, 0, 2} {
+		if err := a.deliver(t, b, i); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	expected := []string{id + ":two", id + ":one", id + ":three"}
+	if fmt.Sprint(b.received) != fmt.Sprint(expected) {
+		t.Fatalf("expected received %v, got %v", expected, b.received)
+	}
+	// replayed messages cannot be decrypted
+	if err := a.deliver(t, b, 0); err == nil {
+		t.Fatal("expected error on replayed message")
+	}
+
+	// the reply starts new chains on both sides
+	dhs := a.ratchet.sessions[id].DHs
+	if err := b.ratchet.Send(id, []byte("reply")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.deliver(t, a, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.received) != 1 || a.received[0] != id+":reply" {
+		t.Fatalf("expected reply, got %v", a.received)
+	}
+	if bytes.Equal(dhs, a.ratchet.sessions[id].DHs) {
+		t.Fatal("expected a new ratchet key after the peer replied")
+	}
+	if err := a.ratchet.Send(id, []byte("four")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.deliver(t, b, 3); err != nil {
+		t.Fatal(err)
+	}
+	if b.received[len(b.received)-1] != id+":four" {
+		t.Fatalf("expected message on the new chain, got %v", b.received)
+	}
+
+	ids, err := b.ratchet.sessionsWith(toPubKeyID(t, a.ps))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != id {
+		t.Fatalf("expected session %s, got %v", id, ids)
+	}
+}
+
+// TestRatchetPersistence tests that sessions continue from the state store
+// and that they are only accepted from the peer which opened them
+func TestRatchetPersistence(t *testing.T) {
+	topic := message.NewTopic([]byte("ratchet-test"))
+	a, b, teardown := newRatchetTestNodes(t, topic)
+	defer teardown()
+
+	id, err := a.ratchet.NewSession(toPubKeyID(t, b.ps), topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ratchet.Send(id, []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.deliver(t, b, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// restart
+	a.ratchet.sessions = make(map[string]*ratchetSession)
+	b.ratchet.sessions = make(map[string]*ratchetSession)
+
+	if err := b.ratchet.Send(id, []byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.deliver(t, a, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.received) != 1 || a.received[0] != id+":two" {
+		t.Fatalf("expected message after restart, got %v", a.received)
+	}
+
+	// messages on the session from another key are rejected
+	if err := b.ratchet.Send(id, []byte("three")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ratchet.handle(b.sent[1], nil, true, toPubKeyID(t, b.ps)); err == nil {
+		t.Fatal("expected error on a message from another peer")
+	}
+
+	if err := a.ratchet.Close(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ratchet.Send(id, []byte("closed")); err != errRatchetSessionNotFound {
+		t.Fatalf("expected error %v, got %v", errRatchetSessionNotFound, err)
+	}
+}
+
+// TestRatchetAccept tests that sessions are only accepted from the peers registered
+// for their topic, on topics with handlers
+func TestRatchetAccept(t *testing.T) {
+	topic := message.NewTopic([]byte("ratchet-test"))
+	a, b, teardown := newRatchetTestNodes(t, topic)
+	defer teardown()
+
+	// b has no handlers on the topic
+	other := message.NewTopic([]byte("ratchet-other"))
+	if err := a.ps.SetPeerPublicKey(b.ps.PublicKey(), other, b.ps.BaseAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ps.SetPeerPublicKey(a.ps.PublicKey(), other, a.ps.BaseAddr()); err != nil {
+		t.Fatal(err)
+	}
+	id, err := a.ratchet.NewSession(toPubKeyID(t, b.ps), other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ratchet.Send(id, []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.deliver(t, b, 0); err != errRatchetPeer {
+		t.Fatalf("expected error %v, got %v", errRatchetPeer, err)
+	}
+
+	// c is not registered by b
+	c, _, teardownC := newRatchetTestNodes(t, topic)
+	defer teardownC()
+	if err := c.ps.SetPeerPublicKey(b.ps.PublicKey(), topic, b.ps.BaseAddr()); err != nil {
+		t.Fatal(err)
+	}
+	id, err = c.ratchet.NewSession(toPubKeyID(t, b.ps), topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ratchet.Send(id, []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.deliver(t, b, 0); err != errRatchetPeer {
+		t.Fatalf("expected error %v, got %v", errRatchetPeer, err)
+	}
+	if len(b.received) != 0 {
+		t.Fatalf("expected no message received, got %v", b.received)
+	}
+}
+
+// TestRatchetExpiry tests that the oldest skipped keys are dropped to make room for new gaps
+// and that the sessions without messages are deleted
+func TestRatchetExpiry(t *testing.T) {
+	topic := message.NewTopic([]byte("ratchet-test"))
+	a, b, teardown := newRatchetTestNodes(t, topic)
+	defer teardown()
+	b.ratchet.params.MaxSkip = 2
+
+	id, err := a.ratchet.NewSession(toPubKeyID(t, b.ps), topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		if err := a.ratchet.Send(id, []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// messages 1 and 2 are skipped
+	if err := a.deliver(t, b, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.deliver(t, b, 3); err != nil {
+		t.Fatal(err)
+	}
+	// the keys of messages 1 and 2 are dropped for messages 4 and 5
+	if err := a.deliver(t, b, 6); err != nil {
+		t.Fatalf("expected gap after max skipped keys accepted, got %v", err)
+	}
+	if n := len(b.ratchet.sessions[id].Skipped); n != 2 {
+		t.Fatalf("expected 2 skipped keys, got %d", n)
+	}
+	if err := a.deliver(t, b, 1); err == nil {
+		t.Fatal("expected error on a message with a dropped key")
+	}
+	if err := a.deliver(t, b, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	b.ratchet.params.SessionTTL = 0
+	b.ratchet.gc()
+	if _, ok := b.ratchet.sessions[id]; ok {
+		t.Fatal("expected expired session deleted")
+	}
+	if err := b.ratchet.Send(id, []byte("expired")); err != errRatchetSessionNotFound {
+		t.Fatalf("expected error %v, got %v", errRatchetSessionNotFound, err)
+	}
+}
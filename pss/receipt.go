@@ -0,0 +1,547 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"context"
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/pss/internal/ttlset"
+	"github.com/ethersphere/swarm/pss/message"
+	"github.com/tilinna/clock"
+)
+
+const (
+	defaultReceiptTimeout        = 5 * time.Second  // time to wait for an acknowledgement before sending again
+	defaultReceiptRetries        = 3                // number of times a message is sent again
+	defaultReceiptRequestTimeout = 30 * time.Second // time a request handler is given to respond
+	receiptIDSize                = 16
+)
+
+// receipt message codes
+const (
+	receiptMessage  = iota // message to acknowledge
+	receiptAck             // acknowledgement of a message or a request
+	receiptRequest         // request to respond to
+	receiptResponse        // response to a request
+)
+
+var (
+	receiptTopic = message.NewTopic([]byte("pss-receipt"))
+
+	// ErrReceiptTimeout is returned when a message is not acknowledged after all retries
+	ErrReceiptTimeout = errors.New("no receipt")
+)
+
+// ReceiptParams are the parameters of the delivery receipts
+type ReceiptParams struct {
+	Timeout        time.Duration // time to wait for an acknowledgement before sending again
+	Retries        int           // number of times a message is sent again
+	RequestTimeout time.Duration // time a request handler is given to respond
+}
+
+// NewReceiptParams returns the default receipt parameters
+func NewReceiptParams() *ReceiptParams {
+	return &ReceiptParams{
+		Timeout:        defaultReceiptTimeout,
+		Retries:        defaultReceiptRetries,
+		RequestTimeout: defaultReceiptRequestTimeout,
+	}
+}
+
+// receiptMsg is the payload of the pss messages with receipts
+type receiptMsg struct {
+	ID      []byte
+	Code    uint8
+	Topic   message.Topic // topic the message is dispatched to
+	From    []byte        // public key of the sender, the receipt is encrypted for
+	Address []byte        // address of the sender, the receipt is sent to
+	Payload []byte
+	Error   string // response: the error of the request handler
+}
+
+// RequestHandler responds to the requests on a topic from the peer with the given public key
+type RequestHandler func(ctx context.Context, req []byte, pubkeyid string) ([]byte, error)
+
+// pendingReceipt is a message waiting for its receipt
+type pendingReceipt struct {
+	keyid   string // public key the receipt must be signed with, or symmetric key it must be encrypted with
+	replies chan *receiptMsg
+}
+
+// requestHandler is a registered request handler, compared by pointer on removal
+type requestHandler struct {
+	handle RequestHandler
+}
+
+// Receipts provides end-to-end acknowledgements of pss messages and
+// request/response calls on top of them.
+//
+// The messages are wrapped with an id and sent again until the recipient acknowledges them,
+// the acknowledgements of asymmetric messages are asymmetric messages, signed by the recipient,
+// and sent back to the sender. The acknowledgements of symmetric messages are encrypted with
+// the same key and sent to the address registered with the key, as the sender is not
+// authenticated. The recipient dispatches each message once to the handlers of its topic
+// if the policy of the topic allows delivering it.
+// Requests are only accepted in asymmetric messages, they are acknowledged when received,
+// and their response is sent once the request handler of the topic returns.
+type Receipts struct {
+	pss      *Pss
+	params   *ReceiptParams
+	seen     *ttlset.TTLSet // ids of the messages and requests received
+	mu       sync.Mutex
+	pending  map[string]*pendingReceipt // messages waiting for a receipt by id
+	handlers map[message.Topic]*requestHandler
+	// responses sent by id, sent again if the request is received again
+	responses map[string]*receiptMsg
+
+	sendFunc func(to []byte, topic message.Topic, msg []byte, asymmetric bool, key []byte) error // sends a receipt message, Pss.send unless overridden in tests
+}
+
+// SetReceipts enables the delivery receipts and requests on the pss node
+//
+// Must be called before starting the pss node service
+func SetReceipts(p *Pss, params *ReceiptParams) *Receipts {
+	r := &Receipts{
+		pss:    p,
+		params: params,
+		seen: ttlset.New(&ttlset.Config{
+			EntryTTL: params.Timeout * time.Duration(params.Retries+1),
+			Clock:    clock.Realtime(),
+		}),
+		pending:   make(map[string]*pendingReceipt),
+		handlers:  make(map[message.Topic]*requestHandler),
+		responses: make(map[string]*receiptMsg),
+		sendFunc:  p.send,
+	}
+	p.Register(&receiptTopic, NewHandler(r.handle))
+	p.addAPI(rpc.API{
+		Namespace: "pss",
+		Version:   "1.0",
+		Service:   NewReceiptAPI(r),
+		Public:    true,
+	})
+	go r.gcLoop()
+	return r
+}
+
+// SendAsym sends a message encrypted with the public key and returns once the
+// recipient acknowledges it, or ErrReceiptTimeout if it does not after all retries
+func (r *Receipts) SendAsym(ctx context.Context, pubkeyid string, topic message.Topic, msg []byte) error {
+	psp, ok := r.pss.getPeerPub(pubkeyid, topic)
+	if !ok {
+		return fmt.Errorf("invalid topic '%s' for pubkey '%s'", topic.String(), pubkeyid)
+	}
+	_, err := r.send(ctx, psp.address, true, common.FromHex(pubkeyid), pubkeyid, r.newMsg(receiptMessage, topic, msg))
+	return err
+}
+
+// SendSym sends a message encrypted with the symmetric key and returns once the
+// recipient acknowledges it, or ErrReceiptTimeout if it does not after all retries
+func (r *Receipts) SendSym(ctx context.Context, symkeyid string, topic message.Topic, msg []byte) error {
+	symkey, err := r.pss.GetSymmetricKey(symkeyid)
+	if err != nil {
+		return fmt.Errorf("missing valid send symkey %s: %v", symkeyid, err)
+	}
+	psp, ok := r.pss.getPeerSym(symkeyid, topic)
+	if !ok {
+		return fmt.Errorf("invalid topic '%s' for symkey '%s'", topic.String(), symkeyid)
+	}
+	// the recipient is not known, any node with the key can acknowledge
+	_, err = r.send(ctx, psp.address, false, symkey, symkeyid, r.newMsg(receiptMessage, topic, msg))
+	return err
+}
+
+// Call sends a request to the peer with the public key on the topic
+// and returns the response of its request handler
+func (r *Receipts) Call(ctx context.Context, pubkeyid string, topic message.Topic, req []byte) ([]byte, error) {
+	psp, ok := r.pss.getPeerPub(pubkeyid, topic)
+	if !ok {
+		return nil, fmt.Errorf("invalid topic '%s' for pubkey '%s'", topic.String(), pubkeyid)
+	}
+	metrics.GetOrRegisterCounter("pss/receipt/call", nil).Inc(1)
+	resp, err := r.send(ctx, psp.address, true, common.FromHex(pubkeyid), pubkeyid, r.newMsg(receiptRequest, topic, req))
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return resp.Payload, nil
+}
+
+// HandleRequests sets the handler of the requests on the topic,
+// it returns a function to remove it unless it was replaced by another handler
+func (r *Receipts) HandleRequests(topic message.Topic, handler RequestHandler) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := &requestHandler{handle: handler}
+	r.handlers[topic] = h
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.handlers[topic] == h {
+			delete(r.handlers, topic)
+		}
+	}
+}
+
+func (r *Receipts) newMsg(code uint8, topic message.Topic, payload []byte) *receiptMsg {
+	id := make([]byte, receiptIDSize)
+	crand.Read(id)
+	return &receiptMsg{
+		ID:      id,
+		Code:    code,
+		Topic:   topic,
+		From:    r.pss.Crypto.SerializePublicKey(r.pss.PublicKey()),
+		Address: r.pss.BaseAddr(),
+		Payload: payload,
+	}
+}
+
+// send sends the message until it is acknowledged, and returns the response of requests
+// the receipts must be signed with the public key or encrypted with the symmetric key with the given id
+func (r *Receipts) send(ctx context.Context, to PssAddress, asymmetric bool, key []byte, keyid string, msg *receiptMsg) (*receiptMsg, error) {
+	payload, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		return nil, err
+	}
+	id := hexutil.Encode(msg.ID)
+	pending := &pendingReceipt{keyid: keyid, replies: make(chan *receiptMsg, 2)}
+	r.mu.Lock()
+	r.pending[id] = pending
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, id)
+		r.mu.Unlock()
+	}()
+
+	var acked bool
+	for attempt := 0; !acked; attempt++ {
+		if attempt > r.params.Retries {
+			metrics.GetOrRegisterCounter("pss/receipt/timeout", nil).Inc(1)
+			return nil, ErrReceiptTimeout
+		}
+		if attempt > 0 {
+			metrics.GetOrRegisterCounter("pss/receipt/retry", nil).Inc(1)
+		}
+		if err := r.sendFunc(to, receiptTopic, payload, asymmetric, key); err != nil {
+			return nil, err
+		}
+		timer := time.NewTimer(r.params.Timeout)
+		select {
+		case reply := <-pending.replies:
+			timer.Stop()
+			if reply.Code == receiptResponse {
+				return reply, nil
+			}
+			acked = true
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	metrics.GetOrRegisterCounter("pss/receipt/acked", nil).Inc(1)
+	if msg.Code != receiptRequest {
+		return nil, nil
+	}
+	// the request was received, wait for the response
+	timer := time.NewTimer(r.params.RequestTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case reply := <-pending.replies:
+			if reply.Code == receiptResponse {
+				return reply, nil
+			}
+		case <-timer.C:
+			return nil, ErrReceiptTimeout
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// reply sends an acknowledgement or a response to the sender of a message,
+// to the address registered with the symmetric key of symmetric messages
+func (r *Receipts) reply(msg *receiptMsg, reply *receiptMsg, asymmetric bool, keyid string) error {
+	payload, err := rlp.EncodeToBytes(reply)
+	if err != nil {
+		return err
+	}
+	if asymmetric {
+		return r.sendFunc(msg.Address, receiptTopic, payload, true, msg.From)
+	}
+	psp, ok := r.pss.getPeerSym(keyid, msg.Topic)
+	if !ok {
+		return fmt.Errorf("symmetric key %s not registered for topic %s", keyid, msg.Topic.String())
+	}
+	key, err := r.pss.GetSymmetricKey(keyid)
+	if err != nil {
+		return err
+	}
+	return r.sendFunc(psp.address, receiptTopic, payload, false, key)
+}
+
+// handle handles the messages with receipts, the receipts and the responses
+func (r *Receipts) handle(payload []byte, _ *p2p.Peer, asymmetric bool, keyid string) error {
+	var msg receiptMsg
+	if err := rlp.DecodeBytes(payload, &msg); err != nil {
+		return fmt.Errorf("invalid receipt message: %v", err)
+	}
+	if len(msg.ID) != receiptIDSize {
+		return fmt.Errorf("invalid receipt message id %x", msg.ID)
+	}
+	id := hexutil.Encode(msg.ID)
+	switch msg.Code {
+	case receiptMessage, receiptRequest:
+		if err := validateAddress(msg.Address); err != nil {
+			return err
+		}
+		if _, err := r.pss.Crypto.UnmarshalPublicKey(msg.From); err != nil {
+			return fmt.Errorf("invalid receipt message sender: %v", err)
+		}
+		// the sender of asymmetric messages is the signer
+		if asymmetric && common.ToHex(msg.From) != keyid {
+			return fmt.Errorf("receipt message %s not from its signer", id)
+		}
+		// the request handlers are given the public key of the sender
+		if !asymmetric && msg.Code == receiptRequest {
+			return fmt.Errorf("receipt request %s not signed", id)
+		}
+		return r.receive(&msg, asymmetric, keyid)
+	case receiptAck, receiptResponse:
+		r.mu.Lock()
+		pending, ok := r.pending[id]
+		r.mu.Unlock()
+		if !ok {
+			return nil
+		}
+		// receipts are only accepted signed by the recipient or encrypted with the key of the message
+		if pending.keyid != keyid {
+			return fmt.Errorf("receipt %s not from the recipient", id)
+		}
+		select {
+		case pending.replies <- &msg:
+		default:
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid receipt message code %d", msg.Code)
+	}
+}
+
+// receive dispatches a message or a request once and acknowledges it
+// if the policy of its topic allows delivering it
+func (r *Receipts) receive(msg *receiptMsg, asymmetric bool, keyid string) error {
+	if !r.pss.policy.deliver(msg.Topic) {
+		log.Trace("pss receipt message denied by topic policy", "topic", label(msg.Topic[:]))
+		return nil
+	}
+	id := hexutil.Encode(msg.ID)
+	duplicate := r.seen.Has(id)
+	r.seen.Add(id)
+	if err := r.reply(msg, &receiptMsg{ID: msg.ID, Code: receiptAck}, asymmetric, keyid); err != nil {
+		return err
+	}
+	if msg.Code == receiptMessage {
+		if !duplicate {
+			metrics.GetOrRegisterCounter("pss/receipt/received", nil).Inc(1)
+			from := msg.Address
+			if !asymmetric {
+				from = nil
+				if psp, ok := r.pss.getPeerSym(keyid, msg.Topic); ok {
+					from = psp.address
+				}
+			}
+			r.pss.executeHandlers(msg.Topic, msg.Payload, from, false, false, asymmetric, keyid)
+		}
+		return nil
+	}
+
+	r.mu.Lock()
+	resp, responded := r.responses[id]
+	handler := r.handlers[msg.Topic]
+	r.mu.Unlock()
+	if responded {
+		return r.reply(msg, resp, asymmetric, keyid)
+	}
+	// the request is being handled
+	if duplicate {
+		return nil
+	}
+	metrics.GetOrRegisterCounter("pss/receipt/request", nil).Inc(1)
+	go func() {
+		resp := &receiptMsg{ID: msg.ID, Code: receiptResponse}
+		if handler == nil {
+			resp.Error = fmt.Sprintf("no request handler for topic %s", msg.Topic.String())
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), r.params.RequestTimeout)
+			payload, err := handler.handle(ctx, msg.Payload, common.ToHex(msg.From))
+			cancel()
+			if err != nil {
+				resp.Error = err.Error()
+			}
+			resp.Payload = payload
+		}
+		r.mu.Lock()
+		r.responses[id] = resp
+		r.mu.Unlock()
+		if err := r.reply(msg, resp, asymmetric, keyid); err != nil {
+			log.Warn("pss response failed", "id", id, "err", err)
+		}
+	}()
+	return nil
+}
+
+// gcLoop removes the responses of the requests which will not be sent again
+func (r *Receipts) gcLoop() {
+	ticker := time.NewTicker(r.params.Timeout * time.Duration(r.params.Retries+1))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.seen.GC()
+			r.mu.Lock()
+			for id := range r.responses {
+				if !r.seen.Has(id) {
+					delete(r.responses, id)
+				}
+			}
+			r.mu.Unlock()
+		case <-r.pss.quitC:
+			return
+		}
+	}
+}
+
+// ReceiptAPI is the API of the delivery receipts and requests
+type ReceiptAPI struct {
+	receipts *Receipts
+	mu       sync.Mutex
+	requests map[string]chan []byte // requests received over the api waiting for their response by id
+}
+
+// NewReceiptAPI creates a new ReceiptAPI
+func NewReceiptAPI(r *Receipts) *ReceiptAPI {
+	return &ReceiptAPI{
+		receipts: r,
+		requests: make(map[string]chan []byte),
+	}
+}
+
+// SendAsymWithReceipt sends a message encrypted with the public key and
+// returns once the recipient acknowledges it
+func (api *ReceiptAPI) SendAsymWithReceipt(ctx context.Context, pubkeyid string, topic message.Topic, msg hexutil.Bytes) error {
+	if err := validateMsg(msg); err != nil {
+		return err
+	}
+	return api.receipts.SendAsym(ctx, pubkeyid, topic, msg)
+}
+
+// SendSymWithReceipt sends a message encrypted with the symmetric key and
+// returns once a recipient acknowledges it
+func (api *ReceiptAPI) SendSymWithReceipt(ctx context.Context, symkeyid string, topic message.Topic, msg hexutil.Bytes) error {
+	if err := validateMsg(msg); err != nil {
+		return err
+	}
+	return api.receipts.SendSym(ctx, symkeyid, topic, msg)
+}
+
+// Call sends a request to the peer (public key) on the topic and returns its response
+func (api *ReceiptAPI) Call(ctx context.Context, pubkeyid string, topic message.Topic, req hexutil.Bytes) (hexutil.Bytes, error) {
+	return api.receipts.Call(ctx, pubkeyid, topic, req)
+}
+
+// APIRequest is a request received by a subscription of the API
+type APIRequest struct {
+	ID  string
+	Msg hexutil.Bytes
+	Key string // public key of the sender
+}
+
+// ReceiveRequests creates a subscription to the requests on the topic,
+// which are responded to with Respond
+func (api *ReceiptAPI) ReceiveRequests(ctx context.Context, topic message.Topic) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, fmt.Errorf("Subscribe not supported")
+	}
+	sub := notifier.CreateSubscription()
+	deregister := api.receipts.HandleRequests(topic, func(ctx context.Context, req []byte, pubkeyid string) ([]byte, error) {
+		var b [receiptIDSize]byte
+		crand.Read(b[:])
+		id := hexutil.Encode(b[:])
+		c := make(chan []byte, 1)
+		api.mu.Lock()
+		api.requests[id] = c
+		api.mu.Unlock()
+		defer func() {
+			api.mu.Lock()
+			delete(api.requests, id)
+			api.mu.Unlock()
+		}()
+		if err := notifier.Notify(sub.ID, &APIRequest{ID: id, Msg: req, Key: pubkeyid}); err != nil {
+			return nil, err
+		}
+		select {
+		case resp := <-c:
+			return resp, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+	go func() {
+		defer deregister()
+		select {
+		case err := <-sub.Err():
+			log.Warn(fmt.Sprintf("caught subscription error in pss requests on topic %x: %v", topic, err))
+		case <-notifier.Closed():
+			log.Warn("rpc sub notifier closed")
+		}
+	}()
+	return sub, nil
+}
+
+// Respond sends the response to a request received by a subscription
+func (api *ReceiptAPI) Respond(id string, resp hexutil.Bytes) error {
+	api.mu.Lock()
+	c, ok := api.requests[id]
+	api.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("request %s not found", id)
+	}
+	select {
+	case c <- resp:
+		return nil
+	default:
+		return fmt.Errorf("request %s already responded to", id)
+	}
+}
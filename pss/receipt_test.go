@@ -0,0 +1,230 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// receiptTestNode is a pss node with receipts counting the messages received on a topic
+type receiptTestNode struct {
+	ps       *Pss
+	receipts *Receipts
+	mu       sync.Mutex
+	received int
+	sent     int
+	drop     func(n int) bool // drops the n-th message sent by the node
+}
+
+func newReceiptTestNodes(t *testing.T, topic message.Topic) (*receiptTestNode, *receiptTestNode, func()) {
+	t.Helper()
+	params := NewReceiptParams()
+	params.Timeout = 50 * time.Millisecond
+	params.Retries = 2
+	pssNodes, stop := newTestPssNodes(t, 2)
+	deliver := newTestDelivery(pssNodes)
+	var nodes []*receiptTestNode
+	for _, ps := range pssNodes {
+		node := &receiptTestNode{ps: ps, receipts: SetReceipts(ps, params)}
+		node.receipts.sendFunc = func(to []byte, topic message.Topic, msg []byte, asymmetric bool, key []byte) error {
+			node.mu.Lock()
+			n := node.sent
+			node.sent++
+			node.mu.Unlock()
+			if node.drop != nil && node.drop(n) {
+				return nil
+			}
+			return deliver(node.ps, to, topic, msg, asymmetric, key)
+		}
+		ps.Register(&topic, NewHandler(func(msg []byte, _ *p2p.Peer, _ bool, _ string) error {
+			node.mu.Lock()
+			defer node.mu.Unlock()
+			node.received++
+			return nil
+		}))
+		nodes = append(nodes, node)
+	}
+	a, b := nodes[0], nodes[1]
+	setTestPeers(t, topic, a.ps, b.ps)
+	return a, b, stop
+}
+
+// TestReceipts tests that messages are sent again until acknowledged
+// and dispatched once by the recipient
+func TestReceipts(t *testing.T) {
+	topic := message.NewTopic([]byte("receipt-test"))
+	a, b, teardown := newReceiptTestNodes(t, topic)
+	defer teardown()
+
+	// the first acknowledgement is lost
+	b.drop = func(n int) bool { return n == 0 }
+	if err := a.receipts.SendAsym(context.Background(), toPubKeyID(t, b.ps), topic, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if a.sent != 2 {
+		t.Fatalf("expected the message sent twice, got %d", a.sent)
+	}
+	if b.received != 1 {
+		t.Fatalf("expected the message received once, got %d", b.received)
+	}
+
+	// the recipient is unreachable
+	a.drop = func(int) bool { return true }
+	err := a.receipts.SendAsym(context.Background(), toPubKeyID(t, b.ps), topic, []byte("hello"))
+	if err != ErrReceiptTimeout {
+		t.Fatalf("expected error %v, got %v", ErrReceiptTimeout, err)
+	}
+	if a.sent-2 != 3 {
+		t.Fatalf("expected the message sent 3 times, got %d", a.sent-2)
+	}
+}
+
+// TestCall tests the request and response calls
+func TestCall(t *testing.T) {
+	topic := message.NewTopic([]byte("receipt-test"))
+	a, b, teardown := newReceiptTestNodes(t, topic)
+	defer teardown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := a.receipts.Call(ctx, toPubKeyID(t, b.ps), topic, []byte("ping")); err == nil {
+		t.Fatal("expected error without request handler")
+	}
+
+	deregister := b.receipts.HandleRequests(topic, func(ctx context.Context, req []byte, pubkeyid string) ([]byte, error) {
+		if pubkeyid != toPubKeyID(t, a.ps) {
+			return nil, errors.New("unexpected sender")
+		}
+		if !bytes.Equal(req, []byte("ping")) {
+			return nil, errors.New("unexpected request")
+		}
+		return []byte("pong"), nil
+	})
+	resp, err := a.receipts.Call(ctx, toPubKeyID(t, b.ps), topic, []byte("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(resp, []byte("pong")) {
+		t.Fatalf("expected response pong, got %q", resp)
+	}
+	if _, err := a.receipts.Call(ctx, toPubKeyID(t, b.ps), topic, []byte("other")); err == nil || err.Error() != "unexpected request" {
+		t.Fatalf("expected the error of the handler, got %v", err)
+	}
+	deregister()
+	if b.received != 0 {
+		t.Fatalf("unexpected requests dispatched to the topic handlers")
+	}
+
+	// a handler is not removed by the function returned for the handler it replaced
+	deregister = b.receipts.HandleRequests(topic, func(ctx context.Context, req []byte, pubkeyid string) ([]byte, error) {
+		return nil, nil
+	})
+	b.receipts.HandleRequests(topic, func(ctx context.Context, req []byte, pubkeyid string) ([]byte, error) {
+		return []byte("replaced"), nil
+	})
+	deregister()
+	resp, err = a.receipts.Call(ctx, toPubKeyID(t, b.ps), topic, []byte("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(resp, []byte("replaced")) {
+		t.Fatalf("expected response of the replacing handler, got %q", resp)
+	}
+}
+
+// TestReceiptsSym tests that the symmetric messages are acknowledged with their key
+// to the address registered with it, regardless of the address in the message
+func TestReceiptsSym(t *testing.T) {
+	topic := message.NewTopic([]byte("receipt-test"))
+	a, b, teardown := newReceiptTestNodes(t, topic)
+	defer teardown()
+
+	key := make([]byte, 32)
+	copy(key, "receipt-test-key")
+	aKeyID, err := a.ps.SetSymmetricKey(key, topic, b.ps.BaseAddr(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bKeyID, err := b.ps.SetSymmetricKey(key, topic, a.ps.BaseAddr(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.receipts.SendSym(context.Background(), aKeyID, topic, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if b.received != 1 {
+		t.Fatalf("expected the message received once, got %d", b.received)
+	}
+
+	var to PssAddress
+	b.receipts.sendFunc = func(addr []byte, _ message.Topic, _ []byte, _ bool, _ []byte) error {
+		to = addr
+		return nil
+	}
+	msg := a.receipts.newMsg(receiptMessage, topic, []byte("forged"))
+	msg.Address = make([]byte, addressLength)
+	payload, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.receipts.handle(payload, nil, false, bKeyID); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(to, a.ps.BaseAddr()) {
+		t.Fatalf("expected acknowledgement to the address of the key %x, got %x", a.ps.BaseAddr(), to)
+	}
+
+	// symmetric requests are rejected
+	msg = a.receipts.newMsg(receiptRequest, topic, []byte("ping"))
+	if payload, err = rlp.EncodeToBytes(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.receipts.handle(payload, nil, false, bKeyID); err == nil {
+		t.Fatal("expected error on a symmetric request")
+	}
+}
+
+// TestReceiptsPolicy tests that the messages with receipts are only delivered
+// if the policy of their topic allows it
+func TestReceiptsPolicy(t *testing.T) {
+	topic := message.NewTopic([]byte("receipt-test"))
+	a, b, teardown := newReceiptTestNodes(t, topic)
+	defer teardown()
+
+	if err := b.ps.SetTopicPolicy(topic, TopicPolicy{Forward: true}); err != nil {
+		t.Fatal(err)
+	}
+	err := a.receipts.SendAsym(context.Background(), toPubKeyID(t, b.ps), topic, []byte("hello"))
+	if err != ErrReceiptTimeout {
+		t.Fatalf("expected error %v, got %v", ErrReceiptTimeout, err)
+	}
+	if b.received != 0 {
+		t.Fatalf("expected the message not delivered, got %d", b.received)
+	}
+	if stats := b.ps.TopicStats()[topic]; stats.Dropped == 0 {
+		t.Fatalf("expected the message counted as dropped, got %+v", stats)
+	}
+}
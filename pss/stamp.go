@@ -0,0 +1,233 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/pss/message"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	defaultIssuerTimeout       = 5 * time.Second  // timeout of the verification of the chequebook of a postage stamp
+	defaultIssuerCacheCapacity = 1024             // number of verified chequebooks kept
+	defaultMineTimeout         = 10 * time.Second // max time spent mining the proof of work of a message
+	maxMineDifficulty          = 24               // highest difficulty mined by the node, higher ones need a postage stamp
+)
+
+// issuerRetryInterval is the time after which a chequebook whose verification failed
+// with a transient error is verified again, it is replaced in tests
+var issuerRetryInterval = time.Minute
+
+var (
+	errStampDifficulty = errors.New("message difficulty too low")
+	errPostageStamp    = errors.New("invalid postage stamp")
+	errMineDifficulty  = errors.New("difficulty too high to mine, a postage stamp is needed")
+)
+
+// ChequebookIssuer returns the issuer of the chequebook at address,
+// or the zero address if the address is not a valid chequebook
+// errors are considered transient, the chequebook is verified again later
+type ChequebookIssuer func(ctx context.Context, chequebook common.Address) (common.Address, error)
+
+// Postage configures the postage stamps of the node
+//
+// Messages with a postage stamp signed by the issuer of a valid chequebook
+// are forwarded regardless of their proof of work difficulty
+type Postage struct {
+	Chequebook common.Address    // chequebook stamping the messages sent by the node, zero to mine them
+	Key        *ecdsa.PrivateKey // key of the issuer of the chequebook
+	Issuer     ChequebookIssuer  // verifies the chequebooks of the postage stamps, nil to reject all postage stamps
+}
+
+// stamps holds the minimum difficulty of the messages forwarded by the node
+type stamps struct {
+	mu         sync.RWMutex
+	difficulty int                     // minimum difficulty of all messages
+	topics     map[message.Topic]int   // minimum difficulty of the messages on a topic, overriding difficulty
+	postage    *Postage                // nil if postage stamps are not accepted
+	issuers    *lru.Cache              // issuerEntry of the verified chequebooks
+	pending    map[common.Address]bool // chequebooks being verified
+}
+
+// issuerEntry is the result of the verification of a chequebook
+type issuerEntry struct {
+	issuer common.Address // zero if the chequebook is not valid
+	retry  time.Time      // set if the verification failed with a transient error
+}
+
+func newStamps(difficulty int) *stamps {
+	issuers, _ := lru.New(defaultIssuerCacheCapacity)
+	return &stamps{
+		difficulty: difficulty,
+		topics:     make(map[message.Topic]int),
+		issuers:    issuers,
+		pending:    make(map[common.Address]bool),
+	}
+}
+
+// SetPostage sets the postage stamps configuration of the node
+func (p *Pss) SetPostage(postage *Postage) {
+	p.stamps.mu.Lock()
+	defer p.stamps.mu.Unlock()
+	p.stamps.postage = postage
+	p.stamps.issuers.Purge()
+}
+
+// SetDifficulty sets the minimum proof of work difficulty of the messages forwarded by the node,
+// zero accepts all messages
+func (p *Pss) SetDifficulty(difficulty int) error {
+	if difficulty < 0 || difficulty > message.MaxDifficulty {
+		return message.ErrInvalidDifficulty
+	}
+	p.stamps.mu.Lock()
+	defer p.stamps.mu.Unlock()
+	p.stamps.difficulty = difficulty
+	return nil
+}
+
+// SetTopicDifficulty sets the minimum proof of work difficulty of the messages on the topic forwarded by the node
+// overriding the difficulty of all messages
+func (p *Pss) SetTopicDifficulty(topic message.Topic, difficulty int) error {
+	if difficulty < 0 || difficulty > message.MaxDifficulty {
+		return message.ErrInvalidDifficulty
+	}
+	p.stamps.mu.Lock()
+	defer p.stamps.mu.Unlock()
+	p.stamps.topics[topic] = difficulty
+	return nil
+}
+
+// RemoveTopicDifficulty removes the minimum difficulty of the topic,
+// the messages on the topic are subject to the difficulty of all messages
+func (p *Pss) RemoveTopicDifficulty(topic message.Topic) {
+	p.stamps.mu.Lock()
+	defer p.stamps.mu.Unlock()
+	delete(p.stamps.topics, topic)
+}
+
+// Difficulty returns the minimum proof of work difficulty of the messages on the topic forwarded by the node
+func (p *Pss) Difficulty(topic message.Topic) int {
+	p.stamps.mu.RLock()
+	defer p.stamps.mu.RUnlock()
+	if difficulty, ok := p.stamps.topics[topic]; ok {
+		return difficulty
+	}
+	return p.stamps.difficulty
+}
+
+// stamp stamps a message sent by the node if its topic requires it
+//
+// messages are signed with the chequebook of the node if it has one,
+// otherwise a proof of work of the difficulty of the topic is mined
+// mining is cancelled with ctx, takes at most defaultMineTimeout and is refused
+// for difficulties above maxMineDifficulty
+func (p *Pss) stamp(ctx context.Context, msg *message.Message) error {
+	difficulty := p.Difficulty(msg.Topic)
+	if difficulty == 0 {
+		return nil
+	}
+	p.stamps.mu.RLock()
+	postage := p.stamps.postage
+	p.stamps.mu.RUnlock()
+	if postage != nil && postage.Chequebook != (common.Address{}) {
+		return msg.SignStamp(postage.Chequebook, postage.Key)
+	}
+	if difficulty > maxMineDifficulty {
+		return errMineDifficulty
+	}
+	ctx, cancel := context.WithTimeout(ctx, defaultMineTimeout)
+	defer cancel()
+	return msg.Mine(ctx, difficulty)
+}
+
+// checkStamp checks that the message satisfies the difficulty of its topic,
+// either by proof of work or by a postage stamp
+func (p *Pss) checkStamp(msg *message.Message) error {
+	difficulty := p.Difficulty(msg.Topic)
+	if difficulty == 0 || msg.Difficulty() >= difficulty {
+		return nil
+	}
+	chequebook, signer, err := msg.PostageStamp()
+	if err == message.ErrNoPostageStamp {
+		return errStampDifficulty
+	}
+	if err != nil {
+		return errPostageStamp
+	}
+	issuer, ok := p.chequebookIssuer(chequebook)
+	if !ok || issuer != signer || issuer == (common.Address{}) {
+		return errPostageStamp
+	}
+	return nil
+}
+
+// chequebookIssuer returns the issuer of a chequebook, and false if it is not verified yet
+//
+// chequebooks are verified once in the background, so that forwarding does not wait
+// for the chain, the messages stamped with a chequebook are dropped until it is verified
+func (p *Pss) chequebookIssuer(chequebook common.Address) (common.Address, bool) {
+	p.stamps.mu.Lock()
+	defer p.stamps.mu.Unlock()
+	if v, ok := p.stamps.issuers.Get(chequebook); ok {
+		entry := v.(*issuerEntry)
+		if entry.retry.IsZero() || time.Now().Before(entry.retry) {
+			return entry.issuer, true
+		}
+	}
+	postage := p.stamps.postage
+	if postage == nil || postage.Issuer == nil {
+		return common.Address{}, false
+	}
+	if !p.stamps.pending[chequebook] {
+		p.stamps.pending[chequebook] = true
+		go p.verifyChequebook(postage, chequebook)
+	}
+	metrics.GetOrRegisterCounter("pss/stamp/pending", nil).Inc(1)
+	return common.Address{}, false
+}
+
+// verifyChequebook verifies the chequebook of a postage stamp and caches its issuer
+// transient errors are cached for issuerRetryInterval only
+func (p *Pss) verifyChequebook(postage *Postage, chequebook common.Address) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultIssuerTimeout)
+	defer cancel()
+	entry := &issuerEntry{}
+	issuer, err := postage.Issuer(ctx, chequebook)
+	if err != nil {
+		log.Debug("pss chequebook verification failed", "chequebook", chequebook, "err", err)
+		entry.retry = time.Now().Add(issuerRetryInterval)
+	} else {
+		entry.issuer = issuer
+	}
+	p.stamps.mu.Lock()
+	defer p.stamps.mu.Unlock()
+	delete(p.stamps.pending, chequebook)
+	// the postage configuration changed in the meantime
+	if p.stamps.postage != postage {
+		return
+	}
+	p.stamps.issuers.Add(chequebook, entry)
+}
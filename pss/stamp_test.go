@@ -0,0 +1,225 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethersphere/swarm/pss/message"
+	"github.com/ethersphere/swarm/testutil"
+)
+
+func newStampTestMessage(topic message.Topic) *message.Message {
+	msg := message.New(message.Flags{Raw: true})
+	msg.To = testutil.RandomBytes(1, addressLength)
+	msg.Expire = uint32(time.Now().Add(time.Minute).Unix())
+	msg.Topic = topic
+	msg.Payload = testutil.RandomBytes(2, 100)
+	return msg
+}
+
+// TestStampDifficulty tests that messages are only forwarded with the difficulty of their topic
+func TestStampDifficulty(t *testing.T) {
+	privkey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := newTestPss(privkey, nil, nil)
+	defer ps.Stop()
+	topic := message.NewTopic([]byte("stamp-test"))
+
+	if err := ps.SetDifficulty(message.MaxDifficulty + 1); err != message.ErrInvalidDifficulty {
+		t.Fatalf("expected error %v, got %v", message.ErrInvalidDifficulty, err)
+	}
+	if err := ps.SetDifficulty(8); err != nil {
+		t.Fatal(err)
+	}
+	msg := newStampTestMessage(topic)
+	if err := ps.handlePssMsg(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if ps.checkFwdCache(msg) {
+		t.Fatal("expected message without stamp to be dropped")
+	}
+
+	// messages sent by the node are mined with the difficulty of their topic
+	if err := ps.stamp(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Difficulty() < 8 {
+		t.Fatalf("expected difficulty at least 8, got %d", msg.Difficulty())
+	}
+	if err := ps.handlePssMsg(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if !ps.checkFwdCache(msg) {
+		t.Fatal("expected message with stamp to be forwarded")
+	}
+
+	// the difficulty of the topic overrides the difficulty of the node
+	if err := ps.SetTopicDifficulty(topic, 20); err != nil {
+		t.Fatal(err)
+	}
+	if ps.Difficulty(topic) != 20 || ps.Difficulty(message.Topic{}) != 8 {
+		t.Fatalf("unexpected difficulties %d, %d", ps.Difficulty(topic), ps.Difficulty(message.Topic{}))
+	}
+	if msg.Difficulty() < 20 && ps.checkStamp(msg) != errStampDifficulty {
+		t.Fatal("expected message below the difficulty of the topic to be dropped")
+	}
+	if err := ps.SetTopicDifficulty(topic, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.checkStamp(newStampTestMessage(topic)); err != nil {
+		t.Fatal(err)
+	}
+	ps.RemoveTopicDifficulty(topic)
+	if ps.Difficulty(topic) != 8 {
+		t.Fatalf("expected difficulty 8, got %d", ps.Difficulty(topic))
+	}
+}
+
+// TestPostageStamp tests that messages with a postage stamp of a verified chequebook are forwarded
+func TestPostageStamp(t *testing.T) {
+	privkey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := newTestPss(privkey, nil, nil)
+	defer ps.Stop()
+	topic := message.NewTopic([]byte("stamp-test"))
+	if err := ps.SetDifficulty(message.MaxDifficulty); err != nil {
+		t.Fatal(err)
+	}
+
+	issuerKey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chequebook := common.HexToAddress("0x1234")
+	transient := common.HexToAddress("0x9abc")
+	var verified int32
+	ps.SetPostage(&Postage{
+		Chequebook: chequebook,
+		Key:        issuerKey,
+		Issuer: func(ctx context.Context, address common.Address) (common.Address, error) {
+			atomic.AddInt32(&verified, 1)
+			switch address {
+			case chequebook:
+				return ethCrypto.PubkeyToAddress(issuerKey.PublicKey), nil
+			case transient:
+				return common.Address{}, errors.New("connection refused")
+			}
+			return common.Address{}, nil
+		},
+	})
+	defer func(interval time.Duration) { issuerRetryInterval = interval }(issuerRetryInterval)
+	issuerRetryInterval = 0
+
+	// checkStamp waits for the chequebook of a message to be verified in the background
+	checkStamp := func(msg *message.Message, verifications int32) error {
+		ps.checkStamp(msg)
+		for i := 0; i < 100 && atomic.LoadInt32(&verified) < verifications; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+		return ps.checkStamp(msg)
+	}
+
+	// messages sent by the node are signed with its chequebook
+	msg := newStampTestMessage(topic)
+	if err := ps.stamp(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.checkStamp(msg); err != errPostageStamp {
+		t.Fatalf("expected message to be dropped until its chequebook is verified, got %v", err)
+	}
+	if err := checkStamp(msg, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// changing the expiry invalidates the stamp
+	msg.Expire++
+	if err := ps.checkStamp(msg); err != errPostageStamp {
+		t.Fatalf("expected error %v, got %v", errPostageStamp, err)
+	}
+
+	otherKey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.SignStamp(chequebook, otherKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.checkStamp(msg); err != errPostageStamp {
+		t.Fatalf("expected error %v, got %v", errPostageStamp, err)
+	}
+	if err := msg.SignStamp(common.HexToAddress("0x5678"), otherKey); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := checkStamp(msg, 2); err != errPostageStamp {
+			t.Fatalf("expected error %v, got %v", errPostageStamp, err)
+		}
+	}
+	if n := atomic.LoadInt32(&verified); n != 2 {
+		t.Fatalf("expected chequebooks verified once, got %d verifications", n)
+	}
+
+	// transient verification failures are not cached
+	if err := msg.SignStamp(transient, otherKey); err != nil {
+		t.Fatal(err)
+	}
+	for i := int32(3); i < 5; i++ {
+		if err := checkStamp(msg, i); err != errPostageStamp {
+			t.Fatalf("expected error %v, got %v", errPostageStamp, err)
+		}
+	}
+	if n := atomic.LoadInt32(&verified); n < 4 {
+		t.Fatalf("expected chequebook verified again after a transient error, got %d verifications", n)
+	}
+}
+
+// TestStampMineDifficulty tests that the node refuses to mine difficulties above maxMineDifficulty
+func TestStampMineDifficulty(t *testing.T) {
+	privkey, err := ethCrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := newTestPss(privkey, nil, nil)
+	defer ps.Stop()
+	topic := message.NewTopic([]byte("stamp-test"))
+	if err := ps.SetTopicDifficulty(topic, maxMineDifficulty+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.stamp(context.Background(), newStampTestMessage(topic)); err != errMineDifficulty {
+		t.Fatalf("expected error %v, got %v", errMineDifficulty, err)
+	}
+	if err := ps.SetTopicDifficulty(topic, maxMineDifficulty); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ps.stamp(ctx, newStampTestMessage(topic)); err != context.Canceled {
+		t.Fatalf("expected error %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,695 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+const (
+	defaultStreamWindow            = 32              // number of frames sent without acknowledgement and buffered by the receiver
+	defaultStreamFrameSize         = 16 * 1024       // maximum size of the data of a frame
+	defaultStreamRetransmitTimeout = 2 * time.Second // time to wait for an acknowledgement before sending a frame again
+	defaultStreamRetries           = 8               // number of retransmissions without acknowledgement before the stream fails
+	streamBacklog                  = 16              // number of streams opened and not accepted yet on a topic
+)
+
+const (
+	streamOpen  = iota // opens the stream, the first sequenced frame
+	streamData         // data of the stream
+	streamClose        // closes the stream, the last sequenced frame
+	streamAck          // acknowledges the sequenced frames and advertises the window
+	streamReset        // aborts the stream
+	streamProbe        // asks for the window of the peer, answered with an acknowledgement
+)
+
+var (
+	streamTopic = message.NewTopic([]byte("pss-stream"))
+
+	// ErrStreamClosed is returned when using a stream or a listener after it was closed
+	ErrStreamClosed = errors.New("stream closed")
+	// ErrStreamReset is returned when the peer refused or aborted the stream
+	ErrStreamReset = errors.New("stream reset by peer")
+	// ErrStreamTimeout is returned when the frames of the stream are not acknowledged after all retransmissions
+	ErrStreamTimeout = errors.New("stream timeout")
+)
+
+// StreamParams are the parameters of the streams
+type StreamParams struct {
+	Window            int           // number of frames sent without acknowledgement and buffered by the receiver
+	FrameSize         int           // maximum size of the data of a frame
+	RetransmitTimeout time.Duration // time to wait for an acknowledgement before sending a frame again
+	Retries           int           // number of retransmissions without acknowledgement before the stream fails
+}
+
+// NewStreamParams returns the default stream parameters
+func NewStreamParams() *StreamParams {
+	return &StreamParams{
+		Window:            defaultStreamWindow,
+		FrameSize:         defaultStreamFrameSize,
+		RetransmitTimeout: defaultStreamRetransmitTimeout,
+		Retries:           defaultStreamRetries,
+	}
+}
+
+// streamFrame is the payload of the pss messages of the streams
+type streamFrame struct {
+	ID      uint64        // stream id chosen by the dialer
+	Code    uint8         //
+	Seq     uint64        // sequence number of open, data and close frames
+	Ack     uint64        // sequence number of the next frame expected by the sender of the frame
+	Window  uint32        // number of frames the sender of the frame can receive
+	Address []byte        // address of the sender of the frame
+	Topic   message.Topic // open: topic of the stream
+	Payload []byte        // data: data of the stream
+}
+
+// sentFrame is a sequenced frame waiting for its acknowledgement
+type sentFrame struct {
+	frame *streamFrame
+	sent  time.Time
+}
+
+// Streams multiplexes reliable, ordered and flow controlled streams over pss
+//
+// The frames of a stream are numbered, acknowledged by the receiver and sent again until they are acknowledged.
+// The receiver delivers the frames in order and advertises how many frames it can buffer,
+// the sender does not send more frames than the receiver can buffer.
+// Streams are encrypted with the public keys of the peers.
+type Streams struct {
+	pss       *Pss
+	params    *StreamParams
+	mu        sync.Mutex
+	streams   map[string]*Stream                // streams by public key and id of the peer
+	listeners map[message.Topic]*StreamListener // listeners by topic
+	dereg     func()
+	quitC     chan struct{}
+
+	sendFunc func(to []byte, topic message.Topic, msg []byte, asymmetric bool, key []byte) error // sends a frame, Pss.send unless overridden in tests
+}
+
+// SetStreams enables the streams on the pss node
+//
+// Must be called before starting the pss node service
+func SetStreams(p *Pss, params *StreamParams) *Streams {
+	ss := &Streams{
+		pss:       p,
+		params:    params,
+		streams:   make(map[string]*Stream),
+		listeners: make(map[message.Topic]*StreamListener),
+		quitC:     make(chan struct{}),
+		sendFunc:  p.send,
+	}
+	ss.dereg = p.Register(&streamTopic, NewHandler(ss.handle))
+	go ss.retransmitLoop()
+	return ss
+}
+
+// Close stops the streams, the listeners are closed and the open streams fail
+func (ss *Streams) Close() {
+	ss.dereg()
+	close(ss.quitC)
+	ss.mu.Lock()
+	streams := ss.streams
+	ss.streams = make(map[string]*Stream)
+	listeners := ss.listeners
+	ss.mu.Unlock()
+	for _, l := range listeners {
+		l.Close()
+	}
+	for _, s := range streams {
+		s.mu.Lock()
+		s.fail(ErrStreamClosed)
+		s.mu.Unlock()
+	}
+}
+
+// Dial opens a stream on the topic to the peer with the public key
+// The public key of the peer must be set for the topic
+// It returns when the peer accepted the stream
+func (ss *Streams) Dial(ctx context.Context, pubkeyid string, topic message.Topic) (*Stream, error) {
+	psp, ok := ss.pss.getPeerPub(pubkeyid, topic)
+	if !ok {
+		return nil, fmt.Errorf("invalid topic '%s' for pubkey '%s'", topic.String(), pubkeyid)
+	}
+	var id [8]byte
+	if _, err := crand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	s := ss.newStream(binary.BigEndian.Uint64(id[:]), pubkeyid, psp.address, topic)
+	ss.mu.Lock()
+	ss.streams[s.key()] = s
+	ss.mu.Unlock()
+
+	s.mu.Lock()
+	open := s.newFrame(streamOpen, nil)
+	open.Topic = topic
+	s.mu.Unlock()
+	ss.send(s, open)
+	metrics.GetOrRegisterCounter("pss/stream/dial", nil).Inc(1)
+
+	select {
+	case <-s.opened:
+		return s, nil
+	case <-s.failC:
+		ss.remove(s)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return nil, s.err
+	case <-ctx.Done():
+		s.mu.Lock()
+		s.fail(ctx.Err())
+		s.mu.Unlock()
+		ss.remove(s)
+		// the peer may have accepted the stream
+		ss.send(s, &streamFrame{ID: s.id, Code: streamReset, Address: ss.pss.BaseAddr()})
+		return nil, ctx.Err()
+	}
+}
+
+// Listen returns a listener of the streams opened on the topic
+func (ss *Streams) Listen(topic message.Topic) (*StreamListener, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if _, ok := ss.listeners[topic]; ok {
+		return nil, fmt.Errorf("topic '%s' already has a listener", topic.String())
+	}
+	l := &StreamListener{
+		streams: ss,
+		topic:   topic,
+		acceptC: make(chan *Stream, streamBacklog),
+		quitC:   make(chan struct{}),
+	}
+	ss.listeners[topic] = l
+	return l, nil
+}
+
+func (ss *Streams) newStream(id uint64, pubkeyid string, address PssAddress, topic message.Topic) *Stream {
+	s := &Stream{
+		streams:      ss,
+		id:           id,
+		pubkeyid:     pubkeyid,
+		address:      address,
+		topic:        topic,
+		opened:       make(chan struct{}),
+		failC:        make(chan struct{}),
+		remoteWindow: ss.params.Window,
+		received:     make(map[uint64]*streamFrame),
+		advertised:   ss.params.Window,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (ss *Streams) remove(s *Stream) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.streams[s.key()] == s {
+		delete(ss.streams, s.key())
+	}
+}
+
+// send sends the frames of the stream to its peer
+func (ss *Streams) send(s *Stream, frames ...*streamFrame) {
+	for _, f := range frames {
+		ss.sendTo(s.address, s.pubkeyid, f)
+	}
+}
+
+func (ss *Streams) sendTo(address PssAddress, pubkeyid string, f *streamFrame) {
+	payload, err := rlp.EncodeToBytes(f)
+	if err != nil {
+		log.Error("pss stream frame encoding failed", "err", err)
+		return
+	}
+	if err := ss.sendFunc(address, streamTopic, payload, true, common.FromHex(pubkeyid)); err != nil {
+		log.Debug("pss stream frame send failed", "id", f.ID, "code", f.Code, "err", err)
+	}
+}
+
+func (ss *Streams) handle(payload []byte, _ *p2p.Peer, asymmetric bool, keyid string) error {
+	// the peer of a stream is the signer of its frames
+	if !asymmetric {
+		return errors.New("stream frame not encrypted with public key")
+	}
+	var f streamFrame
+	if err := rlp.DecodeBytes(payload, &f); err != nil {
+		return fmt.Errorf("invalid stream frame: %v", err)
+	}
+	if err := validateAddress(f.Address); err != nil {
+		return err
+	}
+
+	ss.mu.Lock()
+	s, ok := ss.streams[streamKey(keyid, f.ID)]
+	if !ok && f.Code == streamOpen {
+		s = ss.accept(&f, keyid)
+	}
+	ss.mu.Unlock()
+
+	if s == nil {
+		switch f.Code {
+		case streamOpen, streamData, streamProbe:
+			ss.sendTo(f.Address, keyid, &streamFrame{ID: f.ID, Code: streamReset, Address: ss.pss.BaseAddr()})
+		case streamClose:
+			// the stream was closed and acknowledged before, acknowledge the close again
+			ss.sendTo(f.Address, keyid, &streamFrame{ID: f.ID, Code: streamAck, Ack: f.Seq + 1, Address: ss.pss.BaseAddr()})
+		}
+		return nil
+	}
+	s.mu.Lock()
+	replies := s.receive(&f)
+	done := s.done()
+	s.mu.Unlock()
+	if done {
+		ss.remove(s)
+	}
+	ss.send(s, replies...)
+	return nil
+}
+
+// accept passes a new stream opened by the frame to the listener of its topic,
+// it returns nil if the topic has no listener or too many streams are waiting to be accepted
+func (ss *Streams) accept(f *streamFrame, keyid string) *Stream {
+	l, ok := ss.listeners[f.Topic]
+	if !ok {
+		return nil
+	}
+	s := ss.newStream(f.ID, keyid, f.Address, f.Topic)
+	close(s.opened)
+	select {
+	case l.acceptC <- s:
+	default:
+		return nil
+	}
+	ss.streams[s.key()] = s
+	metrics.GetOrRegisterCounter("pss/stream/accept", nil).Inc(1)
+	return s
+}
+
+func (ss *Streams) retransmitLoop() {
+	ticker := time.NewTicker(ss.params.RetransmitTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ss.quitC:
+			return
+		case <-ss.pss.quitC:
+			return
+		case <-ticker.C:
+			ss.retransmit()
+		}
+	}
+}
+
+// retransmit sends the frames which were not acknowledged in time again
+// and fails the streams whose frames are not acknowledged after all retransmissions
+func (ss *Streams) retransmit() {
+	ss.mu.Lock()
+	streams := make([]*Stream, 0, len(ss.streams))
+	for _, s := range ss.streams {
+		streams = append(streams, s)
+	}
+	ss.mu.Unlock()
+
+	now := time.Now()
+	for _, s := range streams {
+		var frames []*streamFrame
+		s.mu.Lock()
+		for _, sf := range s.unacked {
+			if now.Sub(sf.sent) < ss.params.RetransmitTimeout {
+				continue
+			}
+			sf.sent = now
+			f := *sf.frame
+			f.Ack, f.Window = s.expected, uint32(s.window())
+			frames = append(frames, &f)
+		}
+		if len(frames) > 0 {
+			s.retries++
+			metrics.GetOrRegisterCounter("pss/stream/retransmit", nil).Inc(int64(len(frames)))
+		}
+		// the window update of the peer may have been lost, ask for it
+		if len(s.unacked) == 0 && s.remoteWindow == 0 && !s.writeClosed && s.err == nil && now.Sub(s.probed) >= ss.params.RetransmitTimeout {
+			s.probed = now
+			s.retries++
+			probe := s.ackFrame()
+			probe.Code = streamProbe
+			frames = append(frames, probe)
+		}
+		failed := s.retries > ss.params.Retries
+		if failed {
+			metrics.GetOrRegisterCounter("pss/stream/timeout", nil).Inc(1)
+			s.fail(ErrStreamTimeout)
+			frames = nil
+		}
+		s.mu.Unlock()
+		if failed {
+			ss.remove(s)
+		}
+		ss.send(s, frames...)
+	}
+}
+
+// StreamListener accepts the streams opened on a topic
+type StreamListener struct {
+	streams   *Streams
+	topic     message.Topic
+	acceptC   chan *Stream
+	closeOnce sync.Once
+	quitC     chan struct{}
+}
+
+// Accept waits for and returns the next stream opened on the topic
+func (l *StreamListener) Accept() (*Stream, error) {
+	select {
+	case s := <-l.acceptC:
+		return s, nil
+	case <-l.quitC:
+		return nil, ErrStreamClosed
+	}
+}
+
+// Close stops accepting streams on the topic
+func (l *StreamListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.streams.mu.Lock()
+		delete(l.streams.listeners, l.topic)
+		l.streams.mu.Unlock()
+		close(l.quitC)
+	})
+	return nil
+}
+
+// Stream is a reliable, ordered and flow controlled stream of data with a peer over pss
+//
+// Implements io.ReadWriteCloser
+type Stream struct {
+	streams  *Streams
+	id       uint64
+	pubkeyid string // public key of the peer
+	address  PssAddress
+	topic    message.Topic
+
+	mu     sync.Mutex
+	cond   *sync.Cond    // signals the readers and writers of the stream
+	opened chan struct{} // closed when the peer accepted the stream
+	failC  chan struct{} // closed when the stream fails
+	err    error         // error of the failed stream
+	closed bool          // closed by the node
+
+	// sending
+	writeClosed  bool         // closed for writing by the node
+	seq          uint64       // sequence number of the next sequenced frame
+	unacked      []*sentFrame // sequenced frames not acknowledged, by sequence number
+	remoteAck    uint64       // sequence number of the next frame expected by the peer
+	remoteWindow int          // number of frames the peer can receive
+	retries      int          // number of retransmissions since the last acknowledgement
+	probed       time.Time    // time the window of the peer was last asked for
+
+	// receiving
+	expected     uint64                  // sequence number of the next frame expected
+	received     map[uint64]*streamFrame // frames received before the frames preceding them
+	readQueue    [][]byte                // data received in order and not read yet
+	advertised   int                     // window advertised in the last frame sent
+	remoteClosed bool                    // closed by the peer
+}
+
+// Topic returns the topic of the stream
+func (s *Stream) Topic() message.Topic {
+	return s.topic
+}
+
+// PublicKey returns the public key of the peer of the stream
+func (s *Stream) PublicKey() string {
+	return s.pubkeyid
+}
+
+// Read reads the data received from the peer in order
+// It returns io.EOF when the peer closed the stream and all its data was read
+func (s *Stream) Read(b []byte) (int, error) {
+	s.mu.Lock()
+	for len(s.readQueue) == 0 && !s.remoteClosed && s.err == nil && !s.closed {
+		s.cond.Wait()
+	}
+	if s.closed {
+		s.mu.Unlock()
+		return 0, ErrStreamClosed
+	}
+	if len(s.readQueue) == 0 {
+		defer s.mu.Unlock()
+		if s.err != nil {
+			return 0, s.err
+		}
+		return 0, io.EOF
+	}
+	n := copy(b, s.readQueue[0])
+	if n == len(s.readQueue[0]) {
+		s.readQueue = s.readQueue[1:]
+	} else {
+		s.readQueue[0] = s.readQueue[0][n:]
+	}
+	// the window reopened, let the sender continue
+	var update *streamFrame
+	if s.advertised == 0 && s.err == nil {
+		update = s.ackFrame()
+	}
+	s.mu.Unlock()
+	if update != nil {
+		s.streams.send(s, update)
+	}
+	return n, nil
+}
+
+// Write sends the data to the peer
+// It blocks while the peer can not receive more frames
+func (s *Stream) Write(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		s.mu.Lock()
+		for s.err == nil && !s.writeClosed && len(s.unacked) >= s.sendWindow() {
+			s.cond.Wait()
+		}
+		if s.writeClosed {
+			s.mu.Unlock()
+			return n, ErrStreamClosed
+		}
+		if s.err != nil {
+			err := s.err
+			s.mu.Unlock()
+			return n, err
+		}
+		size := len(b)
+		if size > s.streams.params.FrameSize {
+			size = s.streams.params.FrameSize
+		}
+		payload := make([]byte, size)
+		copy(payload, b)
+		f := s.newFrame(streamData, payload)
+		s.mu.Unlock()
+		s.streams.send(s, f)
+		n += size
+		b = b[size:]
+	}
+	return n, nil
+}
+
+// CloseWrite closes the stream for writing, the peer reads io.EOF after the data written before
+// The data of the peer can still be read
+func (s *Stream) CloseWrite() error {
+	s.mu.Lock()
+	f := s.closeWrite()
+	s.mu.Unlock()
+	if f != nil {
+		s.streams.send(s, f)
+	}
+	return nil
+}
+
+// Close closes the stream, the data written before is still delivered
+// and the data of the peer not read yet is discarded
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.readQueue = nil
+	s.cond.Broadcast()
+	f := s.closeWrite()
+	done := s.done()
+	s.mu.Unlock()
+	if done {
+		s.streams.remove(s)
+	}
+	if f != nil {
+		s.streams.send(s, f)
+	}
+	return nil
+}
+
+// closeWrite returns the close frame to send if the stream was not closed for writing before
+func (s *Stream) closeWrite() *streamFrame {
+	if s.writeClosed || s.err != nil {
+		return nil
+	}
+	s.writeClosed = true
+	s.cond.Broadcast()
+	return s.newFrame(streamClose, nil)
+}
+
+func (s *Stream) key() string {
+	return streamKey(s.pubkeyid, s.id)
+}
+
+func streamKey(pubkeyid string, id uint64) string {
+	return fmt.Sprintf("%s/%x", pubkeyid, id)
+}
+
+// newFrame returns a new sequenced frame waiting for its acknowledgement
+func (s *Stream) newFrame(code uint8, payload []byte) *streamFrame {
+	f := s.ackFrame()
+	f.Code = code
+	f.Seq = s.seq
+	f.Payload = payload
+	s.seq++
+	s.unacked = append(s.unacked, &sentFrame{frame: f, sent: time.Now()})
+	return f
+}
+
+// ackFrame returns a frame acknowledging the frames received and advertising the window
+func (s *Stream) ackFrame() *streamFrame {
+	s.advertised = s.window()
+	return &streamFrame{
+		ID:      s.id,
+		Code:    streamAck,
+		Ack:     s.expected,
+		Window:  uint32(s.advertised),
+		Address: s.streams.pss.BaseAddr(),
+	}
+}
+
+// window returns the number of frames the node can receive
+func (s *Stream) window() int {
+	if w := s.streams.params.Window - len(s.readQueue); w > 0 {
+		return w
+	}
+	return 0
+}
+
+// sendWindow returns the number of frames which can be sent without acknowledgement
+func (s *Stream) sendWindow() int {
+	if s.remoteWindow < s.streams.params.Window {
+		return s.remoteWindow
+	}
+	return s.streams.params.Window
+}
+
+// receive processes a frame from the peer and returns the frames to reply with
+func (s *Stream) receive(f *streamFrame) []*streamFrame {
+	if f.Code == streamReset {
+		s.fail(ErrStreamReset)
+		return nil
+	}
+	s.acknowledged(f.Ack, f.Window)
+	if f.Code == streamAck || s.err != nil {
+		return nil
+	}
+	if f.Code == streamProbe {
+		return []*streamFrame{s.ackFrame()}
+	}
+	if f.Seq >= s.expected && f.Seq-s.expected < uint64(s.window()) {
+		s.received[f.Seq] = f
+	}
+	for {
+		next, ok := s.received[s.expected]
+		if !ok {
+			break
+		}
+		delete(s.received, s.expected)
+		s.expected++
+		switch next.Code {
+		case streamData:
+			// the data is discarded once the stream is closed
+			if len(next.Payload) > 0 && !s.closed {
+				s.readQueue = append(s.readQueue, next.Payload)
+			}
+		case streamClose:
+			s.remoteClosed = true
+		}
+	}
+	s.cond.Broadcast()
+	return []*streamFrame{s.ackFrame()}
+}
+
+// acknowledged removes the frames acknowledged by the peer and updates the window of the peer
+func (s *Stream) acknowledged(ack uint64, window uint32) {
+	// acknowledgements received out of order advertise an outdated window
+	if ack < s.remoteAck {
+		return
+	}
+	s.remoteAck = ack
+	var n int
+	for n < len(s.unacked) && s.unacked[n].frame.Seq < ack {
+		n++
+	}
+	// the peer answered a probe or acknowledged frames
+	if n > 0 || len(s.unacked) == 0 {
+		s.retries = 0
+	}
+	if n > 0 {
+		s.unacked = s.unacked[n:]
+		select {
+		case <-s.opened:
+		default:
+			close(s.opened)
+		}
+	}
+	s.remoteWindow = int(window)
+	s.cond.Broadcast()
+}
+
+// fail ends the stream with the error
+func (s *Stream) fail(err error) {
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	s.unacked = nil
+	close(s.failC)
+	s.cond.Broadcast()
+}
+
+// done returns whether the stream can be removed,
+// it failed or it was closed and all its frames were acknowledged
+func (s *Stream) done() bool {
+	return s.err != nil || (s.closed && len(s.unacked) == 0)
+}
@@ -0,0 +1,246 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethersphere/swarm/p2p/protocols"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// streamTestNode is a pss node with streams
+type streamTestNode struct {
+	ps      *Pss
+	streams *Streams
+}
+
+// newStreamTestNodes returns two nodes with streams, the frames between them are
+// delayed at random, and dropped when drop returns true
+func newStreamTestNodes(t *testing.T, topic message.Topic, drop func() bool) (*streamTestNode, *streamTestNode, func()) {
+	t.Helper()
+	params := NewStreamParams()
+	params.Window = 4
+	params.FrameSize = 1024
+	params.RetransmitTimeout = 50 * time.Millisecond
+	params.Retries = 20
+	pssNodes, stop := newTestPssNodes(t, 2)
+	deliver := newTestDelivery(pssNodes)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var stopped bool
+	rnd := rand.New(rand.NewSource(1))
+	var nodes []*streamTestNode
+	for _, ps := range pssNodes {
+		from := ps
+		node := &streamTestNode{ps: ps, streams: SetStreams(ps, params)}
+		node.streams.sendFunc = func(to []byte, topic message.Topic, msg []byte, asymmetric bool, key []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if stopped || drop() {
+				return nil
+			}
+			delay := time.Duration(rnd.Intn(5)) * time.Millisecond
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				time.Sleep(delay)
+				deliver(from, to, topic, msg, asymmetric, key)
+			}()
+			return nil
+		}
+		nodes = append(nodes, node)
+	}
+	a, b := nodes[0], nodes[1]
+	setTestPeers(t, topic, a.ps, b.ps)
+	return a, b, func() {
+		for _, node := range nodes {
+			node.streams.Close()
+		}
+		mu.Lock()
+		stopped = true
+		mu.Unlock()
+		wg.Wait()
+		stop()
+	}
+}
+
+// TestStream tests that data is delivered in order in both directions over a lossy network
+func TestStream(t *testing.T) {
+	topic := message.NewTopic([]byte("stream-test"))
+	rnd := rand.New(rand.NewSource(2))
+	a, b, teardown := newStreamTestNodes(t, topic, func() bool { return rnd.Intn(10) == 0 })
+	defer teardown()
+
+	l, err := b.streams.Listen(topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := b.streams.Listen(topic); err == nil {
+		t.Fatal("expected error listening twice on the topic")
+	}
+
+	data := make([]byte, 64*1024)
+	rnd.Read(data)
+	errC := make(chan error, 1)
+	go func() {
+		s, err := l.Accept()
+		if err != nil {
+			errC <- err
+			return
+		}
+		if s.PublicKey() != toPubKeyID(t, a.ps) || s.Topic() != topic {
+			errC <- fmt.Errorf("unexpected stream from %s on topic %x", s.PublicKey(), s.Topic())
+			return
+		}
+		// echo the data back
+		if _, err := io.Copy(s, s); err != nil {
+			errC <- err
+			return
+		}
+		errC <- s.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s, err := a.streams.Dial(ctx, toPubKeyID(t, b.ps), topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		s.Write(data)
+		s.CloseWrite()
+	}()
+	echo, err := ioutil.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(echo, data) {
+		t.Fatalf("expected %d bytes echoed, got %d different bytes", len(data), len(echo))
+	}
+	if _, err := s.Write([]byte("hello")); err != ErrStreamClosed {
+		t.Fatalf("expected error %v, got %v", ErrStreamClosed, err)
+	}
+	s.Close()
+}
+
+// TestStreamFailure tests dialing a peer which does not accept streams on the topic
+// and a peer which is unreachable
+func TestStreamFailure(t *testing.T) {
+	topic := message.NewTopic([]byte("stream-test"))
+	var unreachable int32
+	a, b, teardown := newStreamTestNodes(t, topic, func() bool { return atomic.LoadInt32(&unreachable) == 1 })
+	defer teardown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := a.streams.Dial(ctx, toPubKeyID(t, b.ps), topic); err != ErrStreamReset {
+		t.Fatalf("expected error %v, got %v", ErrStreamReset, err)
+	}
+
+	atomic.StoreInt32(&unreachable, 1)
+	if _, err := a.streams.Dial(ctx, toPubKeyID(t, b.ps), topic); err != ErrStreamTimeout {
+		t.Fatalf("expected error %v, got %v", ErrStreamTimeout, err)
+	}
+}
+
+type streamTestMsg struct {
+	Payload []byte
+}
+
+// TestStreamProtocol tests running a devp2p protocol over a stream
+func TestStreamProtocol(t *testing.T) {
+	topic := message.NewTopic([]byte("stream-test"))
+	rnd := rand.New(rand.NewSource(3))
+	a, b, teardown := newStreamTestNodes(t, topic, func() bool { return rnd.Intn(10) == 0 })
+	defer teardown()
+
+	spec := &protocols.Spec{
+		Name:       "streamtest",
+		Version:    1,
+		MaxMsgSize: 10 * 1024,
+		Messages:   []interface{}{streamTestMsg{}},
+	}
+	newPeer := func(s *Stream, id enode.ID) *protocols.Peer {
+		return protocols.NewPeer(p2p.NewPeer(id, "streamtest", nil), NewStreamReadWriter(s, spec.MaxMsgSize), spec)
+	}
+
+	l, err := b.streams.Listen(topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// the peer echoes the messages, which are handled concurrently
+	go func() {
+		s, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer s.Close()
+		peer := newPeer(s, enode.ID{1})
+		peer.Run(func(ctx context.Context, msg interface{}) error {
+			return peer.Send(ctx, msg)
+		})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s, err := a.streams.Dial(ctx, toPubKeyID(t, b.ps), topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := newPeer(s, enode.ID{2})
+	const count = 20
+	received := make(chan *streamTestMsg, count)
+	go peer.Run(func(ctx context.Context, msg interface{}) error {
+		received <- msg.(*streamTestMsg)
+		return nil
+	})
+	for i := 0; i < count; i++ {
+		if err := peer.Send(ctx, &streamTestMsg{Payload: bytes.Repeat([]byte{byte(i)}, 2000)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seen := make(map[byte]bool)
+	for i := 0; i < count; i++ {
+		select {
+		case msg := <-received:
+			if len(msg.Payload) != 2000 || !bytes.Equal(msg.Payload, bytes.Repeat(msg.Payload[:1], 2000)) || seen[msg.Payload[0]] {
+				t.Fatalf("unexpected message %x", msg.Payload)
+			}
+			seen[msg.Payload[0]] = true
+		case <-ctx.Done():
+			t.Fatalf("received %d messages: %v", i, ctx.Err())
+		}
+	}
+	s.Close()
+}
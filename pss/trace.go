@@ -0,0 +1,232 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"context"
+	crand "crypto/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/log"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+const (
+	defaultTraceTimeout = 30 * time.Second // time to wait for the reply to a trace probe if the context has no deadline
+	traceIDSize         = 16
+)
+
+// traceTopic is the topic of the trace probes and their replies
+var traceTopic = message.NewTopic([]byte("pss-trace"))
+
+// traceMsg is the payload of a trace probe or of its reply
+type traceMsg struct {
+	ID       []byte
+	Reply    bool
+	From     []byte        // address of the sender, the reply is sent to
+	Received uint64        // reply: unix time in nanoseconds at which the probe was received
+	Hops     []message.Hop // reply: the forwarders of the probe
+}
+
+// TraceHop is a node on the path of a trace probe or of its reply
+type TraceHop struct {
+	Address hexutil.Bytes   `json:"address"`          // overlay address of the node
+	Signer  *common.Address `json:"signer,omitempty"` // address of the key which signed the hop, nil if not signed or invalid
+	Time    time.Time       `json:"time"`             // time at which the node forwarded or received the message
+	Latency time.Duration   `json:"latency"`          // time since the previous node, subject to the clock differences of the nodes
+}
+
+// Trace is the route of a trace probe to its recipient and of the reply back to the sender
+type Trace struct {
+	Target hexutil.Bytes `json:"target"` // address of the node which replied to the probe
+	Path   []TraceHop    `json:"path"`   // the forwarders of the probe, followed by the target
+	Return []TraceHop    `json:"return"` // the forwarders of the reply, followed by the sender
+	RTT    time.Duration `json:"rtt"`    // time between sending the probe and receiving the reply
+}
+
+// traceReply is a received reply to a trace probe
+type traceReply struct {
+	msg      *traceMsg
+	hops     []message.Hop
+	digest   message.Digest
+	received time.Time
+}
+
+// traces are the trace probes waiting for their replies by id
+type traces struct {
+	mu      sync.Mutex
+	pending map[string]chan *traceReply
+}
+
+func newTraces() *traces {
+	return &traces{
+		pending: make(map[string]chan *traceReply),
+	}
+}
+
+// Trace sends a trace probe to the address and returns the route of the probe and of the reply of its recipient
+// Each forwarder on the route appends a signed hop record to the probe and to the reply
+// If the context has no deadline, the reply is awaited for 30 seconds
+func (p *Pss) Trace(ctx context.Context, to PssAddress) (*Trace, error) {
+	if err := validateAddress(to); err != nil {
+		return nil, err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultTraceTimeout)
+		defer cancel()
+	}
+	id := make([]byte, traceIDSize)
+	crand.Read(id)
+	probe, err := p.newTraceMsg(ctx, to, &traceMsg{ID: id, From: p.BaseAddr()})
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make(chan *traceReply, 1)
+	key := hexutil.Encode(id)
+	p.traces.mu.Lock()
+	p.traces.pending[key] = replies
+	p.traces.mu.Unlock()
+	defer func() {
+		p.traces.mu.Lock()
+		delete(p.traces.pending, key)
+		p.traces.mu.Unlock()
+	}()
+
+	metrics.GetOrRegisterCounter("pss/trace/probe", nil).Inc(1)
+	sent := time.Now()
+	p.sendTrace(probe)
+	select {
+	case reply := <-replies:
+		return reply.trace(sent, probe.Digest(), p.BaseAddr()), nil
+	case <-ctx.Done():
+		metrics.GetOrRegisterCounter("pss/trace/timeout", nil).Inc(1)
+		return nil, ctx.Err()
+	}
+}
+
+// newTraceMsg returns a traced raw message with the payload on the trace topic
+func (p *Pss) newTraceMsg(ctx context.Context, to PssAddress, tm *traceMsg) (*message.Message, error) {
+	payload, err := rlp.EncodeToBytes(tm)
+	if err != nil {
+		return nil, err
+	}
+	msg := message.New(message.Flags{Raw: true, Trace: true})
+	msg.To = to
+	msg.Expire = uint32(time.Now().Add(p.msgTTL).Unix())
+	msg.Topic = traceTopic
+	msg.Payload = payload
+	if err := p.stamp(ctx, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// addHop appends the hop of the node to a traced message it forwards
+func (p *Pss) addHop(msg *message.Message) {
+	added, err := msg.AddHop(p.BaseAddr(), p.privateKey)
+	if err != nil {
+		log.Warn("pss failed to add hop to traced message", "err", err)
+		return
+	}
+	if added {
+		metrics.GetOrRegisterCounter("pss/trace/hop", nil).Inc(1)
+	}
+}
+
+// handleTrace replies to a trace probe or passes a reply to the probe waiting for it
+func (p *Pss) handleTrace(msg *message.Message) error {
+	var tm traceMsg
+	if err := rlp.DecodeBytes(msg.Payload, &tm); err != nil {
+		return err
+	}
+	if !tm.Reply {
+		reply, err := p.newTraceMsg(context.Background(), tm.From, &traceMsg{
+			ID:       tm.ID,
+			Reply:    true,
+			From:     p.BaseAddr(),
+			Received: uint64(time.Now().UnixNano()),
+			Hops:     msg.Hops,
+		})
+		if err != nil {
+			return err
+		}
+		log.Debug("pss trace probe received", "from", label(tm.From), "hops", len(msg.Hops))
+		p.sendTrace(reply)
+		return nil
+	}
+
+	p.traces.mu.Lock()
+	replies, ok := p.traces.pending[hexutil.Encode(tm.ID)]
+	p.traces.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	select {
+	case replies <- &traceReply{msg: &tm, hops: msg.Hops, digest: msg.Digest(), received: time.Now()}:
+	default:
+	}
+	return nil
+}
+
+// trace returns the route of the probe sent at the given time with the digest
+func (r *traceReply) trace(sent time.Time, digest message.Digest, self []byte) *Trace {
+	t := &Trace{
+		Target: r.msg.From,
+		RTT:    r.received.Sub(sent),
+	}
+	var last time.Time
+	t.Path, last = traceHops(r.msg.Hops, digest, sent)
+	received := time.Unix(0, int64(r.msg.Received))
+	t.Path = append(t.Path, TraceHop{Address: r.msg.From, Time: received, Latency: received.Sub(last)})
+	t.Return, last = traceHops(r.hops, r.digest, received)
+	t.Return = append(t.Return, TraceHop{Address: self, Time: r.received, Latency: r.received.Sub(last)})
+	return t
+}
+
+// traceHops returns the nodes of the hops of the message with the digest
+// and the time of the last hop, the time of the previous node is given
+func traceHops(hops []message.Hop, digest message.Digest, last time.Time) ([]TraceHop, time.Time) {
+	nodes := make([]TraceHop, 0, len(hops)+1)
+	for _, hop := range hops {
+		node := TraceHop{
+			Address: hop.Address,
+			Time:    time.Unix(0, int64(hop.Time)),
+		}
+		node.Latency = node.Time.Sub(last)
+		if pubkey, err := hop.Signer(digest); err == nil {
+			signer := crypto.PubkeyToAddress(*pubkey)
+			node.Signer = &signer
+		}
+		nodes = append(nodes, node)
+		last = node.Time
+	}
+	return nodes, last
+}
+
+// sendTrace sends a trace probe or reply, which are not encrypted, to the peers
+func (p *Pss) sendTrace(msg *message.Message) {
+	p.addFwdCache(msg)
+	p.enqueue(msg)
+}
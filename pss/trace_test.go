@@ -0,0 +1,103 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package pss
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethersphere/swarm/pss/message"
+)
+
+// TestTrace tests the route of a trace probe from a sender over a forwarder to a recipient and back
+func TestTrace(t *testing.T) {
+	var nodes []*Pss
+	for i := 0; i < 3; i++ {
+		privkey, err := ethCrypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ps := newTestPss(privkey, nil, nil)
+		defer ps.Stop()
+		nodes = append(nodes, ps)
+	}
+	sender, forwarder, recipient := nodes[0], nodes[1], nodes[2]
+
+	// the messages of the sender and the recipient are forwarded by the forwarder
+	deliver := func(to *Pss, msg *message.Message) error {
+		b, err := rlp.EncodeToBytes(msg)
+		if err != nil {
+			return err
+		}
+		var decoded message.Message
+		if err := rlp.DecodeBytes(b, &decoded); err != nil {
+			return err
+		}
+		return to.handlePssMsg(context.Background(), &decoded)
+	}
+	sender.outbox.SetForward(func(msg *message.Message) error {
+		return deliver(forwarder, msg)
+	})
+	recipient.outbox.SetForward(func(msg *message.Message) error {
+		return deliver(forwarder, msg)
+	})
+	forwarder.outbox.SetForward(func(msg *message.Message) error {
+		if bytes.Equal(msg.To, sender.BaseAddr()) {
+			return deliver(sender, msg)
+		}
+		return deliver(recipient, msg)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	trace, err := sender.Trace(ctx, recipient.BaseAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(trace.Target, recipient.BaseAddr()) {
+		t.Fatalf("expected target %x, got %x", recipient.BaseAddr(), trace.Target)
+	}
+	forwarderSigner := ethCrypto.PubkeyToAddress(*forwarder.PublicKey())
+	for _, path := range [][]TraceHop{trace.Path, trace.Return} {
+		if len(path) != 2 {
+			t.Fatalf("expected path of 2 nodes, got %v", path)
+		}
+		if !bytes.Equal(path[0].Address, forwarder.BaseAddr()) || path[0].Signer == nil || *path[0].Signer != forwarderSigner {
+			t.Fatalf("expected hop of the forwarder, got %v", path[0])
+		}
+	}
+	if !bytes.Equal(trace.Path[1].Address, recipient.BaseAddr()) || !bytes.Equal(trace.Return[1].Address, sender.BaseAddr()) {
+		t.Fatalf("unexpected path %v, return path %v", trace.Path, trace.Return)
+	}
+	if trace.RTT <= 0 {
+		t.Fatalf("expected round trip time, got %v", trace.RTT)
+	}
+
+	// probes to unreachable nodes time out
+	recipient.outbox.SetForward(func(msg *message.Message) error {
+		return nil
+	})
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := sender.Trace(ctx, recipient.BaseAddr()); err != context.DeadlineExceeded {
+		t.Fatalf("expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -109,6 +109,14 @@ func (p *Pusher) Close() {
 	log.Error("timeout closing pusher")
 }
 
+// Backlog returns the number of chunks that were pushed
+// but are not yet recorded as synced
+func (p *Pusher) Backlog() int {
+	p.pushedMu.Lock()
+	defer p.pushedMu.Unlock()
+	return len(p.pushed)
+}
+
 // sync starts a forever loop that pushes chunks to their neighbourhood
 // and receives receipts (statements of custody) for them.
 // chunks that are not acknowledged with a receipt are retried
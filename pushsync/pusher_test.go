@@ -121,6 +121,29 @@ func TestPusher(t *testing.T) {
 
 }
 
+// TestPusherBacklog tests that chunks pushed without receiving a receipt
+// are counted in the backlog of the pusher
+func TestPusherBacklog(t *testing.T) {
+	chunkCnt := 16
+	tagCnt := 4
+
+	// no storer responds with receipts
+	lb := newLoopBack()
+	tags, tagIDs := setupTags(chunkCnt, tagCnt)
+	tp := newTestPushSyncIndex(chunkCnt, tagIDs, tags, &sync.Map{})
+	p := NewPusher(tp, &testPubSub{lb, func([]byte) bool { return false }}, tags)
+	defer p.Close()
+
+	timeout := time.After(10 * time.Second)
+	for p.Backlog() != chunkCnt {
+		select {
+		case <-timeout:
+			t.Fatalf("expected backlog %d, got %d", chunkCnt, p.Backlog())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
 type testPubSub struct {
 	*loopBack
 	isClosestTo func([]byte) bool
@@ -6,6 +6,7 @@ type (
 	HTTPRequestIDKey struct{}
 	requestHostKey   struct{}
 	tagKey           struct{}
+	disconnectKey    struct{}
 )
 
 // SetHost sets the http request host in the context
@@ -35,3 +36,18 @@ func GetTag(ctx context.Context) uint32 {
 	}
 	return 0
 }
+
+// SetDisconnect sets the channel closed when the client of the http request disconnects
+func SetDisconnect(ctx context.Context, disconnect <-chan struct{}) context.Context {
+	return context.WithValue(ctx, disconnectKey{}, disconnect)
+}
+
+// GetDisconnect gets the channel closed when the client of the http request disconnects,
+// nil if it is not known
+func GetDisconnect(ctx context.Context) <-chan struct{} {
+	v, ok := ctx.Value(disconnectKey{}).(<-chan struct{})
+	if ok {
+		return v
+	}
+	return nil
+}
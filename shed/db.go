@@ -33,6 +33,7 @@ import (
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
 )
 
 const (
@@ -59,6 +60,23 @@ func NewDB(path string, metricsPrefix string) (db *DB, err error) {
 	if err != nil {
 		return nil, err
 	}
+	return newDB(ldb, metricsPrefix)
+}
+
+// NewMemDB constructs a new DB which is kept in memory
+// and lost when it is closed.
+// metricsPrefix is used for metrics collection for the given DB.
+func NewMemDB(metricsPrefix string) (db *DB, err error) {
+	ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return newDB(ldb, metricsPrefix)
+}
+
+// newDB initialises the schema of the LevelDB database
+// and starts the metrics collection.
+func newDB(ldb *leveldb.DB, metricsPrefix string) (db *DB, err error) {
 	db = &DB{
 		ldb: ldb,
 	}
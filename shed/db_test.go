@@ -90,6 +90,39 @@ func TestDB_persistence(t *testing.T) {
 	}
 }
 
+// TestNewMemDB constructs a DB in memory and validates
+// that values are stored and the schema is initialized.
+func TestNewMemDB(t *testing.T) {
+	db, err := NewMemDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s, err := db.getSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Fields == nil || s.Indexes == nil {
+		t.Fatal("schema is not initialized")
+	}
+	stringField, err := db.NewStringField("in-memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "memory value"
+	if err := stringField.Put(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := stringField.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got string %q, want %q", got, want)
+	}
+}
+
 // newTestDB is a helper function that constructs a
 // temporary database and returns a cleanup function that must
 // be called to remove the data.
@@ -228,16 +228,14 @@ func (h *Handler) updateCache(request *Request) (*cacheEntry, error) {
 	updateAddr := request.Addr()
 	log.Trace("feed cache update", "topic", request.Topic.Hex(), "updateaddr", updateAddr, "epoch time", request.Epoch.Time, "epoch level", request.Epoch.Level)
 
-	entry := h.get(&request.Feed)
-	if entry == nil {
-		entry = &cacheEntry{}
-		h.set(&request.Feed, entry)
-	}
-
 	// update our rsrcs entry map
-	entry.lastKey = updateAddr
-	entry.Update = request.Update
+	// entries are replaced rather than modified, as they may be read concurrently
+	entry := &cacheEntry{
+		Update:  request.Update,
+		lastKey: updateAddr,
+	}
 	entry.Reader = bytes.NewReader(entry.data)
+	h.set(&request.Feed, entry)
 	return entry, nil
 }
 
@@ -272,11 +270,15 @@ func (h *Handler) Update(ctx context.Context, r *Request) (updateAddr storage.Ad
 
 	// update our feed updates map cache entry if the new update is older than the one we have, if we have it.
 	if feedUpdate != nil && r.Epoch.After(feedUpdate.Epoch) {
-		feedUpdate.Epoch = r.Epoch
-		feedUpdate.data = make([]byte, len(r.data))
-		feedUpdate.lastKey = r.idAddr
-		copy(feedUpdate.data, r.data)
-		feedUpdate.Reader = bytes.NewReader(feedUpdate.data)
+		entry := &cacheEntry{
+			Update:  feedUpdate.Update,
+			lastKey: r.idAddr,
+		}
+		entry.Epoch = r.Epoch
+		entry.data = make([]byte, len(r.data))
+		copy(entry.data, r.data)
+		entry.Reader = bytes.NewReader(entry.data)
+		h.set(&r.Feed, entry)
 	}
 
 	return r.idAddr, nil
@@ -42,6 +42,9 @@ var (
 	// is updated in parallel and one of the updates
 	// takes longer then the configured timeout duration.
 	ErrAddressLockTimeout = errors.New("address lock timeout")
+	// ErrDBClosed is returned when the database is closed
+	// while an upload waits for the push index capacity.
+	ErrDBClosed = errors.New("db closed")
 )
 
 var (
@@ -69,6 +72,16 @@ type DB struct {
 	// push syncing subscriptions triggers
 	pushTriggers   []chan struct{}
 	pushTriggersMu sync.RWMutex
+	// uploads wait for chunks to be push synced when the
+	// push index holds pushCapacity chunks, zero for no limit
+	pushCapacity uint64
+	// number of items in push index, only counted
+	// if pushCapacity is set
+	pushSize   uint64
+	pushSizeMu sync.Mutex
+	// closed and replaced when chunks are removed from
+	// push index to signal the waiting uploads
+	pushSynced chan struct{}
 
 	// pull syncing index
 	pullIndex shed.Index
@@ -146,6 +159,13 @@ type Options struct {
 	// to verify whether that chunk needs to be Set and added to
 	// garbage collection index too
 	PutToGCCheck func([]byte) bool
+	// InMemory keeps the database in memory instead of
+	// the path, for nodes without persistent storage.
+	InMemory bool
+	// PushCapacity is a limit of the number of uploaded chunks
+	// in push index, uploads wait for them to be push synced
+	// when it is reached. Value 0 sets no limit.
+	PushCapacity uint64
 }
 
 // New returns a new DB.  All fields and indexes are initialized
@@ -175,6 +195,8 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 		close:                    make(chan struct{}),
 		collectGarbageWorkerDone: make(chan struct{}),
 		putToGCCheck:             o.PutToGCCheck,
+		pushCapacity:             o.PushCapacity,
+		pushSynced:               make(chan struct{}),
 	}
 	if db.capacity <= 0 {
 		db.capacity = defaultCapacity
@@ -183,7 +205,11 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 		db.updateGCSem = make(chan struct{}, maxParallelUpdateGC)
 	}
 
-	db.shed, err = shed.NewDB(path, o.MetricsPrefix)
+	if o.InMemory {
+		db.shed, err = shed.NewMemDB(o.MetricsPrefix)
+	} else {
+		db.shed, err = shed.NewDB(path, o.MetricsPrefix)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -430,6 +456,14 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 		return nil, err
 	}
 
+	if db.pushCapacity > 0 {
+		count, err := db.pushIndex.Count()
+		if err != nil {
+			return nil, err
+		}
+		db.pushSize = uint64(count)
+	}
+
 	// start garbage collection worker
 	go db.collectGarbageWorker()
 	return db, nil
@@ -81,6 +81,31 @@ func TestDB(t *testing.T) {
 	}
 }
 
+// TestDB_inMemory validates that chunks can be stored
+// and retrieved with a database kept in memory.
+func TestDB_inMemory(t *testing.T) {
+	db, err := New("", make([]byte, 32), &Options{InMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ch := generateTestRandomChunk()
+
+	_, err = db.Put(context.Background(), chunk.ModePutUpload, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.Get(context.Background(), chunk.ModeGetRequest, ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Data(), ch.Data()) {
+		t.Errorf("got data %x, want %x", got.Data(), ch.Data())
+	}
+}
+
 // TestDB_updateGCSem tests maxParallelUpdateGC limit.
 // This test temporary sets the limit to a low number,
 // makes updateGC function execution time longer by
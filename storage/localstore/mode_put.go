@@ -38,6 +38,14 @@ func (db *DB) Put(ctx context.Context, mode chunk.ModePut, chs ...chunk.Chunk) (
 	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
 	defer totalTimeMetric(metricName, time.Now())
 
+	if mode == chunk.ModePutUpload {
+		err = db.waitPushCapacity(ctx)
+		if err != nil {
+			metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
+			return nil, err
+		}
+	}
+
 	exist, err = db.put(mode, chs...)
 	if err != nil {
 		metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
@@ -46,6 +54,53 @@ func (db *DB) Put(ctx context.Context, mode chunk.ModePut, chs ...chunk.Chunk) (
 	return exist, err
 }
 
+// waitPushCapacity blocks while push index holds pushCapacity
+// chunks, until some of them are push synced, the context is
+// done or the database is closed.
+func (db *DB) waitPushCapacity(ctx context.Context) error {
+	if db.pushCapacity == 0 {
+		return nil
+	}
+	for {
+		db.pushSizeMu.Lock()
+		size, synced := db.pushSize, db.pushSynced
+		db.pushSizeMu.Unlock()
+		if size < db.pushCapacity {
+			return nil
+		}
+		metrics.GetOrRegisterCounter("localstore/Put/upload/wait", nil).Inc(1)
+		select {
+		case <-synced:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-db.close:
+			return ErrDBClosed
+		}
+	}
+}
+
+// incPushSize adds the change to the number of items in push index
+// and signals the uploads waiting for the push index capacity
+// if chunks are removed. It must be called after the batch with
+// the changes of push index is written.
+func (db *DB) incPushSize(change int64) {
+	if db.pushCapacity == 0 || change == 0 {
+		return
+	}
+	db.pushSizeMu.Lock()
+	defer db.pushSizeMu.Unlock()
+
+	if change < 0 && uint64(-change) > db.pushSize {
+		db.pushSize = 0
+	} else {
+		db.pushSize = uint64(int64(db.pushSize) + change)
+	}
+	if change < 0 {
+		close(db.pushSynced)
+		db.pushSynced = make(chan struct{})
+	}
+}
+
 // put stores Chunks to database and updates other indexes. It acquires lockAddr
 // to protect two calls of this function for the same address in parallel. Item
 // fields Address and Data must not be with their nil values. If chunks with the
@@ -63,6 +118,7 @@ func (db *DB) put(mode chunk.ModePut, chs ...chunk.Chunk) (exist []bool, err err
 	// variables that provide information for operations
 	// to be done after write batch function successfully executes
 	var gcSizeChange int64                      // number to add or subtract from gcSize
+	var pushSizeChange int64                    // number to add to pushSize
 	var triggerPushFeed bool                    // signal push feed subscriptions to iterate
 	triggerPullFeed := make(map[uint8]struct{}) // signal pull feed subscriptions to iterate
 
@@ -95,11 +151,14 @@ func (db *DB) put(mode chunk.ModePut, chs ...chunk.Chunk) (exist []bool, err err
 				exist[i] = true
 				continue
 			}
-			exists, c, err := db.putUpload(batch, binIDs, chunkToItem(ch))
+			exists, pushed, c, err := db.putUpload(batch, binIDs, chunkToItem(ch))
 			if err != nil {
 				return nil, err
 			}
 			exist[i] = exists
+			if pushed {
+				pushSizeChange++
+			}
 			if !exists {
 				// chunk is new so, trigger subscription feeds
 				// after the batch is successfully written
@@ -145,6 +204,7 @@ func (db *DB) put(mode chunk.ModePut, chs ...chunk.Chunk) (exist []bool, err err
 	if err != nil {
 		return nil, err
 	}
+	db.incPushSize(pushSizeChange)
 
 	for po := range triggerPullFeed {
 		db.triggerPullSubscriptions(po)
@@ -197,26 +257,27 @@ func (db *DB) putRequest(batch *leveldb.Batch, binIDs map[uint8]uint64, item she
 //  - put to indexes: retrieve, push, pull
 // The batch can be written to the database.
 // Provided batch and binID map are updated.
-func (db *DB) putUpload(batch *leveldb.Batch, binIDs map[uint8]uint64, item shed.Item) (exists bool, gcSizeChange int64, err error) {
+// Returned pushed is true if the item is added to push index.
+func (db *DB) putUpload(batch *leveldb.Batch, binIDs map[uint8]uint64, item shed.Item) (exists, pushed bool, gcSizeChange int64, err error) {
 	exists, err = db.retrievalDataIndex.Has(item)
 	if err != nil {
-		return false, 0, err
+		return false, false, 0, err
 	}
 	if exists {
 		if db.putToGCCheck(item.Address) {
 			gcSizeChange, err = db.setGC(batch, item)
 			if err != nil {
-				return false, 0, err
+				return false, false, 0, err
 			}
 		}
 
-		return true, 0, nil
+		return true, false, 0, nil
 	}
 	anonymous := false
 	if db.tags != nil && item.Tag != 0 {
 		tag, err := db.tags.Get(item.Tag)
 		if err != nil {
-			return false, 0, err
+			return false, false, 0, err
 		}
 		anonymous = tag.Anonymous
 	}
@@ -224,7 +285,7 @@ func (db *DB) putUpload(batch *leveldb.Batch, binIDs map[uint8]uint64, item shed
 	item.StoreTimestamp = now()
 	item.BinID, err = db.incBinID(binIDs, db.po(item.Address))
 	if err != nil {
-		return false, 0, err
+		return false, false, 0, err
 	}
 	db.retrievalDataIndex.PutInBatch(batch, item)
 	db.pullIndex.PutInBatch(batch, item)
@@ -240,11 +301,11 @@ func (db *DB) putUpload(batch *leveldb.Batch, binIDs map[uint8]uint64, item shed
 		// to sync it
 		gcSizeChange, err = db.setGC(batch, item)
 		if err != nil {
-			return false, 0, err
+			return false, false, 0, err
 		}
 	}
 
-	return false, gcSizeChange, nil
+	return false, !anonymous, gcSizeChange, nil
 }
 
 // putSync adds an Item to the batch by updating required indexes:
@@ -245,6 +245,52 @@ func TestModePutUpload_parallel(t *testing.T) {
 	}
 }
 
+// TestModePutUpload_pushCapacity validates that uploads wait
+// for chunks to be push synced when push index capacity is reached.
+func TestModePutUpload_pushCapacity(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, &Options{PushCapacity: 2})
+	defer cleanupFunc()
+
+	chunks := generateTestRandomChunks(3)
+
+	_, err := db.Put(context.Background(), chunk.ModePutUpload, chunks[:2]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = db.Put(ctx, chunk.ModePutUpload, chunks[2])
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	errC := make(chan error, 1)
+	go func() {
+		_, err := db.Put(context.Background(), chunk.ModePutUpload, chunks[2])
+		errC <- err
+	}()
+
+	err = db.Set(context.Background(), chunk.ModeSetSyncPush, chunks[0].Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errC:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("upload is not done after a chunk is push synced")
+	}
+
+	newItemsCountTest(db.pushIndex, 2)(t)
+	if db.pushSize != 2 {
+		t.Errorf("got push size %v, want %v", db.pushSize, 2)
+	}
+}
+
 // TestModePut_sameChunk puts the same chunk multiple times
 // and validates that all relevant indexes have only one item
 // in them.
@@ -58,6 +58,7 @@ func (db *DB) set(mode chunk.ModeSet, addrs ...chunk.Address) (err error) {
 	// variables that provide information for operations
 	// to be done after write batch function successfully executes
 	var gcSizeChange int64                      // number to add or subtract from gcSize
+	var pushSizeChange int64                    // number to subtract from pushSize
 	triggerPullFeed := make(map[uint8]struct{}) // signal pull feed subscriptions to iterate
 
 	switch mode {
@@ -81,11 +82,12 @@ func (db *DB) set(mode chunk.ModeSet, addrs ...chunk.Address) (err error) {
 
 	case chunk.ModeSetSyncPush, chunk.ModeSetSyncPull:
 		for _, addr := range addrs {
-			c, err := db.setSync(batch, addr, mode)
+			c, p, err := db.setSync(batch, addr, mode)
 			if err != nil {
 				return err
 			}
 			gcSizeChange += c
+			pushSizeChange += p
 		}
 
 	case chunk.ModeSetRemove:
@@ -125,6 +127,7 @@ func (db *DB) set(mode chunk.ModeSet, addrs ...chunk.Address) (err error) {
 	if err != nil {
 		return err
 	}
+	db.incPushSize(pushSizeChange)
 	for po := range triggerPullFeed {
 		db.triggerPullSubscriptions(po)
 	}
@@ -194,7 +197,8 @@ func (db *DB) setAccess(batch *leveldb.Batch, binIDs map[uint8]uint64, addr chun
 //   from push sync index
 // - update to gc index happens given item does not exist in pin index
 // Provided batch is updated.
-func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeSet) (gcSizeChange int64, err error) {
+// Returned pushSizeChange is -1 if the item is removed from push index.
+func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeSet) (gcSizeChange, pushSizeChange int64, err error) {
 	item := addressToItem(addr)
 
 	// need to get access timestamp here as it is not
@@ -209,9 +213,9 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 			// just delete from the push index
 			// if it is there
 			db.pushIndex.DeleteInBatch(batch, item)
-			return 0, nil
+			return 0, 0, nil
 		}
-		return 0, err
+		return 0, 0, err
 	}
 	item.StoreTimestamp = i.StoreTimestamp
 	item.BinID = i.BinID
@@ -231,7 +235,7 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 				log.Error("chunk not found in pull index", "addr", addr)
 				break
 			}
-			return 0, err
+			return 0, 0, err
 		}
 
 		if db.tags != nil && i.Tag != 0 {
@@ -251,7 +255,7 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 
 				err = db.pullIndex.PutInBatch(batch, item)
 				if err != nil {
-					return 0, err
+					return 0, 0, err
 				}
 			}
 		}
@@ -265,7 +269,7 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 				log.Error("chunk not found in push index", "addr", addr)
 				break
 			}
-			return 0, err
+			return 0, 0, err
 		}
 		if db.tags != nil && i.Tag != 0 {
 			t, err := db.tags.Get(i.Tag)
@@ -276,7 +280,7 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 			} else {
 				// setting a chunk for push sync assumes the tag is not anonymous
 				if t.Anonymous {
-					return 0, errors.New("got an anonymous chunk in push sync index")
+					return 0, 0, errors.New("got an anonymous chunk in push sync index")
 				}
 
 				t.Inc(chunk.StateSynced)
@@ -284,6 +288,7 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 		}
 
 		db.pushIndex.DeleteInBatch(batch, item)
+		pushSizeChange = -1
 	}
 
 	i, err = db.retrievalAccessIndex.Get(item)
@@ -295,7 +300,7 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 	case leveldb.ErrNotFound:
 		// the chunk is not accessed before
 	default:
-		return 0, err
+		return 0, 0, err
 	}
 	item.AccessTimestamp = now()
 	db.retrievalAccessIndex.PutInBatch(batch, item)
@@ -303,17 +308,17 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 	// Add in gcIndex only if this chunk is not pinned
 	ok, err := db.pinIndex.Has(item)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 	if !ok {
 		err = db.gcIndex.PutInBatch(batch, item)
 		if err != nil {
-			return 0, err
+			return 0, 0, err
 		}
 		gcSizeChange++
 	}
 
-	return gcSizeChange, nil
+	return gcSizeChange, pushSizeChange, nil
 }
 
 // setRemove removes the chunk by updating indexes:
@@ -583,6 +583,19 @@ func (s *Swap) getContractOwner(ctx context.Context, address common.Address) (co
 	return contr.Issuer(nil)
 }
 
+// ChequebookIssuer returns the owner of the chequebook at address
+// after verifying that it was deployed by the chequebook factory
+// it returns the zero address without error if it was not
+func (s *Swap) ChequebookIssuer(ctx context.Context, address common.Address) (common.Address, error) {
+	if err := s.chequebookFactory.VerifyContract(address); err != nil {
+		if err == contract.ErrNotDeployedByFactory {
+			return common.Address{}, nil
+		}
+		return common.Address{}, err
+	}
+	return s.getContractOwner(ctx, address)
+}
+
 // promptDepositAmount blocks and asks the user how much ERC20 he wants to deposit
 func (s *Swap) promptDepositAmount() (*big.Int, error) {
 	// retrieve available balance
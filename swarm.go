@@ -90,6 +90,7 @@ type Swarm struct {
 	stateStore        *state.DBStore
 	tags              *chunk.Tags
 	accountingMetrics *protocols.AccountingMetrics
+	rateLimiter       *protocols.RateLimiter // bandwidth limits shared by the bzz protocols and pss
 	cleanupFuncs      []func() error
 	pinAPI            *pin.API // API object implements all pinning related commands
 	inspector         *api.Inspector
@@ -112,17 +113,34 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 	self = &Swarm{
 		config:       config,
 		privateKey:   config.ShiftPrivateKey(),
+		rateLimiter:  protocols.NewRateLimiter(config.RateLimits),
 		cleanupFuncs: []func() error{},
 	}
 	log.Debug("Setting up Swarm service components")
 
 	bzzconfig := &network.BzzConfig{
-		NetworkID:    config.NetworkID,
-		Address:      network.NewBzzAddr(common.FromHex(config.BzzKey), []byte(config.Enode.URLv4())),
-		HiveParams:   config.HiveParams,
-		LightNode:    config.LightNodeEnabled,
-		BootnodeMode: config.BootnodeMode,
-		SyncEnabled:  config.SyncEnabled,
+		NetworkID:        config.NetworkID,
+		Address:          network.NewBzzAddr(common.FromHex(config.BzzKey), []byte(config.Enode.URLv4())),
+		HiveParams:       config.HiveParams,
+		LightNode:        config.LightNodeEnabled,
+		BootnodeMode:     config.BootnodeMode,
+		SyncEnabled:      config.SyncEnabled,
+		NetworkAuthority: config.NetworkAuthority,
+		RateLimiter:      self.rateLimiter,
+	}
+
+	// private network mode
+	if config.NetworkAuthority != (common.Address{}) {
+		if config.NetworkCredential == "" {
+			return nil, errors.New("private network requires a network credential")
+		}
+		bzzconfig.Credential, err = network.ParseCredential(config.NetworkCredential)
+		if err != nil {
+			return nil, err
+		}
+		if err := bzzconfig.Credential.Verify(config.NetworkAuthority, config.NetworkID, config.Enode.ID()); err != nil {
+			return nil, fmt.Errorf("invalid network credential: %v", err)
+		}
 	}
 
 	// Swap initialization
@@ -223,12 +241,26 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 		network.NewKadParams(),
 	)
 
-	localStore, err := localstore.New(config.ChunkDbPath, config.BaseKey, &localstore.Options{
+	localStoreOptions := &localstore.Options{
 		MockStore:    mockStore,
 		Capacity:     config.DbCapacity,
 		Tags:         self.tags,
 		PutToGCCheck: to.IsWithinDepth,
-	})
+	}
+	if config.LightNodeEnabled {
+		// light nodes do not store chunks for the network, they only keep
+		// a small cache of the recent chunks and their uploads until synced in memory
+		// uploads wait for push sync once as many chunks as the cache holds are not synced,
+		// and the chunks not yet synced are lost when the node stops
+		localStoreOptions = &localstore.Options{
+			MockStore:    mockStore,
+			Capacity:     uint64(config.CacheCapacity),
+			Tags:         self.tags,
+			InMemory:     true,
+			PushCapacity: uint64(config.CacheCapacity),
+		}
+	}
+	localStore, err := localstore.New(config.ChunkDbPath, config.BaseKey, localStoreOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -250,6 +282,9 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 	}
 
 	syncProvider := stream.NewSyncProvider(self.netStore, to, bzzconfig.Address, syncing, false)
+	if config.SyncReconcile {
+		syncProvider = stream.NewReconcilingSyncProvider(self.netStore, to, bzzconfig.Address, syncing, false, stream.DefaultDigestSize)
+	}
 	self.streamer = stream.New(self.stateStore, bzzconfig.Address, syncProvider)
 
 	// Swarm Hash Merklised Chunking for Arbitrary-length Document/File storage
@@ -265,6 +300,22 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 	if err != nil {
 		return nil, err
 	}
+	self.ps.SetRateLimiter(self.rateLimiter)
+	if config.Pss.Mailbox {
+		pss.SetMailbox(self.ps, pss.NewMailboxParams().WithNonce(common.FromHex(config.BzzKeyNonce)), self.stateStore)
+	}
+	if config.Pss.Ratchet {
+		pss.SetRatchet(self.ps, pss.NewRatchetParams(), self.stateStore)
+	}
+	pss.SetGroupController(self.ps)
+	pss.SetReceipts(self.ps, pss.NewReceiptParams())
+	if self.swap != nil {
+		self.ps.SetPostage(&pss.Postage{
+			Chequebook: self.swap.GetParams().ContractAddress,
+			Key:        self.privateKey,
+			Issuer:     self.swap.ChequebookIssuer,
+		})
+	}
 	if pss.IsActiveHandshake {
 		pss.SetHandshakeController(self.ps, pss.NewHandshakeParams())
 	}
@@ -273,10 +324,16 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 		// expire time for push-sync messages should be lower than regular chat-like messages to avoid network flooding
 		pubsub := pss.NewPubSub(self.ps, 20*time.Second)
 		self.pushSync = pushsync.NewPusher(localStore, pubsub, self.tags)
-		self.storer = pushsync.NewStorer(self.netStore, pubsub)
+		// light nodes push sync their uploads through full peers but do not store chunks
+		if !config.LightNodeEnabled {
+			self.storer = pushsync.NewStorer(self.netStore, pubsub)
+		}
 	}
 
 	self.api = api.NewAPI(self.fileStore, self.dns, self.rns, feedsHandler, self.privateKey, self.tags)
+	if config.PrefetchWorkers > 0 {
+		self.api.Prefetcher = api.NewPrefetcher(config.PrefetchWorkers)
+	}
 
 	if config.EnablePinning {
 		// Instantiate the pinAPI object with the already opened localstore
@@ -367,8 +424,16 @@ func (s *Swarm) Start(srv *p2p.Server) error {
 	s.tracerClose = tracing.Closer
 
 	// update uaddr to correct enode
-	newaddr := s.bzz.UpdateLocalAddr([]byte(srv.Self().URLv4()))
-	log.Info("Updated bzz local addr", "oaddr", fmt.Sprintf("%x", newaddr.OAddr), "uaddr", fmt.Sprintf("%s", newaddr.UAddr))
+	var alts [][]byte
+	for _, hostport := range s.config.Underlays {
+		u, err := network.NewUnderlay(srv.Self().Pubkey(), hostport)
+		if err != nil {
+			return fmt.Errorf("invalid underlay address %q: %v", hostport, err)
+		}
+		alts = append(alts, u)
+	}
+	newaddr := s.bzz.UpdateLocalAddr([]byte(srv.Self().URLv4()), alts...)
+	log.Info("Updated bzz local addr", "oaddr", fmt.Sprintf("%x", newaddr.OAddr), "uaddr", fmt.Sprintf("%s", newaddr.UAddr), "alternatives", len(alts))
 
 	log.Info("Starting bzz service")
 
@@ -390,7 +455,11 @@ func (s *Swarm) Start(srv *p2p.Server) error {
 	// start swarm http proxy server
 	if s.config.Port != "" {
 		addr := net.JoinHostPort(s.config.ListenAddr, s.config.Port)
-		server := httpapi.NewServer(s.api, s.pinAPI, s.config.Cors)
+		health := api.NewHealthChecker(s.bzz.Hive.Kademlia, s.streamer, s.pushSync, s.config.Readiness)
+		server := httpapi.NewServer(s.api, s.pinAPI, health, s.config.Cors)
+		if s.config.PssGateway && s.ps != nil {
+			server.SetPss(s.ps, s.config.PssGatewayRaw)
+		}
 
 		if s.config.Cors != "" {
 			log.Info("Swarm HTTP proxy CORS headers", "allowedOrigins", s.config.Cors)
@@ -556,9 +625,16 @@ func (s *Swarm) APIs() []rpc.API {
 			Service:   protocols.NewAccountingApi(s.accountingMetrics),
 			Public:    false,
 		},
+		{
+			Namespace: "ratelimit",
+			Version:   protocols.RateLimitVersion,
+			Service:   protocols.NewRateLimitApi(s.rateLimiter),
+			Public:    false,
+		},
 	}
 
 	apis = append(apis, s.bzz.APIs()...)
+	apis = append(apis, s.retrieval.APIs()...)
 
 	// this is a workaround disabling syncing altogether from a node but
 	// must be changed when multiple stream implementations are at hand
@@ -33,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethersphere/swarm/api"
 	"github.com/ethersphere/swarm/network"
+	"github.com/ethersphere/swarm/network/stream"
 	"github.com/ethersphere/swarm/sctx"
 	"github.com/ethersphere/swarm/testutil"
 )
@@ -120,6 +121,28 @@ func TestNewSwarm(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "light node",
+			configure: func(config *api.Config) {
+				config.LightNodeEnabled = true
+			},
+			check: func(t *testing.T, s *Swarm, _ *api.Config) {
+				if !network.IsLightNode(s.bzz.Hive.Kademlia.Capabilities) {
+					t.Error("light node capabilities not announced")
+				}
+				for _, p := range s.bzz.Protocols() {
+					if p.Name == stream.Spec.Name {
+						t.Error("light node runs the stream protocol")
+					}
+				}
+				if s.pushSync == nil {
+					t.Error("push sync not initialized")
+				}
+				if s.storer != nil {
+					t.Error("light node stores push synced chunks")
+				}
+			},
+		},
 		{
 			name: "ens",
 			configure: func(config *api.Config) {